@@ -0,0 +1,320 @@
+package framework
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The config keys of explicit paths to the linters used by the analyze-code tool.
+const (
+	configKeyGolangciLintPath = "golangci_lint_path"
+	configKeyESLintPath       = "eslint_path"
+)
+
+// The severities of findings, from the most to the least severe.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// MaxFindings caps the findings the analyze-code tool returns, the most severe first.
+var MaxFindings = 50
+
+// Finding is an issue reported by a linter.
+type Finding struct {
+	Linter   string `json:"linter"`
+	Rule     string `json:"rule,omitempty"`
+	Severity string `json:"severity"`
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Message  string `json:"message"`
+}
+
+// Linter runs a static analysis tool on the project in dir.
+type Linter struct {
+	Name   string
+	Detect func(dir string) bool
+	Run    func(ctx context.Context, dir string) ([]Finding, error)
+}
+
+// Linters are the linters of the analyze-code tool, which runs the ones that detect the project or that the
+// model asks for by name.
+//
+//goland:noinspection GoUnusedGlobalVariable
+var Linters = []Linter{
+	{
+		Name:   "golangci-lint",
+		Detect: func(dir string) bool { return fileExists(dir, "go.mod") },
+		Run:    runGolangciLint,
+	},
+	{
+		Name:   "eslint",
+		Detect: func(dir string) bool { return fileExists(dir, "package.json") },
+		Run:    runESLint,
+	},
+}
+
+// SetGolangciLintPath stores the path of the golangci-lint binary in the config of the running assistant or
+// extension.
+//
+//goland:noinspection GoUnusedExportedFunction
+func SetGolangciLintPath(path string) error {
+	return ConfigSet(configKeyGolangciLintPath, path)
+}
+
+// SetESLintPath stores the path of the eslint binary in the config of the running assistant or extension.
+//
+//goland:noinspection GoUnusedExportedFunction
+func SetESLintPath(path string) error {
+	return ConfigSet(configKeyESLintPath, path)
+}
+
+// runLinter runs a linter, which usually exits with an error when it finds issues, so only a run without
+// any output is an error.
+func runLinter(ctx context.Context, dir, path string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, BuildStepTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := toolchainCommand(ctx, path, args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	LoggerFrom(ctx).Info("running command", "command", cmd)
+	err := cmd.Run()
+	if err != nil && stdout.Len() == 0 {
+		LoggerFrom(ctx).Error("error while running linter", "command", cmd, "stderr", stderr.String(), "error", err.Error())
+		if stderr.Len() > 0 {
+			return nil, fmt.Errorf("%s", stderr.String())
+		}
+		return nil, fmt.Errorf("error while running %s: %w", filepath.Base(path), err)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+func runGolangciLint(ctx context.Context, dir string) ([]Finding, error) {
+	path, err := resolveToolchain(configKeyGolangciLintPath, "golangci-lint", goimportsCandidates())
+	if err != nil {
+		return nil, err
+	}
+
+	// version 2 replaced --out-format with --output.json.path
+	stdout, err := runLinter(ctx, dir, path, "run", "--out-format=json", "./...")
+	if err != nil && strings.Contains(err.Error(), "unknown flag") {
+		stdout, err = runLinter(ctx, dir, path, "run", "--output.json.path=stdout", "--output.text.path=stderr", "./...")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var report struct {
+		Issues []struct {
+			FromLinter string
+			Text       string
+			Severity   string
+			Pos        struct {
+				Filename string
+				Line     int
+				Column   int
+			}
+		}
+	}
+	err = json.Unmarshal(firstJSONLine(stdout), &report)
+	if err != nil {
+		return nil, fmt.Errorf("error while unmarshaling golangci-lint report: %w", err)
+	}
+
+	findings := make([]Finding, 0, len(report.Issues))
+	for _, issue := range report.Issues {
+		severity := strings.ToLower(issue.Severity)
+		if severity == "" {
+			severity = SeverityWarning
+		}
+		findings = append(findings, Finding{
+			Linter:   "golangci-lint",
+			Rule:     issue.FromLinter,
+			Severity: severity,
+			File:     filepath.ToSlash(issue.Pos.Filename),
+			Line:     issue.Pos.Line,
+			Column:   issue.Pos.Column,
+			Message:  issue.Text,
+		})
+	}
+
+	return findings, nil
+}
+
+// firstJSONLine returns the first line of the output that looks like JSON, some linters print more after it.
+func firstJSONLine(output []byte) []byte {
+	for _, line := range bytes.Split(output, []byte("\n")) {
+		if line = bytes.TrimSpace(line); len(line) > 0 && (line[0] == '{' || line[0] == '[') {
+			return line
+		}
+	}
+	return output
+}
+
+func runESLint(ctx context.Context, dir string) ([]Finding, error) {
+	path, err := resolveToolchain(configKeyESLintPath, "eslint", nodeModulesBins(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := runLinter(ctx, dir, path, "--format", "json", ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var report []struct {
+		FilePath string
+		Messages []struct {
+			RuleID   string
+			Severity int
+			Message  string
+			Line     int
+			Column   int
+		}
+	}
+	err = json.Unmarshal(firstJSONLine(stdout), &report)
+	if err != nil {
+		return nil, fmt.Errorf("error while unmarshaling eslint report: %w", err)
+	}
+
+	var findings []Finding
+	for _, file := range report {
+		name := file.FilePath
+		if rel, err := filepath.Rel(dir, name); err == nil {
+			name = rel
+		}
+
+		for _, message := range file.Messages {
+			severity := SeverityWarning
+			if message.Severity == 2 {
+				severity = SeverityError
+			}
+			findings = append(findings, Finding{
+				Linter:   "eslint",
+				Rule:     message.RuleID,
+				Severity: severity,
+				File:     filepath.ToSlash(name),
+				Line:     message.Line,
+				Column:   message.Column,
+				Message:  message.Message,
+			})
+		}
+	}
+
+	return findings, nil
+}
+
+// AnalysisSummary is what the analyze-code tool returns: the findings grouped by severity, capped at
+// MaxFindings, and how many were left out.
+type AnalysisSummary struct {
+	Total    int                  `json:"total"`
+	Omitted  int                  `json:"omitted,omitempty"`
+	Findings map[string][]Finding `json:"findings"`
+	Errors   []string             `json:"errors,omitempty"`
+}
+
+// Analyze runs the linters, the ones that detect the project in dir when names is empty.
+func Analyze(ctx context.Context, dir string, names []string) AnalysisSummary {
+	var findings []Finding
+	var errs []string
+	ran := 0
+	for _, linter := range Linters {
+		if len(names) > 0 && !slices.Contains(names, linter.Name) || len(names) == 0 && !linter.Detect(dir) {
+			continue
+		}
+
+		ran++
+		start := time.Now()
+		found, err := linter.Run(ctx, dir)
+		if err != nil {
+			errs = append(errs, linter.Name+": "+strings.TrimSpace(err.Error()))
+			continue
+		}
+		LoggerFrom(ctx).Debug("linter finished", "linter", linter.Name, "findings", len(found), "elapsed", time.Since(start))
+		findings = append(findings, found...)
+	}
+
+	rank := map[string]int{SeverityError: 0, SeverityWarning: 1, SeverityInfo: 2}
+	severityRank := func(severity string) int {
+		if r, ok := rank[severity]; ok {
+			return r
+		}
+		return len(rank)
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		ri, rj := severityRank(findings[i].Severity), severityRank(findings[j].Severity)
+		if ri != rj {
+			return ri < rj
+		}
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Line < findings[j].Line
+	})
+
+	if ran == 0 {
+		errs = append(errs, "no linter for the project")
+	}
+
+	summary := AnalysisSummary{Total: len(findings), Findings: make(map[string][]Finding), Errors: errs}
+	if MaxFindings > 0 && len(findings) > MaxFindings {
+		summary.Omitted = len(findings) - MaxFindings
+		findings = findings[:MaxFindings]
+	}
+	for _, f := range findings {
+		summary.Findings[f.Severity] = append(summary.Findings[f.Severity], f)
+	}
+
+	return summary
+}
+
+func analyzeCode(safeSrc string) ToolContextFunction {
+	return func(ctx context.Context, payload string) (string, error) {
+		var request struct {
+			WorkingDir string `json:"workingDir"`
+			Linters    string `json:"linters"`
+		}
+		err := json.Unmarshal([]byte(payload), &request)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while unmarshaling payload", "error", err.Error())
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+		}
+
+		workingDir, err := safeDir(safeSrc, request.WorkingDir)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while getting safe working directory", "error", err.Error())
+			return "", fmt.Errorf("error while getting safe working directory: %w", err)
+		}
+
+		names := strings.FieldsFunc(request.Linters, func(r rune) bool { return r == ',' || r == ' ' })
+		summary := Analyze(ctx, workingDir, names)
+		if summary.Total == 0 && len(summary.Errors) > 0 {
+			err = errors.New(strings.Join(summary.Errors, "\n"))
+			LoggerFrom(ctx).Error("error while analyzing code", "error", err.Error())
+			return "", fmt.Errorf("error while analyzing code: %w", err)
+		}
+
+		data, err := marshalJSON(summary)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while marshaling analysis", "error", err.Error())
+			return "", fmt.Errorf("error while marshaling analysis: %w", err)
+		}
+
+		return string(data), nil
+	}
+}
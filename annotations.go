@@ -0,0 +1,57 @@
+package framework
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Source is a document that an output is based on.
+type Source struct {
+	Title string `json:"title,omitempty"`
+	URL   string `json:"url"`
+	// Quote is the passage of the source that supports the output.
+	Quote string `json:"quote,omitempty"`
+}
+
+// Annotations are the sources of an output and how confident the action is in it, for the host to render
+// next to the output.
+type Annotations struct {
+	Sources []Source `json:"sources,omitempty"`
+	// Confidence is a short note, e.g. "high" or "the page was last updated in 2019".
+	Confidence string   `json:"confidence,omitempty"`
+	Notes      []string `json:"notes,omitempty"`
+}
+
+// Cite adds a source.
+func (a *Annotations) Cite(title, url, quote string) {
+	a.Sources = append(a.Sources, Source{Title: title, URL: url, Quote: quote})
+}
+
+// AppendTo returns the output of a tool followed by the numbered sources and the notes, so the model can
+// cite the sources as [1], [2], and so on. Tool outputs are read by the model as is, so they have no
+// annotations of their own.
+func (a Annotations) AppendTo(output string) string {
+	if len(a.Sources) == 0 && a.Confidence == "" && len(a.Notes) == 0 {
+		return output
+	}
+
+	var sb strings.Builder
+	sb.WriteString(output)
+	if len(a.Sources) > 0 {
+		sb.WriteString("\n\nSources:")
+		for i, source := range a.Sources {
+			title := source.Title
+			if title == "" {
+				title = source.URL
+			}
+			sb.WriteString(fmt.Sprintf("\n[%d] %s <%s>", i+1, title, source.URL))
+		}
+	}
+	if a.Confidence != "" {
+		sb.WriteString("\n\nConfidence: " + a.Confidence)
+	}
+	for _, note := range a.Notes {
+		sb.WriteString("\nNote: " + note)
+	}
+	return sb.String()
+}
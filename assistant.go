@@ -1,9 +1,8 @@
 package framework
 
 import (
-	"bufio"
+	"context"
 	_ "embed"
-	"encoding/json"
 	"fmt"
 	"github.com/BurntSushi/toml"
 	"io"
@@ -14,10 +13,6 @@ import (
 	"strings"
 )
 
-var (
-	logger *slog.Logger
-)
-
 const ModelGPT35Turbo string = "gpt-3.5-turbo-1106"
 
 //goland:noinspection GoUnusedConst
@@ -41,31 +36,96 @@ type Tool struct {
 	Arguments         []ToolArguments
 	RequiredArguments []string
 	Function          ToolFunction
+	// ContextFunction is called instead of Function when set.
+	ContextFunction ToolContextFunction
+	// Latency and Cost are the usual tiers of a call, e.g. LatencySlow and CostHigh, so the model can prefer
+	// cheap tools. Estimate optionally estimates a particular call for the __estimate operation.
+	Latency  string
+	Cost     string
+	Estimate EstimateFunction
+	// Budget is the name of the budget the tool records its spend against with RecordSpend. The tool is
+	// blocked once the budget is used up for the month.
+	Budget string
+	// Env is the environment of the commands the tool runs, see EnvPolicy.
+	Env *EnvPolicy
 }
 
 type Assistant struct {
 	description frameworkAssistant
 	tools       map[string]Tool
+	described   []byte // marshaled description, reset whenever the description changes
+
+	// knowledge holds the knowledge files by the sha256 of their content
+	knowledge map[string]AddKnowledgeFileOptions
+	// beforeReturn are the OnBeforeReturn hooks in the order they were added
+	beforeReturn []BeforeReturnFunction
 }
 
+// userDir returns a path under the jarbles home directory, which is ~/.jarbles unless overridden by
+// JARBLES_HOME, or $XDG_DATA_HOME/jarbles when JARBLES_XDG is true.
 func userDir(dir ...string) string {
+	paths := []string{jarblesHome("JARBLES_HOME", "XDG_DATA_HOME", ".local/share")}
+	paths = append(paths, dir...)
+
+	return filepath.Clean(strings.Join(paths, string(filepath.Separator)))
+}
+
+// userStateDir is like userDir for files that can be discarded, such as logs. With the XDG layout
+// it lives under $XDG_STATE_HOME/jarbles, otherwise it is the same as userDir.
+func userStateDir(dir ...string) string {
+	paths := []string{jarblesHome("JARBLES_HOME", "XDG_STATE_HOME", ".local/state")}
+	paths = append(paths, dir...)
+
+	return filepath.Clean(strings.Join(paths, string(filepath.Separator)))
+}
+
+func jarblesHome(overrideEnv, xdgEnv, xdgDefault string) string {
+	if override := os.Getenv(overrideEnv); override != "" {
+		return override
+	}
+
 	currentUser, err := user.Current()
 	if err != nil {
 		panic(fmt.Errorf("error while getting user home directory: %w", err))
 	}
 
-	paths := []string{currentUser.HomeDir, ".jarbles"}
-	paths = append(paths, dir...)
+	if os.Getenv("JARBLES_XDG") == "true" {
+		base := os.Getenv(xdgEnv)
+		if base == "" {
+			base = filepath.Join(currentUser.HomeDir, xdgDefault)
+		}
+		return filepath.Join(base, "jarbles")
+	}
 
-	return filepath.Clean(strings.Join(paths, string(filepath.Separator)))
+	return filepath.Join(currentUser.HomeDir, ".jarbles")
 }
 
 func AssistantsDir() string {
 	return userDir("assistants")
 }
 
+func ExtensionsDir() string {
+	return userDir("extensions")
+}
+
 func LogDir() string {
-	return userDir("log")
+	return profileStateDir("log")
+}
+
+// DataDir returns the private data directory of an assistant or extension, creating it if needed.
+// Anything an assistant persists between calls belongs here rather than in ad-hoc locations.
+func DataDir(id string) (string, error) {
+	dir := profileDir("data", slugify(id))
+	err := os.MkdirAll(dir, privateDirPerm)
+	if err != nil {
+		return "", fmt.Errorf("error while creating data directory: %s: %w", dir, err)
+	}
+
+	return dir, nil
+}
+
+func (a *Assistant) DataDir() (string, error) {
+	return DataDir(a.description.StaticID)
 }
 
 type NewAssistantOptions struct {
@@ -76,6 +136,8 @@ type NewAssistantOptions struct {
 
 //goland:noinspection GoUnusedExportedFunction
 func NewAssistant(options NewAssistantOptions) Assistant {
+	setConfigID(options.StaticID)
+
 	return Assistant{
 		description: frameworkAssistant{
 			StaticID:    options.StaticID,
@@ -90,13 +152,61 @@ func NewAssistant(options NewAssistantOptions) Assistant {
 }
 
 func NewAssistantFromTOML(data []byte) (Assistant, error) {
+	return NewAssistantFromTOMLWithOptions(data, NewAssistantFromTOMLOptions{})
+}
+
+type NewAssistantFromTOMLOptions struct {
+	// ShellAllowlist holds the names or absolute paths of the binaries that shell handlers are allowed to run.
+	// A handler whose command has a path separator must match an entry exactly.
+	ShellAllowlist []string
+}
+
+// NewAssistantFromTOMLWithOptions creates an assistant from a TOML definition. Tools can reference a
+// handler defined in the same file, either a starlark script or an allowlisted command:
+//
+//	[[tools]]
+//	type = "function"
+//	handler = "greet"
+//	function = { name = "greet", description = "greets someone" }
+//
+//	[[handlers]]
+//	name = "greet"
+//	type = "starlark"
+//	source = 'result = "hello " + json.decode(payload)["name"]'
+func NewAssistantFromTOMLWithOptions(data []byte, options NewAssistantFromTOMLOptions) (Assistant, error) {
 	var fa frameworkAssistant
 	err := toml.Unmarshal(data, &fa)
 	if err != nil {
 		return Assistant{}, fmt.Errorf("error while unmarshaling toml: %w", err)
 	}
 
-	return Assistant{description: fa}, nil
+	setConfigID(fa.StaticID)
+	for i, s := range fa.Settings {
+		fa.Settings[i] = declareSetting(s)
+	}
+
+	a := Assistant{description: fa}
+	for _, t := range fa.Tools {
+		if t.Handler == "" || t.Function == nil {
+			continue
+		}
+
+		function, err := scriptHandlerFunction(fa.Handlers, t.Handler, options.ShellAllowlist)
+		if err != nil {
+			return Assistant{}, fmt.Errorf("error while creating handler for tool %s: %w", t.Function.Name, err)
+		}
+
+		if a.tools == nil {
+			a.tools = make(map[string]Tool)
+		}
+		a.tools[t.Function.Name] = Tool{
+			Name:            t.Function.Name,
+			Description:     t.Function.Description,
+			ContextFunction: function,
+		}
+	}
+
+	return a, nil
 }
 
 func (a *Assistant) String() string {
@@ -105,26 +215,33 @@ func (a *Assistant) String() string {
 
 func (a *Assistant) Model(v string) {
 	a.description.Model = v
+	a.described = nil
 }
 
 func (a *Assistant) Placeholder(v string) {
 	a.description.Placeholder = v
+	a.described = nil
 }
 
 func (a *Assistant) AddInstructions(v string) {
 	a.description.Instructions = v
+	a.described = nil
 }
 
 type AddQuicklinkOptions struct {
 	Title   string
 	Content string
+	// Icon is the name of an icon of lib, see lib.IconNames.
+	Icon string
 }
 
 func (a *Assistant) AddQuicklink(options AddQuicklinkOptions) {
 	a.description.Quicklinks = append(a.description.Quicklinks, quicklink{
 		Title:   options.Title,
 		Content: options.Content,
+		Icon:    options.Icon,
 	})
+	a.described = nil
 }
 
 func (a *Assistant) AddTool(v Tool) {
@@ -141,26 +258,44 @@ func (a *Assistant) AddTool(v Tool) {
 		},
 	}
 
-	if v.Arguments != nil {
-		t.Function.Parameters = &functionParameters{
-			Type:       "object",
-			Required:   v.RequiredArguments,
-			Properties: make(map[string]functionProperty),
-		}
-		for _, argument := range v.Arguments {
-			t.Function.Parameters.Properties[argument.Name] = functionProperty{
-				Type:        argument.Type,
-				Description: argument.Description,
-				Enum:        argument.Enum,
-			}
+	t.Function.Parameters = argumentsSchema(v.Arguments, v.RequiredArguments)
+
+	a.description.Tools = append(a.description.Tools, t)
+
+	// the costs are kept out of the tools, which the host passes on to the model as is
+	metadata := costMetadata{Latency: v.Latency, Cost: v.Cost, Estimable: v.Estimate != nil}
+	if !metadata.empty() {
+		if a.description.Costs == nil {
+			a.description.Costs = make(map[string]costMetadata)
 		}
+		a.description.Costs[v.Name] = metadata
 	}
+	a.described = nil
+}
 
-	a.description.Tools = append(a.description.Tools, t)
+// argumentsSchema returns the JSON schema of the arguments, or nil when there are none.
+func argumentsSchema(arguments []ToolArguments, required []string) *functionParameters {
+	if arguments == nil {
+		return nil
+	}
+
+	parameters := &functionParameters{
+		Type:       "object",
+		Required:   required,
+		Properties: make(map[string]functionProperty),
+	}
+	for _, argument := range arguments {
+		parameters.Properties[argument.Name] = functionProperty{
+			Type:        argument.Type,
+			Description: argument.Description,
+			Enum:        argument.Enum,
+		}
+	}
+	return parameters
 }
 
 func (a *Assistant) Respond() {
-	fmt.Printf(a.execute(os.Stdin))
+	fmt.Print(a.execute(os.Stdin))
 }
 
 func (a *Assistant) Test(r io.Reader) string {
@@ -168,78 +303,124 @@ func (a *Assistant) Test(r io.Reader) string {
 }
 
 func (a *Assistant) execute(r io.Reader) string {
-	var err error
-	logger, err = NewLibLogger(a, "assistants.log")
+	l, err := NewLibLogger(a, "assistants.log")
 	if err != nil {
 		return fmt.Sprintf("error while creating logger: %s", err.Error())
 	}
-	defer func(l *slog.Logger) {
-		h, ok := logger.Handler().(LibLogger)
+	ctx := withRequest(context.Background(), l)
+	defer func(rl *slog.Logger) {
+		if logger.CompareAndSwap(rl, nopLogger) {
+			slog.SetDefault(defaultLogger)
+		}
+		h, ok := l.Handler().(*LibLogger)
 		if ok {
 			_ = h.Close()
 		}
-	}(logger)
-
-	slog.SetDefault(logger)
-
-	scanner := bufio.NewScanner(r)
-
-	// grab the route name
-	scanner.Scan()
-	name := scanner.Text()
+	}(LoggerFrom(ctx))
 
-	// skip payload delimiter
-	scanner.Scan()
+	logger.Store(LoggerFrom(ctx))
+	slog.SetDefault(LoggerFrom(ctx))
+	setConfigID(a.description.StaticID)
 
-	// read the json payload
-	var lines []string
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
-	}
-
-	if scanner.Err() != nil {
-		return fmt.Sprintf("error while scanning: %s", scanner.Err())
+	request, err := ParseRequest(r)
+	if err != nil {
+		LoggerFrom(ctx).Error("parse request", "error", err.Error())
+		return fmt.Sprintf("error while parsing request: %s", err)
 	}
+	defer useRequestProfile(request)()
 
-	// add newlines back
-	payload := strings.Join(lines, "\n")
+	ctx, cancel := withRequestMeta(ctx, request)
+	defer cancel()
+	defer flushUsage(ctx)
+	ctx = withProgress(ctx, RequestIDFrom(ctx), request.Operation)
+	defer clearProgress(RequestIDFrom(ctx))
 
 	// route the request and output the response
-	output, err := a.route(name, payload)
+	output, err := routeSafely(ctx, a.description.StaticID, request, a.route)
 	if err != nil {
-		logger.Error("route response", "error", err.Error())
+		LoggerFrom(ctx).Error("route response", "error", err.Error())
 		return err.Error()
 	}
 
-	logger.Debug("route response", "output", output)
-	return output
+	LoggerFrom(ctx).Debug("route response", "output", output)
+	return compressOutput(request, output)
 }
 
 func (a *Assistant) Payload(tool, data string) io.Reader {
 	return strings.NewReader(tool + "\n\n" + data)
 }
 
-func (a *Assistant) route(name, payload string) (string, error) {
+func (a *Assistant) route(ctx context.Context, name, payload string) (string, error) {
 	switch name {
 	case "describe":
+		LoggerFrom(ctx).Debug("describe called")
+		err := handshake(payload)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while saving user profile", "error", err.Error())
+		}
+		if Flag("lint", false) {
+			for _, warning := range a.Lint() {
+				LoggerFrom(ctx).Warn("lint", "warning", warning.String())
+			}
+		}
 		return a.describe()
+	case "__flags":
+		return flagsOperation(payload)
+	case "__settings":
+		return settingsOperation(payload)
+	case "__config-get":
+		return configGetOperation()
+	case "__config-set":
+		return configSetOperation(payload)
+	case "__progress":
+		return progressOperation(payload)
+	case "__crashes":
+		return crashesOperation(a.description.StaticID, payload)
+	case "__handshake":
+		return handshakeOperation(payload)
+	case "__knowledge":
+		return a.knowledgeOperation(payload)
+	case "__estimate":
+		return estimateOperation(payload, func(name string) (string, string, EstimateFunction, bool) {
+			tool, ok := a.tools[name]
+			return tool.Latency, tool.Cost, tool.Estimate, ok
+		})
 	default:
-		for _, tool := range a.tools {
-			if tool.Name == name {
-				logger.Info("calling tool", "name", name)
-				logger.Debug("calling tool", "payload", payload)
-				return tool.Function(payload)
-			}
+		tool, ok := a.tools[name]
+		if !ok {
+			return "", fmt.Errorf("unknown route: %s", name)
+		}
+		err := checkBudget(tool.Budget)
+		if err != nil {
+			LoggerFrom(ctx).Warn("tool blocked", "name", name, "error", err.Error())
+			return "", err
 		}
-		return "", fmt.Errorf("unknown route: %s", name)
+		LoggerFrom(ctx).Info("calling tool", "name", name)
+		LoggerFrom(ctx).Debug("calling tool", "payload", payload)
+		var output string
+		if tool.ContextFunction != nil {
+			output, err = tool.ContextFunction(withEnvPolicy(ctx, tool.Env), payload)
+		} else {
+			output, err = tool.Function(payload)
+		}
+		recordUsage(name, err)
+		if err != nil {
+			LoggerFrom(ctx).Warn("tool failed", "name", name, "error", err.Error())
+			return output, modelErrorText(err)
+		}
+		return a.guardOutput(ctx, name, output)
 	}
 }
 
 func (a *Assistant) describe() (string, error) {
-	logger.Debug("describe called")
-	data, err := json.Marshal(a.description)
-	if err != nil {
-		return "", fmt.Errorf("error while marshaling json: %w", err)
+	if a.described == nil {
+		description := a.description
+		description.Instructions = withToolHints(description.Instructions, description.ToolHints)
+		data, err := marshalJSON(description)
+		if err != nil {
+			return "", fmt.Errorf("error while marshaling json: %w", err)
+		}
+		a.described = data
 	}
-	return string(data), nil
+	return string(a.described), nil
 }
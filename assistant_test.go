@@ -0,0 +1,58 @@
+package framework
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func benchmarkAssistant(b *testing.B) Assistant {
+	b.Helper()
+	b.Setenv("JARBLES_HOME", b.TempDir())
+
+	a := NewAssistant(NewAssistantOptions{StaticID: "benchmark-assistant", Name: "Benchmark", Description: "an assistant with many tools"})
+	a.AddInstructions("Answer questions about the weather.")
+	for i := 0; i < 50; i++ {
+		a.AddTool(Tool{
+			Name:        fmt.Sprintf("tool-%d", i),
+			Description: "returns its payload",
+			Arguments: []ToolArguments{
+				{Name: "city", Type: "string", Description: "the name of a city"},
+				{Name: "units", Type: "string", Description: "the units", Enum: []string{"metric", "imperial"}},
+			},
+			RequiredArguments: []string{"city"},
+			Function: func(payload string) (string, error) {
+				return payload, nil
+			},
+		})
+	}
+	return a
+}
+
+func BenchmarkDescribe(b *testing.B) {
+	a := benchmarkAssistant(b)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := a.route(ctx, "describe", "")
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRoute(b *testing.B) {
+	a := benchmarkAssistant(b)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := a.route(ctx, "tool-49", `{"city":"Paris"}`)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,435 @@
+package framework
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// RenameSymbol renames the identifier in the go module in dir, e.g. Walk or Ignore.Match, together with its
+// references and the first word of its doc comment. It returns the new content of the changed files by their
+// absolute path without writing them, and an error when the module has new type errors after the rename, e.g.
+// because the new name is taken.
+func RenameSymbol(ctx context.Context, dir, name, newName string) (map[string][]byte, error) {
+	if !token.IsIdentifier(newName) {
+		return nil, fmt.Errorf("%s isn't a valid identifier", newName)
+	}
+
+	results, pkgs, err := lookupSymbol(ctx, dir, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(results.Definitions) == 0 {
+		return nil, fmt.Errorf("no definition of %s found", name)
+	}
+	if results.Truncated {
+		return nil, fmt.Errorf("%s has too many references to rename", name)
+	}
+
+	// the identifiers to replace, by file, with the line of the definitions to rename their doc comments
+	type location struct {
+		line, column int
+		definition   bool
+	}
+	byFile := make(map[string][]location)
+	for _, l := range results.Definitions {
+		byFile[l.File] = append(byFile[l.File], location{l.Line, l.Column, true})
+	}
+	for _, l := range results.References {
+		byFile[l.File] = append(byFile[l.File], location{l.Line, l.Column, false})
+	}
+
+	oldName := results.Definitions[0].Name
+	changed := make(map[string][]byte)
+	for file, locations := range byFile {
+		filename := file
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(dir, filepath.FromSlash(file))
+		}
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading file at %s: %w", filename, err)
+		}
+
+		lines := bytes.SplitAfter(src, []byte("\n"))
+		// positions are bytes, replaced from the last so that the earlier ones stay valid
+		sort.Slice(locations, func(i, j int) bool {
+			if locations[i].line != locations[j].line {
+				return locations[i].line > locations[j].line
+			}
+			return locations[i].column > locations[j].column
+		})
+		for _, l := range locations {
+			line := lines[l.line-1]
+			start := l.column - 1
+			if !bytes.HasPrefix(line[start:], []byte(oldName)) {
+				return nil, fmt.Errorf("error while renaming %s: %s:%d:%d has changed", name, file, l.line, l.column)
+			}
+			lines[l.line-1] = slices.Concat(line[:start], []byte(newName), line[start+len(oldName):])
+			if l.definition {
+				renameDocComment(lines, l.line-1, oldName, newName)
+			}
+		}
+
+		edited, err := format.Source(bytes.Join(lines, nil))
+		if err != nil {
+			return nil, fmt.Errorf("error while formatting %s: %w", file, err)
+		}
+		changed[filename] = edited
+	}
+
+	err = verifyGoEdits(ctx, dir, pkgs, changed, "./...")
+	if err != nil {
+		return nil, err
+	}
+
+	return changed, nil
+}
+
+// renameDocComment renames the first word of the comment block above the line, when it is the old name.
+func renameDocComment(lines [][]byte, line int, oldName, newName string) {
+	first := -1
+	for i := line - 1; i >= 0 && bytes.HasPrefix(bytes.TrimSpace(lines[i]), []byte("//")); i-- {
+		first = i
+	}
+	if first < 0 {
+		return
+	}
+
+	prefix := []byte("// " + oldName)
+	comment := lines[first]
+	trimmed := bytes.TrimLeft(comment, " \t")
+	indent := comment[:len(comment)-len(trimmed)]
+	if !bytes.HasPrefix(trimmed, prefix) {
+		return
+	}
+	rest := trimmed[len(prefix):]
+	if len(rest) > 0 && !bytes.ContainsAny(rest[:1], " \r\n.,") {
+		return
+	}
+	lines[first] = slices.Concat(indent, []byte("// "+newName), rest)
+}
+
+// AddStructField adds the field, e.g. Timeout time.Duration `json:"timeout"`, at the end of the struct type
+// declared in the go source.
+func AddStructField(src []byte, typeName, field string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("error while parsing source: %w", err)
+	}
+
+	// the field is parsed on its own first, so that a broken field doesn't end up in the file
+	fields, err := parseFields(field)
+	if err != nil {
+		return nil, err
+	}
+
+	var st *ast.StructType
+	ast.Inspect(f, func(n ast.Node) bool {
+		if spec, ok := n.(*ast.TypeSpec); ok && spec.Name.Name == typeName {
+			st, _ = spec.Type.(*ast.StructType)
+		}
+		return st == nil
+	})
+	if st == nil {
+		return nil, fmt.Errorf("no struct type %s found", typeName)
+	}
+
+	existing := make(map[string]bool)
+	for _, f := range st.Fields.List {
+		for _, n := range f.Names {
+			existing[n.Name] = true
+		}
+	}
+	for _, f := range fields {
+		for _, n := range f.Names {
+			if existing[n.Name] {
+				return nil, fmt.Errorf("%s already has a field %s", typeName, n.Name)
+			}
+		}
+	}
+
+	// on the line of the closing brace when it is on its own, e.g. not in struct{}
+	offset := fset.Position(st.Fields.Closing).Offset
+	lineStart := bytes.LastIndexByte(src[:offset], '\n') + 1
+	if len(bytes.TrimSpace(src[lineStart:offset])) == 0 {
+		return formatInsert(src, lineStart, strings.TrimSpace(field)+"\n")
+	}
+	return formatInsert(src, offset, "\n"+strings.TrimSpace(field)+"\n")
+}
+
+func parseFields(field string) ([]*ast.Field, error) {
+	src := "package p\n\ntype _ struct {\n" + field + "\n}\n"
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("error while parsing field: %w", err)
+	}
+	fields := f.Decls[0].(*ast.GenDecl).Specs[0].(*ast.TypeSpec).Type.(*ast.StructType).Fields.List
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no field in %q", field)
+	}
+	return fields, nil
+}
+
+// InsertFunc inserts the functions or methods of code into the go source, after the declaration named after,
+// e.g. Walk or Ignore.Match, or at the end when after is empty.
+func InsertFunc(src []byte, code, after string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("error while parsing source: %w", err)
+	}
+
+	funcs, err := parser.ParseFile(token.NewFileSet(), "", "package p\n\n"+code, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("error while parsing code: %w", err)
+	}
+	if len(funcs.Decls) == 0 {
+		return nil, fmt.Errorf("no function in code")
+	}
+
+	declared := make(map[string]bool)
+	for _, decl := range f.Decls {
+		for _, name := range declNames(decl) {
+			declared[name] = true
+		}
+	}
+	for _, decl := range funcs.Decls {
+		if _, ok := decl.(*ast.FuncDecl); !ok {
+			return nil, fmt.Errorf("code has declarations that aren't functions")
+		}
+		if name := declNames(decl)[0]; declared[name] {
+			return nil, fmt.Errorf("%s is already declared", name)
+		}
+	}
+
+	offset := len(src)
+	if after != "" {
+		var decl ast.Decl
+		for _, d := range f.Decls {
+			for _, name := range declNames(d) {
+				if name == after {
+					decl = d
+				}
+			}
+		}
+		if decl == nil {
+			return nil, fmt.Errorf("no declaration %s found", after)
+		}
+		// after the line the declaration ends on, to keep a trailing comment with it
+		offset = fset.Position(decl.End()).Offset
+		if i := bytes.IndexByte(src[offset:], '\n'); i >= 0 {
+			offset += i + 1
+		} else {
+			offset = len(src)
+		}
+	}
+
+	return formatInsert(src, offset, "\n"+strings.TrimSpace(code)+"\n\n")
+}
+
+// declNames returns the names of a declaration, methods with their receiver type, e.g. Ignore.Match.
+func declNames(decl ast.Decl) []string {
+	var names []string
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Recv != nil && len(d.Recv.List) > 0 {
+			return []string{receiverName(d.Recv.List[0].Type) + "." + d.Name.Name}
+		}
+		return []string{d.Name.Name}
+	case *ast.GenDecl:
+		for _, spec := range d.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				names = append(names, s.Name.Name)
+			case *ast.ValueSpec:
+				for _, n := range s.Names {
+					names = append(names, n.Name)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// formatInsert inserts text into the go source at offset and formats the result.
+func formatInsert(src []byte, offset int, text string) ([]byte, error) {
+	edited := slices.Concat(src[:offset], []byte(text), src[offset:])
+	formatted, err := format.Source(edited)
+	if err != nil {
+		return nil, fmt.Errorf("error while formatting edited source: %w", err)
+	}
+	return formatted, nil
+}
+
+// verifyGoEdits type checks the packages of patterns in dir with the changed files, and returns the type errors
+// that the packages before the change, when given, didn't have.
+func verifyGoEdits(ctx context.Context, dir string, before []*packages.Package, changed map[string][]byte, patterns ...string) error {
+	var err error
+	if before == nil {
+		before, err = loadGoPackages(ctx, dir, nil, patterns...)
+		if err != nil {
+			return err
+		}
+	}
+	after, err := loadGoPackages(ctx, dir, changed, patterns...)
+	if err != nil {
+		return err
+	}
+
+	// the positions move with the edit, so the errors are compared by their message
+	known := make(map[string]bool)
+	packages.Visit(before, nil, func(pkg *packages.Package) {
+		for _, e := range pkg.Errors {
+			known[e.Msg] = true
+		}
+	})
+
+	var lines []string
+	seen := make(map[string]bool)
+	for _, pkg := range after {
+		for _, e := range pkg.Errors {
+			line := e.Pos + ": " + e.Msg
+			if e.Pos == "" {
+				line = e.Msg
+			}
+			if !known[e.Msg] && !seen[line] {
+				seen[line] = true
+				lines = append(lines, line)
+			}
+		}
+	}
+	if len(lines) > 0 {
+		return buildError(fmt.Errorf("%s", strings.Join(lines, "\n")), dir)
+	}
+
+	return nil
+}
+
+func editGo(safeSrc string) ToolContextFunction {
+	return func(ctx context.Context, payload string) (string, error) {
+		var request struct {
+			WorkingDir string `json:"workingDir"`
+			File       string `json:"file"`
+			Op         string `json:"op"`
+			Name       string `json:"name"`
+			NewName    string `json:"newName"`
+			Code       string `json:"code"`
+			After      string `json:"after"`
+			Check      bool   `json:"check"`
+		}
+		err := json.Unmarshal([]byte(payload), &request)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while unmarshaling payload", "error", err.Error())
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+		}
+
+		workingDir, err := safeDir(safeSrc, request.WorkingDir)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while getting safe working directory", "error", err.Error())
+			return "", fmt.Errorf("error while getting safe working directory: %w", err)
+		}
+
+		var changed map[string][]byte
+		switch request.Op {
+		case "rename":
+			changed, err = RenameSymbol(ctx, workingDir, request.Name, request.NewName)
+		case "add-field", "insert-func":
+			changed, err = editGoFile(ctx, workingDir, request.File, func(src []byte) ([]byte, error) {
+				if request.Op == "add-field" {
+					return AddStructField(src, request.Name, request.Code)
+				}
+				return InsertFunc(src, request.Code, request.After)
+			})
+		default:
+			err = fmt.Errorf("unknown op %q, must be rename, add-field, or insert-func", request.Op)
+		}
+		if err != nil {
+			LoggerFrom(ctx).Error("error while editing go code", "op", request.Op, "error", err.Error())
+			return "", buildFailure("editing go code", err)
+		}
+
+		files := make([]string, 0, len(changed))
+		for filename := range changed {
+			files = append(files, filename)
+		}
+		sort.Strings(files)
+
+		var diff strings.Builder
+		for _, filename := range files {
+			src, err := os.ReadFile(filename)
+			if err != nil {
+				LoggerFrom(ctx).Error("error while reading file", "filename", filename, "error", err.Error())
+				return "", fmt.Errorf("error while reading file at %s: %w", filename, err)
+			}
+			name := filename
+			if rel, err := filepath.Rel(workingDir, filename); err == nil {
+				name = filepath.ToSlash(rel)
+			}
+			diff.WriteString(UnifiedDiff(name, name, string(src), string(changed[filename])))
+		}
+		if diff.Len() == 0 {
+			return "nothing to change", nil
+		}
+
+		if !request.Check {
+			for _, filename := range files {
+				info, err := os.Stat(filename)
+				if err != nil {
+					LoggerFrom(ctx).Error("error while reading file", "filename", filename, "error", err.Error())
+					return "", fmt.Errorf("error while reading file at %s: %w", filename, err)
+				}
+				err = os.WriteFile(filename, changed[filename], info.Mode().Perm())
+				if err != nil {
+					LoggerFrom(ctx).Error("error while writing file", "filename", filename, "error", err.Error())
+					return "", fmt.Errorf("error while writing file at %s: %s", filename, err)
+				}
+			}
+		}
+
+		return diff.String(), nil
+	}
+}
+
+// editGoFile edits a go file within the working directory and verifies that its package still type checks.
+func editGoFile(ctx context.Context, workingDir, name string, edit func([]byte) ([]byte, error)) (map[string][]byte, error) {
+	filename, err := safePath(workingDir, "", name)
+	if err != nil {
+		return nil, fmt.Errorf("error while getting safe path: %w", err)
+	}
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading file at %s: %w", filename, err)
+	}
+
+	edited, err := edit(src)
+	if err != nil {
+		return nil, err
+	}
+
+	pkgDir, err := filepath.Rel(workingDir, filepath.Dir(filename))
+	if err != nil {
+		return nil, fmt.Errorf("error while getting package directory: %w", err)
+	}
+
+	changed := map[string][]byte{filename: edited}
+	err = verifyGoEdits(ctx, workingDir, nil, changed, "./"+filepath.ToSlash(pkgDir))
+	if err != nil {
+		return nil, err
+	}
+
+	return changed, nil
+}
@@ -0,0 +1,232 @@
+package framework
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	backupMagic      = "JARBLESBAK1"
+	backupSaltSize   = 16
+	backupIterations = 200_000
+)
+
+// backupPrefixes are the storage prefixes included in a backup: assistant data (config, state, notes)
+// and keys, which hold the secrets of the profile.
+var backupPrefixes = []string{"data", "keys"}
+
+// Backup writes an encrypted archive of the data and keys of the active profile to dest.
+// The archive is compressed with gzip and encrypted with AES-256-GCM using a key derived from the passphrase.
+func Backup(dest, passphrase string) error {
+	if passphrase == "" {
+		return fmt.Errorf("a passphrase is required to create a backup")
+	}
+
+	storage := CurrentStorage()
+
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+
+	root := storageKey()
+	for _, prefix := range backupPrefixes {
+		keys, err := storage.List(storageKey(prefix))
+		if err != nil {
+			return fmt.Errorf("error while listing %s: %w", prefix, err)
+		}
+
+		for _, key := range keys {
+			data, err := storage.Read(key)
+			if err != nil {
+				return fmt.Errorf("error while reading %s: %w", key, err)
+			}
+
+			err = tw.WriteHeader(&tar.Header{
+				Name:    strings.TrimPrefix(strings.TrimPrefix(key, root), "/"),
+				Mode:    privateFilePerm,
+				Size:    int64(len(data)),
+				ModTime: time.Now(),
+			})
+			if err != nil {
+				return fmt.Errorf("error while writing archive header for %s: %w", key, err)
+			}
+
+			_, err = tw.Write(data)
+			if err != nil {
+				return fmt.Errorf("error while writing %s to archive: %w", key, err)
+			}
+		}
+	}
+
+	err := tw.Close()
+	if err != nil {
+		return fmt.Errorf("error while closing archive: %w", err)
+	}
+	err = gz.Close()
+	if err != nil {
+		return fmt.Errorf("error while compressing archive: %w", err)
+	}
+
+	salt := make([]byte, backupSaltSize)
+	_, err = rand.Read(salt)
+	if err != nil {
+		return fmt.Errorf("error while generating salt: %w", err)
+	}
+
+	aead, err := backupCipher(passphrase, salt)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return fmt.Errorf("error while generating nonce: %w", err)
+	}
+
+	var out bytes.Buffer
+	out.WriteString(backupMagic)
+	out.Write(salt)
+	out.Write(nonce)
+	out.Write(aead.Seal(nil, nonce, archive.Bytes(), []byte(backupMagic)))
+
+	err = os.WriteFile(dest, out.Bytes(), privateFilePerm)
+	if err != nil {
+		return fmt.Errorf("error while writing backup at %s: %w", dest, err)
+	}
+
+	return nil
+}
+
+// Restore writes the documents from a backup created with Backup into the active profile,
+// overwriting documents with the same key.
+func Restore(src, passphrase string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("error while reading backup at %s: %w", src, err)
+	}
+
+	if !bytes.HasPrefix(data, []byte(backupMagic)) || len(data) < len(backupMagic)+backupSaltSize {
+		return fmt.Errorf("not a jarbles backup: %s", src)
+	}
+	data = data[len(backupMagic):]
+
+	salt := data[:backupSaltSize]
+	aead, err := backupCipher(passphrase, salt)
+	if err != nil {
+		return err
+	}
+
+	data = data[backupSaltSize:]
+	if len(data) < aead.NonceSize() {
+		return fmt.Errorf("backup is truncated: %s", src)
+	}
+
+	archive, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(backupMagic))
+	if err != nil {
+		return fmt.Errorf("error while decrypting backup, the passphrase may be wrong: %w", err)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return fmt.Errorf("error while decompressing backup: %w", err)
+	}
+
+	storage := CurrentStorage()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error while reading backup archive: %w", err)
+		}
+
+		name := path.Clean("/" + header.Name)[1:]
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("error while reading %s from backup: %w", name, err)
+		}
+
+		err = storage.Write(storageKey(name), content)
+		if err != nil {
+			return fmt.Errorf("error while restoring %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func backupCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(passphrase), salt, backupIterations, 32, sha256.New))
+	if err != nil {
+		return nil, fmt.Errorf("error while creating cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("error while creating cipher: %w", err)
+	}
+
+	return aead, nil
+}
+
+func backupTool(safeDir string, restore bool) ToolContextFunction {
+	return func(ctx context.Context, payload string) (string, error) {
+		var request struct {
+			Name string `json:"name"`
+		}
+		err := json.Unmarshal([]byte(payload), &request)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while unmarshaling payload", "error", err.Error())
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+		}
+
+		passphrase := os.Getenv("JARBLES_BACKUP_PASSPHRASE")
+		if passphrase == "" {
+			LoggerFrom(ctx).Error("missing env variable: JARBLES_BACKUP_PASSPHRASE")
+			return "", fmt.Errorf("backups are not configured: JARBLES_BACKUP_PASSPHRASE is not set")
+		}
+
+		filename, err := safePath(safeDir, "", request.Name)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while getting safe path", "error", err.Error())
+			return "", fmt.Errorf("error while getting safe path: %w", err)
+		}
+
+		if restore {
+			LoggerFrom(ctx).Info("restoring backup", "filename", filename)
+			err = Restore(filename, passphrase)
+			if err != nil {
+				LoggerFrom(ctx).Error("error while restoring backup", "filename", filename, "error", err.Error())
+				return "", err
+			}
+			return "backup restored successfully", nil
+		}
+
+		LoggerFrom(ctx).Info("creating backup", "filename", filename)
+		err = Backup(filename, passphrase)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while creating backup", "filename", filename, "error", err.Error())
+			return "", err
+		}
+		return "backup created successfully", nil
+	}
+}
@@ -0,0 +1,103 @@
+package framework
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func backupFixture(t *testing.T) (string, string) {
+	t.Helper()
+	t.Setenv("JARBLES_HOME", t.TempDir())
+
+	key := storageKey("data", "backup-test", "config.json")
+	err := CurrentStorage().Write(key, []byte(`{"api-key":"secret"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "backup.jbak")
+	err = Backup(dest, "correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dest, key
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	dest, key := backupFixture(t)
+
+	err := CurrentStorage().Delete(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Restore(dest, "correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := CurrentStorage().Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"api-key":"secret"}` {
+		t.Fatalf("restored %q", data)
+	}
+}
+
+func TestRestoreWrongPassphrase(t *testing.T) {
+	dest, key := backupFixture(t)
+	_ = CurrentStorage().Delete(key)
+
+	err := Restore(dest, "wrong")
+	if err == nil {
+		t.Fatal("backup is restored with the wrong passphrase")
+	}
+	if _, err := CurrentStorage().Read(key); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("document is restored with the wrong passphrase: %v", err)
+	}
+}
+
+func TestRestoreTampered(t *testing.T) {
+	dest, _ := backupFixture(t)
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, offset := range map[string]int{
+		"salt":       len(backupMagic),
+		"ciphertext": len(data) - 20,
+		"tag":        len(data) - 1,
+	} {
+		t.Run(name, func(t *testing.T) {
+			tampered := append([]byte(nil), data...)
+			tampered[offset] ^= 1
+			filename := filepath.Join(t.TempDir(), "tampered.jbak")
+			err := os.WriteFile(filename, tampered, 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = Restore(filename, "correct horse battery staple")
+			if err == nil {
+				t.Fatal("tampered backup is restored")
+			}
+		})
+	}
+}
+
+func TestRestoreNotABackup(t *testing.T) {
+	t.Setenv("JARBLES_HOME", t.TempDir())
+	filename := filepath.Join(t.TempDir(), "notes.txt")
+	err := os.WriteFile(filename, []byte("just some notes"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Restore(filename, "correct horse battery staple")
+	if err == nil {
+		t.Fatal("a file that isn't a backup is restored")
+	}
+}
@@ -0,0 +1,267 @@
+package framework
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobsDir is where blobs are stored, named by the sha256 hash of their content.
+func BlobsDir() string {
+	return profileDir("blobs")
+}
+
+type blobRecord struct {
+	Refs    int       `json:"refs"`
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+	// Released is when the last reference was released, GC only removes blobs released a while ago.
+	Released time.Time `json:"released"`
+}
+
+// PutBlob stores the content of r and returns its hash, which references it from responses instead of the
+// content itself. Storing the same content again adds a reference, see ReleaseBlob.
+func PutBlob(r io.Reader) (string, error) {
+	err := os.MkdirAll(BlobsDir(), privateDirPerm)
+	if err != nil {
+		LogError("error while creating blobs directory", "error", err.Error())
+		return "", fmt.Errorf("error while creating blobs directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(BlobsDir(), ".put-*")
+	if err != nil {
+		LogError("error while creating blob", "error", err.Error())
+		return "", fmt.Errorf("error while creating blob: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		_ = tmp.Close()
+	}
+	if err != nil {
+		LogError("error while writing blob", "error", err.Error())
+		return "", fmt.Errorf("error while writing blob: %w", err)
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	err = updateBlobIndex(func(index map[string]blobRecord) error {
+		record, ok := index[hash]
+		if !ok {
+			record = blobRecord{Size: size, Created: time.Now()}
+		}
+		if _, err := os.Stat(blobFilename(hash)); err != nil {
+			err = os.MkdirAll(filepath.Dir(blobFilename(hash)), privateDirPerm)
+			if err == nil {
+				err = os.Rename(tmp.Name(), blobFilename(hash))
+			}
+			if err != nil {
+				return fmt.Errorf("error while storing blob: %w", err)
+			}
+		}
+		record.Refs++
+		record.Released = time.Time{}
+		index[hash] = record
+		return nil
+	})
+	if err != nil {
+		LogError("error while putting blob", "hash", hash, "error", err.Error())
+		return "", err
+	}
+
+	LogDebug("blob stored", "hash", hash, "size", size)
+	return hash, nil
+}
+
+// GetBlob opens the blob with the hash. The caller closes it.
+//
+//goland:noinspection GoUnusedExportedFunction
+func GetBlob(hash string) (io.ReadCloser, error) {
+	if !validBlobHash(hash) {
+		return nil, fmt.Errorf("%w: %s", ErrBlobNotFound, hash)
+	}
+	f, err := os.Open(blobFilename(hash))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrBlobNotFound, hash)
+	}
+	if err != nil {
+		LogError("error while opening blob", "hash", hash, "error", err.Error())
+		return nil, fmt.Errorf("error while opening blob %s: %w", hash, err)
+	}
+	return f, nil
+}
+
+// ReleaseBlob removes a reference to the blob. Blobs without references are removed by GCBlobs.
+//
+//goland:noinspection GoUnusedExportedFunction
+func ReleaseBlob(hash string) error {
+	err := updateBlobIndex(func(index map[string]blobRecord) error {
+		record, ok := index[hash]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrBlobNotFound, hash)
+		}
+		record.Refs = max(0, record.Refs-1)
+		if record.Refs == 0 {
+			record.Released = time.Now()
+		}
+		index[hash] = record
+		return nil
+	})
+	if err != nil {
+		LogError("error while releasing blob", "hash", hash, "error", err.Error())
+		return err
+	}
+	return nil
+}
+
+// GCBlobs removes the blobs that were released more than grace ago and returns how many it removed. The
+// grace period keeps blobs that a response still links to for a while.
+//
+//goland:noinspection GoUnusedExportedFunction
+func GCBlobs(grace time.Duration) (int, error) {
+	removed := 0
+	err := updateBlobIndex(func(index map[string]blobRecord) error {
+		for hash, record := range index {
+			if record.Refs > 0 || time.Since(record.Released) < grace {
+				continue
+			}
+			err := os.Remove(blobFilename(hash))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("error while removing blob %s: %w", hash, err)
+			}
+			delete(index, hash)
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		LogError("error while collecting blobs", "error", err.Error())
+		return removed, err
+	}
+
+	LogInfo("blobs collected", "removed", removed)
+	return removed, nil
+}
+
+type AddBlobActionOptions struct {
+	// ID of the action. Defaults to "blob".
+	ID string
+	// MaxSize is the largest blob the action returns. Defaults to 32 MiB.
+	MaxSize int64
+}
+
+// AddBlobAction adds an action that returns a blob as an attachment, so responses can link to large
+// artifacts by hash instead of inlining them. The payload is {"hash": "...", "filename": "...",
+// "content_type": "..."}, only the hash is required.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (e *Extension) AddBlobAction(options AddBlobActionOptions) {
+	if options.ID == "" {
+		options.ID = "blob"
+	}
+	if options.MaxSize == 0 {
+		options.MaxSize = 32 << 20
+	}
+
+	e.AddAction(AddActionOptions{
+		ID: options.ID,
+		ContextFunction: func(ctx context.Context, payload string) (*ExtensionResponse, error) {
+			var request struct {
+				Hash        string `json:"hash"`
+				Filename    string `json:"filename"`
+				ContentType string `json:"content_type"`
+			}
+			err := json.Unmarshal([]byte(payload), &request)
+			if err != nil {
+				LoggerFrom(ctx).Error("error while unmarshaling payload", "error", err.Error())
+				return nil, fmt.Errorf("error while unmarshaling payload: %w", err)
+			}
+
+			blob, err := GetBlob(request.Hash)
+			if err != nil {
+				LoggerFrom(ctx).Error("error while getting blob", "hash", request.Hash, "error", err.Error())
+				return nil, err
+			}
+			defer func() { _ = blob.Close() }()
+
+			data, err := io.ReadAll(io.LimitReader(blob, options.MaxSize+1))
+			if err != nil {
+				LoggerFrom(ctx).Error("error while reading blob", "hash", request.Hash, "error", err.Error())
+				return nil, fmt.Errorf("error while reading blob %s: %w", request.Hash, err)
+			}
+			if int64(len(data)) > options.MaxSize {
+				LoggerFrom(ctx).Error("blob too large", "hash", request.Hash, "max", options.MaxSize)
+				return nil, fmt.Errorf("blob %s is larger than %d bytes", request.Hash, options.MaxSize)
+			}
+
+			if request.Filename == "" {
+				request.Filename = request.Hash
+			}
+			if request.ContentType == "" {
+				request.ContentType = "application/octet-stream"
+			}
+			response := &ExtensionResponse{TextBody: fmt.Sprintf("%s (%d bytes)", request.Filename, len(data))}
+			return response.AddAttachment(request.Filename, request.ContentType, data), nil
+		},
+	})
+}
+
+// updateBlobIndex changes the reference counts under a lock shared by all processes.
+func updateBlobIndex(update func(index map[string]blobRecord) error) error {
+	unlock, err := lockFile(filepath.Join(BlobsDir(), "index.lock"), 10*time.Second, time.Minute)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	filename := filepath.Join(BlobsDir(), "index.json")
+	index := make(map[string]blobRecord)
+	data, err := os.ReadFile(filename)
+	if err == nil {
+		err = json.Unmarshal(data, &index)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error while reading blob index: %w", err)
+	}
+
+	err = update(index)
+	if err != nil {
+		return err
+	}
+
+	data, err = json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error while marshaling blob index: %w", err)
+	}
+	err = os.WriteFile(filename, data, privateFilePerm)
+	if err != nil {
+		return fmt.Errorf("error while writing blob index: %w", err)
+	}
+	return nil
+}
+
+// blobFilename spreads the blobs over directories named by the first two characters of their hash.
+func blobFilename(hash string) string {
+	return filepath.Join(BlobsDir(), hash[:2], hash)
+}
+
+func validBlobHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil && strings.ToLower(hash) == hash
+}
@@ -0,0 +1,162 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("temporarily unavailable")
+
+type NewCircuitBreakerOptions struct {
+	// Name identifies the dependency, e.g. the host of an API. Breakers with the same name share their state.
+	Name string
+	// FailureThreshold is the number of consecutive failures that opens the circuit. Defaults to 5.
+	FailureThreshold int
+	// Cooldown is how long the circuit stays open before a call is let through again. Defaults to 30 seconds.
+	// Failures older than the cooldown are forgotten.
+	Cooldown time.Duration
+}
+
+// CircuitBreaker stops calling a failing dependency for a while, so that tools fail fast instead of waiting
+// on a timeout every time the model retries. Every request runs in a new process, so the state is kept in a
+// file under ~/.jarbles/cache/breakers.
+type CircuitBreaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+	filename  string
+}
+
+type circuitState struct {
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+	OpenedAt    time.Time `json:"opened_at,omitempty"`
+}
+
+//goland:noinspection GoUnusedExportedFunction
+func NewCircuitBreaker(options NewCircuitBreakerOptions) *CircuitBreaker {
+	if options.FailureThreshold == 0 {
+		options.FailureThreshold = 5
+	}
+	if options.Cooldown == 0 {
+		options.Cooldown = 30 * time.Second
+	}
+
+	return &CircuitBreaker{
+		name:      options.Name,
+		threshold: options.FailureThreshold,
+		cooldown:  options.Cooldown,
+		filename:  filepath.Join(profileDir("cache", "breakers"), slugify(options.Name)+".json"),
+	}
+}
+
+// Do calls fn unless the circuit is open, in which case an error wrapping ErrCircuitOpen is returned right away.
+// Errors of fn count as failures, except for a canceled context and errors that aren't of the dependency: a
+// ToolError, e.g. from ModelError for a bad payload of the model, and an error marked with Permanent.
+func (b *CircuitBreaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	state := b.load(ctx)
+	now := time.Now()
+
+	if !state.OpenedAt.IsZero() {
+		remaining := state.OpenedAt.Add(b.cooldown).Sub(now)
+		if remaining > 0 {
+			LoggerFrom(ctx).Warn("circuit is open", "name", b.name, "remaining", remaining.String())
+			return fmt.Errorf("%s is %w, try again in %s", b.name, ErrCircuitOpen, max(remaining.Round(time.Second), time.Second))
+		}
+		// half open: this call decides whether the circuit closes or opens again
+	}
+
+	err := fn(ctx)
+	if err != nil && !dependencyFailure(err) {
+		return err
+	}
+
+	if err == nil {
+		if state.Failures > 0 || !state.OpenedAt.IsZero() {
+			LoggerFrom(ctx).Info("circuit closed", "name", b.name)
+			b.save(ctx, circuitState{})
+		}
+		return nil
+	}
+
+	if now.Sub(state.LastFailure) > b.cooldown {
+		state.Failures = 0
+	}
+	state.Failures++
+	state.LastFailure = now
+	if !state.OpenedAt.IsZero() || state.Failures >= b.threshold {
+		LoggerFrom(ctx).Warn("circuit opened", "name", b.name, "failures", state.Failures)
+		state.OpenedAt = now
+	}
+	b.save(ctx, state)
+
+	return err
+}
+
+// dependencyFailure reports whether an error of fn counts against the dependency.
+func dependencyFailure(err error) bool {
+	var toolErr *ToolError
+	var permanent permanentError
+	return !errors.Is(err, context.Canceled) && !errors.As(err, &toolErr) && !errors.As(err, &permanent)
+}
+
+func (b *CircuitBreaker) load(ctx context.Context) circuitState {
+	var state circuitState
+	data, err := os.ReadFile(b.filename)
+	if err != nil {
+		return state
+	}
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		LoggerFrom(ctx).Warn("ignoring unreadable circuit state", "name", b.name, "error", err.Error())
+		return circuitState{}
+	}
+	return state
+}
+
+// save writes the state. A breaker that can't persist its state only loses its memory, so errors are logged.
+// The state is renamed into place, so a concurrent load never reads half of it.
+func (b *CircuitBreaker) save(ctx context.Context, state circuitState) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		LoggerFrom(ctx).Error("error while marshaling circuit state", "name", b.name, "error", err.Error())
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(b.filename), privateDirPerm)
+	if err == nil {
+		err = writeFileAtomic(b.filename, data)
+	}
+	if err != nil {
+		LoggerFrom(ctx).Error("error while writing circuit state", "name", b.name, "error", err.Error())
+	}
+}
+
+// WithCircuitBreaker returns a copy of the tool whose calls go through the breaker.
+//
+//goland:noinspection GoUnusedExportedFunction
+func WithCircuitBreaker(t Tool, b *CircuitBreaker) Tool {
+	function, contextFunction := t.Function, t.ContextFunction
+
+	t.Function = nil
+	t.ContextFunction = func(ctx context.Context, payload string) (string, error) {
+		var output string
+		err := b.Do(ctx, func(ctx context.Context) error {
+			var err error
+			if contextFunction != nil {
+				output, err = contextFunction(ctx, payload)
+			} else {
+				output, err = function(payload)
+			}
+			return err
+		})
+		return output, err
+	}
+
+	return t
+}
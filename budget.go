@@ -0,0 +1,272 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spcoder/jarbles-framework/lib"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// budgetConfigPrefix is the prefix of the config keys with the monthly caps, e.g. budgets.openai = "20 USD"
+// or budgets.tokens = "500000".
+const budgetConfigPrefix = "budgets."
+
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+var budgetsMu sync.Mutex
+
+// BudgetStatus is the spend of a budget in the current month.
+type BudgetStatus struct {
+	Name  string  `json:"name"`
+	Month string  `json:"month"`
+	Spent float64 `json:"spent"`
+	// Cap is the monthly cap from the config, zero when there's none.
+	Cap  float64 `json:"cap,omitempty"`
+	Unit string  `json:"unit,omitempty"`
+}
+
+// Exceeded reports whether the spend reached the cap.
+func (s BudgetStatus) Exceeded() bool {
+	return s.Cap > 0 && s.Spent >= s.Cap
+}
+
+type budgetLedger struct {
+	Month string  `json:"month"`
+	Spent float64 `json:"spent"`
+	Unit  string  `json:"unit,omitempty"`
+}
+
+// RecordSpend adds the amount, e.g. tokens, API credits, or currency, to the spend of the budget in the
+// current month. Tools and actions that name the budget are blocked once the spend reaches the cap in the
+// config under budgets.<name>.
+//
+//goland:noinspection GoUnusedExportedFunction
+func RecordSpend(ctx context.Context, budget string, amount float64, unit string) error {
+	budgetsMu.Lock()
+	defer budgetsMu.Unlock()
+
+	ledgers, err := loadBudgets()
+	if err != nil {
+		return err
+	}
+
+	name := slugify(budget)
+	month := budgetMonth(time.Now())
+	ledger := ledgers[name]
+	if ledger.Month != month {
+		ledger = budgetLedger{Month: month, Unit: ledger.Unit}
+	}
+	if unit != "" {
+		if ledger.Unit != "" && ledger.Unit != unit && ledger.Spent > 0 {
+			return fmt.Errorf("budget %s is in %s, not %s", name, ledger.Unit, unit)
+		}
+		ledger.Unit = unit
+	}
+	ledger.Spent += amount
+	ledgers[name] = ledger
+
+	LoggerFrom(ctx).Debug("recorded spend", "budget", name, "amount", amount, "unit", unit, "spent", ledger.Spent)
+	return saveBudgets(ledgers)
+}
+
+// Budgets returns the spend of the budgets with a cap or a spend in the current month, by name.
+func Budgets() ([]BudgetStatus, error) {
+	budgetsMu.Lock()
+	ledgers, err := loadBudgets()
+	budgetsMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := configLoad()
+	if err != nil {
+		return nil, err
+	}
+	for key := range config {
+		name, ok := strings.CutPrefix(key, budgetConfigPrefix)
+		if ok {
+			if _, ok := ledgers[name]; !ok {
+				ledgers[name] = budgetLedger{}
+			}
+		}
+	}
+
+	statuses := make([]BudgetStatus, 0, len(ledgers))
+	for name := range ledgers {
+		statuses = append(statuses, budgetStatus(name, ledgers[name], config[budgetConfigPrefix+name]))
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses, nil
+}
+
+type AddBudgetsCardOptions struct {
+	ID      string
+	Title   string
+	Refresh time.Duration
+	Height  string
+}
+
+// AddBudgetsCard adds a card that shows the spend of the budgets this month against their caps, and the
+// action that renders it.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (e *Extension) AddBudgetsCard(options AddBudgetsCardOptions) {
+	if options.Title == "" {
+		options.Title = "Budgets"
+	}
+	if options.Refresh == 0 {
+		options.Refresh = time.Minute
+	}
+
+	e.AddAction(AddActionOptions{
+		ID: options.ID,
+		Function: func(payload string) (*ExtensionResponse, error) {
+			budgets, err := Budgets()
+			if err != nil {
+				LogError("error while listing budgets", "error", err.Error())
+				return nil, err
+			}
+
+			rows := make([]lib.BudgetRow, 0, len(budgets))
+			for _, budget := range budgets {
+				rows = append(rows, lib.BudgetRow{Name: budget.Name, Spent: budget.Spent, Cap: budget.Cap, Unit: budget.Unit})
+			}
+
+			return &ExtensionResponse{
+				HTMLTitle: options.Title,
+				HTMLBody: lib.Budgets(lib.BudgetsOptions{
+					Title:   options.Title,
+					Month:   budgetMonth(time.Now()),
+					Budgets: rows,
+					Refresh: options.Refresh,
+				}),
+				NoLayout: true,
+			}, nil
+		},
+	})
+
+	e.AddCardCustom(ExtensionCard{
+		ID: options.ID,
+		HTML: lib.CardEmbed(lib.CardEmbedOptions{
+			ExtensionName: e.Name,
+			Title:         options.Title,
+			Href:          e.ActionUrl(slugify(options.ID)),
+			Height:        options.Height,
+		}),
+	})
+}
+
+// checkBudget returns an error wrapping ErrBudgetExceeded when the budget is used up for this month.
+func checkBudget(budget string) error {
+	if budget == "" {
+		return nil
+	}
+
+	name := slugify(budget)
+	capValue, ok := ConfigGet(budgetConfigPrefix + name)
+	if !ok {
+		return nil
+	}
+
+	budgetsMu.Lock()
+	ledgers, err := loadBudgets()
+	budgetsMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	status := budgetStatus(name, ledgers[name], capValue)
+	if !status.Exceeded() {
+		return nil
+	}
+
+	spent := strconv.FormatFloat(status.Spent, 'f', -1, 64)
+	limit := strings.TrimSpace(strconv.FormatFloat(status.Cap, 'f', -1, 64) + " " + status.Unit)
+	now := time.Now().In(TimeZone())
+	resets := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location()).Format("January")
+	return fmt.Errorf("%w: the monthly %s budget is used up, %s of %s spent, it resets on %s 1",
+		ErrBudgetExceeded, name, spent, limit, resets)
+}
+
+func budgetStatus(name string, ledger budgetLedger, capValue string) BudgetStatus {
+	month := budgetMonth(time.Now())
+	status := BudgetStatus{Name: name, Month: month, Unit: ledger.Unit}
+	if ledger.Month == month {
+		status.Spent = ledger.Spent
+	}
+
+	// the cap is a number with an optional unit, which takes precedence over the unit of the spend
+	fields := strings.Fields(capValue)
+	if len(fields) > 0 {
+		status.Cap, _ = strconv.ParseFloat(fields[0], 64)
+	}
+	if len(fields) > 1 {
+		status.Unit = fields[1]
+	}
+	return status
+}
+
+// budgetMonth returns the month that spend at t counts against, in the default time zone.
+func budgetMonth(t time.Time) string {
+	return t.In(TimeZone()).Format("2006-01")
+}
+
+func budgetsKey() (string, error) {
+	configMu.RLock()
+	defer configMu.RUnlock()
+
+	if configID == "" {
+		return "", fmt.Errorf("budgets are not available before an assistant or extension is created")
+	}
+
+	return storageKey("data", configID, "budgets.json"), nil
+}
+
+func loadBudgets() (map[string]budgetLedger, error) {
+	key, err := budgetsKey()
+	if err != nil {
+		return nil, err
+	}
+
+	ledgers := make(map[string]budgetLedger)
+	data, err := CurrentStorage().Read(key)
+	if errors.Is(err, os.ErrNotExist) {
+		return ledgers, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while reading budgets: %w", err)
+	}
+
+	err = json.Unmarshal(data, &ledgers)
+	if err != nil {
+		return nil, fmt.Errorf("error while unmarshaling budgets: %w", err)
+	}
+	return ledgers, nil
+}
+
+func saveBudgets(ledgers map[string]budgetLedger) error {
+	key, err := budgetsKey()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(ledgers, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error while marshaling budgets: %w", err)
+	}
+
+	err = CurrentStorage().Write(key, data)
+	if err != nil {
+		return fmt.Errorf("error while writing budgets: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// BuildStepTimeout limits each step of the node, python, and rust builders, e.g. installing dependencies.
+var BuildStepTimeout = 5 * time.Minute
+
+// ErrNoBuilder is returned when no builder detects the project.
+var ErrNoBuilder = errors.New("no builder for project")
+
+// BuildRequest is what the build tool asks a Builder to build. OutputDir and OutputName are where the binary
+// goes for builders that produce one, and are empty when the model doesn't ask for one.
+type BuildRequest struct {
+	WorkingDir string
+	OutputDir  string
+	OutputName string
+}
+
+// Builder builds the projects of one language. The build tool picks the first registered builder that detects
+// the project, so that the same tool works across the projects of a safe directory.
+type Builder interface {
+	Name() string
+	Detect(dir string) bool
+	Build(ctx context.Context, request BuildRequest) error
+}
+
+var (
+	buildersMu sync.RWMutex
+	builders   = []Builder{goBuilder{}, rustBuilder{}, nodeBuilder{}, pythonBuilder{}}
+)
+
+// RegisterBuilder adds a builder, which is tried before the built-in go, rust, node, and python builders.
+// A builder with the name of a registered one replaces it.
+//
+//goland:noinspection GoUnusedExportedFunction
+func RegisterBuilder(b Builder) {
+	buildersMu.Lock()
+	defer buildersMu.Unlock()
+
+	if b == nil {
+		panic("builder is nil")
+	}
+
+	registered := []Builder{b}
+	for _, existing := range builders {
+		if existing.Name() != b.Name() {
+			registered = append(registered, existing)
+		}
+	}
+	builders = registered
+}
+
+// DetectBuilder returns the builder of the project in dir, or the builder with the name when it isn't empty.
+func DetectBuilder(dir, name string) (Builder, error) {
+	buildersMu.RLock()
+	defer buildersMu.RUnlock()
+
+	for _, b := range builders {
+		if name != "" && b.Name() == name || name == "" && b.Detect(dir) {
+			return b, nil
+		}
+	}
+
+	if name != "" {
+		return nil, fmt.Errorf("unknown builder %s: %w", name, ErrNoBuilder)
+	}
+	return nil, fmt.Errorf("error while detecting project at %s: %w", dir, ErrNoBuilder)
+}
+
+func build(safeSrc, safeDest string) ToolContextFunction {
+	return func(ctx context.Context, payload string) (string, error) {
+		var request struct {
+			WorkingDir string `json:"workingDir"`
+			OutputDir  string `json:"outputDir"`
+			OutputName string `json:"outputName"`
+			Builder    string `json:"builder"`
+		}
+		err := json.Unmarshal([]byte(payload), &request)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while unmarshaling payload", "error", err.Error())
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+		}
+
+		workingDir, err := safeDir(safeSrc, request.WorkingDir)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while getting safe working directory", "error", err.Error())
+			return "", fmt.Errorf("error while getting safe working directory: %w", err)
+		}
+
+		var outputDir string
+		if request.OutputName != "" {
+			outputDir, err = safeDir(safeDest, request.OutputDir)
+			if err != nil {
+				LoggerFrom(ctx).Error("error while getting safe output directory", "error", err.Error())
+				return "", fmt.Errorf("error while getting safe output directory: %w", err)
+			}
+		}
+
+		builder, err := DetectBuilder(workingDir, request.Builder)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while detecting builder", "workingDir", workingDir, "error", err.Error())
+			return "", err
+		}
+
+		LoggerFrom(ctx).Debug("build", "builder", builder.Name(), "workingDir", workingDir, "outputDir", outputDir, "outputName", request.OutputName)
+		err = builder.Build(ctx, BuildRequest{WorkingDir: workingDir, OutputDir: outputDir, OutputName: request.OutputName})
+		if err != nil {
+			return "", buildFailure("building with "+builder.Name(), err)
+		}
+
+		return "build with " + builder.Name() + " completed successfully", nil
+	}
+}
+
+// runBuildStep runs a step of a builder in dir, with the EnvPolicy of the tool.
+func runBuildStep(ctx context.Context, dir, name string, args ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, BuildStepTimeout)
+	defer cancel()
+
+	cmd := Command(ctx, name, args...)
+	cmd.Dir = dir
+
+	return runCommand(cmd)
+}
+
+func fileExists(dir, name string) bool {
+	_, err := os.Stat(filepath.Join(dir, name))
+	return err == nil
+}
+
+// goBuilder builds a go module whose entrypoint is main.go, like the compile tool.
+type goBuilder struct{}
+
+func (goBuilder) Name() string { return "go" }
+
+func (goBuilder) Detect(dir string) bool { return fileExists(dir, "go.mod") }
+
+func (goBuilder) Build(ctx context.Context, request BuildRequest) error {
+	err := modTidyCommand(ctx, request.WorkingDir)
+	if err != nil {
+		return fmt.Errorf("error while downloading dependencies: %s", err)
+	}
+
+	err = goimportsCommand(ctx, request.WorkingDir)
+	if err != nil {
+		return err
+	}
+
+	outputDir, outputName := request.OutputDir, request.OutputName
+	if outputName == "" {
+		outputDir, outputName = request.WorkingDir, filepath.Base(request.WorkingDir)
+	}
+	return buildCommand(ctx, request.WorkingDir, outputDir, outputName)
+}
+
+// rustBuilder builds a cargo package in release mode and copies its binary to the output.
+type rustBuilder struct{}
+
+func (rustBuilder) Name() string { return "rust" }
+
+func (rustBuilder) Detect(dir string) bool { return fileExists(dir, "Cargo.toml") }
+
+func (rustBuilder) Build(ctx context.Context, request BuildRequest) error {
+	err := runBuildStep(ctx, request.WorkingDir, "cargo", "build", "--release", "--message-format=short")
+	if err != nil {
+		return buildError(err, request.WorkingDir)
+	}
+	if request.OutputName == "" {
+		return nil
+	}
+
+	var manifest struct {
+		Package struct {
+			Name string `toml:"name"`
+		} `toml:"package"`
+	}
+	_, err = toml.DecodeFile(filepath.Join(request.WorkingDir, "Cargo.toml"), &manifest)
+	if err != nil {
+		return fmt.Errorf("error while reading Cargo.toml: %w", err)
+	}
+
+	binary := filepath.Join(request.WorkingDir, "target", "release", executableName(manifest.Package.Name))
+	return copyFileTo(binary, filepath.Join(request.OutputDir, request.OutputName), 0o755)
+}
+
+// nodeBuilder installs the dependencies of a package with yarn when it has a yarn.lock, or else with npm, and
+// runs its build script when it has one.
+type nodeBuilder struct{}
+
+func (nodeBuilder) Name() string { return "node" }
+
+func (nodeBuilder) Detect(dir string) bool { return fileExists(dir, "package.json") }
+
+func (nodeBuilder) Build(ctx context.Context, request BuildRequest) error {
+	data, err := os.ReadFile(filepath.Join(request.WorkingDir, "package.json"))
+	if err != nil {
+		return fmt.Errorf("error while reading package.json: %w", err)
+	}
+
+	var manifest struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return fmt.Errorf("error while unmarshaling package.json: %w", err)
+	}
+
+	manager, install := "npm", "install"
+	if fileExists(request.WorkingDir, "yarn.lock") {
+		manager = "yarn"
+	} else if fileExists(request.WorkingDir, "package-lock.json") {
+		install = "ci"
+	}
+	if runtime.GOOS == "windows" {
+		manager += ".cmd"
+	}
+
+	err = runBuildStep(ctx, request.WorkingDir, manager, install)
+	if err != nil {
+		return fmt.Errorf("error while installing dependencies: %s", err)
+	}
+
+	if _, ok := manifest.Scripts["build"]; ok {
+		return runBuildStep(ctx, request.WorkingDir, manager, "run", "build")
+	}
+	return nil
+}
+
+// pythonBuilder creates a virtual environment in .venv and installs the requirements, or else the project
+// itself, into it.
+type pythonBuilder struct{}
+
+func (pythonBuilder) Name() string { return "python" }
+
+func (pythonBuilder) Detect(dir string) bool {
+	return fileExists(dir, "pyproject.toml") || fileExists(dir, "requirements.txt") || fileExists(dir, "setup.py")
+}
+
+func (pythonBuilder) Build(ctx context.Context, request BuildRequest) error {
+	python, bin := "python3", "bin"
+	if runtime.GOOS == "windows" {
+		python, bin = "python", "Scripts"
+	}
+
+	err := runBuildStep(ctx, request.WorkingDir, python, "-m", "venv", ".venv")
+	if err != nil {
+		return fmt.Errorf("error while creating virtual environment: %s", err)
+	}
+
+	pip := filepath.Join(request.WorkingDir, ".venv", bin, executableName("pip"))
+	if fileExists(request.WorkingDir, "requirements.txt") {
+		return runBuildStep(ctx, request.WorkingDir, pip, "install", "-r", "requirements.txt")
+	}
+	return runBuildStep(ctx, request.WorkingDir, pip, "install", ".")
+}
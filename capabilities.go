@@ -0,0 +1,139 @@
+package framework
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ProtocolVersion is the version of the jarbles protocol that this framework speaks.
+const ProtocolVersion = 2
+
+// Features that a host can support. Responses are adjusted for hosts that don't support a feature, so new
+// features don't break older hosts.
+const (
+	FeatureHeaders      string = "headers"
+	FeatureContentTypes string = "content_types"
+	FeatureAnnotations  string = "annotations"
+	FeatureParts        string = "parts"
+	FeatureAttachments  string = "attachments"
+	FeatureStreaming    string = "streaming"
+	FeatureSSE          string = "sse"
+)
+
+var frameworkFeatures = []string{
+	FeatureHeaders, FeatureContentTypes, FeatureAnnotations, FeatureParts, FeatureAttachments, FeatureSSE, FeatureGzip, FeatureUploads,
+}
+
+// HostCapabilities is what the host advertised in the __handshake operation.
+type HostCapabilities struct {
+	Protocol int      `json:"protocol"`
+	Features []string `json:"features"`
+}
+
+// CurrentHost returns the capabilities that the host advertised. A host that never did is assumed to speak
+// protocol 1 without any features. JARBLES_HOST_FEATURES, a comma separated list, overrides the features.
+func CurrentHost() HostCapabilities {
+	host := HostCapabilities{Protocol: 1}
+	data, err := CurrentStorage().Read(hostKey())
+	if err == nil {
+		err = json.Unmarshal(data, &host)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		LogWarn("error while loading host capabilities", "error", err.Error())
+	}
+
+	if v, ok := os.LookupEnv("JARBLES_HOST_FEATURES"); ok {
+		host.Features = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	return host
+}
+
+// HostSupports reports whether the host advertised the feature.
+//
+//goland:noinspection GoUnusedExportedFunction
+func HostSupports(feature string) bool {
+	return slices.Contains(CurrentHost().Features, feature)
+}
+
+// handshakeOperation serves the __handshake operation. The capabilities of the host are remembered for the
+// requests that follow, and the protocol version and features of the framework are returned.
+func handshakeOperation(payload string) (string, error) {
+	var host HostCapabilities
+	err := json.Unmarshal([]byte(payload), &host)
+	if err != nil {
+		return "", fmt.Errorf("error while unmarshaling host capabilities: %w", err)
+	}
+
+	data, err := json.MarshalIndent(host, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error while marshaling host capabilities: %w", err)
+	}
+	err = CurrentStorage().Write(hostKey(), data)
+	if err != nil {
+		return "", fmt.Errorf("error while writing host capabilities: %w", err)
+	}
+
+	data, err = marshalJSON(HostCapabilities{Protocol: ProtocolVersion, Features: frameworkFeatures})
+	if err != nil {
+		return "", fmt.Errorf("error while marshaling capabilities: %w", err)
+	}
+	return string(data), nil
+}
+
+// adaptResponse rewrites a response for a host without the features that it uses, falling back to the
+// text body that every host renders.
+func adaptResponse(response *ExtensionResponse, host HostCapabilities) *ExtensionResponse {
+	if response == nil {
+		return nil
+	}
+	supports := func(feature string) bool {
+		return slices.Contains(host.Features, feature)
+	}
+
+	appendText := func(text string) {
+		if response.TextBody != "" && text != "" {
+			response.TextBody += "\n\n"
+		}
+		response.TextBody += text
+	}
+
+	if !supports(FeatureContentTypes) && response.Body != "" {
+		appendText(response.Body)
+		response.Body = ""
+	}
+	if !supports(FeatureContentTypes) {
+		response.ContentType = ""
+	}
+
+	if !supports(FeatureParts) || !supports(FeatureAttachments) {
+		var kept []ResponsePart
+		for _, part := range response.Parts {
+			switch {
+			case part.Kind == PartAttachment && !supports(FeatureAttachments):
+				appendText(fmt.Sprintf("(%s isn't attached, attachments aren't supported)", part.Filename))
+			case !supports(FeatureParts) && part.Kind == PartText:
+				appendText(part.Body)
+			case !supports(FeatureParts):
+				// a card update can't be expressed without parts, the card updates on the next describe
+			default:
+				kept = append(kept, part)
+			}
+		}
+		response.Parts = kept
+	}
+
+	if !supports(FeatureAnnotations) && response.Annotations != nil {
+		response.TextBody = response.Annotations.AppendTo(response.TextBody)
+		response.Annotations = nil
+	}
+
+	return response
+}
+
+func hostKey() string {
+	return storageKey("data", "host.json")
+}
@@ -0,0 +1,193 @@
+package framework
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+type ChunkOptions struct {
+	// Size is the largest chunk in characters. Defaults to 8000, about 2000 tokens.
+	Size int
+	// Overlap is how many characters of the end of a chunk start the next one, so a passage cut in two keeps
+	// some context. Must be less than Size.
+	Overlap int
+}
+
+// chunkSeparators are tried in order, so chunks end at paragraphs, then lines, sentences, and words.
+var chunkSeparators = []string{"\n\n", "\n", ". ", " "}
+
+// Chunk splits text into chunks of at most Size characters, at the largest boundary that fits.
+//
+//goland:noinspection GoUnusedExportedFunction
+func Chunk(text string, options ChunkOptions) []string {
+	if options.Size <= 0 {
+		options.Size = 8000
+	}
+	options.Overlap = min(max(options.Overlap, 0), options.Size/2)
+
+	var chunks []string
+	for _, piece := range splitText(text, options.Size-options.Overlap, 0) {
+		if strings.TrimSpace(piece) == "" {
+			continue
+		}
+		if options.Overlap > 0 && len(chunks) > 0 {
+			piece = lastRunes(chunks[len(chunks)-1], options.Overlap) + piece
+		}
+		chunks = append(chunks, piece)
+	}
+	return chunks
+}
+
+// splitText splits text into pieces of at most size characters with the separators from level on, merging
+// small neighbouring pieces.
+func splitText(text string, size, level int) []string {
+	if utf8.RuneCountInString(text) <= size {
+		return []string{text}
+	}
+	if level == len(chunkSeparators) {
+		// no separator left, cut at the size
+		var pieces []string
+		runes := []rune(text)
+		for len(runes) > 0 {
+			n := min(size, len(runes))
+			pieces = append(pieces, string(runes[:n]))
+			runes = runes[n:]
+		}
+		return pieces
+	}
+
+	separator := chunkSeparators[level]
+	parts := strings.SplitAfter(text, separator)
+
+	var pieces []string
+	var current strings.Builder
+	for _, part := range parts {
+		if utf8.RuneCountInString(part) > size {
+			if current.Len() > 0 {
+				pieces = append(pieces, current.String())
+				current.Reset()
+			}
+			pieces = append(pieces, splitText(part, size, level+1)...)
+			continue
+		}
+		if utf8.RuneCountInString(current.String())+utf8.RuneCountInString(part) > size {
+			pieces = append(pieces, current.String())
+			current.Reset()
+		}
+		current.WriteString(part)
+	}
+	if current.Len() > 0 {
+		pieces = append(pieces, current.String())
+	}
+	return pieces
+}
+
+func lastRunes(s string, n int) string {
+	runes := []rune(s)
+	return string(runes[max(0, len(runes)-n):])
+}
+
+// LLMFunction sends a prompt to a model and returns its answer. The framework doesn't call models itself,
+// the assistant passes the client it uses.
+type LLMFunction func(ctx context.Context, prompt string) (string, error)
+
+type SummarizeOptions struct {
+	// Prompt is sent with each chunk, which follows it. Defaults to a request for a concise summary.
+	Prompt string
+	// CombinePrompt is sent with the summaries of the chunks to combine them. Defaults to Prompt.
+	CombinePrompt string
+	// Workers is how many chunks are summarized at the same time. Defaults to 4.
+	Workers int
+	// Size is the largest input of a prompt in characters. Summaries that don't fit together are combined in
+	// rounds. Defaults to 8000.
+	Size int
+}
+
+var ErrSummaryTooLong = errors.New("summaries don't get shorter")
+
+// SummarizeMapReduce summarizes each chunk with llm, then combines the summaries until one is left. The
+// first error stops the summary.
+//
+//goland:noinspection GoUnusedExportedFunction
+func SummarizeMapReduce(ctx context.Context, chunks []string, llm LLMFunction, options SummarizeOptions) (string, error) {
+	if options.Prompt == "" {
+		options.Prompt = "Summarize the following text concisely, keeping names, numbers, and decisions:"
+	}
+	if options.CombinePrompt == "" {
+		options.CombinePrompt = options.Prompt
+	}
+	if options.Workers <= 0 {
+		options.Workers = 4
+	}
+	if options.Size <= 0 {
+		options.Size = 8000
+	}
+	if len(chunks) == 0 {
+		return "", nil
+	}
+
+	summaries, err := mapPrompts(ctx, chunks, options.Prompt, llm, options.Workers)
+	if err != nil {
+		return "", err
+	}
+
+	for round := 1; len(summaries) > 1; round++ {
+		combined := strings.Join(summaries, "\n\n")
+		groups := Chunk(combined, ChunkOptions{Size: options.Size})
+		if len(groups) == 0 {
+			return "", nil
+		}
+		if len(groups) >= len(summaries) {
+			LoggerFrom(ctx).Error("summaries don't get shorter", "round", round, "summaries", len(summaries))
+			return "", fmt.Errorf("%w: %d summaries after round %d", ErrSummaryTooLong, len(summaries), round)
+		}
+		LoggerFrom(ctx).Debug("combining summaries", "round", round, "summaries", len(summaries), "groups", len(groups))
+
+		summaries, err = mapPrompts(ctx, groups, options.CombinePrompt, llm, options.Workers)
+		if err != nil {
+			return "", err
+		}
+	}
+	return summaries[0], nil
+}
+
+// mapPrompts sends the prompt with each input, with at most workers at the same time, and returns the
+// answers in the order of the inputs.
+func mapPrompts(ctx context.Context, inputs []string, prompt string, llm LLMFunction, workers int) ([]string, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	outputs := make([]string, len(inputs))
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, input := range inputs {
+		wg.Add(1)
+		go func(i int, input string) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			output, err := llm(ctx, prompt+"\n\n"+input)
+			if err != nil {
+				cancel(fmt.Errorf("error while summarizing chunk %d: %w", i+1, err))
+				return
+			}
+			outputs[i] = strings.TrimSpace(output)
+		}(i, input)
+	}
+	wg.Wait()
+
+	if err := context.Cause(ctx); err != nil {
+		LoggerFrom(ctx).Error("error while summarizing", "error", err.Error())
+		return nil, err
+	}
+	return outputs, nil
+}
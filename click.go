@@ -0,0 +1,65 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/spcoder/jarbles-framework/lib"
+)
+
+type ButtonOptions struct {
+	Label string
+	// Operation is the ID of the action or command that a click runs, with Payload.
+	Operation string
+	Payload   string
+	Confirm   string
+}
+
+// Button renders a button for a card of the extension that runs an action or command when it's clicked.
+// An action can update the card by returning a card part, see ExtensionResponse.AddCard.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (e *Extension) Button(options ButtonOptions) string {
+	return lib.Button(e.buttonOptions(options))
+}
+
+// Menu renders a button for a card of the extension that opens a list of buttons.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (e *Extension) Menu(label string, items ...ButtonOptions) string {
+	options := lib.MenuOptions{Label: label}
+	for _, item := range items {
+		options.Items = append(options.Items, e.buttonOptions(item))
+	}
+	return lib.Menu(options)
+}
+
+func (e *Extension) buttonOptions(options ButtonOptions) lib.ButtonOptions {
+	return lib.ButtonOptions{
+		Label:     options.Label,
+		Extension: e.ID,
+		Operation: slugify(options.Operation),
+		Payload:   options.Payload,
+		Confirm:   options.Confirm,
+	}
+}
+
+// click routes a click on a card to the action or command of the button. Only actions and commands can be
+// clicked, not the operations of the framework.
+func (e *Extension) click(ctx context.Context, payload string) (string, error) {
+	var request struct {
+		Operation string `json:"operation"`
+		Payload   string `json:"payload"`
+	}
+	err := json.Unmarshal([]byte(payload), &request)
+	if err != nil {
+		return "", fmt.Errorf("error while unmarshaling click: %w", err)
+	}
+
+	if _, ok := e.operation(request.Operation); !ok {
+		return "", fmt.Errorf("unknown operation: %s", request.Operation)
+	}
+
+	LoggerFrom(ctx).Info("card clicked", "operation", request.Operation)
+	return e.route(ctx, request.Operation, request.Payload)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	framework "github.com/spcoder/jarbles-framework"
+)
+
+// butlerDir is the only directory the file butler touches, ~/Documents/butler.
+func butlerDir() string {
+	return filepath.Join(framework.MustCurrentUser().HomeDir, "Documents", "butler")
+}
+
+func newFileButler(dir string) framework.Assistant {
+	a := framework.NewAssistant(framework.NewAssistantOptions{
+		StaticID:    "example-file-butler",
+		Name:        "File Butler",
+		Description: "reads, writes, and tidies the files of " + dir,
+	})
+	a.Placeholder("Tidy up my folder")
+	a.AddInstructions("You look after the files of a single folder. List the files before you read or change " +
+		"them, and preview tidy-folder before you run it for real.")
+
+	// the standard tools check that every path stays within dir
+	a.AddTool(framework.StandardTools.ListFiles(dir))
+	a.AddTool(framework.StandardTools.ReadFile(dir))
+	a.AddTool(framework.StandardTools.WriteFile(dir))
+	a.AddTool(framework.Tool{
+		Name:        "tidy-folder",
+		Description: "moves the loose files of the folder into subfolders by kind: images, documents, audio, video, and archives",
+		Arguments: []framework.ToolArguments{
+			{
+				Name:        "preview",
+				Type:        "boolean",
+				Description: "only list the moves without making them",
+			},
+		},
+		Function: func(payload string) (string, error) {
+			preview, _ := framework.PayloadGetBool(payload, "preview", false)
+			return tidyFolder(dir, preview)
+		},
+	})
+	return a
+}
+
+// fileKind returns the subfolder of a file by its mime type, or an empty string for files that stay put.
+func fileKind(mimeType string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return "images"
+	case strings.HasPrefix(mimeType, "audio/"):
+		return "audio"
+	case strings.HasPrefix(mimeType, "video/"):
+		return "video"
+	case strings.HasPrefix(mimeType, "text/"), mimeType == "application/pdf",
+		strings.Contains(mimeType, "officedocument"), strings.Contains(mimeType, "opendocument"):
+		return "documents"
+	case mimeType == "application/zip", mimeType == "application/gzip", mimeType == "application/x-tar",
+		mimeType == "application/x-7z-compressed":
+		return "archives"
+	}
+	return ""
+}
+
+func tidyFolder(dir string, preview bool) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		framework.LogError("error while reading folder", "dir", dir, "error", err.Error())
+		return "", fmt.Errorf("error while reading folder: %w", err)
+	}
+
+	var moves []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		src := filepath.Join(dir, entry.Name())
+		mimeType, err := framework.DetectMIME(src)
+		if err != nil {
+			return "", err
+		}
+		kind := fileKind(mimeType)
+		if kind == "" {
+			continue
+		}
+
+		dest := filepath.Join(dir, kind, entry.Name())
+		if _, err := os.Stat(dest); err == nil {
+			continue
+		}
+		moves = append(moves, entry.Name()+" -> "+kind+"/")
+		if preview {
+			continue
+		}
+
+		err = os.MkdirAll(filepath.Dir(dest), 0o755)
+		if err != nil {
+			return "", fmt.Errorf("error while creating folder: %w", err)
+		}
+		err = os.Rename(src, dest)
+		if err != nil {
+			framework.LogError("error while moving file", "src", src, "error", err.Error())
+			return "", fmt.Errorf("error while moving %s: %w", entry.Name(), err)
+		}
+	}
+
+	if len(moves) == 0 {
+		return "the folder is already tidy", nil
+	}
+	sort.Strings(moves)
+	if preview {
+		return "would move:\n" + strings.Join(moves, "\n"), nil
+	}
+	return "moved:\n" + strings.Join(moves, "\n"), nil
+}
+
+func verifyFileButler() error {
+	dir, err := os.MkdirTemp("", "butler-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	a := newFileButler(dir)
+	output := a.Test(a.Payload("save-file", `{"dir": "", "name": "notes.txt", "content": "buy milk"}`))
+	if output != "file saved successfully" {
+		return fmt.Errorf("unexpected save-file output: %s", output)
+	}
+	output = a.Test(a.Payload("read-file", `{"dir": "", "name": "notes.txt"}`))
+	if output != "buy milk" {
+		return fmt.Errorf("unexpected read-file output: %s", output)
+	}
+	output = a.Test(a.Payload("read-file", `{"dir": "..", "name": "passwd"}`))
+	if !strings.Contains(output, "error") {
+		return fmt.Errorf("read-file left the folder: %s", output)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "photo.png"), []byte("\x89PNG\r\n\x1a\n"), 0o644)
+	if err != nil {
+		return err
+	}
+	output = a.Test(a.Payload("tidy-folder", `{"preview": true}`))
+	if !strings.Contains(output, "photo.png -> images/") || !strings.Contains(output, "notes.txt -> documents/") {
+		return fmt.Errorf("unexpected tidy-folder preview: %s", output)
+	}
+	output = a.Test(a.Payload("tidy-folder", `{}`))
+	if _, err := os.Stat(filepath.Join(dir, "images", "photo.png")); err != nil {
+		return fmt.Errorf("tidy-folder didn't move photo.png: %s", output)
+	}
+
+	return nil
+}
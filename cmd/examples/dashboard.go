@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	framework "github.com/spcoder/jarbles-framework"
+	"github.com/spcoder/jarbles-framework/lib"
+)
+
+// logsPageSize is the number of rows of a page of the logs table.
+const logsPageSize = 10
+
+func newDashboard() *framework.Extension {
+	e := framework.NewExtension(framework.NewExtensionOptions{
+		Name:        "Jarbles Dashboard",
+		Description: "what is installed, how much disk jarbles uses, and the spend of the budgets",
+	})
+
+	e.AddCardCustom(framework.ExtensionCard{
+		ID:   "installed",
+		Icon: "home",
+		Render: func() (string, error) {
+			assistants := countFiles(framework.AssistantsDir(), "*.toml")
+			extensions := countFiles(framework.ExtensionsDir(), "*")
+			body := lib.Stat(lib.StatOptions{Label: "assistants", Value: strconv.Itoa(assistants)}) +
+				lib.Stat(lib.StatOptions{Label: "extensions", Value: strconv.Itoa(extensions)})
+			return lib.CardDefault(lib.CardDefaultOptions{ExtensionName: e.Name, Title: "Installed", Body: lib.Raw(body)}), nil
+		},
+	})
+
+	e.AddAction(framework.AddActionOptions{
+		ID:          "logs",
+		Latency:     framework.LatencyFast,
+		ContentType: framework.ContentTypeHTML,
+		Function: func(payload string) (*framework.ExtensionResponse, error) {
+			return framework.ReturnHTML("Logs", logsTable(e.ActionUrl("logs"), framework.PayloadTableQuery(payload)))
+		},
+	})
+
+	e.AddCardCustom(framework.ExtensionCard{
+		ID:   "disk",
+		Icon: "folder",
+		Render: func() (string, error) {
+			logs := dirSize(framework.LogDir())
+			blobs := dirSize(framework.BlobsDir())
+			percent := 0.0
+			if logs+blobs > 0 {
+				percent = float64(logs) / float64(logs+blobs) * 100
+			}
+			body := lib.Stat(lib.StatOptions{Label: "used by jarbles", Value: formatBytes(logs + blobs)}) +
+				lib.ProgressBar(lib.ProgressBarOptions{Label: "logs " + formatBytes(logs), Percent: percent}) +
+				lib.ProgressBar(lib.ProgressBarOptions{Label: "blobs " + formatBytes(blobs), Percent: 100 - percent, Status: lib.StatusNeutral})
+			return lib.CardDefault(lib.CardDefaultOptions{
+				ExtensionName: e.Name,
+				Title:         "Disk",
+				Description:   "open the logs to see the largest ones",
+				Href:          e.ActionUrl("logs"),
+				Body:          lib.Raw(body),
+			}), nil
+		},
+	})
+
+	e.AddBudgetsCard(framework.AddBudgetsCardOptions{ID: "budgets", Title: "Budgets", Refresh: time.Minute})
+
+	return &e
+}
+
+type logFile struct {
+	name     string
+	size     int64
+	modified time.Time
+}
+
+// logsTable renders the log files as a table sorted and paginated by the query of its links.
+func logsTable(href string, query framework.TableQuery) string {
+	var files []logFile
+	_ = filepath.WalkDir(framework.LogDir(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(framework.LogDir(), path)
+		files = append(files, logFile{name: filepath.ToSlash(rel), size: info.Size(), modified: info.ModTime()})
+		return nil
+	})
+
+	sort.Slice(files, func(i, j int) bool {
+		var less bool
+		switch query.Sort {
+		case "size":
+			less = files[i].size < files[j].size
+		case "modified":
+			less = files[i].modified.Before(files[j].modified)
+		default:
+			less = files[i].name < files[j].name
+		}
+		if query.Desc {
+			return !less
+		}
+		return less
+	})
+
+	start := min((query.Page-1)*logsPageSize, len(files))
+	end := min(start+logsPageSize, len(files))
+	var rows [][]string
+	for _, f := range files[start:end] {
+		rows = append(rows, []string{f.name, formatBytes(f.size), f.modified.Format(time.DateTime)})
+	}
+
+	return lib.Table([]string{"name", "size", "modified"}, rows, lib.TableOptions{
+		Caption:  "log files",
+		Href:     href,
+		Sortable: true,
+		Sort:     query.Sort,
+		Desc:     query.Desc,
+		Page:     query.Page,
+		PageSize: logsPageSize,
+		Total:    len(files),
+	})
+}
+
+func countFiles(dir, pattern string) int {
+	matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+	return len(matches)
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+func formatBytes(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
+func verifyDashboard() error {
+	err := os.MkdirAll(framework.AssistantsDir(), 0o755)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filepath.Join(framework.AssistantsDir(), "weather.toml"), nil, 0o644)
+	if err != nil {
+		return err
+	}
+
+	e := newDashboard()
+	description := e.Test(e.Payload("describe", ""))
+	for _, want := range []string{`"installed"`, `"disk"`, `"budgets"`, "assistants"} {
+		if !strings.Contains(description, want) {
+			return fmt.Errorf("describe doesn't have %s: %s", want, description)
+		}
+	}
+
+	// the extension logs its own requests, so there is at least one log file
+	output := e.Test(e.Payload("logs", `{"sort": "size", "order": "desc"}`))
+	if !strings.Contains(output, "log files") || !strings.Contains(output, ".log") {
+		return fmt.Errorf("unexpected logs output: %s", output)
+	}
+
+	return nil
+}
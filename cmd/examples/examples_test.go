@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExamples(t *testing.T) {
+	for _, e := range examples {
+		t.Run(e.Name, func(t *testing.T) {
+			t.Setenv("JARBLES_HOME", t.TempDir())
+
+			err := e.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// TestRespond sends describe to each example on standard input, the way jarbles runs them.
+func TestRespond(t *testing.T) {
+	for _, e := range examples {
+		t.Run(e.Name, func(t *testing.T) {
+			t.Setenv("JARBLES_HOME", t.TempDir())
+
+			output := respond(t, e, "describe\n\n")
+			var description struct {
+				Name string `json:"name"`
+			}
+			err := json.Unmarshal([]byte(output), &description)
+			if err != nil {
+				t.Fatalf("describe isn't JSON: %v: %s", err, output)
+			}
+			if description.Name == "" {
+				t.Fatalf("describe has no name: %s", output)
+			}
+		})
+	}
+}
+
+func respond(t *testing.T, e example, request string) string {
+	t.Helper()
+
+	stdin, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.WriteString(stdin, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stdin.Seek(0, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldStdin, oldStdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = stdin, stdout
+	defer func() {
+		os.Stdin, os.Stdout = oldStdin, oldStdout
+		_ = stdin.Close()
+		_ = stdout.Close()
+	}()
+	e.Respond()
+
+	data, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(data))
+}
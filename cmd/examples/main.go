@@ -0,0 +1,104 @@
+// Command examples is a gallery of assistants and extensions built with the framework. Each one is a complete
+// program that answers the requests of jarbles on standard input, and verify runs canned requests through all
+// of them, as a check that the public API still works the way the examples use it.
+//
+// Usage:
+//
+//	examples list
+//	examples verify
+//	examples <name>
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// example is one program of the gallery. Respond answers a request on standard input, and Verify runs canned
+// requests and checks the responses.
+type example struct {
+	Name        string
+	Description string
+	Respond     func()
+	Verify      func() error
+}
+
+var examples = []example{
+	{
+		Name:        "weather",
+		Description: "an assistant with a tool that calls a web API",
+		Respond:     func() { a := newWeatherAssistant(openMeteo); a.Respond() },
+		Verify:      verifyWeather,
+	},
+	{
+		Name:        "file-butler",
+		Description: "an assistant that reads, writes, and tidies files with the standard tools",
+		Respond:     func() { a := newFileButler(butlerDir()); a.Respond() },
+		Verify:      verifyFileButler,
+	},
+	{
+		Name:        "dashboard",
+		Description: "an extension with live cards and a sortable table action",
+		Respond:     func() { newDashboard().Respond() },
+		Verify:      verifyDashboard,
+	},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	switch name := os.Args[1]; name {
+	case "list":
+		usage()
+	case "verify":
+		if !verify() {
+			os.Exit(1)
+		}
+	default:
+		for _, e := range examples {
+			if e.Name == name {
+				e.Respond()
+				return
+			}
+		}
+		fmt.Fprintf(os.Stderr, "unknown example: %s\n", name)
+		usage()
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: examples list | verify | <name>")
+	sorted := append([]example(nil), examples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	for _, e := range sorted {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", e.Name, e.Description)
+	}
+}
+
+// verify runs the checks of every example in a temporary jarbles home, so that they don't touch the real one.
+func verify() bool {
+	home, err := os.MkdirTemp("", "jarbles-examples-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error while creating temporary home: %s\n", err)
+		return false
+	}
+	defer func() { _ = os.RemoveAll(home) }()
+	_ = os.Setenv("JARBLES_HOME", home)
+
+	ok := true
+	for _, e := range examples {
+		err := e.Verify()
+		if err != nil {
+			ok = false
+			fmt.Printf("FAIL %s: %s\n", e.Name, err)
+			continue
+		}
+		fmt.Printf("ok   %s\n", e.Name)
+	}
+	return ok
+}
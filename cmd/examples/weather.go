@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	framework "github.com/spcoder/jarbles-framework"
+)
+
+// weather is the current weather of a place.
+type weather struct {
+	Place       string  `json:"place"`
+	Temperature float64 `json:"temperature_celsius"`
+	WindSpeed   float64 `json:"wind_speed_kmh"`
+	Conditions  string  `json:"conditions"`
+}
+
+// weatherProvider looks up the current weather of a city. The assistant takes it as a parameter, so that
+// verify doesn't need the network.
+type weatherProvider func(ctx context.Context, city string) (weather, error)
+
+func newWeatherAssistant(provider weatherProvider) framework.Assistant {
+	a := framework.NewAssistant(framework.NewAssistantOptions{
+		StaticID:    "example-weather",
+		Name:        "Weather",
+		Description: "tells the current weather anywhere",
+	})
+	a.Placeholder("What's the weather in Lisbon?")
+	a.AddInstructions("Answer questions about the weather with the current-weather tool. " +
+		"Give temperatures in celsius unless the user asks otherwise.")
+	a.AddTool(framework.Tool{
+		Name:        "current-weather",
+		Description: "returns the current temperature, wind speed, and conditions of a city",
+		Arguments: []framework.ToolArguments{
+			{
+				Name:        "city",
+				Type:        "string",
+				Description: "the name of the city, e.g. Lisbon",
+			},
+		},
+		RequiredArguments: []string{"city"},
+		Latency:           framework.LatencyMedium,
+		Cost:              framework.CostFree,
+		ContextFunction: func(ctx context.Context, payload string) (string, error) {
+			city, ok := framework.PayloadGetString(payload, "city", "")
+			if !ok || city == "" {
+				return "", fmt.Errorf("city parameter is missing")
+			}
+
+			w, err := provider(ctx, city)
+			if err != nil {
+				framework.LogError("error while getting weather", "city", city, "error", err.Error())
+				return "", fmt.Errorf("error while getting weather: %w", err)
+			}
+
+			data, err := json.Marshal(w)
+			if err != nil {
+				return "", fmt.Errorf("error while marshaling weather: %w", err)
+			}
+			return string(data), nil
+		},
+	})
+	return a
+}
+
+// weatherCodes describes the WMO weather codes of Open-Meteo.
+var weatherCodes = map[int]string{
+	0: "clear sky", 1: "mainly clear", 2: "partly cloudy", 3: "overcast", 45: "fog", 48: "fog",
+	51: "light drizzle", 53: "drizzle", 55: "dense drizzle", 61: "light rain", 63: "rain", 65: "heavy rain",
+	71: "light snow", 73: "snow", 75: "heavy snow", 80: "rain showers", 81: "rain showers", 82: "violent rain showers",
+	95: "thunderstorm", 96: "thunderstorm with hail", 99: "thunderstorm with hail",
+}
+
+// openMeteo looks up the weather with the free APIs of Open-Meteo, which don't need a key.
+func openMeteo(ctx context.Context, city string) (weather, error) {
+	var places struct {
+		Results []struct {
+			Name      string  `json:"name"`
+			Country   string  `json:"country"`
+			Latitude  float64 `json:"latitude"`
+			Longitude float64 `json:"longitude"`
+		} `json:"results"`
+	}
+	err := getJSON(ctx, "https://geocoding-api.open-meteo.com/v1/search?count=1&name="+url.QueryEscape(city), &places)
+	if err != nil {
+		return weather{}, err
+	}
+	if len(places.Results) == 0 {
+		return weather{}, fmt.Errorf("no city named %s", city)
+	}
+	place := places.Results[0]
+
+	var forecast struct {
+		Current struct {
+			Temperature float64 `json:"temperature_2m"`
+			WindSpeed   float64 `json:"wind_speed_10m"`
+			WeatherCode int     `json:"weather_code"`
+		} `json:"current"`
+	}
+	err = getJSON(ctx, fmt.Sprintf("https://api.open-meteo.com/v1/forecast?latitude=%f&longitude=%f&current=temperature_2m,wind_speed_10m,weather_code",
+		place.Latitude, place.Longitude), &forecast)
+	if err != nil {
+		return weather{}, err
+	}
+
+	return weather{
+		Place:       strings.TrimSuffix(place.Name+", "+place.Country, ", "),
+		Temperature: forecast.Current.Temperature,
+		WindSpeed:   forecast.Current.WindSpeed,
+		Conditions:  weatherCodes[forecast.Current.WeatherCode],
+	}, nil
+}
+
+func getJSON(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("error while creating request: %w", err)
+	}
+
+	resp, err := framework.HTTPClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("error while requesting %s: %w", req.URL.Host, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error while requesting %s: %s", req.URL.Host, resp.Status)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		return fmt.Errorf("error while unmarshaling response of %s: %w", req.URL.Host, err)
+	}
+	return nil
+}
+
+func verifyWeather() error {
+	a := newWeatherAssistant(func(_ context.Context, city string) (weather, error) {
+		if city != "Lisbon" {
+			return weather{}, fmt.Errorf("no city named %s", city)
+		}
+		return weather{Place: "Lisbon, Portugal", Temperature: 21.5, WindSpeed: 12, Conditions: "clear sky"}, nil
+	})
+
+	description := a.Test(a.Payload("describe", ""))
+	if !strings.Contains(description, "current-weather") {
+		return fmt.Errorf("describe doesn't have the tool: %s", description)
+	}
+
+	output := a.Test(a.Payload("current-weather", `{"city": "Lisbon"}`))
+	if !strings.Contains(output, `"temperature_celsius":21.5`) {
+		return fmt.Errorf("unexpected weather: %s", output)
+	}
+
+	output = a.Test(a.Payload("current-weather", `{"city": "Atlantis"}`))
+	if !strings.Contains(output, "no city named Atlantis") {
+		return fmt.Errorf("unexpected error: %s", output)
+	}
+
+	return nil
+}
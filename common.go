@@ -1,12 +1,18 @@
 package framework
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
 	"os/user"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -14,6 +20,11 @@ type ToolFunction func(payload string) (string, error)
 type ActionFunction func(payload string) (string, error)
 type CommandFunction func(payload string) error
 
+// The Context variants receive the context of the request, which carries its logger (see LoggerFrom).
+type ToolContextFunction func(ctx context.Context, payload string) (string, error)
+type ActionContextFunction func(ctx context.Context, payload string) (string, error)
+type CommandContextFunction func(ctx context.Context, payload string) error
+
 //goland:noinspection GoUnusedExportedFunction
 func MustCurrentUser() *user.User {
 	currentUser, err := user.Current()
@@ -90,6 +101,63 @@ func PayloadGetString(payload any, key, defaultValue string) (string, bool) {
 	return defaultValue, false // wrong type
 }
 
+func PayloadGetBool(payload any, key string, defaultValue bool) (bool, bool) {
+	var payloadMap map[string]any
+	switch v := payload.(type) {
+	case string:
+		var err error
+		payloadMap, err = PayloadParse(v)
+		if err != nil {
+			return defaultValue, false // error while parsing
+		}
+	case map[string]any:
+		payloadMap = v
+	default:
+		return defaultValue, false // wrong type
+	}
+
+	value, ok := payloadMap[key]
+	if !ok {
+		return defaultValue, false // missing key
+	}
+
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case string:
+		b, err := strconv.ParseBool(v)
+		if err == nil {
+			return b, true
+		}
+	}
+
+	return defaultValue, false // wrong type
+}
+
+var jsonBuffers = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// marshalJSON is json.Marshal using pooled buffers, for hot paths such as describe.
+func marshalJSON(v any) ([]byte, error) {
+	buf := jsonBuffers.Get().(*bytes.Buffer)
+	defer jsonBuffers.Put(buf)
+	buf.Reset()
+
+	err := json.NewEncoder(buf).Encode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// copy because the buffer goes back to the pool, and drop the newline added by Encode
+	data := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	return append([]byte(nil), data...), nil
+}
+
+// SleepAtLeast sleeps until at least min has passed since started.
+//
+// Deprecated: to wait between attempts of a call, use Retry, which backs off with jitter and stops when the
+// context is done.
 func SleepAtLeast(started time.Time, min time.Duration) {
 	duration := time.Since(started)
 	if duration < min {
@@ -97,6 +165,13 @@ func SleepAtLeast(started time.Time, min time.Duration) {
 	}
 }
 
+// randomID returns a random 16 character hex ID, e.g. to correlate the records of a request.
+func randomID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 func slugify(str string) string {
 	s := strings.ToLower(str)
 	s = strings.ReplaceAll(s, " ", "-")
@@ -0,0 +1,93 @@
+package framework
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// FeatureGzip is advertised by hosts that accept gzip compressed responses.
+const FeatureGzip string = "gzip"
+
+// Headers that negotiate the compression of a request and its response. gzip is the only encoding, since it's
+// in the standard library and zstd isn't: a payload in any other encoding is rejected as malformed, and a host
+// that only accepts zstd gets uncompressed responses.
+const (
+	HeaderContentEncoding = "Content-Encoding"
+	HeaderAcceptEncoding  = "Accept-Encoding"
+)
+
+// CompressionThreshold is the smallest response that is compressed for a host that accepts gzip.
+var CompressionThreshold = 8 << 10
+
+// gzipPrefix starts a compressed response, followed by the base64 encoded gzip data, so the response stays
+// text like every other response.
+const gzipPrefix = "gzip:"
+
+// decompressPayload decodes a payload sent with "Content-Encoding: gzip", which is base64 encoded gzip data.
+func decompressPayload(payload string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(payload))
+	if err != nil {
+		return "", fmt.Errorf("error while decoding payload: %w", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("error while decompressing payload: %w", err)
+	}
+	defer func() { _ = zr.Close() }()
+
+	limited := &io.LimitedReader{R: zr, N: MaxRequestSize + 1}
+	data, err = io.ReadAll(limited)
+	if err != nil {
+		return "", fmt.Errorf("error while decompressing payload: %w", err)
+	}
+	if int64(len(data)) > MaxRequestSize {
+		return "", fmt.Errorf("%w: more than %d bytes decompressed", ErrRequestTooLarge, MaxRequestSize)
+	}
+	return string(data), nil
+}
+
+// acceptsGzip reports whether the host accepts compressed responses, with the Accept-Encoding header of the
+// request, the gzip feature in the handshake, or JARBLES_COMPRESSION=gzip.
+func acceptsGzip(request Request) bool {
+	if strings.Contains(request.Headers[HeaderAcceptEncoding], "gzip") {
+		return true
+	}
+	if os.Getenv("JARBLES_COMPRESSION") == "gzip" {
+		return true
+	}
+	return HostSupports(FeatureGzip)
+}
+
+// compressOutput compresses a large output for a host that accepts gzip. Compressed outputs start with
+// "gzip:", small outputs and outputs for other hosts are returned as is.
+func compressOutput(request Request, output string) string {
+	if len(output) < CompressionThreshold || !acceptsGzip(request) {
+		return output
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(gzipPrefix)
+	b64 := base64.NewEncoder(base64.StdEncoding, &buf)
+	zw := gzip.NewWriter(b64)
+	_, err := io.WriteString(zw, output)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = b64.Close()
+	}
+	if err != nil {
+		LogWarn("error while compressing output", "error", err.Error())
+		return output
+	}
+
+	if buf.Len() >= len(output) {
+		return output
+	}
+	return buf.String()
+}
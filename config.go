@@ -0,0 +1,392 @@
+package framework
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	configMu sync.RWMutex
+	configID string
+
+	// configWriteMu serializes the config writers of this process, the lock file those of other processes.
+	configWriteMu sync.Mutex
+)
+
+// setConfigID selects whose config is read and written by the Config functions.
+// It is called when an assistant or extension is created and again when it executes.
+func setConfigID(id string) {
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	configID = slugify(id)
+}
+
+func currentConfigID() (string, error) {
+	configMu.RLock()
+	defer configMu.RUnlock()
+
+	if configID == "" {
+		return "", fmt.Errorf("config is not available before an assistant or extension is created")
+	}
+
+	return configID, nil
+}
+
+func configKey() (string, error) {
+	id, err := currentConfigID()
+	if err != nil {
+		return "", err
+	}
+
+	return storageKey("data", id, "config.json"), nil
+}
+
+func configLoad() (map[string]string, error) {
+	key, err := configKey()
+	if err != nil {
+		return nil, err
+	}
+
+	config := make(map[string]string)
+	data, err := CurrentStorage().Read(key)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while reading config: %w", err)
+	}
+
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return nil, fmt.Errorf("error while unmarshaling config: %w", err)
+	}
+
+	return config, nil
+}
+
+func configSave(config map[string]string) error {
+	key, err := configKey()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error while marshaling config: %w", err)
+	}
+
+	err = CurrentStorage().Write(key, data)
+	if err != nil {
+		return fmt.Errorf("error while writing config: %w", err)
+	}
+
+	return nil
+}
+
+// configUpdate loads the config, passes it to update, and saves it unless update fails. Writers are serialized
+// with a mutex and a lock file, so concurrent invocations, e.g. a scheduled action and one of the user, don't
+// lose each other's changes.
+func configUpdate(update func(config map[string]string) error) error {
+	id, err := currentConfigID()
+	if err != nil {
+		return err
+	}
+
+	configWriteMu.Lock()
+	defer configWriteMu.Unlock()
+
+	unlock, err := lockFile(filepath.Join(profileStateDir("locks"), id+"-config.lock"), 10*time.Second, time.Minute)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	config, err := configLoad()
+	if err != nil {
+		return err
+	}
+
+	err = update(config)
+	if err != nil {
+		return err
+	}
+
+	return configSave(config)
+}
+
+// ConfigGet returns the value of a config key of the running assistant or extension.
+// A config that can't be loaded is treated as empty. The keys declared with AddSetting fall back to their
+// default when they aren't set or their value isn't valid.
+func ConfigGet(key string) (string, bool) {
+	setting, declared := lookupSetting(key)
+
+	// a nil config of a failed load reads as empty
+	config, _ := configLoad()
+
+	value, ok := config[key]
+	if !declared {
+		return value, ok
+	}
+	if ok {
+		err := setting.Validate(value)
+		if err == nil {
+			return value, true
+		}
+		LogWarn("invalid config value, using the default", "key", key, "error", err.Error())
+	}
+	return setting.Default, setting.Default != ""
+}
+
+// ConfigSet stores the value of a config key of the running assistant or extension. The value of a key
+// declared with AddSetting must be valid.
+func ConfigSet(key, value string) error {
+	if setting, ok := lookupSetting(key); ok {
+		err := setting.Validate(value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return configUpdate(func(config map[string]string) error {
+		config[key] = value
+		return nil
+	})
+}
+
+// ConfigDelete removes a config key of the running assistant or extension.
+//
+//goland:noinspection GoUnusedExportedFunction
+func ConfigDelete(key string) error {
+	return configUpdate(func(config map[string]string) error {
+		delete(config, key)
+		return nil
+	})
+}
+
+// ConfigExportJSON returns the config of the running assistant or extension as a JSON object of keys and
+// values, including secrets, e.g. to back it up.
+//
+//goland:noinspection GoUnusedExportedFunction
+func ConfigExportJSON() ([]byte, error) {
+	config, err := configLoad()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error while marshaling config: %w", err)
+	}
+	return data, nil
+}
+
+// ConfigImportJSON merges a JSON object of keys and values into the config of the running assistant or
+// extension. A null value removes the key, and the keys that aren't in data are kept. The values of the keys
+// declared with AddSetting are all validated before any is saved.
+//
+//goland:noinspection GoUnusedExportedFunction
+func ConfigImportJSON(data []byte) error {
+	var values map[string]*string
+	err := json.Unmarshal(data, &values)
+	if err != nil {
+		return fmt.Errorf("error while unmarshaling config: %w", err)
+	}
+
+	for key, value := range values {
+		if setting, ok := lookupSetting(key); ok && value != nil {
+			err = setting.Validate(*value)
+			if err != nil {
+				return fmt.Errorf("error while importing config: %w", err)
+			}
+		}
+	}
+
+	LogInfo("importing config", "count", len(values))
+	return configUpdate(func(config map[string]string) error {
+		for key, value := range values {
+			if value == nil {
+				delete(config, key)
+			} else {
+				config[key] = *value
+			}
+		}
+		return nil
+	})
+}
+
+// configGetOperation returns the config for the host to edit. Only the values of settings declared with
+// AddSetting are returned, and not those of secret settings, which the host only sees through the is_set of
+// the __settings operation. Other keys, e.g. the credentials of HTTPRequestOptions, may hold secrets too.
+func configGetOperation() (string, error) {
+	config, err := configLoad()
+	if err != nil {
+		return "", err
+	}
+
+	for key := range config {
+		if setting, ok := lookupSetting(key); !ok || setting.Secret {
+			delete(config, key)
+		}
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("error while marshaling config: %w", err)
+	}
+	return string(data), nil
+}
+
+// configSetOperation imports the payload like ConfigImportJSON and returns the config like configGetOperation.
+func configSetOperation(payload string) (string, error) {
+	err := ConfigImportJSON([]byte(payload))
+	if err != nil {
+		return "", err
+	}
+
+	return configGetOperation()
+}
+
+// ErrInvalidConfig is wrapped by the errors of the typed ConfigGet functions when a value doesn't parse.
+var ErrInvalidConfig = errors.New("invalid config value")
+
+// ConfigGetInt returns the value of a config key as an integer, or defaultValue when it isn't set. Besides
+// decimals it accepts underscores, e.g. 10_000, and 0x, 0o, and 0b prefixes. A value that doesn't parse
+// returns defaultValue and an error wrapping ErrInvalidConfig.
+//
+//goland:noinspection GoUnusedExportedFunction
+func ConfigGetInt(key string, defaultValue int) (int, error) {
+	value, ok := ConfigGet(key)
+	if !ok {
+		return defaultValue, nil
+	}
+
+	n, err := parseConfigInt(value)
+	if err != nil {
+		return defaultValue, invalidConfig(key, value, err)
+	}
+	return n, nil
+}
+
+// ConfigGetDuration returns the value of a config key as a duration, or defaultValue when it isn't set. Besides
+// the units of time.ParseDuration it accepts days and weeks, e.g. 1d12h or 2w, spaces, e.g. 1h 30m, and plain
+// numbers of seconds. A value that doesn't parse returns defaultValue and an error wrapping ErrInvalidConfig.
+//
+//goland:noinspection GoUnusedExportedFunction
+func ConfigGetDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	value, ok := ConfigGet(key)
+	if !ok {
+		return defaultValue, nil
+	}
+
+	d, err := parseConfigDuration(value)
+	if err != nil {
+		return defaultValue, invalidConfig(key, value, err)
+	}
+	return d, nil
+}
+
+// ConfigGetTime returns the value of a config key as a time, or defaultValue when it isn't set. It accepts
+// RFC 3339, a date and time without a zone, e.g. 2024-05-01 09:00, a date, or a time of day, e.g. 09:00 or
+// 9:30pm, which is today. Values without a zone are in TimeZone(). A value that doesn't parse returns
+// defaultValue and an error wrapping ErrInvalidConfig.
+//
+//goland:noinspection GoUnusedExportedFunction
+func ConfigGetTime(key string, defaultValue time.Time) (time.Time, error) {
+	value, ok := ConfigGet(key)
+	if !ok {
+		return defaultValue, nil
+	}
+
+	t, err := parseConfigTime(value, TimeZone(), time.Now())
+	if err != nil {
+		return defaultValue, invalidConfig(key, value, err)
+	}
+	return t, nil
+}
+
+func invalidConfig(key, value string, err error) error {
+	LogWarn("invalid config value", "key", key, "value", value, "error", err.Error())
+	return fmt.Errorf("%w: %s is %q: %s", ErrInvalidConfig, key, value, err)
+}
+
+func parseConfigInt(value string) (int, error) {
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 0, strconv.IntSize)
+	if err != nil {
+		var numErr *strconv.NumError
+		if errors.As(err, &numErr) && errors.Is(numErr.Err, strconv.ErrRange) {
+			return 0, fmt.Errorf("out of range")
+		}
+		return 0, fmt.Errorf("not an integer")
+	}
+	return int(n), nil
+}
+
+var durationDaysWeeks = regexp.MustCompile(`(\d+(?:\.\d+)?)([dw])`)
+
+func parseConfigDuration(value string) (time.Duration, error) {
+	s := strings.Join(strings.Fields(value), "")
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+
+	// time.ParseDuration stops at hours
+	s = durationDaysWeeks.ReplaceAllStringFunc(s, func(m string) string {
+		match := durationDaysWeeks.FindStringSubmatch(m)
+		n, _ := strconv.ParseFloat(match[1], 64)
+		hours := n * 24
+		if match[2] == "w" {
+			hours *= 7
+		}
+		return strconv.FormatFloat(hours, 'f', -1, 64) + "h"
+	})
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("not a duration, e.g. 90s, 1h30m, or 7d")
+	}
+	return d, nil
+}
+
+// configTimeLayouts are the layouts parseConfigTime tries in order, those of a time of day last.
+var configTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	time.DateOnly,
+}
+
+var configTimeOfDayLayouts = []string{"15:04:05", "15:04", "3:04pm", "3:04 pm", "3pm", "3 pm"}
+
+func parseConfigTime(value string, location *time.Location, now time.Time) (time.Time, error) {
+	s := strings.TrimSpace(value)
+	for _, layout := range configTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, location); err == nil {
+			return t, nil
+		}
+	}
+
+	lower := strings.ToLower(s)
+	for _, layout := range configTimeOfDayLayouts {
+		if t, err := time.ParseInLocation(layout, lower, location); err == nil {
+			today := now.In(location)
+			return time.Date(today.Year(), today.Month(), today.Day(), t.Hour(), t.Minute(), t.Second(), 0, location), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("not a time, e.g. 2024-05-01T09:00:00Z, 2024-05-01 09:00, 2024-05-01, or 09:00")
+}
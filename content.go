@@ -0,0 +1,83 @@
+package framework
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	ContentTypeText     string = "text/plain"
+	ContentTypeMarkdown string = "text/markdown"
+	ContentTypeJSON     string = "application/json"
+	ContentTypeHTML     string = "text/html"
+)
+
+// ReturnText returns a plain text response.
+//
+//goland:noinspection GoUnusedExportedFunction
+func ReturnText(text string) (*ExtensionResponse, error) {
+	return &ExtensionResponse{ContentType: ContentTypeText, TextBody: text}, nil
+}
+
+// ReturnMarkdown returns a markdown response, which the host renders.
+//
+//goland:noinspection GoUnusedExportedFunction
+func ReturnMarkdown(markdown string) (*ExtensionResponse, error) {
+	return &ExtensionResponse{ContentType: ContentTypeMarkdown, Body: markdown}, nil
+}
+
+// ReturnHTML returns an HTML page with the title and body.
+//
+//goland:noinspection GoUnusedExportedFunction
+func ReturnHTML(title, body string) (*ExtensionResponse, error) {
+	return &ExtensionResponse{ContentType: ContentTypeHTML, HTMLTitle: title, HTMLBody: body}, nil
+}
+
+// ReturnJSON returns v marshaled as an indented JSON response.
+//
+//goland:noinspection GoUnusedExportedFunction
+func ReturnJSON(v any) (*ExtensionResponse, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		LogError("error while marshaling response", "error", err.Error())
+		return nil, fmt.Errorf("error while marshaling response: %w", err)
+	}
+	return &ExtensionResponse{ContentType: ContentTypeJSON, Body: string(data)}, nil
+}
+
+// Kinds of the parts of a response.
+const (
+	PartText       string = "text"
+	PartCard       string = "card"
+	PartAttachment string = "attachment"
+)
+
+// ResponsePart is one part of a response with several, e.g. a text summary, an update of a card, and a file.
+type ResponsePart struct {
+	Kind        string `json:"kind"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body,omitempty"`
+	// CardID is the ID of the card that a card part replaces the HTML of.
+	CardID string `json:"card_id,omitempty"`
+	// Filename and Data are the file of an attachment part. Data is base64 encoded in the response.
+	Filename string `json:"filename,omitempty"`
+	Data     []byte `json:"data,omitempty"`
+}
+
+// AddText adds a text part with the content type, e.g. ContentTypeMarkdown.
+func (r *ExtensionResponse) AddText(contentType, body string) *ExtensionResponse {
+	r.Parts = append(r.Parts, ResponsePart{Kind: PartText, ContentType: contentType, Body: body})
+	return r
+}
+
+// AddCard adds a part that updates the HTML of a card of the extension.
+func (r *ExtensionResponse) AddCard(cardID, html string) *ExtensionResponse {
+	r.Parts = append(r.Parts, ResponsePart{Kind: PartCard, ContentType: ContentTypeHTML, CardID: cardID, Body: html})
+	return r
+}
+
+// AddAttachment adds a file part.
+func (r *ExtensionResponse) AddAttachment(filename, contentType string, data []byte) *ExtensionResponse {
+	r.Parts = append(r.Parts, ResponsePart{Kind: PartAttachment, ContentType: contentType, Filename: filename, Data: data})
+	return r
+}
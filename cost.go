@@ -0,0 +1,77 @@
+package framework
+
+import (
+	"fmt"
+)
+
+// Latency tiers of tools and actions, for how long a call usually takes.
+const (
+	LatencyFast   string = "fast"   // under a second
+	LatencyMedium string = "medium" // a few seconds
+	LatencySlow   string = "slow"   // tens of seconds or more
+)
+
+// Cost tiers of tools and actions, for what a call usually costs.
+const (
+	CostFree   string = "free"
+	CostLow    string = "low"
+	CostMedium string = "medium"
+	CostHigh   string = "high"
+)
+
+// Estimate is what a call with a particular payload is expected to take and cost. The zero values of
+// Seconds and Amount mean unknown.
+type Estimate struct {
+	Latency  string  `json:"latency,omitempty"`
+	Cost     string  `json:"cost,omitempty"`
+	Seconds  float64 `json:"seconds,omitempty"`
+	Amount   float64 `json:"amount,omitempty"`
+	Currency string  `json:"currency,omitempty"`
+	Note     string  `json:"note,omitempty"`
+}
+
+// EstimateFunction estimates a call with the payload without making it.
+type EstimateFunction func(payload string) (Estimate, error)
+
+type costMetadata struct {
+	Latency   string `json:"latency,omitempty"`
+	Cost      string `json:"cost,omitempty"`
+	Estimable bool   `json:"estimable,omitempty"`
+}
+
+func (m costMetadata) empty() bool {
+	return m == costMetadata{}
+}
+
+// estimateOperation serves the __estimate operation, whose payload has the name of a tool or action and the
+// payload it would be called with. Without an estimate function the declared tiers are returned.
+func estimateOperation(payload string, lookup func(name string) (latency, cost string, estimate EstimateFunction, ok bool)) (string, error) {
+	name, _ := PayloadGetString(payload, "name", "")
+	callPayload, _ := PayloadGetString(payload, "payload", "")
+
+	latency, cost, estimate, ok := lookup(name)
+	if !ok {
+		return "", fmt.Errorf("unknown route: %s", name)
+	}
+
+	e := Estimate{Latency: latency, Cost: cost}
+	if estimate != nil {
+		var err error
+		e, err = estimate(callPayload)
+		if err != nil {
+			return "", fmt.Errorf("error while estimating %s: %w", name, err)
+		}
+		if e.Latency == "" {
+			e.Latency = latency
+		}
+		if e.Cost == "" {
+			e.Cost = cost
+		}
+	}
+
+	data, err := marshalJSON(e)
+	if err != nil {
+		return "", fmt.Errorf("error while marshaling estimate: %w", err)
+	}
+	return string(data), nil
+}
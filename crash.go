@@ -0,0 +1,200 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCrashReports is how many crash reports are kept, the oldest are removed first.
+const maxCrashReports = 50
+
+var ErrCrashed = errors.New("crashed")
+
+var (
+	crashHandlerMu sync.RWMutex
+	crashHandler   func(CrashReport)
+)
+
+// CrashReport is written to CrashDir when an operation panics.
+type CrashReport struct {
+	ID        string    `json:"id"`
+	Time      time.Time `json:"time"`
+	Component string    `json:"component"`
+	Operation string    `json:"operation"`
+	Panic     string    `json:"panic"`
+	Stack     string    `json:"stack"`
+	Version   string    `json:"version,omitempty"`
+	GoVersion string    `json:"go_version"`
+	Platform  string    `json:"platform"`
+	// ConversationID and MessageID are the request metadata from the host, if it sent them.
+	ConversationID string `json:"conversation_id,omitempty"`
+	MessageID      string `json:"message_id,omitempty"`
+}
+
+func CrashDir() string {
+	return profileStateDir("crash")
+}
+
+// SetCrashHandler calls handler with every crash report after it's written, e.g. to notify the author.
+// The handler runs before the response is returned, so it should be quick.
+//
+//goland:noinspection GoUnusedExportedFunction
+func SetCrashHandler(handler func(CrashReport)) {
+	crashHandlerMu.Lock()
+	defer crashHandlerMu.Unlock()
+	crashHandler = handler
+}
+
+// routeSafely routes the request and turns a panic into a crash report and an error wrapping ErrCrashed,
+// instead of a process that dies without a word.
+func routeSafely(ctx context.Context, component string, request Request, route func(ctx context.Context, operation, payload string) (string, error)) (output string, err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+
+		meta := RequestMeta(ctx)
+		report := CrashReport{
+			ID:             time.Now().UTC().Format("20060102T150405") + "-" + RequestIDFrom(ctx),
+			Time:           time.Now(),
+			Component:      component,
+			Operation:      request.Operation,
+			Panic:          fmt.Sprint(r),
+			Stack:          string(debug.Stack()),
+			Version:        buildVersion(),
+			GoVersion:      runtime.Version(),
+			Platform:       runtime.GOOS + "/" + runtime.GOARCH,
+			ConversationID: meta.ConversationID,
+			MessageID:      meta.MessageID,
+		}
+		LoggerFrom(ctx).Error("panic", "operation", request.Operation, "panic", report.Panic, "stack", report.Stack)
+
+		writeErr := writeCrashReport(report)
+		if writeErr != nil {
+			LoggerFrom(ctx).Error("error while writing crash report", "error", writeErr.Error())
+		}
+
+		crashHandlerMu.RLock()
+		handler := crashHandler
+		crashHandlerMu.RUnlock()
+		if handler != nil {
+			handler(report)
+		}
+
+		output, err = "", fmt.Errorf("%s %w: %s, see crash report %s", request.Operation, ErrCrashed, report.Panic, report.ID)
+	}()
+
+	return route(ctx, request.Operation, request.Payload)
+}
+
+func writeCrashReport(report CrashReport) error {
+	err := os.MkdirAll(CrashDir(), privateDirPerm)
+	if err != nil {
+		return fmt.Errorf("error while creating crash directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error while marshaling crash report: %w", err)
+	}
+	err = os.WriteFile(filepath.Join(CrashDir(), report.ID+".json"), data, privateFilePerm)
+	if err != nil {
+		return fmt.Errorf("error while writing crash report: %w", err)
+	}
+
+	names, err := crashReportNames()
+	if err != nil {
+		return err
+	}
+	for len(names) > maxCrashReports {
+		_ = os.Remove(filepath.Join(CrashDir(), names[0]))
+		names = names[1:]
+	}
+	return nil
+}
+
+// crashReportNames returns the file names of the crash reports, oldest first.
+func crashReportNames() ([]string, error) {
+	entries, err := os.ReadDir(CrashDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while reading crash directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// CrashReports returns the most recent crash reports, newest first.
+func CrashReports(limit int) ([]CrashReport, error) {
+	names, err := crashReportNames()
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []CrashReport
+	for i := len(names) - 1; i >= 0 && len(reports) < limit; i-- {
+		data, err := os.ReadFile(filepath.Join(CrashDir(), names[i]))
+		if err != nil {
+			continue // removed by another process
+		}
+		var report CrashReport
+		if json.Unmarshal(data, &report) == nil {
+			reports = append(reports, report)
+		}
+	}
+	return reports, nil
+}
+
+// crashesOperation serves the __crashes operation, the recent crash reports of the component. The payload
+// is {"limit": 10}.
+func crashesOperation(component, payload string) (string, error) {
+	var request struct {
+		Limit int `json:"limit"`
+	}
+	if strings.TrimSpace(payload) != "" {
+		err := json.Unmarshal([]byte(payload), &request)
+		if err != nil {
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+		}
+	}
+	if request.Limit <= 0 {
+		request.Limit = 10
+	}
+
+	all, err := CrashReports(maxCrashReports)
+	if err != nil {
+		return "", err
+	}
+	reports := []CrashReport{}
+	for _, report := range all {
+		if report.Component == component && len(reports) < request.Limit {
+			reports = append(reports, report)
+		}
+	}
+
+	data, err := marshalJSON(reports)
+	if err != nil {
+		return "", fmt.Errorf("error while marshaling crash reports: %w", err)
+	}
+	return string(data), nil
+}
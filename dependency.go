@@ -0,0 +1,88 @@
+package framework
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+const KindBinary string = "binary"
+
+// Dependency is an assistant, extension, or external binary that an extension needs.
+type Dependency struct {
+	// Kind is KindAssistant, KindExtension, or KindBinary.
+	Kind string `json:"kind"`
+	// Name is the ID of the assistant or extension, or the name of the binary in the PATH.
+	Name string `json:"name"`
+	// Optional dependencies only disable some features when they're missing.
+	Optional bool   `json:"optional,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// DependencyStatus is the result of the preflight check of a dependency.
+type DependencyStatus struct {
+	Dependency
+	Satisfied bool   `json:"satisfied"`
+	Error     string `json:"error,omitempty"`
+}
+
+// AddDependency declares a dependency. Dependencies are listed in describe and checked by Preflight, so the
+// host can warn when the extension is installed rather than when it's first used.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (e *Extension) AddDependency(dependency Dependency) {
+	e.dependencies = append(e.dependencies, dependency)
+}
+
+// Preflight checks the dependencies: binaries are looked up in the PATH, and assistants and extensions must be
+// installed and enabled.
+func (e *Extension) Preflight() []DependencyStatus {
+	statuses := make([]DependencyStatus, 0, len(e.dependencies))
+	for _, dependency := range e.dependencies {
+		err := checkDependency(dependency)
+		status := DependencyStatus{Dependency: dependency, Satisfied: err == nil}
+		if err != nil {
+			status.Error = err.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func checkDependency(dependency Dependency) error {
+	var installed []Installed
+	var err error
+	switch dependency.Kind {
+	case KindBinary:
+		_, err = exec.LookPath(dependency.Name)
+		return err
+	case KindAssistant:
+		installed, err = InstalledAssistants()
+	case KindExtension:
+		installed, err = InstalledExtensions()
+	default:
+		return fmt.Errorf("unknown dependency kind: %s", dependency.Kind)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, i := range installed {
+		if i.ID != slugify(dependency.Name) {
+			continue
+		}
+		if !i.Enabled {
+			return fmt.Errorf("%s %s is disabled", dependency.Kind, dependency.Name)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s %s is not installed", dependency.Kind, dependency.Name)
+}
+
+// preflightOperation serves the __preflight operation.
+func (e *Extension) preflightOperation() (string, error) {
+	data, err := marshalJSON(e.Preflight())
+	if err != nil {
+		return "", fmt.Errorf("error while marshaling preflight: %w", err)
+	}
+	return string(data), nil
+}
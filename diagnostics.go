@@ -0,0 +1,94 @@
+package framework
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Diagnostic is one error of the go compiler, goimports, go vet, or cargo, e.g. main.go:12:5: undefined: foo.
+type Diagnostic struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// BuildError is returned by the build steps of the compile and build-extension tools. Its message is the exact
+// output of the command, and Diagnostics has the errors parsed from it.
+type BuildError struct {
+	Output      string
+	Diagnostics []Diagnostic
+}
+
+func (e *BuildError) Error() string {
+	return e.Output
+}
+
+var diagnosticLine = regexp.MustCompile(`^(?:vet: )?(.+?\.(?:go|rs)):(\d+)(?::(\d+))?: (.*)$`)
+
+// ParseDiagnostics parses the errors in the output of the go toolchain, or of cargo with --message-format=short. Files are made relative to dir when
+// they are within it. Indented lines continue the message of the previous error, and other lines, e.g. the
+// # package headers, are skipped.
+func ParseDiagnostics(output, dir string) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, "\t") && len(diagnostics) > 0 {
+			last := &diagnostics[len(diagnostics)-1]
+			last.Message += "\n" + strings.TrimSpace(line)
+			continue
+		}
+
+		match := diagnosticLine.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		d := Diagnostic{File: match[1], Message: match[4]}
+		d.Line, _ = strconv.Atoi(match[2])
+		d.Column, _ = strconv.Atoi(match[3])
+		if dir != "" && filepath.IsAbs(d.File) {
+			if rel, err := filepath.Rel(dir, d.File); err == nil && !strings.HasPrefix(rel, "..") {
+				d.File = rel
+			}
+		}
+		d.File = filepath.ToSlash(strings.TrimPrefix(d.File, "./"))
+		diagnostics = append(diagnostics, d)
+	}
+
+	return diagnostics
+}
+
+// buildError wraps the error of a build step in a BuildError when its output has diagnostics, and otherwise
+// returns it as it is.
+func buildError(err error, dir string) error {
+	var buildErr *BuildError
+	if err == nil || errors.As(err, &buildErr) {
+		return err
+	}
+
+	diagnostics := ParseDiagnostics(err.Error(), dir)
+	if len(diagnostics) == 0 {
+		return err
+	}
+	return &BuildError{Output: err.Error(), Diagnostics: diagnostics}
+}
+
+// buildFailure returns the error of a compile tool for the model: the diagnostics as JSON when there are any,
+// so that it can fix the exact lines, and otherwise the output of the step.
+func buildFailure(step string, err error) error {
+	var buildErr *BuildError
+	if errors.As(err, &buildErr) {
+		data, jsonErr := marshalJSON(struct {
+			Diagnostics []Diagnostic `json:"diagnostics"`
+		}{buildErr.Diagnostics})
+		if jsonErr == nil {
+			return fmt.Errorf("error while %s: %s", step, data)
+		}
+	}
+	return fmt.Errorf("error while %s: %s", step, err)
+}
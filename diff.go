@@ -0,0 +1,160 @@
+package framework
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines around each change in a unified diff.
+const diffContext = 3
+
+// DiffOp is one line of a diff: ' ' when the line is in both texts, '-' when it was removed from the old
+// one, and '+' when it was added to the new one.
+type DiffOp struct {
+	Kind byte
+	Line string
+}
+
+// DiffLines returns the shortest edit script from the lines of a to the lines of b, see Myers' O(ND) algorithm.
+func DiffLines(a, b []string) []DiffOp {
+	n, m := len(a), len(b)
+	maxD := n + m
+	offset := maxD + 1
+	v := make([]int, 2*maxD+2)
+	var trace [][]int
+
+	for d := 0; d <= maxD; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackDiff(a, b, trace, offset, d)
+			}
+		}
+	}
+
+	return nil
+}
+
+// backtrackDiff walks the trace of DiffLines back from the end to build the edit script.
+func backtrackDiff(a, b []string, trace [][]int, offset, d int) []DiffOp {
+	ops := make([]DiffOp, 0, len(a)+len(b))
+	x, y := len(a), len(b)
+	for ; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, DiffOp{' ', a[x]})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, DiffOp{'+', b[y]})
+		} else {
+			x--
+			ops = append(ops, DiffOp{'-', a[x]})
+		}
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// UnifiedDiff returns the changes from a to b in the unified format of diff -u, or an empty string when
+// they are the same.
+func UnifiedDiff(oldName, newName, a, b string) string {
+	if a == b {
+		return ""
+	}
+
+	ops := DiffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	_, _ = fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+
+	// the line numbers in a and b before each op
+	oldLine, newLine := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, op := range ops {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if op.Kind != '+' {
+			oldLine[i+1]++
+		}
+		if op.Kind != '-' {
+			newLine[i+1]++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].Kind == ' ' {
+			i++
+			continue
+		}
+
+		// extend the hunk while the next change is close enough to share context
+		start := max(i-diffContext, 0)
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].Kind != ' ' {
+				end = j + 1
+			} else if j-end >= 2*diffContext {
+				break
+			}
+		}
+		end = min(end+diffContext, len(ops))
+
+		_, _ = fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(oldLine[start], oldLine[end]-oldLine[start]), hunkRange(newLine[start], newLine[end]-newLine[start]))
+		for _, op := range ops[start:end] {
+			out.WriteByte(op.Kind)
+			out.WriteString(op.Line)
+			out.WriteByte('\n')
+		}
+		i = end
+	}
+
+	return out.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
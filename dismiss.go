@@ -0,0 +1,141 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// cardDismissal is a card that a user dismissed, until a time when it was snoozed.
+type cardDismissal struct {
+	Until time.Time `json:"until,omitempty"`
+}
+
+func (d cardDismissal) active(now time.Time) bool {
+	return d.Until.IsZero() || now.Before(d.Until)
+}
+
+// dismissOperation serves the __dismiss operation, whose payload has the card and optionally the seconds
+// to snooze it for, one of its snooze durations. Without them the card is dismissed for good. Dismissals
+// are per user, the User-Id header of the request.
+func (e *Extension) dismissOperation(ctx context.Context, payload string) (string, error) {
+	var request struct {
+		Card   string `json:"card"`
+		Snooze int64  `json:"snooze"`
+	}
+	err := json.Unmarshal([]byte(payload), &request)
+	if err != nil {
+		return "", fmt.Errorf("error while unmarshaling dismissal: %w", err)
+	}
+
+	var card *ExtensionCard
+	for i := range e.Cards {
+		if e.Cards[i].ID == request.Card {
+			card = &e.Cards[i]
+			break
+		}
+	}
+	if card == nil {
+		return "", fmt.Errorf("unknown card: %s", request.Card)
+	}
+
+	var dismissal cardDismissal
+	if request.Snooze > 0 {
+		snooze := time.Duration(request.Snooze) * time.Second
+		allowed := false
+		for _, d := range card.Snooze {
+			allowed = allowed || d == snooze
+		}
+		if !allowed {
+			return "", fmt.Errorf("card %s can't be snoozed for %s", card.ID, snooze)
+		}
+		dismissal.Until = time.Now().Add(snooze)
+	} else if !card.Dismissible {
+		return "", fmt.Errorf("card %s can't be dismissed", card.ID)
+	}
+
+	user := RequestMeta(ctx).UserID
+	dismissals, err := e.loadDismissals()
+	if err != nil {
+		return "", err
+	}
+	if dismissals[user] == nil {
+		dismissals[user] = make(map[string]cardDismissal)
+	}
+	dismissals[user][card.ID] = dismissal
+
+	// forget the snoozes that are over
+	now := time.Now()
+	for _, cards := range dismissals {
+		for id, d := range cards {
+			if !d.active(now) {
+				delete(cards, id)
+			}
+		}
+	}
+
+	err = e.saveDismissals(dismissals)
+	if err != nil {
+		return "", err
+	}
+
+	LoggerFrom(ctx).Info("card dismissed", "card", card.ID, "until", dismissal.Until)
+	return `{"dismissed":true}`, nil
+}
+
+// dismissedCards returns the cards that the user of the request dismissed or snoozed. The dismissals only
+// hide cards, so an error is logged rather than failing describe.
+func (e *Extension) dismissedCards(ctx context.Context) map[string]bool {
+	dismissed := make(map[string]bool)
+
+	dismissals, err := e.loadDismissals()
+	if err != nil {
+		LoggerFrom(ctx).Error("error while loading card dismissals", "error", err.Error())
+		return dismissed
+	}
+
+	now := time.Now()
+	for id, d := range dismissals[RequestMeta(ctx).UserID] {
+		if d.active(now) {
+			dismissed[id] = true
+		}
+	}
+	return dismissed
+}
+
+func (e *Extension) dismissalsKey() string {
+	return storageKey("data", e.ID, "dismissed.json")
+}
+
+func (e *Extension) loadDismissals() (map[string]map[string]cardDismissal, error) {
+	dismissals := make(map[string]map[string]cardDismissal)
+	data, err := CurrentStorage().Read(e.dismissalsKey())
+	if errors.Is(err, os.ErrNotExist) {
+		return dismissals, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while reading card dismissals: %w", err)
+	}
+
+	err = json.Unmarshal(data, &dismissals)
+	if err != nil {
+		return nil, fmt.Errorf("error while unmarshaling card dismissals: %w", err)
+	}
+	return dismissals, nil
+}
+
+func (e *Extension) saveDismissals(dismissals map[string]map[string]cardDismissal) error {
+	data, err := json.MarshalIndent(dismissals, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error while marshaling card dismissals: %w", err)
+	}
+
+	err = CurrentStorage().Write(e.dismissalsKey(), data)
+	if err != nil {
+		return fmt.Errorf("error while writing card dismissals: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package framework
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var ErrDownloadTooLarge = errors.New("download too large")
+
+type DownloadOptions struct {
+	// AllowHosts are the hosts files can be downloaded from, e.g. "go.dev" or "*.github.com". The network
+	// policy applies too.
+	AllowHosts []string
+	// MaxSize is the largest file in bytes. Defaults to 100 MiB.
+	MaxSize int64
+}
+
+// downloadFile downloads a URL into a file within the safeDir. The download goes to a .part file first,
+// which a retry with a sha256 resumes with a range request.
+func downloadFile(safeDir string, options DownloadOptions) ToolContextFunction {
+	if options.MaxSize == 0 {
+		options.MaxSize = 100 << 20
+	}
+
+	return func(ctx context.Context, payload string) (string, error) {
+		var request struct {
+			URL    string `json:"url"`
+			Name   string `json:"name"`
+			SHA256 string `json:"sha256"`
+		}
+		err := json.Unmarshal([]byte(payload), &request)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while unmarshaling payload", "error", err.Error())
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+		}
+
+		u, err := url.Parse(request.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+			LoggerFrom(ctx).Error("invalid download url", "url", request.URL)
+			return "", fmt.Errorf("invalid download url: %s", request.URL)
+		}
+		err = checkDownloadHost(options.AllowHosts, u)
+		if err != nil {
+			LoggerFrom(ctx).Error("download host is not allowed", "url", request.URL)
+			return "", err
+		}
+		if request.Name == "" {
+			request.Name = filepath.Base(u.Path)
+		}
+
+		filename, err := safePath(safeDir, "", request.Name)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while getting safe path", "error", err.Error())
+			return "", fmt.Errorf("error while getting safe path: %w", err)
+		}
+		absSafeDir, err := filepath.Abs(safeDir)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while getting absolute path", "safeDir", safeDir, "error", err.Error())
+			return "", fmt.Errorf("error while getting absolute path at %s: %w", safeDir, err)
+		}
+		if sameDir(absSafeDir, filename) {
+			LoggerFrom(ctx).Error("download name is the safe directory", "url", request.URL, "name", request.Name)
+			return "", ModelError("the download has no file name: "+request.URL, "pass the name of the file to download into")
+		}
+		err = os.MkdirAll(filepath.Dir(filename), workspaceDirPerm)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while making the download directory", "dir", filepath.Dir(filename), "error", err.Error())
+			return "", fmt.Errorf("error while making the download directory at %s: %w", filepath.Dir(filename), err)
+		}
+
+		// a part is only resumed when the checksum can tell whether it's of the same file
+		part := filename + ".part"
+		size, err := fetchDownload(ctx, request.URL, part, request.SHA256 != "", options)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while downloading file", "url", request.URL, "error", err.Error())
+			return "", err
+		}
+
+		sum, err := fileSHA256(part)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while hashing download", "filename", part, "error", err.Error())
+			return "", fmt.Errorf("error while hashing download: %w", err)
+		}
+		if request.SHA256 != "" && !strings.EqualFold(sum, request.SHA256) {
+			_ = os.Remove(part)
+			LoggerFrom(ctx).Error("checksum mismatch", "url", request.URL, "expected", request.SHA256, "actual", sum)
+			return "", fmt.Errorf("checksum mismatch for %s: expected %s, got %s", request.URL, request.SHA256, sum)
+		}
+
+		err = os.Rename(part, filename)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while renaming download", "filename", filename, "error", err.Error())
+			return "", fmt.Errorf("error while renaming download to %s: %w", filename, err)
+		}
+
+		LoggerFrom(ctx).Debug("file downloaded successfully", "url", request.URL, "filename", filename, "size", size)
+		return fmt.Sprintf("downloaded %s (%d bytes, sha256 %s)", request.Name, size, sum), nil
+	}
+}
+
+// fetchDownload downloads into part, resuming from its size when resume is true, and returns the size of the
+// complete file.
+func fetchDownload(ctx context.Context, rawURL, part string, resume bool, options DownloadOptions) (int64, error) {
+	var offset int64
+	if info, err := os.Stat(part); err == nil && resume {
+		offset = info.Size()
+	}
+
+	client := *HTTPClient()
+	client.CheckRedirect = func(r *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return checkDownloadHost(options.AllowHosts, r.URL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error while creating request: %w", err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error while downloading %s: %w", rawURL, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	flags := os.O_WRONLY | os.O_CREATE
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		start, ok := contentRangeStart(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			_ = os.Remove(part)
+			return 0, fmt.Errorf("error while downloading %s: the range starts at %q instead of %d", rawURL, resp.Header.Get("Content-Range"), offset)
+		}
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// the part is already complete
+		return offset, nil
+	case resp.StatusCode == http.StatusOK:
+		// the server ignored the range, start over
+		flags |= os.O_TRUNC
+		offset = 0
+	default:
+		return 0, fmt.Errorf("error while downloading %s: %s", rawURL, resp.Status)
+	}
+	if resp.ContentLength > 0 && offset+resp.ContentLength > options.MaxSize {
+		return 0, fmt.Errorf("%w: %s is %d bytes, the limit is %d", ErrDownloadTooLarge, rawURL, offset+resp.ContentLength, options.MaxSize)
+	}
+
+	f, err := os.OpenFile(part, flags, workspaceFilePerm)
+	if err != nil {
+		return 0, fmt.Errorf("error while opening %s: %w", part, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	n, err := io.Copy(f, io.LimitReader(resp.Body, options.MaxSize-offset+1))
+	if err != nil {
+		// the part is kept, so the next try resumes
+		return 0, fmt.Errorf("error while downloading %s: %w", rawURL, err)
+	}
+	if offset+n > options.MaxSize {
+		_ = f.Close()
+		_ = os.Remove(part)
+		return 0, fmt.Errorf("%w: %s is more than %d bytes", ErrDownloadTooLarge, rawURL, options.MaxSize)
+	}
+	err = f.Sync()
+	if err != nil {
+		return 0, fmt.Errorf("error while syncing %s: %w", part, err)
+	}
+	return offset + n, nil
+}
+
+// contentRangeStart returns the first byte of a Content-Range header like "bytes 100-199/200".
+func contentRangeStart(header string) (int64, bool) {
+	r, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	first, _, ok := strings.Cut(r, "-")
+	if !ok {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(strings.TrimSpace(first), 10, 64)
+	return start, err == nil
+}
+
+func checkDownloadHost(allowHosts []string, u *url.URL) error {
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if len(allowHosts) > 0 && !hostMatches(allowHosts, host) {
+		return fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+	}
+	return nil
+}
+
+func fileSHA256(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
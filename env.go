@@ -0,0 +1,87 @@
+package framework
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// EnvPolicy decides the environment of the commands a tool or action runs, e.g. compile or a shell handler, so
+// that secrets in the environment of the host don't leak into subprocesses the model triggers. Without a policy
+// commands inherit the whole environment, and an empty policy gives them none.
+type EnvPolicy struct {
+	// Allow holds the names of the variables passed through from the environment. A name ending in * matches
+	// a prefix, e.g. LC_* or GO*.
+	Allow []string `toml:"allow,omitempty"`
+	// Set holds variables set explicitly, overriding the ones passed through.
+	Set map[string]string `toml:"set,omitempty"`
+}
+
+// DefaultEnvAllow is enough for most commands, go builds included, without passing tokens or credentials.
+//
+//goland:noinspection GoUnusedGlobalVariable
+var DefaultEnvAllow = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TMPDIR", "TMP", "TEMP", "LANG", "LC_*", "TZ", "XDG_*", "GO*",
+	"SystemRoot", "SystemDrive", "ComSpec", "PATHEXT", "USERPROFILE", "APPDATA", "LOCALAPPDATA",
+}
+
+// Environ returns the environment for a command in the format of os.Environ, or nil to inherit it when p is nil.
+func (p *EnvPolicy) Environ() []string {
+	if p == nil {
+		return nil
+	}
+
+	env := make([]string, 0, len(p.Allow)+len(p.Set))
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if _, ok := p.Set[name]; ok || !envAllowed(p.Allow, name) {
+			continue
+		}
+		env = append(env, kv)
+	}
+	for name, value := range p.Set {
+		env = append(env, name+"="+value)
+	}
+
+	return env
+}
+
+func envAllowed(allow []string, name string) bool {
+	// variable names are case-insensitive on windows
+	equal := func(a, b string) bool { return a == b }
+	if runtime.GOOS == "windows" {
+		equal = strings.EqualFold
+	}
+
+	for _, pattern := range allow {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if len(name) >= len(prefix) && equal(name[:len(prefix)], prefix) {
+				return true
+			}
+		} else if equal(name, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+type envPolicyKey struct{}
+
+// withEnvPolicy makes the commands run with ctx use the policy, unless it is nil.
+func withEnvPolicy(ctx context.Context, policy *EnvPolicy) context.Context {
+	if policy == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, envPolicyKey{}, policy)
+}
+
+// Command is like exec.CommandContext, with the environment the EnvPolicy of the running tool or action allows.
+func Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	if policy, ok := ctx.Value(envPolicyKey{}).(*EnvPolicy); ok {
+		cmd.Env = policy.Environ()
+	}
+	return cmd
+}
@@ -1,15 +1,18 @@
 package framework
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/spcoder/jarbles-framework/lib"
+	"html/template"
 	"io"
 	"log/slog"
 	"os"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 type ExtensionResponse struct {
@@ -19,39 +22,67 @@ type ExtensionResponse struct {
 	Subject   string `json:"subject,omitempty"`
 	TextBody  string `json:"text_body,omitempty"`
 	NoLayout  bool   `json:"no_layout,omitempty"`
+	// ContentType tells the host how to render the response, e.g. ContentTypeMarkdown. Body has the output of
+	// the content types without a field of their own, markdown and JSON.
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body,omitempty"`
+	// Annotations are the sources and confidence of the response, in a section of their own.
+	Annotations *Annotations `json:"annotations,omitempty"`
+	// Parts are rendered by the host in order, after the fields above.
+	Parts []ResponsePart `json:"parts,omitempty"`
 }
 
 type ExtensionFunction func(payload string) (*ExtensionResponse, error)
-
-type ExtensionAction struct {
-	ID          string
-	Index       int
-	Name        string
-	Description string
-	Function    ActionFunction
-	Extension   *Extension
-	URLPath     string
-	Cron        string
-}
-
-type ExtensionCommand struct {
-	ID        string
-	Extension *Extension
-	Function  CommandFunction
-}
+type ExtensionContextFunction func(ctx context.Context, payload string) (*ExtensionResponse, error)
 
 type ExtensionCard struct {
 	ID   string `json:"id"`
 	HTML string `json:"html"`
+	// Icon is the name of an icon of lib, see lib.IconNames.
+	Icon string `json:"icon,omitempty"`
+	// Weight orders the cards with SortCards, the lightest first.
+	Weight int `json:"-"`
+	// Hidden is called at describe time and leaves the card out when it returns true, e.g. based on the config.
+	Hidden func() bool `json:"-"`
+	// Render regenerates the HTML of a live card, for describe and for the card events of Serve.
+	Render func() (string, error) `json:"-"`
+	// Dismissible cards can be dismissed by the user for good, and cards with Snooze durations for one of
+	// them, with the __dismiss operation.
+	Dismissible bool            `json:"-"`
+	Snooze      []time.Duration `json:"-"`
+}
+
+// html returns the HTML of the card, regenerated when it's live. A live card that fails to render shows the error.
+func (c ExtensionCard) html() string {
+	if c.Render == nil {
+		return c.HTML
+	}
+
+	html, err := c.Render()
+	if err != nil {
+		LogError("error while rendering card", "id", c.ID, "error", err.Error())
+		return template.HTMLEscapeString(err.Error())
+	}
+	return html
 }
 
 type Extension struct {
-	ID          string
-	Name        string
-	Description string
-	Cards       []ExtensionCard
-	actions     map[string]ExtensionAction
-	commands    map[string]ExtensionCommand
+	ID           string
+	Name         string
+	Description  string
+	Cards        []ExtensionCard
+	operations   map[operationKey]Operation
+	scheduled    map[string]ExtensionFunction
+	scheduledMu  sync.Mutex
+	jobHandlers  map[string]jobHandler
+	jobsMu       sync.Mutex
+	serveMu      sync.Mutex
+	stylesheets  []string
+	dependencies []Dependency
+	settings     []Setting
+
+	describedActions  map[string]jarblesExtensionAction
+	describedCommands map[string]jarblesExtensionCommand
 }
 
 type NewExtensionOptions struct {
@@ -61,6 +92,7 @@ type NewExtensionOptions struct {
 
 func NewExtension(options NewExtensionOptions) Extension {
 	id := slugify(options.Name)
+	setConfigID(id)
 
 	return Extension{
 		ID:          id,
@@ -69,6 +101,10 @@ func NewExtension(options NewExtensionOptions) Extension {
 	}
 }
 
+func (e *Extension) DataDir() (string, error) {
+	return DataDir(e.ID)
+}
+
 func (e *Extension) String() string {
 	return fmt.Sprintf("(%s)", e.ID)
 }
@@ -78,11 +114,17 @@ type AddCardOptions struct {
 	ActionID    string
 	Title       string
 	Description string
+	Icon        string
+	Weight      int
+	Hidden      func() bool
 }
 
 func (e *Extension) AddCard(options AddCardOptions) {
 	e.Cards = append(e.Cards, ExtensionCard{
-		ID: options.ID,
+		ID:     options.ID,
+		Icon:   options.Icon,
+		Weight: options.Weight,
+		Hidden: options.Hidden,
 		HTML: lib.CardDefault(lib.CardDefaultOptions{
 			ExtensionName: e.Name,
 			Title:         options.Title,
@@ -96,60 +138,123 @@ func (e *Extension) AddCardCustom(card ExtensionCard) {
 	e.Cards = append(e.Cards, card)
 }
 
+func snoozeSeconds(durations []time.Duration) []int64 {
+	var seconds []int64
+	for _, d := range durations {
+		seconds = append(seconds, int64(d/time.Second))
+	}
+	return seconds
+}
+
+// SortCards orders the cards by weight. Cards with the same weight keep the order they were added in.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (e *Extension) SortCards() {
+	sort.SliceStable(e.Cards, func(i, j int) bool {
+		return e.Cards[i].Weight < e.Cards[j].Weight
+	})
+}
+
+// AddStylesheet adds CSS for the custom cards of the extension. The host includes the stylesheet once, scoped
+// to the cards of the extension, which it wraps in an element with a data-jarbles-extension attribute. Use the
+// theme tokens of lib for colors and spacing to match the host.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (e *Extension) AddStylesheet(css string) {
+	e.stylesheets = append(e.stylesheets, css)
+}
+
 type AddActionOptions struct {
 	ID       string
 	Function ExtensionFunction
+	Latency  string
+	Cost     string
+	Estimate EstimateFunction
+	Budget   string
+	// ContentType is what the action usually returns, for the host to know before it runs the action.
+	ContentType string
+	// ContextFunction is called instead of Function when set, e.g. to get the Uploads of the request.
+	ContextFunction ExtensionContextFunction
+	// Uploads lets the host send files the user uploaded to the action, see Uploads. They are checked against
+	// the rules before the action runs.
+	Uploads *UploadRules
+	// Env is the environment of the commands the action runs with Command, see EnvPolicy.
+	Env *EnvPolicy
 }
 
 func (e *Extension) AddAction(options AddActionOptions) {
-	e.addAction(ExtensionAction{
+	e.addOperation(Operation{
+		Kind:        OperationAction,
 		ID:          slugify(options.ID),
-		Index:       len(e.actions),
+		Index:       e.operationsOfKind(OperationAction),
 		Name:        options.ID,
 		Description: options.ID,
-		Function: func(payload string) (string, error) {
-			response, err := options.Function(payload)
-			if err != nil {
-				return "", err
+		ContextFunction: func(ctx context.Context, payload string) (string, error) {
+			if options.Uploads != nil {
+				err := checkUploads(ctx, *options.Uploads)
+				if err != nil {
+					return "", err
+				}
+			}
+
+			var response *ExtensionResponse
+			var err error
+			if options.ContextFunction != nil {
+				response, err = options.ContextFunction(ctx, payload)
+			} else {
+				response, err = options.Function(payload)
 			}
-			data, err := json.Marshal(response)
 			if err != nil {
-				return "", fmt.Errorf("error while marshaling response: %w", err)
+				return "", err
 			}
-			return string(data), nil
+			return marshalResponse(response)
 		},
-		Extension: e,
-		URLPath:   fmt.Sprintf("/extension/action/%s/%s", e.ID, options.ID),
+		Extension:   e,
+		URLPath:     fmt.Sprintf("/extension/action/%s/%s", e.ID, options.ID),
+		Latency:     options.Latency,
+		Cost:        options.Cost,
+		Estimate:    options.Estimate,
+		Budget:      options.Budget,
+		ContentType: options.ContentType,
+		Uploads:     options.Uploads,
+		Env:         options.Env,
 	})
 }
 
 type AddCommandOptions struct {
-	ID       string
-	Function CommandFunction
+	ID                string
+	Function          CommandFunction
+	Arguments         []ToolArguments
+	RequiredArguments []string
+	Cron              string
+	TimeZone          string
 }
 
 func (e *Extension) AddCommand(options AddCommandOptions) {
-	e.addCommand(ExtensionCommand{
-		ID: slugify(options.ID),
-		Function: func(payload string) error {
-			err := options.Function(payload)
-			if err != nil {
-				return err
-			}
-			return nil
+	e.addOperation(Operation{
+		Kind: OperationCommand,
+		ID:   slugify(options.ID),
+		Function: func(payload string) (string, error) {
+			return "", options.Function(payload)
 		},
-		Extension: e,
+		Extension:         e,
+		Arguments:         options.Arguments,
+		RequiredArguments: options.RequiredArguments,
+		Cron:              options.Cron,
+		TimeZone:          options.TimeZone,
 	})
 }
 
 type AddCronOptions struct {
 	ID       string
 	Cron     string
+	TimeZone string
 	Function ExtensionFunction
 }
 
 func (e *Extension) AddCron(options AddCronOptions) {
-	e.addAction(ExtensionAction{
+	e.addOperation(Operation{
+		Kind:        OperationAction,
 		ID:          slugify(options.ID),
 		Index:       -1,
 		Name:        options.ID,
@@ -159,25 +264,30 @@ func (e *Extension) AddCron(options AddCronOptions) {
 			if err != nil {
 				return "", err
 			}
-			data, err := json.Marshal(response)
-			if err != nil {
-				return "", fmt.Errorf("error while marshaling response: %w", err)
-			}
-			return string(data), nil
+			return marshalResponse(response)
 		},
 		Extension: e,
 		URLPath:   fmt.Sprintf("/extension/action/%s/%s", e.ID, options.ID),
 		Cron:      options.Cron,
+		TimeZone:  options.TimeZone,
 	})
 }
 
+// marshalResponse marshals the response of an action, adapted to what the host supports.
+func marshalResponse(response *ExtensionResponse) (string, error) {
+	data, err := json.Marshal(adaptResponse(response, CurrentHost()))
+	if err != nil {
+		return "", fmt.Errorf("error while marshaling response: %w", err)
+	}
+	return string(data), nil
+}
+
 func (e *Extension) ActionById(id string) *ExtensionAction {
-	for _, action := range e.actions {
-		if action.ID == id {
-			return &action
-		}
+	action, ok := e.operations[operationKey{OperationAction, id}]
+	if !ok {
+		return nil
 	}
-	return nil
+	return &action
 }
 
 func (e *Extension) ActionUrl(id string) string {
@@ -188,22 +298,8 @@ func (e *Extension) ActionUrl(id string) string {
 	return ""
 }
 
-func (e *Extension) addAction(v ExtensionAction) {
-	if e.actions == nil {
-		e.actions = make(map[string]ExtensionAction)
-	}
-	e.actions[v.ID] = v
-}
-
-func (e *Extension) addCommand(v ExtensionCommand) {
-	if e.commands == nil {
-		e.commands = make(map[string]ExtensionCommand)
-	}
-	e.commands[v.ID] = v
-}
-
 func (e *Extension) Respond() {
-	fmt.Printf(e.execute(os.Stdin))
+	fmt.Print(e.execute(os.Stdin))
 }
 
 func (e *Extension) Test(r io.Reader) string {
@@ -211,50 +307,47 @@ func (e *Extension) Test(r io.Reader) string {
 }
 
 func (e *Extension) execute(r io.Reader) string {
-	var err error
-	logger, err = NewLibLogger(e, "extensions.log")
+	l, err := NewLibLogger(e, "extensions.log")
 	if err != nil {
 		return fmt.Sprintf("error while creating logger: %s", err.Error())
 	}
-	defer func(l *slog.Logger) {
-		h, ok := logger.Handler().(LibLogger)
+	ctx := withRequest(context.Background(), l)
+	defer func(rl *slog.Logger) {
+		if logger.CompareAndSwap(rl, nopLogger) {
+			slog.SetDefault(defaultLogger)
+		}
+		h, ok := l.Handler().(*LibLogger)
 		if ok {
 			_ = h.Close()
 		}
-	}(logger)
-
-	slog.SetDefault(logger)
+	}(LoggerFrom(ctx))
 
-	scanner := bufio.NewScanner(r)
+	logger.Store(LoggerFrom(ctx))
+	slog.SetDefault(LoggerFrom(ctx))
+	setConfigID(e.ID)
 
-	// grab the operation id
-	scanner.Scan()
-	operationId := scanner.Text()
-
-	// skip payload delimiter
-	scanner.Scan()
-
-	// read the json payload
-	var lines []string
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
-	}
-	if scanner.Err() != nil {
-		return fmt.Sprintf("error while scanning: %s", scanner.Err())
+	request, err := ParseRequest(r)
+	if err != nil {
+		LoggerFrom(ctx).Error("parse request", "error", err.Error())
+		return fmt.Sprintf("error while parsing request: %s", err)
 	}
+	defer useRequestProfile(request)()
 
-	// add newlines back
-	payload := strings.Join(lines, "\n")
+	ctx, cancel := withRequestMeta(ctx, request)
+	defer cancel()
+	defer flushUsage(ctx)
+	ctx = withProgress(ctx, RequestIDFrom(ctx), request.Operation)
+	defer clearProgress(RequestIDFrom(ctx))
 
 	// route the request and output the response
-	output, err := e.route(operationId, payload)
+	output, err := routeSafely(ctx, e.ID, request, e.route)
 	if err != nil {
-		logger.Log(context.Background(), slog.LevelDebug-1, "operation response", "error", err.Error())
+		LoggerFrom(ctx).Log(ctx, slog.LevelDebug-1, "operation response", "error", err.Error())
 		return err.Error()
 	}
 
-	logger.Log(context.Background(), slog.LevelDebug-1, "operation response", "output", output)
-	return output
+	LoggerFrom(ctx).Log(ctx, slog.LevelDebug-1, "operation response", "output", output)
+	return compressOutput(request, output)
 }
 
 // Payload builds a payload from an action and data. This is useful for testing.
@@ -262,90 +355,151 @@ func (e *Extension) Payload(action, data string) io.Reader {
 	return strings.NewReader(action + "\n\n" + data)
 }
 
-func (e *Extension) route(operationId, payload string) (string, error) {
+func (e *Extension) route(ctx context.Context, operationId, payload string) (string, error) {
 	switch operationId {
 	case "describe":
-		return e.describe()
-	default:
-		for _, action := range e.actions {
-			if action.ID == operationId {
-				logger.Info("calling action", "name", action.ID)
-				logger.Debug("calling action", "payload", payload)
-				return action.Function(payload)
-			}
+		LoggerFrom(ctx).Debug("describe called")
+		err := handshake(payload)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while saving user profile", "error", err.Error())
 		}
-		for _, command := range e.commands {
-			if command.ID == operationId {
-				logger.Info("calling command", "name", command.ID)
-				logger.Debug("calling command", "payload", payload)
-				return "", command.Function(payload)
-			}
+		return e.describe(ctx)
+	case "__flags":
+		return flagsOperation(payload)
+	case "__settings":
+		return settingsOperation(payload)
+	case "__config-get":
+		return configGetOperation()
+	case "__config-set":
+		return configSetOperation(payload)
+	case "__progress":
+		return progressOperation(payload)
+	case "__scheduled":
+		return e.runScheduled(ctx)
+	case "__jobs":
+		return e.jobsOperation()
+	case "__jobs_run":
+		return e.runDueJobs(ctx)
+	case "__click":
+		return e.click(ctx, payload)
+	case "__dismiss":
+		return e.dismissOperation(ctx, payload)
+	case "__crashes":
+		return crashesOperation(e.ID, payload)
+	case "__preflight":
+		return e.preflightOperation()
+	case "__handshake":
+		return handshakeOperation(payload)
+	case "__estimate":
+		return estimateOperation(payload, func(name string) (string, string, EstimateFunction, bool) {
+			op, ok := e.operation(name)
+			return op.Latency, op.Cost, op.Estimate, ok
+		})
+	default:
+		op, ok := e.operation(operationId)
+		if !ok {
+			return "", fmt.Errorf("unknown operation: %s", operationId)
 		}
-		return "", fmt.Errorf("unknown operation: %s", operationId)
+		return op.call(ctx, payload)
 	}
 }
 
-// transforms the extension struct to a jarbles compatible one, and then returns the marshaled json
-func (e *Extension) describe() (string, error) {
-	logger.Debug("describe called")
-
-	type JarblesExtensionAction struct {
-		Id          string `json:"id"`
-		Index       int    `json:"index"`
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		Cron        string `json:"cron"`
-		CronSummary string `json:"cronSummary"`
-	}
+type jarblesExtensionAction struct {
+	Id          string              `json:"id"`
+	Index       int                 `json:"index"`
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Cron        string              `json:"cron"`
+	CronSummary string              `json:"cronSummary"`
+	TimeZone    string              `json:"timeZone,omitempty"`
+	Latency     string              `json:"latency,omitempty"`
+	Cost        string              `json:"cost,omitempty"`
+	Estimable   bool                `json:"estimable,omitempty"`
+	ContentType string              `json:"contentType,omitempty"`
+	Parameters  *functionParameters `json:"parameters,omitempty"`
+	Uploads     *jarblesUploads     `json:"uploads,omitempty"`
+}
 
-	type JarblesExtensionCommand struct {
-		Id string `json:"id"`
-	}
+type jarblesExtensionCommand struct {
+	Id         string              `json:"id"`
+	Parameters *functionParameters `json:"parameters,omitempty"`
+	Cron       string              `json:"cron,omitempty"`
+	TimeZone   string              `json:"timeZone,omitempty"`
+	Latency    string              `json:"latency,omitempty"`
+	Cost       string              `json:"cost,omitempty"`
+	Estimable  bool                `json:"estimable,omitempty"`
+}
 
-	type JarblesExtensionCard struct {
-		Id   string `json:"id"`
-		Html string `json:"html"`
-	}
+type jarblesExtensionCard struct {
+	Id            string  `json:"id"`
+	Index         int     `json:"index"`
+	Html          string  `json:"html"`
+	Icon          string  `json:"icon,omitempty"`
+	Dismissible   bool    `json:"dismissible,omitempty"`
+	SnoozeSeconds []int64 `json:"snoozeSeconds,omitempty"`
+}
 
-	type JarblesExtension struct {
-		Id          string                             `json:"id"`
-		Name        string                             `json:"name"`
-		Description string                             `json:"description"`
-		Actions     map[string]JarblesExtensionAction  `json:"actions"`
-		Commands    map[string]JarblesExtensionCommand `json:"commands"`
-		Cards       []JarblesExtensionCard             `json:"cards"`
-	}
+type jarblesExtension struct {
+	Id           string                             `json:"id"`
+	Name         string                             `json:"name"`
+	Description  string                             `json:"description"`
+	TimeZone     string                             `json:"timeZone,omitempty"`
+	Actions      map[string]jarblesExtensionAction  `json:"actions"`
+	Commands     map[string]jarblesExtensionCommand `json:"commands"`
+	Cards        []jarblesExtensionCard             `json:"cards"`
+	Scheduled    []jarblesExtensionScheduled        `json:"scheduled"`
+	Stylesheet   string                             `json:"stylesheet,omitempty"`
+	Dependencies []Dependency                       `json:"dependencies,omitempty"`
+	Settings     []Setting                          `json:"settings,omitempty"`
+}
 
-	je := JarblesExtension{
-		Id:          e.ID,
-		Name:        e.Name,
-		Description: e.Description,
-		Actions:     make(map[string]JarblesExtensionAction),
-		Commands:    make(map[string]JarblesExtensionCommand),
-		Cards:       make([]JarblesExtensionCard, 0),
-	}
-	for _, op := range e.actions {
-		je.Actions[op.ID] = JarblesExtensionAction{
-			Id:          op.ID,
-			Index:       op.Index,
-			Name:        op.Name,
-			Description: op.Description,
-			Cron:        op.Cron,
+// transforms the extension struct to a jarbles compatible one, and then returns the marshaled json
+// the action and command maps are only rebuilt after an action or command is added
+func (e *Extension) describe(ctx context.Context) (string, error) {
+	if e.describedActions == nil || e.describedCommands == nil {
+		e.describedActions = make(map[string]jarblesExtensionAction)
+		e.describedCommands = make(map[string]jarblesExtensionCommand)
+		for _, op := range e.operations {
+			switch op.Kind {
+			case OperationAction:
+				e.describedActions[op.ID] = op.describeAction()
+			case OperationCommand:
+				e.describedCommands[op.ID] = op.describeCommand()
+			}
 		}
 	}
-	for _, op := range e.commands {
-		je.Commands[op.ID] = JarblesExtensionCommand{
-			Id: op.ID,
-		}
+
+	je := jarblesExtension{
+		Id:           e.ID,
+		Name:         e.Name,
+		Description:  e.Description,
+		TimeZone:     describeTimeZone(defaultTimeZone()),
+		Actions:      e.describedActions,
+		Commands:     e.describedCommands,
+		Cards:        make([]jarblesExtensionCard, 0, len(e.Cards)),
+		Scheduled:    e.describeScheduled(),
+		Dependencies: e.dependencies,
+		Settings:     e.settings,
 	}
+	if len(e.stylesheets) > 0 {
+		je.Stylesheet = fmt.Sprintf("[data-jarbles-extension=%q] {\n%s\n}\n", e.ID, strings.Join(e.stylesheets, "\n"))
+	}
+	dismissed := e.dismissedCards(ctx)
 	for _, card := range e.Cards {
-		je.Cards = append(je.Cards, JarblesExtensionCard{
-			Id:   card.ID,
-			Html: card.HTML,
+		if card.Hidden != nil && card.Hidden() || dismissed[card.ID] {
+			continue
+		}
+		je.Cards = append(je.Cards, jarblesExtensionCard{
+			Id:            card.ID,
+			Index:         len(je.Cards),
+			Html:          card.html(),
+			Icon:          card.Icon,
+			Dismissible:   card.Dismissible,
+			SnoozeSeconds: snoozeSeconds(card.Snooze),
 		})
 	}
 
-	data, err := json.Marshal(je)
+	data, err := marshalJSON(je)
 	if err != nil {
 		return "", fmt.Errorf("error while marshaling: %w", err)
 	}
@@ -0,0 +1,60 @@
+package framework
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func benchmarkExtension(b *testing.B) *Extension {
+	b.Helper()
+	b.Setenv("JARBLES_HOME", b.TempDir())
+
+	e := NewExtension(NewExtensionOptions{Name: "Benchmark Extension", Description: "an extension with many actions"})
+	for i := 0; i < 50; i++ {
+		e.AddAction(AddActionOptions{
+			ID: fmt.Sprintf("action-%d", i),
+			Function: func(payload string) (*ExtensionResponse, error) {
+				return &ExtensionResponse{HTMLBody: payload}, nil
+			},
+		})
+		e.AddCommand(AddCommandOptions{
+			ID: fmt.Sprintf("command-%d", i),
+			Function: func(payload string) error {
+				return nil
+			},
+		})
+	}
+	for i := 0; i < 10; i++ {
+		e.AddCard(AddCardOptions{ID: fmt.Sprintf("card-%d", i), Title: "Card", Description: "the description of a card"})
+	}
+	return &e
+}
+
+func BenchmarkExtensionDescribe(b *testing.B) {
+	e := benchmarkExtension(b)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := e.route(ctx, "describe", "")
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExtensionRoute(b *testing.B) {
+	e := benchmarkExtension(b)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := e.route(ctx, "command-49", `{"city":"Paris"}`)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
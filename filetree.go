@@ -0,0 +1,240 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spcoder/jarbles-framework/lib"
+)
+
+// Types of a FileNode.
+const (
+	FileTypeFile    string = "file"
+	FileTypeDir     string = "dir"
+	FileTypeSymlink string = "symlink"
+)
+
+// FileNode is a file or a directory in the results of list, search, and workspace actions, so models and
+// hosts get the same structure from all of them. Paths are relative to the root and use forward slashes.
+type FileNode struct {
+	Path     string     `json:"path"`
+	Type     string     `json:"type"`
+	Size     int64      `json:"size,omitempty"`
+	ModTime  *time.Time `json:"mod_time,omitempty"`
+	Children []FileNode `json:"children,omitempty"`
+	// Truncated is set on the root when the listing stopped at its limit.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// FileTree walks root into a tree of FileNode with Walk. The root node has the path ".".
+//
+//goland:noinspection GoUnusedExportedFunction
+func FileTree(ctx context.Context, root string, options WalkOptions) (FileNode, error) {
+	entries, truncated, err := Walk(ctx, root, options)
+	if err != nil {
+		return FileNode{}, err
+	}
+
+	nodes := map[string]*FileNode{".": {Path: ".", Type: FileTypeDir}}
+	for _, entry := range entries {
+		node := &FileNode{Path: entry.Path, Type: entry.Type, Size: entry.Size}
+		if !entry.ModTime.IsZero() {
+			// seconds are precise enough for a model and keep the listing short
+			modTime := entry.ModTime.Truncate(time.Second)
+			node.ModTime = &modTime
+		}
+		nodes[entry.Path] = node
+	}
+
+	tree := buildFileTree(nodes)
+	if options.Glob != "" {
+		tree = pruneFileTree(tree)
+	}
+	tree.Truncated = truncated
+	return tree, nil
+}
+
+// pruneFileTree removes the directories without files.
+func pruneFileTree(node FileNode) FileNode {
+	children := node.Children[:0]
+	for _, child := range node.Children {
+		if child.Type == FileTypeDir {
+			child = pruneFileTree(child)
+			if len(child.Children) == 0 {
+				continue
+			}
+		}
+		children = append(children, child)
+	}
+	node.Children = children
+	return node
+}
+
+// FileTreeFromPaths builds a tree from a flat list of file paths, e.g. the matches of a search, adding their
+// directories. The sizes of the files are unknown.
+//
+//goland:noinspection GoUnusedExportedFunction
+func FileTreeFromPaths(paths []string) FileNode {
+	nodes := map[string]*FileNode{".": {Path: ".", Type: FileTypeDir}}
+	for _, p := range paths {
+		p = path.Clean(filepath.ToSlash(p))
+		nodes[p] = &FileNode{Path: p, Type: FileTypeFile}
+		for dir := path.Dir(p); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if _, ok := nodes[dir]; ok {
+				break
+			}
+			nodes[dir] = &FileNode{Path: dir, Type: FileTypeDir}
+		}
+	}
+	return buildFileTree(nodes)
+}
+
+// buildFileTree links the nodes to their parents, directories first and then by name.
+func buildFileTree(nodes map[string]*FileNode) FileNode {
+	paths := make([]string, 0, len(nodes))
+	for p := range nodes {
+		paths = append(paths, p)
+	}
+	// the deepest nodes are linked first, so their parents copy complete children
+	slices.SortFunc(paths, func(a, b string) int {
+		return strings.Count(b, "/") - strings.Count(a, "/")
+	})
+
+	for _, p := range paths {
+		if p == "." {
+			continue
+		}
+		node := nodes[p]
+		slices.SortFunc(node.Children, compareFileNodes)
+		parent := nodes[path.Dir(p)]
+		if parent == nil {
+			parent = nodes["."]
+		}
+		parent.Children = append(parent.Children, *node)
+	}
+
+	root := nodes["."]
+	slices.SortFunc(root.Children, compareFileNodes)
+	return *root
+}
+
+func compareFileNodes(a, b FileNode) int {
+	if (a.Type == FileTypeDir) != (b.Type == FileTypeDir) {
+		if a.Type == FileTypeDir {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a.Path, b.Path)
+}
+
+// Name returns the last element of the path.
+func (n FileNode) Name() string {
+	return path.Base(n.Path)
+}
+
+// Files returns the paths of the files in the tree, in order.
+func (n FileNode) Files() []string {
+	var files []string
+	if n.Type != FileTypeDir {
+		files = append(files, n.Path)
+	}
+	for _, child := range n.Children {
+		files = append(files, child.Files()...)
+	}
+	return files
+}
+
+// String renders the tree as indented text, which models read more easily than JSON.
+func (n FileNode) String() string {
+	var sb strings.Builder
+	n.writeTo(&sb, 0)
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func (n FileNode) writeTo(sb *strings.Builder, depth int) {
+	sb.WriteString(strings.Repeat("  ", depth))
+	sb.WriteString(n.Name())
+	switch n.Type {
+	case FileTypeDir:
+		sb.WriteString("/")
+	case FileTypeSymlink:
+		sb.WriteString(" -> symlink")
+	default:
+		if n.Size > 0 {
+			sb.WriteString(fmt.Sprintf(" (%d bytes)", n.Size))
+		}
+	}
+	sb.WriteString("\n")
+	for _, child := range n.Children {
+		child.writeTo(sb, depth+1)
+	}
+}
+
+// HTML renders the tree with lib.FileTree for a card or a response.
+func (n FileNode) HTML(options lib.FileTreeOptions) string {
+	return lib.FileTree(n.lib(), options)
+}
+
+func (n FileNode) lib() lib.FileNode {
+	node := lib.FileNode{Path: n.Path, Name: n.Name(), Type: n.Type, Size: n.Size}
+	for _, child := range n.Children {
+		node.Children = append(node.Children, child.lib())
+	}
+	return node
+}
+
+func listFiles(root string) ToolContextFunction {
+	return func(ctx context.Context, payload string) (string, error) {
+		var request struct {
+			Dir   string `json:"dir"`
+			Depth int    `json:"depth"`
+			Glob  string `json:"glob"`
+		}
+		if strings.TrimSpace(payload) != "" {
+			err := json.Unmarshal([]byte(payload), &request)
+			if err != nil {
+				LoggerFrom(ctx).Error("error while unmarshaling payload", "error", err.Error())
+				return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+			}
+		}
+
+		dir, err := safeDir(root, request.Dir)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while getting safe directory", "error", err.Error())
+			return "", fmt.Errorf("error while getting safe directory: %w", err)
+		}
+		if _, err := os.Stat(dir); err != nil {
+			LoggerFrom(ctx).Error("error while reading directory", "dir", dir, "error", err.Error())
+			return "", fmt.Errorf("error while reading directory at %s: %w", dir, err)
+		}
+
+		ignore, err := loadIgnoreFor(root, dir)
+		if err != nil {
+			return "", err
+		}
+		tree, err := FileTree(ctx, dir, WalkOptions{
+			MaxEntries: WalkMaxEntries,
+			MaxDepth:   request.Depth,
+			Ignore:     ignore,
+			Glob:       request.Glob,
+		})
+		if err != nil {
+			return "", err
+		}
+
+		data, err := marshalJSON(tree)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while marshaling file tree", "error", err.Error())
+			return "", fmt.Errorf("error while marshaling file tree: %w", err)
+		}
+		return string(data), nil
+	}
+}
@@ -0,0 +1,402 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrRateLimited is returned by a QuoteProvider when the upstream API refuses a request because of rate limits.
+var ErrRateLimited = errors.New("rate limited by provider")
+
+type FXRate struct {
+	Base  string    `json:"base"`
+	Quote string    `json:"quote"`
+	Rate  float64   `json:"rate"`
+	Time  time.Time `json:"time"`
+}
+
+type StockQuote struct {
+	Symbol   string    `json:"symbol"`
+	Price    float64   `json:"price"`
+	Change   float64   `json:"change"`
+	Currency string    `json:"currency,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// QuoteProvider is implemented by sources of exchange rates and equity quotes.
+// A provider that doesn't support one of the lookups should return an error from it.
+type QuoteProvider interface {
+	Name() string
+	FXRate(ctx context.Context, base, quote string) (FXRate, error)
+	StockQuote(ctx context.Context, symbol string) (StockQuote, error)
+}
+
+type NewCachedQuoteProviderOptions struct {
+	Provider    QuoteProvider
+	TTL         time.Duration
+	MinInterval time.Duration
+}
+
+// NewCachedQuoteProvider wraps a provider with a file cache under ~/.jarbles/cache/quotes.
+// Cached values are returned until the TTL expires, upstream calls are spaced at least MinInterval apart,
+// and stale values are served when the provider reports ErrRateLimited.
+//
+//goland:noinspection GoUnusedExportedFunction
+func NewCachedQuoteProvider(options NewCachedQuoteProviderOptions) QuoteProvider {
+	if options.TTL == 0 {
+		options.TTL = 5 * time.Minute
+	}
+
+	return &cachedQuoteProvider{
+		provider:    options.Provider,
+		ttl:         options.TTL,
+		minInterval: options.MinInterval,
+		filename:    filepath.Join(profileDir("cache", "quotes"), slugify(options.Provider.Name())+".json"),
+	}
+}
+
+type quoteCacheEntry struct {
+	Value   json.RawMessage `json:"value"`
+	Fetched time.Time       `json:"fetched"`
+}
+
+type quoteCache struct {
+	LastCall time.Time                  `json:"last_call"`
+	Entries  map[string]quoteCacheEntry `json:"entries"`
+}
+
+type cachedQuoteProvider struct {
+	provider    QuoteProvider
+	ttl         time.Duration
+	minInterval time.Duration
+	filename    string
+}
+
+func (c *cachedQuoteProvider) Name() string {
+	return c.provider.Name()
+}
+
+func (c *cachedQuoteProvider) FXRate(ctx context.Context, base, quote string) (FXRate, error) {
+	var rate FXRate
+	key := "fx:" + strings.ToUpper(base) + ":" + strings.ToUpper(quote)
+	err := c.lookup(ctx, key, &rate, func() (any, error) {
+		return c.provider.FXRate(ctx, base, quote)
+	})
+	return rate, err
+}
+
+func (c *cachedQuoteProvider) StockQuote(ctx context.Context, symbol string) (StockQuote, error) {
+	var sq StockQuote
+	key := "stock:" + strings.ToUpper(symbol)
+	err := c.lookup(ctx, key, &sq, func() (any, error) {
+		return c.provider.StockQuote(ctx, symbol)
+	})
+	return sq, err
+}
+
+func (c *cachedQuoteProvider) lookup(ctx context.Context, key string, v any, fetch func() (any, error)) error {
+	cache := c.load(ctx)
+	entry, cached := cache.Entries[key]
+
+	if cached && time.Since(entry.Fetched) < c.ttl {
+		LoggerFrom(ctx).Debug("quote cache hit", "key", key)
+		return json.Unmarshal(entry.Value, v)
+	}
+
+	if cached && time.Since(cache.LastCall) < c.minInterval {
+		LoggerFrom(ctx).Debug("quote provider called too recently, serving stale value", "key", key)
+		return json.Unmarshal(entry.Value, v)
+	}
+
+	cache.LastCall = time.Now()
+	value, err := fetch()
+	if err != nil {
+		c.save(ctx, cache)
+		if cached && errors.Is(err, ErrRateLimited) {
+			LoggerFrom(ctx).Warn("quote provider rate limited, serving stale value", "key", key, "fetched", entry.Fetched)
+			return json.Unmarshal(entry.Value, v)
+		}
+		return err
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("error while marshaling quote: %w", err)
+	}
+	cache.Entries[key] = quoteCacheEntry{Value: data, Fetched: time.Now()}
+	c.save(ctx, cache)
+
+	return json.Unmarshal(data, v)
+}
+
+func (c *cachedQuoteProvider) load(ctx context.Context) quoteCache {
+	cache := quoteCache{Entries: make(map[string]quoteCacheEntry)}
+	data, err := os.ReadFile(c.filename)
+	if err != nil {
+		return cache
+	}
+
+	err = json.Unmarshal(data, &cache)
+	if err != nil {
+		LoggerFrom(ctx).Warn("ignoring unreadable quote cache", "filename", c.filename, "error", err.Error())
+		return quoteCache{Entries: make(map[string]quoteCacheEntry)}
+	}
+	if cache.Entries == nil {
+		cache.Entries = make(map[string]quoteCacheEntry)
+	}
+
+	return cache
+}
+
+func (c *cachedQuoteProvider) save(ctx context.Context, cache quoteCache) {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		LoggerFrom(ctx).Error("error while marshaling quote cache", "error", err.Error())
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(c.filename), privateDirPerm)
+	if err != nil {
+		LoggerFrom(ctx).Error("error while creating quote cache directory", "filename", c.filename, "error", err.Error())
+		return
+	}
+
+	err = os.WriteFile(c.filename, data, privateFilePerm)
+	if err != nil {
+		LoggerFrom(ctx).Error("error while writing quote cache", "filename", c.filename, "error", err.Error())
+	}
+}
+
+// NewFrankfurterProvider returns a keyless provider for ECB reference exchange rates. It does not support stock quotes.
+//
+//goland:noinspection GoUnusedExportedFunction
+func NewFrankfurterProvider() QuoteProvider {
+	return frankfurterProvider{}
+}
+
+type frankfurterProvider struct{}
+
+func (p frankfurterProvider) Name() string {
+	return "frankfurter"
+}
+
+func (p frankfurterProvider) FXRate(ctx context.Context, base, quote string) (FXRate, error) {
+	base = strings.ToUpper(base)
+	quote = strings.ToUpper(quote)
+
+	query := url.Values{"from": {base}, "to": {quote}}
+	var response struct {
+		Date  string             `json:"date"`
+		Rates map[string]float64 `json:"rates"`
+	}
+	err := quoteGetJSON(ctx, "https://api.frankfurter.app/latest?"+query.Encode(), &response)
+	if err != nil {
+		return FXRate{}, err
+	}
+
+	rate, ok := response.Rates[quote]
+	if !ok {
+		return FXRate{}, fmt.Errorf("no rate returned for %s/%s", base, quote)
+	}
+
+	date, _ := time.Parse(time.DateOnly, response.Date)
+	return FXRate{Base: base, Quote: quote, Rate: rate, Time: date}, nil
+}
+
+func (p frankfurterProvider) StockQuote(_ context.Context, _ string) (StockQuote, error) {
+	return StockQuote{}, fmt.Errorf("stock quotes are not supported by the frankfurter provider")
+}
+
+// NewAlphaVantageProvider returns a provider backed by the Alpha Vantage API, supporting both exchange rates and stock quotes.
+//
+//goland:noinspection GoUnusedExportedFunction
+func NewAlphaVantageProvider(apiKey string) QuoteProvider {
+	return alphaVantageProvider{apiKey: apiKey}
+}
+
+type alphaVantageProvider struct {
+	apiKey string
+}
+
+func (p alphaVantageProvider) Name() string {
+	return "alphavantage"
+}
+
+func (p alphaVantageProvider) FXRate(ctx context.Context, base, quote string) (FXRate, error) {
+	base = strings.ToUpper(base)
+	quote = strings.ToUpper(quote)
+
+	var response struct {
+		Note        string            `json:"Note"`
+		Information string            `json:"Information"`
+		Rate        map[string]string `json:"Realtime Currency Exchange Rate"`
+	}
+	err := quoteGetJSON(ctx, p.url(url.Values{
+		"function":      {"CURRENCY_EXCHANGE_RATE"},
+		"from_currency": {base},
+		"to_currency":   {quote},
+	}), &response)
+	if err != nil {
+		return FXRate{}, err
+	}
+	if response.Note != "" || response.Information != "" {
+		return FXRate{}, fmt.Errorf("%w: %s%s", ErrRateLimited, response.Note, response.Information)
+	}
+
+	rate, err := strconv.ParseFloat(response.Rate["5. Exchange Rate"], 64)
+	if err != nil {
+		return FXRate{}, fmt.Errorf("error while parsing exchange rate for %s/%s: %w", base, quote, err)
+	}
+
+	updated, _ := time.Parse(time.DateTime, response.Rate["6. Last Refreshed"])
+	return FXRate{Base: base, Quote: quote, Rate: rate, Time: updated}, nil
+}
+
+func (p alphaVantageProvider) StockQuote(ctx context.Context, symbol string) (StockQuote, error) {
+	symbol = strings.ToUpper(symbol)
+
+	var response struct {
+		Note        string            `json:"Note"`
+		Information string            `json:"Information"`
+		Quote       map[string]string `json:"Global Quote"`
+	}
+	err := quoteGetJSON(ctx, p.url(url.Values{
+		"function": {"GLOBAL_QUOTE"},
+		"symbol":   {symbol},
+	}), &response)
+	if err != nil {
+		return StockQuote{}, err
+	}
+	if response.Note != "" || response.Information != "" {
+		return StockQuote{}, fmt.Errorf("%w: %s%s", ErrRateLimited, response.Note, response.Information)
+	}
+
+	price, err := strconv.ParseFloat(response.Quote["05. price"], 64)
+	if err != nil {
+		return StockQuote{}, fmt.Errorf("error while parsing price for %s: %w", symbol, err)
+	}
+	change, _ := strconv.ParseFloat(response.Quote["09. change"], 64)
+	day, _ := time.Parse(time.DateOnly, response.Quote["07. latest trading day"])
+
+	return StockQuote{Symbol: symbol, Price: price, Change: change, Time: day}, nil
+}
+
+func (p alphaVantageProvider) url(query url.Values) string {
+	query.Set("apikey", p.apiKey)
+	return "https://www.alphavantage.co/query?" + query.Encode()
+}
+
+func quoteGetJSON(ctx context.Context, rawURL string, v any) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	// the errors of url.Parse and the client have the URL, whose query holds the api key
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return fmt.Errorf("error while creating request: %w", withoutURL(err))
+	}
+
+	resp, err := HTTPClient().Do(request)
+	if err != nil {
+		err = withoutURL(err)
+		LoggerFrom(ctx).Error("error fetching quote", "url", withoutQuery(request.URL), "error", err.Error())
+		return fmt.Errorf("error fetching quote from %s: %w", withoutQuery(request.URL), err)
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return ErrRateLimited
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status while fetching quote: %s", resp.Status)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		return fmt.Errorf("error while decoding quote response: %w", err)
+	}
+
+	return nil
+}
+
+// withoutURL returns the cause of a *url.Error, which is err without the URL.
+func withoutURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+// withoutQuery returns the URL without its query and credentials.
+func withoutQuery(u *url.URL) string {
+	stripped := *u
+	stripped.User = nil
+	stripped.RawQuery = ""
+	stripped.ForceQuery = false
+	return stripped.Redacted()
+}
+
+func fxRate(provider QuoteProvider) ToolContextFunction {
+	return func(ctx context.Context, payload string) (string, error) {
+		var request struct {
+			Base  string `json:"base"`
+			Quote string `json:"quote"`
+		}
+		err := json.Unmarshal([]byte(payload), &request)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while unmarshaling payload", "error", err.Error())
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+		}
+
+		LoggerFrom(ctx).Debug("fx-rate", "provider", provider.Name(), "base", request.Base, "quote", request.Quote)
+
+		rate, err := provider.FXRate(ctx, request.Base, request.Quote)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while getting exchange rate", "base", request.Base, "quote", request.Quote, "error", err.Error())
+			return "", fmt.Errorf("error while getting exchange rate for %s/%s: %w", request.Base, request.Quote, err)
+		}
+
+		data, err := json.Marshal(rate)
+		if err != nil {
+			return "", fmt.Errorf("error while marshaling exchange rate: %w", err)
+		}
+		return string(data), nil
+	}
+}
+
+func stockQuote(provider QuoteProvider) ToolContextFunction {
+	return func(ctx context.Context, payload string) (string, error) {
+		symbol, ok := PayloadGetString(payload, "symbol", "")
+		if !ok {
+			LoggerFrom(ctx).Error("symbol parameter is missing")
+			return "", fmt.Errorf("symbol parameter is missing")
+		}
+
+		LoggerFrom(ctx).Debug("stock-quote", "provider", provider.Name(), "symbol", symbol)
+
+		quote, err := provider.StockQuote(ctx, symbol)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while getting stock quote", "symbol", symbol, "error", err.Error())
+			return "", fmt.Errorf("error while getting stock quote for %s: %w", symbol, err)
+		}
+
+		data, err := json.Marshal(quote)
+		if err != nil {
+			return "", fmt.Errorf("error while marshaling stock quote: %w", err)
+		}
+		return string(data), nil
+	}
+}
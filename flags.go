@@ -0,0 +1,94 @@
+package framework
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const flagConfigPrefix = "flags."
+
+var (
+	flagsMu  sync.Mutex
+	flagDefs = make(map[string]bool)
+)
+
+type flagState struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Default bool   `json:"default"`
+}
+
+// Flag reports whether a feature flag is enabled, falling back to defaultValue when it was never toggled.
+// Flags are persisted in the config under flags.<name> and can be listed and toggled by the host through
+// the __flags operation, so experimental tools and actions can ship dark and be enabled per install:
+//
+//	if framework.Flag("web-search", false) {
+//		assistant.AddTool(webSearch)
+//	}
+//
+//goland:noinspection GoUnusedExportedFunction
+func Flag(name string, defaultValue bool) bool {
+	flagsMu.Lock()
+	flagDefs[name] = defaultValue
+	flagsMu.Unlock()
+
+	value, ok := ConfigGet(flagConfigPrefix + name)
+	if !ok {
+		return defaultValue
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return defaultValue
+	}
+
+	return enabled
+}
+
+// flagsOperation lists the known flags, or toggles one when the payload has a name and enabled field.
+func flagsOperation(payload string) (string, error) {
+	var request struct {
+		Name    string `json:"name"`
+		Enabled *bool  `json:"enabled"`
+	}
+	if payload != "" {
+		err := json.Unmarshal([]byte(payload), &request)
+		if err != nil {
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+		}
+	}
+
+	if request.Name != "" && request.Enabled != nil {
+		LogInfo("toggling flag", "name", request.Name, "enabled", *request.Enabled)
+		err := ConfigSet(flagConfigPrefix+request.Name, strconv.FormatBool(*request.Enabled))
+		if err != nil {
+			return "", fmt.Errorf("error while saving flag %s: %w", request.Name, err)
+		}
+	}
+
+	flagsMu.Lock()
+	names := make([]string, 0, len(flagDefs))
+	for name := range flagDefs {
+		names = append(names, name)
+	}
+	flagsMu.Unlock()
+	sort.Strings(names)
+
+	states := make([]flagState, 0, len(names))
+	for _, name := range names {
+		flagsMu.Lock()
+		defaultValue := flagDefs[name]
+		flagsMu.Unlock()
+
+		states = append(states, flagState{Name: name, Enabled: Flag(name, defaultValue), Default: defaultValue})
+	}
+
+	data, err := json.Marshal(states)
+	if err != nil {
+		return "", fmt.Errorf("error while marshaling flags: %w", err)
+	}
+	return string(data), nil
+}
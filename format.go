@@ -0,0 +1,185 @@
+package framework
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The config keys of explicit paths to the formatters used by the format-code tool.
+const (
+	configKeyPrettierPath = "prettier_path"
+	configKeyBlackPath    = "black_path"
+)
+
+// formatterExtensions maps the file extensions to the formatter of the format-code tool.
+var formatterExtensions = map[string]string{
+	".go":   "goimports",
+	".js":   "prettier",
+	".jsx":  "prettier",
+	".mjs":  "prettier",
+	".ts":   "prettier",
+	".tsx":  "prettier",
+	".css":  "prettier",
+	".scss": "prettier",
+	".less": "prettier",
+	".html": "prettier",
+	".vue":  "prettier",
+	".json": "prettier",
+	".md":   "prettier",
+	".yaml": "prettier",
+	".yml":  "prettier",
+	".py":   "black",
+	".pyi":  "black",
+}
+
+// SetPrettierPath stores the path of the prettier binary in the config of the running assistant or extension.
+//
+//goland:noinspection GoUnusedExportedFunction
+func SetPrettierPath(path string) error {
+	return ConfigSet(configKeyPrettierPath, path)
+}
+
+// SetBlackPath stores the path of the black binary in the config of the running assistant or extension.
+//
+//goland:noinspection GoUnusedExportedFunction
+func SetBlackPath(path string) error {
+	return ConfigSet(configKeyBlackPath, path)
+}
+
+// FormatCode formats the source code of the file at filename, which doesn't have to exist, with goimports,
+// prettier, or black depending on its extension. Go files fall back to gofmt without goimports. Prettier is
+// also looked up in node_modules/.bin of the directories above the file.
+func FormatCode(ctx context.Context, filename string, src []byte) ([]byte, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	formatter, ok := formatterExtensions[ext]
+	if !ok {
+		return nil, fmt.Errorf("no formatter for %s files", ext)
+	}
+
+	var path string
+	var args []string
+	var err error
+	switch formatter {
+	case "goimports":
+		path, err = GoimportsPath()
+		if err != nil {
+			var goPath string
+			goPath, err = GoPath()
+			path = filepath.Join(filepath.Dir(goPath), executableName("gofmt"))
+		}
+	case "prettier":
+		path, err = resolveToolchain(configKeyPrettierPath, "prettier", nodeModulesBins(filepath.Dir(filename)))
+		args = []string{"--stdin-filepath", filename}
+	case "black":
+		path, err = resolveToolchain(configKeyBlackPath, "black", userBins())
+		args = []string{"--quiet", "--stdin-filename", filename, "-"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := toolchainCommand(ctx, path, args...)
+	cmd.Dir = filepath.Dir(filename)
+	cmd.Stdin = bytes.NewReader(src)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	LoggerFrom(ctx).Info("running command", "command", cmd)
+	err = cmd.Run()
+	if err != nil {
+		LoggerFrom(ctx).Error("error while formatting", "command", cmd, "stderr", stderr.String(), "error", err.Error())
+		if stderr.Len() > 0 {
+			// gofmt and goimports don't know the name of the file on standard input
+			output := strings.ReplaceAll(stderr.String(), "<standard input>", filepath.Base(filename))
+			return nil, buildError(fmt.Errorf("%s", output), filepath.Dir(filename))
+		}
+		return nil, fmt.Errorf("error while running %s: %w", formatter, err)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// nodeModulesBins returns node_modules/.bin in dir and the directories above it.
+func nodeModulesBins(dir string) []string {
+	var dirs []string
+	for {
+		dirs = append(dirs, filepath.Join(dir, "node_modules", ".bin"))
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dirs
+		}
+		dir = parent
+	}
+}
+
+// userBins returns the directories where pip and pipx install commands for the user.
+func userBins() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	return []string{filepath.Join(home, ".local", "bin")}
+}
+
+func formatCode(safeDir string) ToolContextFunction {
+	return func(ctx context.Context, payload string) (string, error) {
+		var request struct {
+			Dir   string `json:"dir"`
+			Name  string `json:"name"`
+			Check bool   `json:"check"`
+		}
+		err := json.Unmarshal([]byte(payload), &request)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while unmarshaling payload", "error", err.Error())
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+		}
+
+		filename, err := safePath(safeDir, request.Dir, request.Name)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while getting safe path", "error", err.Error())
+			return "", fmt.Errorf("error while getting safe path: %w", err)
+		}
+
+		info, err := os.Stat(filename)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while reading file", "filename", filename, "error", err.Error())
+			return "", fmt.Errorf("error while reading file at %s: %w", filename, err)
+		}
+
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while reading file", "filename", filename, "error", err.Error())
+			return "", fmt.Errorf("error while reading file at %s: %w", filename, err)
+		}
+
+		formatted, err := FormatCode(ctx, filename, src)
+		if err != nil {
+			return "", buildFailure("formatting", err)
+		}
+
+		diff := UnifiedDiff(request.Name, request.Name, string(src), string(formatted))
+		if diff == "" {
+			return "the file is already formatted", nil
+		}
+
+		if !request.Check {
+			err = os.WriteFile(filename, formatted, info.Mode().Perm())
+			if err != nil {
+				LoggerFrom(ctx).Error("error while writing file", "filename", filename, "error", err.Error())
+				return "", fmt.Errorf("error while writing file at %s: %s", filename, err)
+			}
+		}
+
+		return diff, nil
+	}
+}
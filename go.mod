@@ -1,10 +1,20 @@
 module github.com/spcoder/jarbles-framework
 
-go 1.22
+go 1.22.0
 
 require (
 	github.com/BurntSushi/toml v1.3.2
 	github.com/spcoder/rumble v0.8.0
+	github.com/tetratelabs/wazero v1.8.2
+	go.starlark.net v0.0.0-20240705175910-70002002b310
+	golang.org/x/crypto v0.33.0
+	golang.org/x/tools v0.30.0
+)
+
+require (
+	golang.org/x/mod v0.23.0 // indirect
+	golang.org/x/sync v0.11.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
 )
 
 replace github.com/spcoder/rumble v0.8.0 => ../rumble
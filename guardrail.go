@@ -0,0 +1,31 @@
+package framework
+
+import (
+	"context"
+	"fmt"
+)
+
+// BeforeReturnFunction gets the name of a tool and its output before the model sees it, and returns the output
+// to pass on, e.g. scrubbed or truncated, or an error to withhold it.
+type BeforeReturnFunction func(tool, output string) (string, error)
+
+// OnBeforeReturn adds a hook that every successful tool output goes through before it's returned to the model,
+// to scrub, validate, or veto it, e.g. when it contains a secret or is too large. Hooks run in the order they
+// were added, each gets the output of the one before, and the first error stops the output.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (a *Assistant) OnBeforeReturn(f BeforeReturnFunction) {
+	a.beforeReturn = append(a.beforeReturn, f)
+}
+
+func (a *Assistant) guardOutput(ctx context.Context, tool, output string) (string, error) {
+	for _, f := range a.beforeReturn {
+		var err error
+		output, err = f(tool, output)
+		if err != nil {
+			LoggerFrom(ctx).Warn("tool output withheld", "name", tool, "error", err.Error())
+			return "", fmt.Errorf("the output of %s was withheld: %w", tool, err)
+		}
+	}
+	return output, nil
+}
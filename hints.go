@@ -0,0 +1,71 @@
+package framework
+
+import (
+	"strings"
+)
+
+// ToolHint declares where a tool fits in multi-turn tool use, e.g. that search-files comes before read-file or
+// that compile follows save-file. Hints are described as metadata for the host and appended to the
+// instructions for the model.
+type ToolHint struct {
+	Tool string `json:"tool" toml:"tool"`
+	// After are the tools to call before Tool, e.g. to find what it works on.
+	After []string `json:"after,omitempty" toml:"after,omitempty"`
+	// Then are the tools to call after Tool, e.g. to check what it changed.
+	Then []string `json:"then,omitempty" toml:"then,omitempty"`
+	// Note explains the hint, or is one that doesn't fit After and Then.
+	Note string `json:"note,omitempty" toml:"note,omitempty"`
+}
+
+// String returns the hint as an instruction, e.g. "Before read-file, call search-files."
+func (h ToolHint) String() string {
+	var sentences []string
+	if len(h.After) > 0 {
+		sentences = append(sentences, "Before "+h.Tool+", call "+joinToolNames(h.After)+".")
+	}
+	if len(h.Then) > 0 {
+		sentences = append(sentences, "After "+h.Tool+", call "+joinToolNames(h.Then)+".")
+	}
+	if h.Note != "" {
+		note := strings.TrimSpace(h.Note)
+		if len(sentences) == 0 {
+			note = h.Tool + ": " + note
+		}
+		sentences = append(sentences, note)
+	}
+	return strings.Join(sentences, " ")
+}
+
+func joinToolNames(names []string) string {
+	if len(names) <= 2 {
+		return strings.Join(names, " and ")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + ", and " + names[len(names)-1]
+}
+
+// AddToolHint declares the order of tool calls around a tool, which the model otherwise has to guess from the
+// descriptions. Lint warns about hints that refer to unknown tools.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (a *Assistant) AddToolHint(hint ToolHint) {
+	a.description.ToolHints = append(a.description.ToolHints, hint)
+	a.described = nil
+}
+
+// withToolHints appends the hints to the instructions as a list.
+func withToolHints(instructions string, hints []ToolHint) string {
+	var sb strings.Builder
+	for _, hint := range hints {
+		if s := hint.String(); s != "" {
+			sb.WriteString("\n- " + s)
+		}
+	}
+	if sb.Len() == 0 {
+		return instructions
+	}
+
+	if instructions != "" {
+		instructions = strings.TrimRight(instructions, "\n") + "\n\n"
+	}
+	return instructions + "Tool use:" + sb.String()
+}
@@ -0,0 +1,331 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+type HTTPOptions struct {
+	// AllowHosts are the only hosts requests can be made to, e.g. "api.github.com" or "*.example.com", and "*"
+	// allows every host. No host is allowed when it's empty. The network policy applies too.
+	AllowHosts []string
+	// MaxSize is the most bytes of a response body that are returned, the rest is cut. Defaults to 1 MiB.
+	MaxSize int64
+	// Timeout limits the whole request, redirects included. Defaults to 30 seconds.
+	Timeout time.Duration
+}
+
+func (o HTTPOptions) withDefaults() HTTPOptions {
+	if o.MaxSize <= 0 {
+		o.MaxSize = 1 << 20
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 30 * time.Second
+	}
+	return o
+}
+
+// checkHTTPURL returns the URL when it's http or https and its host is allowed.
+func (o HTTPOptions) checkHTTPURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, ModelError("invalid url: "+rawURL, "pass a full http or https URL, e.g. https://example.com/page")
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if len(o.AllowHosts) == 0 {
+		return nil, withHint(fmt.Errorf("%w: %s", ErrHostNotAllowed, host), "no hosts are allowed, don't use this tool")
+	}
+	if !hostMatches(o.AllowHosts, host) {
+		return nil, withHint(fmt.Errorf("%w: %s", ErrHostNotAllowed, host), "use a URL of one of the allowed hosts: "+strings.Join(o.AllowHosts, ", "))
+	}
+	return u, nil
+}
+
+// client returns HTTPClient with the timeout, which checks the host of every redirect too.
+func (o HTTPOptions) client() *http.Client {
+	client := *HTTPClient()
+	client.Timeout = o.Timeout
+	client.CheckRedirect = func(r *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		_, err := o.checkHTTPURL(r.URL.String())
+		return err
+	}
+	return &client
+}
+
+// readHTTPBody reads up to maxSize bytes of the body and reports whether there was more.
+func readHTTPBody(body io.Reader, maxSize int64) ([]byte, bool, error) {
+	data, err := io.ReadAll(io.LimitReader(body, maxSize+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(data)) > maxSize {
+		return data[:maxSize], true, nil
+	}
+	return data, false, nil
+}
+
+func httpGet(options HTTPOptions) ToolContextFunction {
+	options = options.withDefaults()
+
+	return func(ctx context.Context, payload string) (string, error) {
+		rawURL, _ := PayloadGetString(payload, "url", "")
+		u, err := options.checkHTTPURL(rawURL)
+		if err != nil {
+			LoggerFrom(ctx).Error("url is not allowed", "url", rawURL, "error", err.Error())
+			return "", err
+		}
+
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return "", fmt.Errorf("error while creating request: %w", err)
+		}
+		response, err := options.client().Do(request)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while fetching url", "url", u.Redacted(), "error", err.Error())
+			return "", fmt.Errorf("error while fetching %s: %w", u.Redacted(), err)
+		}
+		defer func() { _ = response.Body.Close() }()
+
+		body, truncated, err := readHTTPBody(response.Body, options.MaxSize)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while reading response body", "url", u.Redacted(), "error", err.Error())
+			return "", fmt.Errorf("error while reading response body: %w", err)
+		}
+		if response.StatusCode < 200 || response.StatusCode > 299 {
+			LoggerFrom(ctx).Error("unexpected status", "url", u.Redacted(), "status", response.Status)
+			return "", fmt.Errorf("error while fetching %s: %s: %s", u.Redacted(), response.Status, firstRunes(string(body), 500))
+		}
+
+		contentType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+		if contentType == "" {
+			contentType, _, _ = strings.Cut(http.DetectContentType(body), ";")
+		}
+		if !textMIME(contentType) {
+			return "", withHint(fmt.Errorf("%w: %s is %s, not text", ErrUnsupportedMIME, u.Redacted(), contentType), "only text can be fetched, look for a text or HTML version of the page")
+		}
+
+		text := string(body)
+		if markdown, _ := PayloadGetBool(payload, "markdown", false); markdown && contentType == ContentTypeHTML {
+			text = HTMLToMarkdown(text)
+		}
+		if truncated {
+			// the cut may split a rune
+			text = strings.ToValidUTF8(text, "")
+			text += fmt.Sprintf("\n\n[the response was cut at %d bytes]", options.MaxSize)
+		}
+		return text, nil
+	}
+}
+
+var defaultHTTPMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+type HTTPRequestOptions struct {
+	HTTPOptions
+	// Methods are the methods the model can use. Defaults to GET, HEAD, POST, PUT, PATCH, and DELETE.
+	Methods []string
+	// BearerTokenKey is the config key of a token that is sent as Authorization: Bearer, e.g. one declared
+	// with AddSetting as a secret, so the model never sees it.
+	BearerTokenKey string
+	// BasicAuthUserKey and BasicAuthPasswordKey are the config keys of the user and password of basic
+	// authentication.
+	BasicAuthUserKey     string
+	BasicAuthPasswordKey string
+	// AuthHosts are the hosts the credentials are sent to, in the format of AllowHosts. The credentials aren't
+	// sent to any other host, nor kept on a redirect to one, so none are sent when it's empty.
+	AuthHosts []string
+	// ResponseHeaders are the headers of the response that are returned to the model. Defaults to
+	// defaultHTTPResponseHeaders, which leaves out cookies and the like.
+	ResponseHeaders []string
+}
+
+// defaultHTTPResponseHeaders are the response headers http-request returns unless ResponseHeaders is set.
+var defaultHTTPResponseHeaders = []string{
+	"Allow", "Cache-Control", "Content-Disposition", "Content-Encoding", "Content-Language", "Content-Length",
+	"Content-Type", "Date", "ETag", "Expires", "Last-Modified", "Link", "Location", "Retry-After",
+}
+
+// HTTPResponse is the envelope http-request returns. The body of a response that isn't text is replaced by
+// a note of its type and size.
+type HTTPResponse struct {
+	Status     int               `json:"status"`
+	StatusText string            `json:"status_text"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body"`
+	Truncated  bool              `json:"truncated,omitempty"`
+}
+
+func httpRequest(options HTTPRequestOptions) ToolContextFunction {
+	options.HTTPOptions = options.HTTPOptions.withDefaults()
+	if len(options.Methods) == 0 {
+		options.Methods = defaultHTTPMethods
+	}
+	if len(options.ResponseHeaders) == 0 {
+		options.ResponseHeaders = defaultHTTPResponseHeaders
+	}
+
+	return func(ctx context.Context, payload string) (string, error) {
+		var request struct {
+			Method  string            `json:"method"`
+			URL     string            `json:"url"`
+			Headers map[string]string `json:"headers"`
+			Body    string            `json:"body"`
+		}
+		err := json.Unmarshal([]byte(payload), &request)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while unmarshaling payload", "error", err.Error())
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+		}
+
+		method := strings.ToUpper(request.Method)
+		if method == "" {
+			method = http.MethodGet
+		}
+		if !slices.Contains(options.Methods, method) {
+			return "", ModelError("the method "+method+" isn't allowed", "use one of "+strings.Join(options.Methods, ", "))
+		}
+		u, err := options.checkHTTPURL(request.URL)
+		if err != nil {
+			LoggerFrom(ctx).Error("url is not allowed", "url", request.URL, "error", err.Error())
+			return "", err
+		}
+
+		var body io.Reader
+		if request.Body != "" {
+			body = strings.NewReader(request.Body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+		if err != nil {
+			return "", fmt.Errorf("error while creating request: %w", err)
+		}
+		for name, value := range request.Headers {
+			req.Header.Set(name, value)
+		}
+		if request.Body != "" && req.Header.Get("Content-Type") == "" && json.Valid([]byte(request.Body)) {
+			req.Header.Set("Content-Type", ContentTypeJSON)
+		}
+		err = options.authorize(req)
+		if err != nil {
+			return "", err
+		}
+
+		response, err := options.requestClient().Do(req)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while sending request", "method", method, "url", u.Redacted(), "error", err.Error())
+			return "", fmt.Errorf("error while sending %s %s: %w", method, u.Redacted(), err)
+		}
+		defer func() { _ = response.Body.Close() }()
+
+		data, truncated, err := readHTTPBody(response.Body, options.MaxSize)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while reading response body", "url", u.Redacted(), "error", err.Error())
+			return "", fmt.Errorf("error while reading response body: %w", err)
+		}
+
+		result := HTTPResponse{
+			Status:     response.StatusCode,
+			StatusText: response.Status,
+			Headers:    make(map[string]string, len(options.ResponseHeaders)),
+			Truncated:  truncated,
+		}
+		for _, name := range options.ResponseHeaders {
+			values := response.Header.Values(name)
+			if len(values) > 0 {
+				result.Headers[http.CanonicalHeaderKey(name)] = strings.Join(values, ", ")
+			}
+		}
+		contentType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+		if contentType == "" && len(data) > 0 {
+			contentType, _, _ = strings.Cut(http.DetectContentType(data), ";")
+		}
+		if len(data) == 0 || textMIME(contentType) {
+			// the cut may split a rune
+			result.Body = strings.ToValidUTF8(string(data), "")
+		} else {
+			result.Body = fmt.Sprintf("[%d bytes of %s]", len(data), contentType)
+		}
+
+		out, err := marshalJSON(result)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while marshaling response", "error", err.Error())
+			return "", fmt.Errorf("error while marshaling response: %w", err)
+		}
+		return string(out), nil
+	}
+}
+
+// requestClient returns the client of HTTPOptions, which also drops the credentials on a redirect to a host
+// that isn't one of AuthHosts.
+func (o HTTPRequestOptions) requestClient() *http.Client {
+	client := o.client()
+	checkRedirect := client.CheckRedirect
+	client.CheckRedirect = func(r *http.Request, via []*http.Request) error {
+		err := checkRedirect(r, via)
+		if err != nil {
+			return err
+		}
+		if !o.authHost(r.URL) {
+			r.Header.Del("Authorization")
+		}
+		return nil
+	}
+	return client
+}
+
+func (o HTTPRequestOptions) authHost(u *url.URL) bool {
+	return hostMatches(o.AuthHosts, strings.ToLower(strings.TrimSuffix(u.Hostname(), ".")))
+}
+
+// authorize adds the credentials of the config to the request when its host is one of AuthHosts.
+func (o HTTPRequestOptions) authorize(req *http.Request) error {
+	if !o.authHost(req.URL) {
+		return nil
+	}
+
+	config := func(key string) (string, error) {
+		value, ok := ConfigGet(key)
+		if !ok || value == "" {
+			return "", ModelError("the config key "+key+" isn't set", "ask the user to set "+key+" in the settings")
+		}
+		return value, nil
+	}
+
+	if o.BearerTokenKey != "" {
+		token, err := config(o.BearerTokenKey)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if o.BasicAuthUserKey != "" {
+		user, err := config(o.BasicAuthUserKey)
+		if err != nil {
+			return err
+		}
+		var password string
+		if o.BasicAuthPasswordKey != "" {
+			password, err = config(o.BasicAuthPasswordKey)
+			if err != nil {
+				return err
+			}
+		}
+		req.SetBasicAuth(user, password)
+	}
+	return nil
+}
+
+func firstRunes(s string, n int) string {
+	runes := []rune(s)
+	return string(runes[:min(len(runes), n)])
+}
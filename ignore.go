@@ -0,0 +1,270 @@
+package framework
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// IgnoreFiles are read from a directory by LoadIgnore, in order, so .jarblesignore can re-include what
+// .gitignore ignores.
+var IgnoreFiles = []string{".gitignore", ".jarblesignore"}
+
+// DefaultIgnorePatterns are ignored in every directory, so noisy directories never reach the model.
+var DefaultIgnorePatterns = []string{".git/", "node_modules/", ".DS_Store"}
+
+// Ignore decides which files the file tools skip, with the patterns of gitignore files.
+type Ignore struct {
+	// mu guards rules, which are added while walking concurrently.
+	mu    sync.RWMutex
+	rules []ignoreRule
+	// prefix is the directory that paths are relative to, relative to the root, see Within.
+	prefix string
+}
+
+type ignoreRule struct {
+	// base is the directory of the file the rule is from, relative to the root, or "" for the root.
+	base    string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// NewIgnore returns an Ignore with the patterns, which are relative to the root.
+func NewIgnore(patterns ...string) *Ignore {
+	i := &Ignore{}
+	for _, pattern := range patterns {
+		i.add("", pattern)
+	}
+	return i
+}
+
+// LoadIgnore returns an Ignore with DefaultIgnorePatterns and the IgnoreFiles in root. Ignore files in the
+// directories below are added with AddDir while walking.
+func LoadIgnore(root string) (*Ignore, error) {
+	i := NewIgnore(DefaultIgnorePatterns...)
+	err := i.AddDir(root, "")
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// loadIgnoreFor returns the Ignore of dir within root, with the IgnoreFiles of root and of the directories
+// down to dir.
+func loadIgnoreFor(root, dir string) (*Ignore, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("error while getting absolute path at %s: %w", root, err)
+	}
+	i, err := LoadIgnore(root)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return nil, fmt.Errorf("error while getting relative path of %s: %w", dir, err)
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == "." {
+		return i, nil
+	}
+
+	parts := strings.Split(rel, "/")
+	for n := 1; n <= len(parts); n++ {
+		sub := strings.Join(parts[:n], "/")
+		err = i.AddDir(filepath.Join(root, filepath.FromSlash(sub)), sub)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return i.Within(rel), nil
+}
+
+// Within returns an Ignore for the paths relative to rel, a directory below the root.
+func (i *Ignore) Within(rel string) *Ignore {
+	prefix := path.Join(i.prefix, filepath.ToSlash(rel))
+	if prefix == "." {
+		prefix = ""
+	}
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return &Ignore{rules: slices.Clip(i.rules), prefix: prefix}
+}
+
+// AddDir adds the IgnoreFiles in dir, whose path relative to the root is rel, if it has any.
+func (i *Ignore) AddDir(dir, rel string) error {
+	base := path.Join(i.prefix, filepath.ToSlash(rel))
+	if base == "." {
+		base = ""
+	}
+	for _, name := range IgnoreFiles {
+		err := i.addFile(filepath.Join(dir, name), base)
+		if err != nil {
+			LogError("error while reading ignore file", "dir", dir, "name", name, "error", err.Error())
+			return fmt.Errorf("error while reading ignore file %s in %s: %w", name, dir, err)
+		}
+	}
+	return nil
+}
+
+func (i *Ignore) addFile(filename, base string) error {
+	f, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		i.add(base, scanner.Text())
+	}
+	return scanner.Err()
+}
+
+func (i *Ignore) add(base, pattern string) {
+	pattern = strings.TrimRight(strings.TrimSuffix(pattern, "\r"), " ")
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return
+	}
+
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\!`) || strings.HasPrefix(pattern, `\#`) {
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return
+	}
+
+	// a pattern without a slash matches at any depth, one with a slash is relative to its directory
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	re, err := globRegexp(pattern)
+	if err != nil {
+		LogWarn("ignoring invalid ignore pattern", "pattern", pattern, "error", err.Error())
+		return
+	}
+	rule.re = re
+	i.mu.Lock()
+	i.rules = append(i.rules, rule)
+	i.mu.Unlock()
+}
+
+// Match reports whether the path, relative to the root, is ignored. A path in an ignored directory is
+// ignored too.
+func (i *Ignore) Match(rel string, isDir bool) bool {
+	if i == nil {
+		return false
+	}
+	rel = path.Join(i.prefix, filepath.ToSlash(rel))
+	if rel == "." {
+		return false
+	}
+
+	parts := strings.Split(rel, "/")
+	for n := 1; n < len(parts); n++ {
+		if i.matchOne(strings.Join(parts[:n], "/"), true) {
+			return true
+		}
+	}
+	return i.matchOne(rel, isDir)
+}
+
+// matchOne applies the rules to a path, the last rule that matches wins.
+func (i *Ignore) matchOne(rel string, isDir bool) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	ignored := false
+	for _, rule := range i.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		p := rel
+		if rule.base != "" {
+			var ok bool
+			p, ok = strings.CutPrefix(rel, rule.base+"/")
+			if !ok {
+				continue
+			}
+		}
+		if rule.re.MatchString(p) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// MatchGlob reports whether name matches the glob pattern. Unlike path.Match, ** matches any number of
+// directories, e.g. "src/**/*.go" matches "src/main.go" and "src/a/b/main.go".
+//
+//goland:noinspection GoUnusedExportedFunction
+func MatchGlob(pattern, name string) bool {
+	re, err := globRegexp(pattern)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(filepath.ToSlash(name))
+}
+
+// globRegexp translates a glob pattern with * ? [...] and ** into a regular expression.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "/**") && i+3 == len(pattern):
+			sb.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class in %q", pattern)
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
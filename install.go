@@ -0,0 +1,148 @@
+package framework
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+)
+
+type PackageOptions struct {
+	// Dir is the destination directory. Defaults to AssistantsDir().
+	Dir string
+	// SourceDir is a directory containing main.go to build the binary from.
+	// When empty, the currently running executable is copied instead.
+	SourceDir string
+	// Avatar is the path of an image copied next to the description.
+	Avatar string
+	// Version overrides the version read from the build info.
+	Version string
+}
+
+// Install packages the assistant into AssistantsDir() so that jarbles picks it up.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (a *Assistant) Install(options PackageOptions) error {
+	options.Dir = AssistantsDir()
+	_, err := a.Package(options)
+	return err
+}
+
+// Package writes the assistant binary, its description TOML, and its avatar into options.Dir.
+// BinaryName and Version are computed and written into the description. It returns the path of the description.
+func (a *Assistant) Package(options PackageOptions) (string, error) {
+	if options.Dir == "" {
+		options.Dir = AssistantsDir()
+	}
+
+	err := os.MkdirAll(options.Dir, privateDirPerm)
+	if err != nil {
+		return "", fmt.Errorf("error while creating package directory: %s: %w", options.Dir, err)
+	}
+
+	id := slugify(a.description.StaticID)
+	binaryName := id
+	if runtime.GOOS == "windows" {
+		binaryName += ".exe"
+	}
+
+	if options.SourceDir != "" {
+		err = buildCommand(context.Background(), options.SourceDir, options.Dir, binaryName)
+		if err != nil {
+			return "", fmt.Errorf("error while building assistant: %w", err)
+		}
+	} else {
+		executable, err := os.Executable()
+		if err != nil {
+			return "", fmt.Errorf("error while locating executable: %w", err)
+		}
+		err = copyFileTo(executable, filepath.Join(options.Dir, binaryName), privateExecPerm)
+		if err != nil {
+			return "", fmt.Errorf("error while copying executable: %w", err)
+		}
+	}
+
+	if options.Avatar != "" {
+		avatar := filepath.Join(options.Dir, id+filepath.Ext(options.Avatar))
+		err = copyFileTo(options.Avatar, avatar, privateFilePerm)
+		if err != nil {
+			return "", fmt.Errorf("error while copying avatar: %w", err)
+		}
+	}
+
+	description := a.description
+	description.BinaryName = binaryName
+	description.Version = options.Version
+	if description.Version == "" {
+		description.Version = buildVersion()
+	}
+
+	var buf bytes.Buffer
+	err = toml.NewEncoder(&buf).Encode(description)
+	if err != nil {
+		return "", fmt.Errorf("error while marshaling toml: %w", err)
+	}
+
+	filename := filepath.Join(options.Dir, id+".toml")
+	err = os.WriteFile(filename, buf.Bytes(), privateFilePerm)
+	if err != nil {
+		return "", fmt.Errorf("error while writing description: %s: %w", filename, err)
+	}
+
+	return filename, nil
+}
+
+// buildVersion returns the module version of the running binary, falling back to the vcs revision.
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && len(setting.Value) >= 12 {
+			return setting.Value[:12]
+		}
+	}
+
+	return info.Main.Version
+}
+
+func copyFileTo(src, dest string, perm os.FileMode) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error while opening source file at %s: %w", src, err)
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(srcFile)
+
+	// write to a temporary file first so that a running binary is never left half written
+	tmp := dest + ".tmp"
+	destFile, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return fmt.Errorf("error while creating destination file at %s: %w", tmp, err)
+	}
+
+	_, err = io.Copy(destFile, srcFile)
+	if err != nil {
+		_ = destFile.Close()
+		return fmt.Errorf("error while copying file from %s to %s: %w", src, tmp, err)
+	}
+
+	err = destFile.Close()
+	if err != nil {
+		return fmt.Errorf("error while closing destination file at %s: %w", tmp, err)
+	}
+
+	return os.Rename(tmp, dest)
+}
@@ -21,11 +21,30 @@ type toolFunction struct {
 type tool struct {
 	Type     string        `json:"type" toml:"type"`
 	Function *toolFunction `json:"function" toml:"function"`
+	Handler  string        `json:"-" toml:"handler,omitempty"`
+}
+
+type scriptHandler struct {
+	Name    string     `toml:"name"`
+	Type    string     `toml:"type"`
+	Source  string     `toml:"source,omitempty"`
+	Command []string   `toml:"command,omitempty"`
+	Env     *EnvPolicy `toml:"env,omitempty"`
 }
 
 type quicklink struct {
 	Title   string `json:"title" toml:"title"`
 	Content string `json:"content" toml:"content"`
+	Icon    string `json:"icon,omitempty" toml:"icon,omitempty"`
+}
+
+// knowledgeFile is a reference document of an assistant. Hosts that support retrieval fetch it with the
+// __knowledge operation, and only fetch it again when its hash changes.
+type knowledgeFile struct {
+	Name     string `json:"name"`
+	MIMEType string `json:"mime_type"`
+	Size     int    `json:"size"`
+	SHA256   string `json:"sha256"`
 }
 
 type message struct {
@@ -42,16 +61,21 @@ type initiate struct {
 }
 
 type frameworkAssistant struct {
-	StaticID     string      `json:"static_id" toml:"static_id"`
-	Name         string      `json:"name" toml:"name"`
-	Description  string      `json:"description" toml:"description"`
-	Model        string      `json:"model" toml:"model"`
-	Instructions string      `json:"instructions" toml:"instructions"`
-	Tools        []tool      `json:"tools,omitempty" toml:"tools,omitempty"`
-	Version      string      `json:"version,omitempty" toml:"version,omitempty"`
-	BinaryName   string      `json:"binary_name,omitempty" toml:"binary_name,omitempty"`
-	Placeholder  string      `json:"placeholder,omitempty" toml:"placeholder,omitempty"`
-	Initiate     initiate    `json:"initiate,omitempty" toml:"initiate,omitempty"`
-	Quicklinks   []quicklink `json:"quicklinks,omitempty" toml:"quicklinks,omitempty"`
-	Messages     []message   `json:"messages,omitempty" toml:"messages,omitempty"`
+	StaticID     string                  `json:"static_id" toml:"static_id"`
+	Name         string                  `json:"name" toml:"name"`
+	Description  string                  `json:"description" toml:"description"`
+	Model        string                  `json:"model" toml:"model"`
+	Instructions string                  `json:"instructions" toml:"instructions"`
+	Tools        []tool                  `json:"tools,omitempty" toml:"tools,omitempty"`
+	Costs        map[string]costMetadata `json:"costs,omitempty" toml:"-"`
+	Version      string                  `json:"version,omitempty" toml:"version,omitempty"`
+	BinaryName   string                  `json:"binary_name,omitempty" toml:"binary_name,omitempty"`
+	Placeholder  string                  `json:"placeholder,omitempty" toml:"placeholder,omitempty"`
+	Initiate     initiate                `json:"initiate,omitempty" toml:"initiate,omitempty"`
+	Quicklinks   []quicklink             `json:"quicklinks,omitempty" toml:"quicklinks,omitempty"`
+	Messages     []message               `json:"messages,omitempty" toml:"messages,omitempty"`
+	Handlers     []scriptHandler         `json:"-" toml:"handlers,omitempty"`
+	Settings     []Setting               `json:"settings,omitempty" toml:"settings,omitempty"`
+	Knowledge    []knowledgeFile         `json:"knowledge,omitempty" toml:"-"`
+	ToolHints    []ToolHint              `json:"tool_hints,omitempty" toml:"tool_hints,omitempty"`
 }
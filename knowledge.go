@@ -0,0 +1,112 @@
+package framework
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type AddKnowledgeFileOptions struct {
+	// Path is a file that is read when the host fetches it, so it must not change while the assistant runs.
+	Path string
+	// Content is the document itself when there is no Path, e.g. one embedded in the binary.
+	Content []byte
+	// Name is shown by the host. Defaults to the base name of Path.
+	Name string
+	// MIMEType defaults to the one of the extension of Name, or is detected from the content.
+	MIMEType string
+}
+
+// AddKnowledgeFile attaches a reference document to the assistant, which describe lists with its hash for
+// hosts that support retrieval. Adding the same content twice attaches it once.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (a *Assistant) AddKnowledgeFile(options AddKnowledgeFileOptions) error {
+	content := options.Content
+	if options.Path != "" {
+		data, err := os.ReadFile(options.Path)
+		if err != nil {
+			LogError("error while reading knowledge file", "path", options.Path, "error", err.Error())
+			return fmt.Errorf("error while reading knowledge file at %s: %w", options.Path, err)
+		}
+		content = data
+		if options.Name == "" {
+			options.Name = filepath.Base(options.Path)
+		}
+		// the content is read again from the path when the host fetches it
+		options.Content = nil
+	}
+	if options.Name == "" {
+		return fmt.Errorf("error while adding knowledge file: a name is required without a path")
+	}
+	if options.MIMEType == "" {
+		options.MIMEType = mimeByExtension(options.Name)
+	}
+	if options.MIMEType == "" {
+		options.MIMEType, _, _ = strings.Cut(http.DetectContentType(content), ";")
+	}
+
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	if a.knowledge == nil {
+		a.knowledge = make(map[string]AddKnowledgeFileOptions)
+	}
+	if _, ok := a.knowledge[hash]; ok {
+		return nil
+	}
+	a.knowledge[hash] = options
+
+	a.description.Knowledge = append(a.description.Knowledge, knowledgeFile{
+		Name:     options.Name,
+		MIMEType: options.MIMEType,
+		Size:     len(content),
+		SHA256:   hash,
+	})
+	a.described = nil
+	return nil
+}
+
+// knowledgeOperation returns the content of the knowledge file with the sha256 of the payload. A file whose
+// path changed since it was added is refused, so the host never indexes content under a stale hash.
+func (a *Assistant) knowledgeOperation(payload string) (string, error) {
+	var request struct {
+		SHA256 string `json:"sha256"`
+	}
+	err := json.Unmarshal([]byte(payload), &request)
+	if err != nil {
+		return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+	}
+
+	options, ok := a.knowledge[request.SHA256]
+	if !ok {
+		return "", fmt.Errorf("unknown knowledge file: %s", request.SHA256)
+	}
+
+	content := options.Content
+	if options.Path != "" {
+		content, err = os.ReadFile(options.Path)
+		if err != nil {
+			LogError("error while reading knowledge file", "path", options.Path, "error", err.Error())
+			return "", fmt.Errorf("error while reading knowledge file at %s: %w", options.Path, err)
+		}
+		sum := sha256.Sum256(content)
+		if hex.EncodeToString(sum[:]) != request.SHA256 {
+			return "", fmt.Errorf("error while reading knowledge file at %s: it changed since it was added", options.Path)
+		}
+	}
+
+	data, err := json.Marshal(struct {
+		Name     string `json:"name"`
+		MIMEType string `json:"mime_type"`
+		Content  []byte `json:"content"` // base64
+	}{options.Name, options.MIMEType, content})
+	if err != nil {
+		return "", fmt.Errorf("error while marshaling knowledge file: %w", err)
+	}
+	return string(data), nil
+}
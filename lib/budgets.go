@@ -0,0 +1,49 @@
+package lib
+
+import (
+	"bytes"
+	_ "embed"
+	"html/template"
+	"time"
+)
+
+//go:embed budgets.html
+var budgetsHTML string
+
+var budgetsTemplate = template.Must(template.New("budgets").Parse(budgetsHTML))
+
+type BudgetRow struct {
+	Name  string
+	Spent float64
+	// Cap is zero for a budget without a monthly cap.
+	Cap  float64
+	Unit string
+}
+
+// Percent returns how much of the cap is spent, from 0 to 100.
+func (r BudgetRow) Percent() float64 {
+	if r.Cap <= 0 {
+		return 0
+	}
+	return min(100, r.Spent/r.Cap*100)
+}
+
+type BudgetsOptions struct {
+	Title   string
+	Month   string
+	Budgets []BudgetRow
+	Refresh time.Duration
+}
+
+// Budgets renders a standalone page with the spend of each budget this month against its cap.
+func Budgets(options BudgetsOptions) string {
+	var buf bytes.Buffer
+	err := budgetsTemplate.Execute(&buf, struct {
+		BudgetsOptions
+		RefreshMillis int64
+	}{options, options.Refresh.Milliseconds()})
+	if err != nil {
+		return template.HTMLEscapeString(err.Error())
+	}
+	return buf.String()
+}
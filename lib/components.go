@@ -0,0 +1,87 @@
+package lib
+
+import (
+	"bytes"
+	"html/template"
+)
+
+var componentsTemplate = template.Must(template.New("components").Parse(
+	`{{define "badge"}}<span class="badge badge--{{.Status}}">{{.Label}}</span>{{end}}` +
+		`{{define "stat"}}<div class="stat"><div class="stat__label">{{.Label}}</div>` +
+		`<div class="stat__value">{{.Value}}</div>` +
+		`{{if .Delta}}<div class="stat__delta stat__delta--{{.Trend}}">{{if eq .Trend "up"}}▲{{else if eq .Trend "down"}}▼{{end}} {{.Delta}}</div>{{end}}</div>{{end}}` +
+		`{{define "progress"}}<div class="progress">{{if .Label}}<div class="progress__label">{{.Label}}</div>{{end}}` +
+		`<div class="progress__bar" role="progressbar" aria-valuemin="0" aria-valuemax="100" aria-valuenow="{{printf "%.0f" .Percent}}"` +
+		`{{if .Label}} aria-label="{{.Label}}"{{end}}><div class="progress__fill progress__fill--{{.Status}}" style="width: {{printf "%.0f" .Percent}}%"></div></div></div>{{end}}`))
+
+// Statuses of badges and progress bars, which set their color.
+const (
+	StatusNeutral string = "neutral"
+	StatusSuccess string = "success"
+	StatusWarning string = "warning"
+	StatusDanger  string = "danger"
+)
+
+// Trends of the delta of a stat.
+const (
+	TrendUp   string = "up"
+	TrendDown string = "down"
+	TrendFlat string = "flat"
+)
+
+type BadgeOptions struct {
+	Label string
+	// Status defaults to StatusNeutral.
+	Status string
+}
+
+// Badge renders a small colored label, e.g. the status of a build.
+func Badge(options BadgeOptions) string {
+	if options.Status == "" {
+		options.Status = StatusNeutral
+	}
+	return renderComponent("badge", options)
+}
+
+type StatOptions struct {
+	Label string
+	Value string
+	// Delta is the change since the previous period, e.g. "+12%", shown with an arrow for the trend.
+	Delta string
+	// Trend defaults to TrendFlat.
+	Trend string
+}
+
+// Stat renders a big number with a label and an optional delta, for KPI cards.
+func Stat(options StatOptions) string {
+	if options.Trend == "" {
+		options.Trend = TrendFlat
+	}
+	return renderComponent("stat", options)
+}
+
+type ProgressBarOptions struct {
+	Label string
+	// Percent is between 0 and 100.
+	Percent float64
+	// Status defaults to StatusSuccess.
+	Status string
+}
+
+// ProgressBar renders a horizontal bar that is filled to the percent.
+func ProgressBar(options ProgressBarOptions) string {
+	if options.Status == "" {
+		options.Status = StatusSuccess
+	}
+	options.Percent = max(0, min(100, options.Percent))
+	return renderComponent("progress", options)
+}
+
+func renderComponent(name string, data any) string {
+	var buf bytes.Buffer
+	err := componentsTemplate.ExecuteTemplate(&buf, name, data)
+	if err != nil {
+		return template.HTMLEscapeString(err.Error())
+	}
+	return buf.String()
+}
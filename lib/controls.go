@@ -0,0 +1,49 @@
+package lib
+
+import (
+	"bytes"
+	"html/template"
+)
+
+// The host handles clicks on the elements with a data-jarbles-operation attribute by sending the __click
+// operation to the extension, with the operation and payload of the element.
+var controlsTemplate = template.Must(template.New("button").Parse(`{{define "button"}}<button type="button" class="card__button"` +
+	` data-jarbles-extension="{{.Extension}}" data-jarbles-operation="{{.Operation}}" data-jarbles-payload="{{.Payload}}"` +
+	`{{if .Confirm}} data-jarbles-confirm="{{.Confirm}}"{{end}}>{{.Label}}</button>{{end}}` +
+	`{{define "menu"}}<details class="card__menu"><summary class="card__button">{{.Label}}</summary>` +
+	`<div class="card__menu-items">{{range .Items}}{{template "button" .}}{{end}}</div></details>{{end}}`))
+
+type ButtonOptions struct {
+	Label string
+	// Extension is the ID of the extension that the click is sent to.
+	Extension string
+	// Operation is the action or command that the click runs, with Payload.
+	Operation string
+	Payload   string
+	// Confirm is a question the host asks before it sends the click, e.g. for destructive operations.
+	Confirm string
+}
+
+// Button renders a button that runs an operation of the extension when it's clicked.
+func Button(options ButtonOptions) string {
+	return renderControl("button", options)
+}
+
+type MenuOptions struct {
+	Label string
+	Items []ButtonOptions
+}
+
+// Menu renders a button that opens a list of buttons.
+func Menu(options MenuOptions) string {
+	return renderControl("menu", options)
+}
+
+func renderControl(name string, data any) string {
+	var buf bytes.Buffer
+	err := controlsTemplate.ExecuteTemplate(&buf, name, data)
+	if err != nil {
+		return template.HTMLEscapeString(err.Error())
+	}
+	return buf.String()
+}
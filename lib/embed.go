@@ -0,0 +1,42 @@
+package lib
+
+import (
+	"bytes"
+	"html/template"
+)
+
+var cardEmbedTemplate = template.Must(template.New("card-embed").Parse(`<style>{{.CSS}}</style>
+<div class="card">
+    <div class="card__header">
+        <div class="card__extension-name">{{.ExtensionName}}</div>
+    </div>
+    <div class="card__title">{{.IconHTML}}{{.Title}}</div>
+    <iframe class="card__embed" src="{{.Href}}" title="{{.Title}}" style="width: 100%; height: {{.Height}}; border: 0;"></iframe>
+</div>`))
+
+type CardEmbedOptions struct {
+	ExtensionName string
+	Title         string
+	Href          string
+	Height        string
+	// Icon is the name of an icon shown before the title, see IconNames.
+	Icon string
+}
+
+// CardEmbed renders a card that embeds the page at Href, e.g. an action that renders a live view.
+func CardEmbed(options CardEmbedOptions) string {
+	if options.Height == "" {
+		options.Height = "16rem"
+	}
+
+	var buf bytes.Buffer
+	err := cardEmbedTemplate.Execute(&buf, struct {
+		CardEmbedOptions
+		CSS      template.CSS
+		IconHTML template.HTML
+	}{options, template.CSS(css), template.HTML(Icon(options.Icon, 16))})
+	if err != nil {
+		return template.HTMLEscapeString(err.Error())
+	}
+	return buf.String()
+}
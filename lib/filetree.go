@@ -0,0 +1,75 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/url"
+)
+
+var fileTreeTemplate = template.Must(template.New("filetree").Funcs(template.FuncMap{
+	"size": formatSize,
+}).Parse(`{{define "node"}}<li class="file-tree__{{.Type}}">
+    {{- if eq .Type "dir"}}<details{{if .Open}} open{{end}}><summary>{{.Name}}/</summary>
+        <ul>{{range .Children}}{{template "node" .}}{{end}}</ul>
+    </details>
+    {{- else}}{{if .Href}}<a href="{{.Href}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}{{if .Size}} <span class="file-tree__size">{{size .Size}}</span>{{end}}{{end -}}
+</li>{{end}}<ul class="file-tree">{{range .Children}}{{template "node" .}}{{end}}</ul>`))
+
+// FileNode is a file or a directory of FileTree.
+type FileNode struct {
+	Path     string
+	Name     string
+	Type     string
+	Size     int64
+	Children []FileNode
+}
+
+type FileTreeOptions struct {
+	// Href is the URL of the action that opens a file, which gets the path of the file in the path query
+	// parameter. Without it the files aren't links.
+	Href string
+	// OpenDepth is how many levels of directories are expanded, none when zero.
+	OpenDepth int
+}
+
+type fileTreeNode struct {
+	FileNode
+	Href     string
+	Open     bool
+	Children []fileTreeNode
+}
+
+// FileTree renders the children of root as a tree with collapsible directories.
+func FileTree(root FileNode, options FileTreeOptions) string {
+	var buf bytes.Buffer
+	err := fileTreeTemplate.Execute(&buf, fileTreeNodeOf(root, options, 0))
+	if err != nil {
+		return template.HTMLEscapeString(err.Error())
+	}
+	return buf.String()
+}
+
+func fileTreeNodeOf(node FileNode, options FileTreeOptions, depth int) fileTreeNode {
+	n := fileTreeNode{FileNode: node, Open: depth <= options.OpenDepth}
+	if options.Href != "" && node.Type != "dir" {
+		n.Href = options.Href + "?" + url.Values{"path": {node.Path}}.Encode()
+	}
+	for _, child := range node.Children {
+		n.Children = append(n.Children, fileTreeNodeOf(child, options, depth+1))
+	}
+	return n
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
@@ -0,0 +1,62 @@
+package lib
+
+import (
+	"fmt"
+	"sort"
+)
+
+// icons are 24x24 outline icons drawn with the current color, named after their lucide and feather
+// counterparts so that hosts can map them to their own icon set.
+var icons = map[string]string{
+	"activity":       `<polyline points="22 12 18 12 15 21 9 3 6 12 2 12"/>`,
+	"alert-triangle": `<path d="M12 3 2 21h20L12 3z"/><line x1="12" y1="10" x2="12" y2="14"/><line x1="12" y1="17.5" x2="12" y2="18"/>`,
+	"bar-chart":      `<line x1="6" y1="20" x2="6" y2="14"/><line x1="12" y1="20" x2="12" y2="4"/><line x1="18" y1="20" x2="18" y2="10"/>`,
+	"bell":           `<path d="M6 17V11a6 6 0 0 1 12 0v6l2 2H4l2-2z"/><path d="M10 21h4"/>`,
+	"calendar":       `<rect x="3" y="5" width="18" height="16" rx="2"/><line x1="3" y1="10" x2="21" y2="10"/><line x1="8" y1="3" x2="8" y2="7"/><line x1="16" y1="3" x2="16" y2="7"/>`,
+	"check":          `<polyline points="4 12 9 17 20 6"/>`,
+	"clock":          `<circle cx="12" cy="12" r="9"/><polyline points="12 7 12 12 15 14"/>`,
+	"cloud":          `<path d="M7 18h10a4 4 0 0 0 .5-8 6 6 0 0 0-11.5 1.5A3.5 3.5 0 0 0 7 18z"/>`,
+	"file":           `<path d="M14 3H6a1 1 0 0 0-1 1v16a1 1 0 0 0 1 1h12a1 1 0 0 0 1-1V8l-5-5z"/><polyline points="14 3 14 8 19 8"/>`,
+	"folder":         `<path d="M3 6a1 1 0 0 1 1-1h5l2 2h9a1 1 0 0 1 1 1v10a1 1 0 0 1-1 1H4a1 1 0 0 1-1-1V6z"/>`,
+	"globe":          `<circle cx="12" cy="12" r="9"/><line x1="3" y1="12" x2="21" y2="12"/><path d="M12 3a14 14 0 0 1 0 18 14 14 0 0 1 0-18z"/>`,
+	"home":           `<path d="M3 11 12 4l9 7"/><path d="M5 10v10h5v-6h4v6h5V10"/>`,
+	"info":           `<circle cx="12" cy="12" r="9"/><line x1="12" y1="11" x2="12" y2="16"/><line x1="12" y1="7.5" x2="12" y2="8"/>`,
+	"link":           `<path d="M10 14a4 4 0 0 0 5.7 0l3-3a4 4 0 0 0-5.7-5.7l-1 1"/><path d="M14 10a4 4 0 0 0-5.7 0l-3 3a4 4 0 0 0 5.7 5.7l1-1"/>`,
+	"lock":           `<rect x="5" y="11" width="14" height="10" rx="2"/><path d="M8 11V7a4 4 0 0 1 8 0v4"/>`,
+	"mail":           `<rect x="3" y="5" width="18" height="14" rx="2"/><polyline points="3 7 12 13 21 7"/>`,
+	"pause":          `<line x1="9" y1="5" x2="9" y2="19"/><line x1="15" y1="5" x2="15" y2="19"/>`,
+	"play":           `<polygon points="7 4 19 12 7 20 7 4"/>`,
+	"refresh":        `<path d="M20 11a8 8 0 0 0-14.5-4.5L4 8"/><polyline points="4 3 4 8 9 8"/><path d="M4 13a8 8 0 0 0 14.5 4.5L20 16"/><polyline points="20 21 20 16 15 16"/>`,
+	"search":         `<circle cx="11" cy="11" r="7"/><line x1="16" y1="16" x2="21" y2="21"/>`,
+	"sliders":        `<line x1="4" y1="6" x2="20" y2="6"/><line x1="4" y1="12" x2="20" y2="12"/><line x1="4" y1="18" x2="20" y2="18"/><circle cx="9" cy="6" r="2"/><circle cx="15" cy="12" r="2"/><circle cx="7" cy="18" r="2"/>`,
+	"star":           `<polygon points="12 3 14.8 8.8 21 9.6 16.5 14 17.6 20.2 12 17.2 6.4 20.2 7.5 14 3 9.6 9.2 8.8 12 3"/>`,
+	"terminal":       `<polyline points="4 7 9 12 4 17"/><line x1="12" y1="18" x2="20" y2="18"/>`,
+	"user":           `<circle cx="12" cy="8" r="4"/><path d="M4 21a8 8 0 0 1 16 0"/>`,
+	"x":              `<line x1="6" y1="6" x2="18" y2="18"/><line x1="18" y1="6" x2="6" y2="18"/>`,
+}
+
+// Icon renders the named icon as an inline SVG of size pixels, 24 when size is 0. Unknown names render
+// nothing, see IconNames.
+func Icon(name string, size int) string {
+	shapes, ok := icons[name]
+	if !ok {
+		return ""
+	}
+	if size == 0 {
+		size = 24
+	}
+
+	return fmt.Sprintf(`<svg class="icon" xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 24 24" `+
+		`fill="none" stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round" aria-hidden="true">%s</svg>`,
+		size, size, shapes)
+}
+
+// IconNames returns the names of the icons, sorted.
+func IconNames() []string {
+	names := make([]string, 0, len(icons))
+	for name := range icons {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
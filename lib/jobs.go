@@ -0,0 +1,41 @@
+package lib
+
+import (
+	"bytes"
+	_ "embed"
+	"html/template"
+	"time"
+)
+
+//go:embed jobs.html
+var jobsHTML string
+
+var jobsTemplate = template.Must(template.New("jobs").Parse(jobsHTML))
+
+type JobRow struct {
+	ID       string
+	Handler  string
+	Status   string
+	Attempts int
+	RunAfter string
+	Error    string
+}
+
+type JobsOptions struct {
+	Title   string
+	Jobs    []JobRow
+	Refresh time.Duration
+}
+
+// Jobs renders a standalone page with a table of jobs that reloads itself every Refresh.
+func Jobs(options JobsOptions) string {
+	var buf bytes.Buffer
+	err := jobsTemplate.Execute(&buf, struct {
+		JobsOptions
+		RefreshMillis int64
+	}{options, options.Refresh.Milliseconds()})
+	if err != nil {
+		return template.HTMLEscapeString(err.Error())
+	}
+	return buf.String()
+}
@@ -0,0 +1,58 @@
+package lib
+
+import (
+	"bytes"
+	_ "embed"
+	"html/template"
+	"log/slog"
+	"time"
+)
+
+//go:embed logviewer.html
+var logViewerHTML string
+
+var logViewerTemplate = template.Must(template.New("logviewer").Parse(logViewerHTML))
+
+type LogRecord struct {
+	Level slog.Level
+	Text  string
+}
+
+type LogViewerOptions struct {
+	Title    string
+	Records  []LogRecord
+	MinLevel slog.Level
+	Refresh  time.Duration
+}
+
+// LogViewer renders a standalone page with the log records, which can be filtered by level and reloads itself
+// every Refresh.
+func LogViewer(options LogViewerOptions) string {
+	var buf bytes.Buffer
+	err := logViewerTemplate.Execute(&buf, struct {
+		LogViewerOptions
+		MinLevelInt   int
+		RefreshMillis int64
+	}{options, int(options.MinLevel), options.Refresh.Milliseconds()})
+	if err != nil {
+		return template.HTMLEscapeString(err.Error())
+	}
+	return buf.String()
+}
+
+type CardLogViewerOptions struct {
+	ExtensionName string
+	Title         string
+	Href          string
+	Height        string
+}
+
+// CardLogViewer renders a card that embeds the log viewer page at Href.
+func CardLogViewer(options CardLogViewerOptions) string {
+	return CardEmbed(CardEmbedOptions{
+		ExtensionName: options.ExtensionName,
+		Title:         options.Title,
+		Href:          options.Href,
+		Height:        options.Height,
+	})
+}
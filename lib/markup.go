@@ -3,27 +3,61 @@ package lib
 import (
 	_ "embed"
 	. "github.com/spcoder/rumble"
+	"html"
+	"html/template"
+	"net/url"
+	"strings"
 )
 
 //go:embed markup.css
 var css string
 
+// Every text parameter of the components in this package is HTML-escaped. Fields of type template.HTML are
+// the explicit opt-outs, and take markup built with Raw.
+
+// Raw marks markup as safe to include as is, e.g. the output of another component. It must never be used on
+// text from users, models, or web pages.
+func Raw(markup string) template.HTML {
+	return template.HTML(markup)
+}
+
+// safeHref returns the href escaped for an attribute, or # when its scheme could run script, e.g. javascript:.
+func safeHref(href string) string {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return "#"
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+		return html.EscapeString(href)
+	}
+	return "#"
+}
+
 type CardDefaultOptions struct {
 	ExtensionName string
 	Title         string
 	Description   string
 	Href          string
+	// Body is markup shown below the description, e.g. a badge or a stat.
+	Body template.HTML
 }
 
 func CardDefault(options CardDefaultOptions) string {
+	card := []any{
+		Href(safeHref(options.Href)), Class("card"),
+		Div(Class("card__header"),
+			Div(Class("card__extension-name"), html.EscapeString(options.ExtensionName)),
+		),
+		Div(Class("card__title"), html.EscapeString(options.Title)),
+		Div(Class("card__description"), html.EscapeString(options.Description)),
+	}
+	if options.Body != "" {
+		card = append(card, Div(Class("card__body"), string(options.Body)))
+	}
+
 	return Fragment(
 		Style(css),
-		A(Href(options.Href), Class("card"),
-			Div(Class("card__header"),
-				Div(Class("card__extension-name"), options.ExtensionName),
-			),
-			Div(Class("card__title"), options.Title),
-			Div(Class("card__description"), options.Description),
-		),
+		A(card...),
 	).Render()
 }
@@ -0,0 +1,58 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+)
+
+const hostile = `<script>alert("x & 'y'")</script>`
+
+func TestComponentsEscapeText(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+	}{
+		{"card default", CardDefault(CardDefaultOptions{ExtensionName: hostile, Title: hostile, Description: hostile})},
+		{"card embed", CardEmbed(CardEmbedOptions{ExtensionName: hostile, Title: hostile, Href: "https://example.com"})},
+		{"badge", Badge(BadgeOptions{Label: hostile})},
+		{"stat", Stat(StatOptions{Label: hostile, Value: hostile, Delta: hostile})},
+		{"progress bar", ProgressBar(ProgressBarOptions{Label: hostile, Percent: 50})},
+		{"button", Button(ButtonOptions{Label: hostile, Operation: hostile, Payload: hostile, Confirm: hostile})},
+		{"menu", Menu(MenuOptions{Label: hostile, Items: []ButtonOptions{{Label: hostile}}})},
+		{"table", Table([]string{hostile}, [][]string{{hostile}}, TableOptions{Caption: hostile})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if strings.Contains(tt.html, "<script>") {
+				t.Fatalf("script tag isn't escaped: %s", tt.html)
+			}
+			for _, raw := range []string{`alert("x`, `'y'`, `x & `} {
+				if strings.Contains(tt.html, raw) {
+					t.Fatalf("%q isn't escaped: %s", raw, tt.html)
+				}
+			}
+			if !strings.Contains(tt.html, "&lt;script&gt;") {
+				t.Fatalf("escaped script tag is missing: %s", tt.html)
+			}
+		})
+	}
+}
+
+func TestCardDefaultEscapesHref(t *testing.T) {
+	html := CardDefault(CardDefaultOptions{Title: "title", Href: `javascript:alert("x")`})
+	if strings.Contains(html, "javascript:") {
+		t.Fatalf("javascript URL isn't filtered: %s", html)
+	}
+}
+
+func TestRawPassesThrough(t *testing.T) {
+	badge := Badge(BadgeOptions{Label: "new & <improved>"})
+	html := CardDefault(CardDefaultOptions{Title: "title", Body: Raw(badge)})
+	if !strings.Contains(html, `<div class="card__body">`+badge+`</div>`) {
+		t.Fatalf("raw body isn't included as is: %s", html)
+	}
+	if !strings.Contains(badge, "new &amp; &lt;improved&gt;") {
+		t.Fatalf("badge label isn't escaped: %s", badge)
+	}
+}
@@ -0,0 +1,107 @@
+package lib
+
+import (
+	"bytes"
+	"html/template"
+	"net/url"
+	"strconv"
+)
+
+var tableTemplate = template.Must(template.New("table").Parse(`<div class="table">
+<table>
+    {{if .Caption}}<caption>{{.Caption}}</caption>{{end}}
+    <thead><tr>{{range .Headers}}<th scope="col" aria-sort="{{.AriaSort}}">{{if .Href}}<a href="{{.Href}}">{{.Label}}{{if eq .AriaSort "ascending"}} ▲{{else if eq .AriaSort "descending"}} ▼{{end}}</a>{{else}}{{.Label}}{{end}}</th>{{end}}</tr></thead>
+    <tbody>{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>{{end}}</tbody>
+</table>
+{{if gt .Pages 1}}<nav class="table__pagination" aria-label="pagination">
+    {{if .PreviousHref}}<a href="{{.PreviousHref}}" rel="prev">previous</a>{{end}}
+    <span aria-current="page">page {{.Page}} of {{.Pages}}</span>
+    {{if .NextHref}}<a href="{{.NextHref}}" rel="next">next</a>{{end}}
+</nav>{{end}}
+</div>`))
+
+type TableOptions struct {
+	Caption string
+	// Href is the URL of the action that renders the table. The sort and pagination links go to it with the
+	// page, sort, and order query parameters. Without it the table has no links.
+	Href string
+	// Sortable makes the headers links that sort by them, and again in the opposite order.
+	Sortable bool
+	// Sort is the header the rows are sorted by, in descending order when Desc is true.
+	Sort string
+	Desc bool
+	// Page starts at 1. The table is paginated when Total is more than PageSize.
+	Page     int
+	PageSize int
+	Total    int
+}
+
+type tableHeader struct {
+	Label    string
+	Href     string
+	AriaSort string
+}
+
+// Table renders an accessible table of rows, which are the rows of the current page. Sorting and pagination
+// happen in the action, see TableOptions.
+func Table(headers []string, rows [][]string, options TableOptions) string {
+	if options.Page < 1 {
+		options.Page = 1
+	}
+
+	data := struct {
+		Caption      string
+		Headers      []tableHeader
+		Rows         [][]string
+		Page         int
+		Pages        int
+		PreviousHref string
+		NextHref     string
+	}{Caption: options.Caption, Rows: rows, Page: options.Page, Pages: 1}
+
+	for _, header := range headers {
+		h := tableHeader{Label: header, AriaSort: "none"}
+		desc := false
+		if header == options.Sort {
+			h.AriaSort = "ascending"
+			if options.Desc {
+				h.AriaSort = "descending"
+			}
+			desc = !options.Desc
+		}
+		if options.Sortable && options.Href != "" {
+			h.Href = tableHref(options.Href, 1, header, desc)
+		}
+		data.Headers = append(data.Headers, h)
+	}
+
+	if options.PageSize > 0 && options.Total > options.PageSize {
+		data.Pages = (options.Total + options.PageSize - 1) / options.PageSize
+	}
+	if options.Href != "" && options.Page > 1 {
+		data.PreviousHref = tableHref(options.Href, options.Page-1, options.Sort, options.Desc)
+	}
+	if options.Href != "" && options.Page < data.Pages {
+		data.NextHref = tableHref(options.Href, options.Page+1, options.Sort, options.Desc)
+	}
+
+	var buf bytes.Buffer
+	err := tableTemplate.Execute(&buf, data)
+	if err != nil {
+		return template.HTMLEscapeString(err.Error())
+	}
+	return buf.String()
+}
+
+func tableHref(href string, page int, sort string, desc bool) string {
+	query := url.Values{}
+	query.Set("page", strconv.Itoa(page))
+	if sort != "" {
+		query.Set("sort", sort)
+		query.Set("order", "asc")
+		if desc {
+			query.Set("order", "desc")
+		}
+	}
+	return href + "?" + query.Encode()
+}
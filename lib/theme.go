@@ -0,0 +1,25 @@
+package lib
+
+// Theme tokens are CSS custom properties with the default dark theme as the fallback. The host defines the
+// properties to match its own theme, light or dark, and cards that use the tokens follow it. The constants can
+// be used wherever a CSS value is expected, e.g. in the style attribute of a custom card.
+const (
+	ColorBackground      = "var(--jarbles-color-background, #262427)"
+	ColorBackgroundHover = "var(--jarbles-color-background-hover, #333134)"
+	ColorText            = "var(--jarbles-color-text, #d8dae3)"
+	ColorBorder          = "var(--jarbles-color-border, #9499A5)"
+	ColorMuted           = "var(--jarbles-color-muted, #777)"
+	ColorSuccess         = "var(--jarbles-color-success, #98c379)"
+	ColorWarning         = "var(--jarbles-color-warning, #e5c07b)"
+	ColorDanger          = "var(--jarbles-color-danger, #e06c75)"
+
+	SpacingSmall  = "var(--jarbles-spacing-small, 0.5rem)"
+	SpacingMedium = "var(--jarbles-spacing-medium, 1rem)"
+	Radius        = "var(--jarbles-radius, 0.5rem)"
+)
+
+// Stylesheet returns the stylesheet of the lib components, for hosts that include it once rather than with
+// every card.
+func Stylesheet() string {
+	return css
+}
@@ -0,0 +1,128 @@
+package framework
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	lintMinDescriptionLength = 20
+	lintDuplicateSimilarity  = 0.8
+)
+
+type LintWarning struct {
+	Tool     string
+	Argument string
+	Message  string
+}
+
+func (w LintWarning) String() string {
+	if w.Argument != "" {
+		return fmt.Sprintf("%s.%s: %s", w.Tool, w.Argument, w.Message)
+	}
+	return fmt.Sprintf("%s: %s", w.Tool, w.Message)
+}
+
+// Lint checks the descriptions of the tools, which the model relies on to choose a tool and its arguments.
+// It warns about empty or very short descriptions, arguments without a description, enum values that no
+// description mentions, tools whose descriptions are so alike that the model may confuse them, and tool hints
+// that refer to unknown tools.
+// When the lint flag is enabled, the warnings are also logged every time the assistant is described.
+func (a *Assistant) Lint() []LintWarning {
+	tools := make([]*toolFunction, 0, len(a.description.Tools))
+	for _, t := range a.description.Tools {
+		if t.Function != nil {
+			tools = append(tools, t.Function)
+		}
+	}
+	sort.Slice(tools, func(i, j int) bool {
+		return tools[i].Name < tools[j].Name
+	})
+
+	var warnings []LintWarning
+	for _, t := range tools {
+		warnings = append(warnings, lintDescription(t.Name, "", t.Description)...)
+
+		if t.Parameters == nil {
+			continue
+		}
+
+		names := make([]string, 0, len(t.Parameters.Properties))
+		for name := range t.Parameters.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			property := t.Parameters.Properties[name]
+			warnings = append(warnings, lintDescription(t.Name, name, property.Description)...)
+
+			described := strings.ToLower(t.Description + " " + property.Description)
+			for _, value := range property.Enum {
+				if !strings.Contains(described, strings.ToLower(value)) {
+					warnings = append(warnings, LintWarning{Tool: t.Name, Argument: name, Message: fmt.Sprintf("enum value %q is never mentioned in a description", value)})
+				}
+			}
+		}
+	}
+
+	for i := range tools {
+		for j := i + 1; j < len(tools); j++ {
+			if lintSimilarity(tools[i].Description, tools[j].Description) >= lintDuplicateSimilarity {
+				warnings = append(warnings, LintWarning{Tool: tools[i].Name, Message: fmt.Sprintf("description is nearly the same as the one of %s", tools[j].Name)})
+			}
+		}
+	}
+
+	for _, hint := range a.description.ToolHints {
+		for _, name := range slices.Concat([]string{hint.Tool}, hint.After, hint.Then) {
+			if _, ok := a.tools[name]; !ok {
+				warnings = append(warnings, LintWarning{Tool: hint.Tool, Message: fmt.Sprintf("tool hint refers to the unknown tool %s", name)})
+			}
+		}
+	}
+
+	return warnings
+}
+
+func lintDescription(tool, argument, description string) []LintWarning {
+	description = strings.TrimSpace(description)
+	switch {
+	case description == "":
+		return []LintWarning{{Tool: tool, Argument: argument, Message: "description is empty"}}
+	case argument == "" && len(description) < lintMinDescriptionLength:
+		return []LintWarning{{Tool: tool, Message: fmt.Sprintf("description is shorter than %d characters", lintMinDescriptionLength)}}
+	}
+	return nil
+}
+
+// lintSimilarity returns the jaccard similarity of the words of two descriptions.
+func lintSimilarity(a, b string) float64 {
+	words := func(s string) map[string]bool {
+		set := make(map[string]bool)
+		for _, word := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if len(word) > 2 {
+				set[word] = true
+			}
+		}
+		return set
+	}
+
+	wa, wb := words(a), words(b)
+	if len(wa) == 0 || len(wb) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for word := range wa {
+		if wb[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(wa)+len(wb)-shared)
+}
@@ -2,32 +2,180 @@ package framework
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/spcoder/jarbles-framework/redact"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+var (
+	// nopLogger discards everything. It's the logger until an assistant or extension executes,
+	// so logging while constructing one, or from a unit test, doesn't panic.
+	nopLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	defaultLogger = slog.Default()
+
+	// logger is the logger of the most recent execute. It's only kept for the Log functions without a context;
+	// anything that has the context of a request should log with LoggerFrom instead.
+	logger atomic.Pointer[slog.Logger]
+)
+
+func init() {
+	logger.Store(nopLogger)
+}
+
+type loggerKey struct{}
+
+// WithLogger returns a copy of ctx that carries l.
+func WithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// LoggerFrom returns the logger of the request that ctx belongs to.
+// It falls back to the logger of the most recent request, or a no-op logger outside of a request.
+func LoggerFrom(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok && l != nil {
+			return l
+		}
+	}
+	return logger.Load()
+}
+
+type requestIDKey struct{}
+
+// RequestIDFrom returns the ID of the request that ctx belongs to, or an empty string outside of a request.
+func RequestIDFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// withRequest returns the context of a new request: an ID is generated and attached to every record of l.
+func withRequest(ctx context.Context, l *slog.Logger) context.Context {
+	id := randomID()
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	return WithLogger(ctx, l.With("request_id", id))
+}
+
+// logFlushBytes is how much of a log is buffered for a storage that can't append.
+const logFlushBytes = 64 << 10
+
+// logKey returns the storage key of a log.
+func logKey(logname string) string {
+	return storageKey("log", logname)
+}
+
+// storageLogWriter writes a log through the storage. A storage that can append gets every record as it's
+// written. Any other storage would have to rewrite the log for every record, so it gets the buffered records
+// when the writer is closed or logFlushBytes have been buffered. The key is looked up for every record, since
+// the request selects its profile after the logger is created.
+type storageLogWriter struct {
+	mu      sync.Mutex
+	storage Storage
+	logname string
+	key     string
+	buf     []byte
+}
+
+func (w *storageLogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	key := logKey(w.logname)
+	if _, ok := w.storage.(Appender); ok {
+		err := appendStorage(w.storage, key, p)
+		if err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if key != w.key {
+		// the buffered records belong to the previous profile
+		err := w.flush()
+		if err != nil {
+			return 0, err
+		}
+		w.key = key
+	}
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= logFlushBytes {
+		err := w.flush()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *storageLogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.flush()
+}
+
+// flush appends the buffered records. The caller holds the lock.
+func (w *storageLogWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	err := appendStorage(w.storage, w.key, w.buf)
+	if err != nil {
+		return fmt.Errorf("error while writing log %s: %w", w.key, err)
+	}
+	w.buf = w.buf[:0]
+	return nil
+}
+
 type LibLogger struct {
 	stringer fmt.Stringer
 	w        io.WriteCloser
 	minLevel slog.Level
 	pretty   bool
+	source   bool
+	state    *libLoggerState
+
+	attrs []slog.Attr
+	group string
 }
 
-func NewLibLogger(stringer fmt.Stringer, logname string) (*slog.Logger, error) {
-	err := os.MkdirAll(LogDir(), 0700)
-	if err != nil {
-		return nil, fmt.Errorf("error while creating log directory: %s: %w", LogDir(), err)
-	}
+// libLoggerState is shared by the handlers writing to the same log file.
+type libLoggerState struct {
+	mu sync.Mutex
 
-	filename := filepath.Join(LogDir(), logname)
-	logfile, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0700)
-	if err != nil {
-		return nil, fmt.Errorf("error while creating log file: %s: %w", filename, err)
+	// records below info level are sampled: only one in every sampleRate is written
+	sampleRate int
+	sampled    int
+
+	// records are passed through redact before they're written
+	redact bool
+
+	// identical consecutive records are collapsed into "last message repeated N times"
+	dedup    bool
+	lastKey  string
+	lastLvl  slog.Level
+	repeated int
+}
+
+func NewLibLogger(stringer fmt.Stringer, logname string) (*slog.Logger, error) {
+	if logname == "" || strings.ContainsAny(logname, `/\`) {
+		return nil, fmt.Errorf("invalid log name: %s", logname)
 	}
+	logfile := &storageLogWriter{storage: CurrentStorage(), logname: logname}
 
 	minLevel := slog.LevelInfo
 	levelStr := os.Getenv("JARBLES_LOG_LEVEL")
@@ -44,7 +192,20 @@ func NewLibLogger(stringer fmt.Stringer, logname string) (*slog.Logger, error) {
 		pretty = false
 	}
 
-	return slog.New(&LibLogger{stringer: stringer, w: logfile, minLevel: minLevel, pretty: pretty}), nil
+	sampleRate, err := strconv.Atoi(os.Getenv("JARBLES_LOG_SAMPLE_RATE"))
+	if err != nil || sampleRate < 1 {
+		sampleRate = 1
+	}
+
+	source := os.Getenv("JARBLES_LOG_SOURCE") == "true"
+
+	state := &libLoggerState{
+		sampleRate: sampleRate,
+		redact:     os.Getenv("JARBLES_LOG_REDACT") == "true",
+		dedup:      os.Getenv("JARBLES_LOG_DEDUP") != "false",
+	}
+
+	return slog.New(&LibLogger{stringer: stringer, w: logfile, minLevel: minLevel, pretty: pretty, source: source, state: state}), nil
 }
 
 func (l LibLogger) Enabled(context context.Context, level slog.Level) bool {
@@ -52,33 +213,97 @@ func (l LibLogger) Enabled(context context.Context, level slog.Level) bool {
 }
 
 func (l LibLogger) Handle(context context.Context, record slog.Record) error {
+	l.state.mu.Lock()
+	defer l.state.mu.Unlock()
+
+	if record.Level < slog.LevelInfo && l.state.sampleRate > 1 {
+		l.state.sampled++
+		if l.state.sampled%l.state.sampleRate != 1 {
+			return nil
+		}
+	}
+
+	line, key := l.format(record)
+	if l.state.redact {
+		line, key = redact.Redact(line), redact.Redact(key)
+	}
+
+	if l.state.dedup {
+		if key == l.state.lastKey {
+			l.state.repeated++
+			return nil
+		}
+		err := l.flushRepeated()
+		if err != nil {
+			return err
+		}
+		l.state.lastKey = key
+		l.state.lastLvl = record.Level
+	}
+
+	_, err := fmt.Fprintf(l.w, "%s\n", line)
+	return err
+}
+
+// flushRepeated writes how often the last message was repeated, if it was. The caller holds the state lock.
+func (l LibLogger) flushRepeated() error {
+	if l.state.repeated == 0 {
+		return nil
+	}
+
+	message := fmt.Sprintf("last message repeated %d times", l.state.repeated)
+	l.state.repeated = 0
+
+	line, _ := l.format(slog.NewRecord(time.Now(), l.state.lastLvl, message, 0))
+	_, err := fmt.Fprintf(l.w, "%s\n", line)
+	return err
+}
+
+// format returns the line to write for the record, and a key that is the same for records
+// that only differ in time.
+func (l LibLogger) format(record slog.Record) (string, string) {
 	message := record.Message
 
+	attrs := make([]slog.Attr, 0, len(l.attrs)+record.NumAttrs()+1)
+	attrs = append(attrs, l.attrs...)
+	record.Attrs(func(attr slog.Attr) bool {
+		attrs = append(attrs, l.grouped(attr))
+		return true
+	})
+	if l.source && record.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{record.PC}).Next()
+		attrs = append(attrs, slog.String(slog.SourceKey, fmt.Sprintf("%s:%d", filepath.Base(frame.File), frame.Line)))
+	}
+
 	line := ""
+	key := ""
 	if l.pretty {
-		attrs := make([]string, 0)
-		record.Attrs(func(attr slog.Attr) bool {
-			attrs = append(attrs, fmt.Sprintf("- %v: %v", attr.Key, attr.Value))
-			return true
-		})
-
 		timestamp := record.Time.Format(time.Kitchen)
-		line += fmt.Sprintf("\n%v %v %v\n", timestamp, levelAbbrev(record.Level), message)
+		body := fmt.Sprintf("%v %v\n", levelAbbrev(record.Level), message)
 		for _, attr := range attrs {
-			line += fmt.Sprintf("  %v\n", attr)
+			body += fmt.Sprintf("  - %v: %v\n", attr.Key, attr.Value)
 		}
+		line = fmt.Sprintf("\n%v %v", timestamp, body)
+		key = body
 	} else {
-		record.Attrs(func(attr slog.Attr) bool {
+		for _, attr := range attrs {
 			message += fmt.Sprintf(" %v", attr)
-			return true
-		})
+		}
 
 		timestamp := record.Time.Format(time.Kitchen)
 		line = fmt.Sprintf("[%v] %s %v %v", record.Level, l.stringer.String(), timestamp, message)
+		key = fmt.Sprintf("[%v] %v", record.Level, message)
 	}
 
-	_, err := fmt.Fprintf(l.w, "%s\n", line)
-	return err
+	return line, key
+}
+
+// grouped qualifies the key of the attr with the group of the handler, if any.
+func (l LibLogger) grouped(attr slog.Attr) slog.Attr {
+	if l.group != "" {
+		attr.Key = l.group + "." + attr.Key
+	}
+	return attr
 }
 
 func levelAbbrev(level slog.Level) string {
@@ -97,63 +322,118 @@ func levelAbbrev(level slog.Level) string {
 }
 
 func (l LibLogger) WithAttrs(attrs []slog.Attr) slog.Handler {
-	panic("unimplemented")
+	h := l
+	h.attrs = make([]slog.Attr, 0, len(l.attrs)+len(attrs))
+	h.attrs = append(h.attrs, l.attrs...)
+	for _, attr := range attrs {
+		h.attrs = append(h.attrs, l.grouped(attr))
+	}
+	return &h
 }
 
 func (l LibLogger) WithGroup(name string) slog.Handler {
-	panic("unimplemented")
+	if name == "" {
+		return &l
+	}
+
+	h := l
+	h.group = l.grouped(slog.Attr{Key: name}).Key
+	return &h
 }
 
 func (l LibLogger) Close() error {
-	return l.w.Close()
+	l.state.mu.Lock()
+	err := l.flushRepeated()
+	l.state.mu.Unlock()
+
+	return errors.Join(err, l.w.Close())
 }
 
 //goland:noinspection GoUnusedExportedFunction
 func Log(ctx context.Context, level slog.Level, msg string, args ...any) {
-	logger.Log(ctx, level, msg, args...)
+	logAt(ctx, LoggerFrom(ctx), level, msg, args...)
 }
 
 //goland:noinspection GoUnusedExportedFunction
 func LogAttrs(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
-	logger.LogAttrs(ctx, level, msg, attrs...)
+	l := LoggerFrom(ctx)
+	if !l.Enabled(ctx, level) {
+		return
+	}
+	var pcs [1]uintptr
+	runtime.Callers(2, pcs[:])
+	record := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	record.AddAttrs(attrs...)
+	_ = l.Handler().Handle(ctx, record)
 }
 
+// The Log functions without a context log to the logger of the most recent request. When more than one
+// assistant or extension executes in the same process, use the Context variants or LoggerFrom.
+
+// LogDebug logs at the debug level to the logger of the most recent request.
+//
+// Deprecated: use LoggerFrom(ctx) or LogDebugContext, which log to the logger of the request of ctx.
+//
 //goland:noinspection GoUnusedExportedFunction
 func LogDebug(msg string, args ...any) {
-	logger.Debug(msg, args...)
+	logAt(context.Background(), logger.Load(), slog.LevelDebug, msg, args...)
 }
 
 //goland:noinspection GoUnusedExportedFunction
 func LogDebugContext(ctx context.Context, msg string, args ...any) {
-	logger.DebugContext(ctx, msg, args...)
+	logAt(ctx, LoggerFrom(ctx), slog.LevelDebug, msg, args...)
 }
 
+// LogInfo logs at the info level to the logger of the most recent request.
+//
+// Deprecated: use LoggerFrom(ctx) or LogInfoContext, which log to the logger of the request of ctx.
+//
 //goland:noinspection GoUnusedExportedFunction
 func LogInfo(msg string, args ...any) {
-	logger.Info(msg, args...)
+	logAt(context.Background(), logger.Load(), slog.LevelInfo, msg, args...)
 }
 
 //goland:noinspection GoUnusedExportedFunction
 func LogInfoContext(ctx context.Context, msg string, args ...any) {
-	logger.InfoContext(ctx, msg, args...)
+	logAt(ctx, LoggerFrom(ctx), slog.LevelInfo, msg, args...)
 }
 
+// LogWarn logs at the warning level to the logger of the most recent request.
+//
+// Deprecated: use LoggerFrom(ctx) or LogWarnContext, which log to the logger of the request of ctx.
+//
 //goland:noinspection GoUnusedExportedFunction
 func LogWarn(msg string, args ...any) {
-	logger.Warn(msg, args...)
+	logAt(context.Background(), logger.Load(), slog.LevelWarn, msg, args...)
 }
 
 //goland:noinspection GoUnusedExportedFunction
 func LogWarnContext(ctx context.Context, msg string, args ...any) {
-	logger.WarnContext(ctx, msg, args...)
+	logAt(ctx, LoggerFrom(ctx), slog.LevelWarn, msg, args...)
 }
 
+// LogError logs at the error level to the logger of the most recent request.
+//
+// Deprecated: use LoggerFrom(ctx) or LogErrorContext, which log to the logger of the request of ctx.
+//
 //goland:noinspection GoUnusedExportedFunction
 func LogError(msg string, args ...any) {
-	logger.Error(msg, args...)
+	logAt(context.Background(), logger.Load(), slog.LevelError, msg, args...)
 }
 
 //goland:noinspection GoUnusedExportedFunction
 func LogErrorContext(ctx context.Context, msg string, args ...any) {
-	logger.ErrorContext(ctx, msg, args...)
+	logAt(ctx, LoggerFrom(ctx), slog.LevelError, msg, args...)
+}
+
+// logAt logs like slog.Logger.Log, but records the caller of the Log function as the source instead of the Log function.
+func logAt(ctx context.Context, l *slog.Logger, level slog.Level, msg string, args ...any) {
+	if !l.Enabled(ctx, level) {
+		return
+	}
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	record := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	record.Add(args...)
+	_ = l.Handler().Handle(ctx, record)
 }
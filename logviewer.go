@@ -0,0 +1,183 @@
+package framework
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spcoder/jarbles-framework/lib"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// logTailBytes is how much of the end of a log file is read to find the last records.
+const logTailBytes = 1 << 20
+
+type AddLogViewerCardOptions struct {
+	ID       string
+	Title    string
+	Logname  string
+	Lines    int
+	MinLevel slog.Level
+	Refresh  time.Duration
+	Height   string
+}
+
+// AddLogViewerCard adds a card that shows the last records of a log file in the log directory, and the action
+// that renders them. The card refreshes itself and the records can be filtered by level.
+// Logname defaults to extensions.log, Lines to 200, and Refresh to 10 seconds.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (e *Extension) AddLogViewerCard(options AddLogViewerCardOptions) {
+	if options.Logname == "" {
+		options.Logname = "extensions.log"
+	}
+	if options.Lines == 0 {
+		options.Lines = 200
+	}
+	if options.Refresh == 0 {
+		options.Refresh = 10 * time.Second
+	}
+	if options.Title == "" {
+		options.Title = options.Logname
+	}
+
+	e.AddAction(AddActionOptions{
+		ID: options.ID,
+		Function: func(payload string) (*ExtensionResponse, error) {
+			key := logKey(options.Logname)
+			if !strings.HasPrefix(key, logKey("")+"/") {
+				LogError("log is outside of the log directory", "logname", options.Logname)
+				return nil, fmt.Errorf("log is outside of the log directory: %s", options.Logname)
+			}
+
+			records, err := tailLog(key, options.Lines)
+			if err != nil {
+				LogError("error while reading log", "key", key, "error", err.Error())
+				return nil, err
+			}
+
+			return &ExtensionResponse{
+				HTMLTitle: options.Title,
+				HTMLBody: lib.LogViewer(lib.LogViewerOptions{
+					Title:    options.Title,
+					Records:  records,
+					MinLevel: options.MinLevel,
+					Refresh:  options.Refresh,
+				}),
+				NoLayout: true,
+			}, nil
+		},
+	})
+
+	e.AddCardCustom(ExtensionCard{
+		ID: options.ID,
+		HTML: lib.CardLogViewer(lib.CardLogViewerOptions{
+			ExtensionName: e.Name,
+			Title:         options.Title,
+			Href:          e.ActionUrl(slugify(options.ID)),
+			Height:        options.Height,
+		}),
+	})
+}
+
+// tailLog returns the last records of a log written by LibLogger, in either the pretty or the plain format.
+func tailLog(key string, n int) ([]lib.LogRecord, error) {
+	data, offset, err := readLogTail(CurrentStorage(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []lib.LogRecord
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		// attribute lines of the pretty format belong to the record above them
+		if strings.HasPrefix(line, "  ") {
+			if len(records) > 0 {
+				records[len(records)-1].Text += "\n" + line
+			}
+			continue
+		}
+
+		records = append(records, lib.LogRecord{Level: logLineLevel(line), Text: line})
+	}
+
+	// the first record may have been cut off by the offset
+	if offset > 0 && len(records) > 0 {
+		records = records[1:]
+	}
+	if len(records) > n {
+		records = records[len(records)-n:]
+	}
+
+	return records, nil
+}
+
+// readLogTail returns the last logTailBytes of the log at key and the offset they start at. A log in a
+// FileStorage can be read from the offset, any other storage has to read all of it.
+func readLogTail(s Storage, key string) ([]byte, int64, error) {
+	fileStorage, ok := s.(FileStorage)
+	if !ok {
+		data, err := s.Read(key)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, 0, nil
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("error while reading log: %w", err)
+		}
+		offset := max(len(data)-logTailBytes, 0)
+		return data[offset:], int64(offset), nil
+	}
+
+	f, err := os.Open(fileStorage.filename(key))
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("error while opening log: %w", err)
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, fmt.Errorf("error while reading log info: %w", err)
+	}
+
+	offset := max(info.Size()-logTailBytes, 0)
+	data, err := io.ReadAll(io.NewSectionReader(f, offset, info.Size()-offset))
+	if err != nil {
+		return nil, 0, fmt.Errorf("error while reading log: %w", err)
+	}
+	return data, offset, nil
+}
+
+// logLineLevel parses the level of the first line of a record, e.g. "3:04PM WRN message" or "[WARN] (id) message".
+func logLineLevel(line string) slog.Level {
+	if strings.HasPrefix(line, "[") {
+		end := strings.Index(line, "]")
+		var level slog.Level
+		if end > 0 && level.UnmarshalText([]byte(line[1:end])) == nil {
+			return level
+		}
+		return slog.LevelInfo
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) > 1 {
+		switch fields[1] {
+		case "DBG":
+			return slog.LevelDebug
+		case "WRN":
+			return slog.LevelWarn
+		case "ERR":
+			return slog.LevelError
+		}
+	}
+	return slog.LevelInfo
+}
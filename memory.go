@@ -0,0 +1,252 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryEntry is something the running assistant or extension remembers, e.g. a turn of a conversation or a
+// fact. A compaction replaces the oldest entries with one Summary entry.
+type MemoryEntry struct {
+	Time    time.Time `json:"time"`
+	Role    string    `json:"role,omitempty"`
+	Text    string    `json:"text"`
+	Summary bool      `json:"summary,omitempty"`
+}
+
+type MemoryCompactionOptions struct {
+	// LLM condenses the entries, the framework doesn't call models itself.
+	LLM LLMFunction
+	// MaxEntries is how many entries the memory holds before MemoryAppend compacts it. Defaults to 100.
+	MaxEntries int
+	// Keep is how many of the newest entries a compaction leaves as they are. Defaults to 20.
+	Keep int
+	// Prompt is sent with the entries, which follow it. Defaults to a request for a summary that keeps facts
+	// and decisions.
+	Prompt string
+}
+
+var (
+	memoryMu         sync.Mutex
+	memoryCompaction *MemoryCompactionOptions
+)
+
+// OnMemoryCompaction makes MemoryAppend condense the oldest entries of the memory with options.LLM when it
+// holds more than options.MaxEntries, so the memory of a long-lived assistant stays bounded.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (a *Assistant) OnMemoryCompaction(options MemoryCompactionOptions) {
+	setMemoryCompaction(options)
+}
+
+// OnMemoryCompaction is like Assistant.OnMemoryCompaction.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (e *Extension) OnMemoryCompaction(options MemoryCompactionOptions) {
+	setMemoryCompaction(options)
+}
+
+func setMemoryCompaction(options MemoryCompactionOptions) {
+	if options.MaxEntries <= 0 {
+		options.MaxEntries = 100
+	}
+	if options.Keep <= 0 {
+		options.Keep = 20
+	}
+	options.Keep = min(options.Keep, options.MaxEntries)
+	if options.Prompt == "" {
+		options.Prompt = "Summarize the following memory of an assistant concisely, keeping facts about the user, " +
+			"names, numbers, decisions, and open tasks:"
+	}
+
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+
+	memoryCompaction = &options
+}
+
+// Memory returns the entries of the memory of the running assistant or extension, oldest first.
+//
+//goland:noinspection GoUnusedExportedFunction
+func Memory() ([]MemoryEntry, error) {
+	key, err := memoryKey()
+	if err != nil {
+		return nil, err
+	}
+	return loadMemory(key)
+}
+
+// MemoryAppend adds an entry to the memory of the running assistant or extension. The time of the entry
+// defaults to now. When OnMemoryCompaction is set and the memory is full it is compacted, a compaction that
+// fails is logged and tried again with the next entry.
+//
+//goland:noinspection GoUnusedExportedFunction
+func MemoryAppend(ctx context.Context, entry MemoryEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	var count int
+	err := updateMemory(func(entries []MemoryEntry) ([]MemoryEntry, error) {
+		entries = append(entries, entry)
+		count = len(entries)
+		return entries, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	memoryMu.Lock()
+	options := memoryCompaction
+	memoryMu.Unlock()
+	if options == nil || count <= options.MaxEntries {
+		return nil
+	}
+
+	err = compactMemory(ctx, *options)
+	if err != nil {
+		LoggerFrom(ctx).Warn("error while compacting memory", "entries", count, "error", err.Error())
+	}
+	return nil
+}
+
+// MemoryCompact condenses the memory of the running assistant or extension now, regardless of its size.
+// It fails when OnMemoryCompaction isn't set.
+//
+//goland:noinspection GoUnusedExportedFunction
+func MemoryCompact(ctx context.Context) error {
+	memoryMu.Lock()
+	options := memoryCompaction
+	memoryMu.Unlock()
+	if options == nil {
+		return fmt.Errorf("error while compacting memory: OnMemoryCompaction isn't set")
+	}
+
+	return compactMemory(ctx, *options)
+}
+
+// MemoryClear forgets all the entries of the memory of the running assistant or extension.
+//
+//goland:noinspection GoUnusedExportedFunction
+func MemoryClear() error {
+	return updateMemory(func(_ []MemoryEntry) ([]MemoryEntry, error) {
+		return nil, nil
+	})
+}
+
+// compactMemory summarizes all but the newest options.Keep entries into one. The model is called without the
+// lock, so entries appended meanwhile are kept, and the summary is dropped when another compaction won.
+func compactMemory(ctx context.Context, options MemoryCompactionOptions) error {
+	key, err := memoryKey()
+	if err != nil {
+		return err
+	}
+	entries, err := loadMemory(key)
+	if err != nil {
+		return err
+	}
+	if len(entries) <= options.Keep {
+		return nil
+	}
+
+	old := entries[:len(entries)-options.Keep]
+	var sb strings.Builder
+	for _, entry := range old {
+		switch {
+		case entry.Summary:
+			sb.WriteString("Summary of earlier entries: ")
+		case entry.Role != "":
+			sb.WriteString(entry.Time.Format(time.DateTime) + " " + entry.Role + ": ")
+		default:
+			sb.WriteString(entry.Time.Format(time.DateTime) + ": ")
+		}
+		sb.WriteString(entry.Text + "\n\n")
+	}
+
+	LoggerFrom(ctx).Info("compacting memory", "entries", len(old), "kept", options.Keep)
+	summary, err := SummarizeMapReduce(ctx, Chunk(sb.String(), ChunkOptions{}), options.LLM, SummarizeOptions{Prompt: options.Prompt})
+	if err != nil {
+		return err
+	}
+
+	last := old[len(old)-1]
+	return updateMemory(func(entries []MemoryEntry) ([]MemoryEntry, error) {
+		if len(entries) < len(old) || entries[len(old)-1] != last {
+			LoggerFrom(ctx).Debug("memory changed while compacting, dropping the summary")
+			return entries, nil
+		}
+
+		compacted := []MemoryEntry{{Time: last.Time, Text: summary, Summary: true}}
+		return append(compacted, entries[len(old):]...), nil
+	})
+}
+
+func memoryKey() (string, error) {
+	id, err := currentConfigID()
+	if err != nil {
+		return "", fmt.Errorf("memory is not available before an assistant or extension is created")
+	}
+
+	return storageKey("data", id, "memory.json"), nil
+}
+
+func loadMemory(key string) ([]MemoryEntry, error) {
+	var entries []MemoryEntry
+	data, err := CurrentStorage().Read(key)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while reading memory: %w", err)
+	}
+
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("error while unmarshaling memory: %w", err)
+	}
+	return entries, nil
+}
+
+// updateMemory loads the memory, passes it to update, and saves what update returns, under a lock shared by
+// all processes.
+func updateMemory(update func(entries []MemoryEntry) ([]MemoryEntry, error)) error {
+	key, err := memoryKey()
+	if err != nil {
+		return err
+	}
+	id, _ := currentConfigID()
+
+	unlock, err := lockFile(filepath.Join(profileStateDir("locks"), id+"-memory.lock"), 10*time.Second, time.Minute)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, err := loadMemory(key)
+	if err != nil {
+		return err
+	}
+
+	entries, err = update(entries)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("error while marshaling memory: %w", err)
+	}
+
+	err = CurrentStorage().Write(key, data)
+	if err != nil {
+		return fmt.Errorf("error while writing memory: %w", err)
+	}
+	return nil
+}
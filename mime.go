@@ -0,0 +1,364 @@
+package framework
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	MIMEDocx = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	MIMEPDF  = "application/pdf"
+)
+
+var ErrUnsupportedMIME = errors.New("unsupported mime type")
+
+// extensionMIME covers the extensions that mime.TypeByExtension doesn't know on every platform.
+var extensionMIME = map[string]string{
+	".md":       ContentTypeMarkdown,
+	".markdown": ContentTypeMarkdown,
+	".go":       ContentTypeText,
+	".txt":      ContentTypeText,
+	".csv":      "text/csv",
+	".json":     ContentTypeJSON,
+	".toml":     "application/toml",
+	".yaml":     "application/yaml",
+	".yml":      "application/yaml",
+	".html":     ContentTypeHTML,
+	".htm":      ContentTypeHTML,
+	".docx":     MIMEDocx,
+	".pdf":      MIMEPDF,
+}
+
+// DetectMIME returns the mime type of a file without parameters, e.g. "text/html". The extension decides,
+// the content is sniffed for files with an unknown extension.
+//
+//goland:noinspection GoUnusedExportedFunction
+func DetectMIME(path string) (string, error) {
+	if t := mimeByExtension(path); t != "" {
+		return t, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		LogError("error while opening file", "path", path, "error", err.Error())
+		return "", fmt.Errorf("error while opening file at %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		LogError("error while reading file", "path", path, "error", err.Error())
+		return "", fmt.Errorf("error while reading file at %s: %w", path, err)
+	}
+	t, _, _ := strings.Cut(http.DetectContentType(head[:n]), ";")
+	return t, nil
+}
+
+// mimeByExtension returns the mime type of a file name without parameters, or an empty string when the
+// extension is unknown.
+func mimeByExtension(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if t, ok := extensionMIME[ext]; ok {
+		return t
+	}
+	t, _, _ := strings.Cut(mime.TypeByExtension(ext), ";")
+	return t
+}
+
+// ExtractText reads a file as text for a model: HTML is converted to markdown, docx to plain text, and
+// other text formats are returned as is. Other types return an error wrapping ErrUnsupportedMIME.
+//
+//goland:noinspection GoUnusedExportedFunction
+func ExtractText(path string) (string, error) {
+	t, err := DetectMIME(path)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case t == MIMEDocx:
+		return DocxToText(path)
+	case t == ContentTypeHTML:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			LogError("error while reading file", "path", path, "error", err.Error())
+			return "", fmt.Errorf("error while reading file at %s: %w", path, err)
+		}
+		return HTMLToMarkdown(string(data)), nil
+	case textMIME(t):
+		data, err := os.ReadFile(path)
+		if err != nil {
+			LogError("error while reading file", "path", path, "error", err.Error())
+			return "", fmt.Errorf("error while reading file at %s: %w", path, err)
+		}
+		return string(data), nil
+	default:
+		LogError("unsupported mime type", "path", path, "type", t)
+		return "", fmt.Errorf("%w: %s is %s", ErrUnsupportedMIME, filepath.Base(path), t)
+	}
+}
+
+func textMIME(t string) bool {
+	switch t {
+	case ContentTypeJSON, "application/toml", "application/yaml", "application/xml", "application/javascript":
+		return true
+	}
+	return strings.HasPrefix(t, "text/")
+}
+
+// HTMLToMarkdown converts HTML to markdown, keeping headings, paragraphs, links, emphasis, lists, code, and
+// quotes. Scripts, styles, and unknown markup are dropped.
+func HTMLToMarkdown(html string) string {
+	decoder := xml.NewDecoder(strings.NewReader(html))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	var (
+		sb    strings.Builder
+		skip  int      // depth inside script and style
+		pre   int      // depth inside pre
+		lists []string // the markers of the open lists
+		hrefs []string // the targets of the open links
+	)
+	block := func(prefix string) {
+		out := strings.TrimRight(sb.String(), " ")
+		sb.Reset()
+		sb.WriteString(out)
+		if sb.Len() > 0 && !strings.HasSuffix(out, "\n\n") {
+			if strings.HasSuffix(out, "\n") {
+				sb.WriteString("\n")
+			} else {
+				sb.WriteString("\n\n")
+			}
+		}
+		sb.WriteString(prefix)
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break // io.EOF, or markup that can't be parsed, the text so far is kept
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(t.Name.Local)
+			switch name {
+			case "script", "style", "head", "noscript":
+				skip++
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				block(strings.Repeat("#", int(name[1]-'0')) + " ")
+			case "p", "div", "section", "article", "table", "tr":
+				block("")
+			case "br":
+				sb.WriteString("\n")
+			case "blockquote":
+				block("> ")
+			case "pre":
+				block("```\n")
+				pre++
+			case "code":
+				if pre == 0 {
+					sb.WriteString("`")
+				}
+			case "strong", "b":
+				sb.WriteString("**")
+			case "em", "i":
+				sb.WriteString("*")
+			case "ul", "ol":
+				lists = append(lists, map[string]string{"ul": "- ", "ol": "1. "}[name])
+			case "li":
+				marker := "- "
+				if len(lists) > 0 {
+					marker = lists[len(lists)-1]
+				}
+				sb.WriteString("\n" + strings.Repeat("  ", max(0, len(lists)-1)) + marker)
+			case "a":
+				hrefs = append(hrefs, htmlAttr(t, "href"))
+				sb.WriteString("[")
+			case "img":
+				sb.WriteString(fmt.Sprintf("![%s](%s)", htmlAttr(t, "alt"), htmlAttr(t, "src")))
+			case "td", "th":
+				sb.WriteString("| ")
+			case "hr":
+				block("---")
+			}
+		case xml.EndElement:
+			name := strings.ToLower(t.Name.Local)
+			switch name {
+			case "script", "style", "head", "noscript":
+				skip = max(0, skip-1)
+			case "h1", "h2", "h3", "h4", "h5", "h6", "p", "div", "section", "article", "blockquote", "table":
+				block("")
+			case "pre":
+				pre = max(0, pre-1)
+				if !strings.HasSuffix(sb.String(), "\n") {
+					sb.WriteString("\n")
+				}
+				sb.WriteString("```")
+				block("")
+			case "code":
+				if pre == 0 {
+					sb.WriteString("`")
+				}
+			case "strong", "b":
+				sb.WriteString("**")
+			case "em", "i":
+				sb.WriteString("*")
+			case "ul", "ol":
+				if len(lists) > 0 {
+					lists = lists[:len(lists)-1]
+				}
+				if len(lists) == 0 {
+					block("")
+				}
+			case "a":
+				href := ""
+				if len(hrefs) > 0 {
+					href, hrefs = hrefs[len(hrefs)-1], hrefs[:len(hrefs)-1]
+				}
+				sb.WriteString("](" + href + ")")
+			case "td", "th":
+				sb.WriteString(" ")
+			case "tr":
+				sb.WriteString("|")
+			}
+		case xml.CharData:
+			if skip > 0 {
+				continue
+			}
+			if pre > 0 {
+				sb.Write(t)
+				continue
+			}
+			text := strings.Join(strings.Fields(string(t)), " ")
+			if text == "" {
+				if len(t) > 0 && !strings.HasSuffix(sb.String(), " ") && !strings.HasSuffix(sb.String(), "\n") {
+					sb.WriteString(" ")
+				}
+				continue
+			}
+			if startsWithSpace(t) && sb.Len() > 0 && !strings.HasSuffix(sb.String(), " ") && !strings.HasSuffix(sb.String(), "\n") {
+				sb.WriteString(" ")
+			}
+			sb.WriteString(text)
+			if endsWithSpace(t) {
+				sb.WriteString(" ")
+			}
+		}
+	}
+
+	return strings.TrimSpace(blankLines.ReplaceAllString(sb.String(), "\n\n"))
+}
+
+var blankLines = regexp.MustCompile(`\n[ \t]*\n(?:[ \t]*\n)+`)
+
+func htmlAttr(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if strings.EqualFold(attr.Name.Local, name) {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func startsWithSpace(b []byte) bool {
+	return len(b) > 0 && strings.ContainsRune(" \t\r\n", rune(b[0]))
+}
+
+func endsWithSpace(b []byte) bool {
+	return len(b) > 0 && strings.ContainsRune(" \t\r\n", rune(b[len(b)-1]))
+}
+
+var markdownReplacements = []struct {
+	re   *regexp.Regexp
+	with string
+}{
+	{regexp.MustCompile("(?m)^```.*$\n?"), ""},
+	{regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`), "$1"},
+	{regexp.MustCompile(`\[([^\]]*)\]\(([^)]*)\)`), "$1 ($2)"},
+	{regexp.MustCompile(`(?m)^#{1,6}\s+`), ""},
+	{regexp.MustCompile(`(?m)^>\s?`), ""},
+	{regexp.MustCompile(`(?m)^(\s*)[*+]\s+`), "$1- "},
+	{regexp.MustCompile(`(?m)^\s*(?:-{3,}|\*{3,}|_{3,})\s*$`), ""},
+	{regexp.MustCompile(`(\*\*|__)(.+?)(\*\*|__)`), "$2"},
+	{regexp.MustCompile(`(^|[^\w*])[*_]([^*_\n]+)[*_]`), "$1$2"},
+	{regexp.MustCompile("`([^`]*)`"), "$1"},
+}
+
+// MarkdownToText strips the markdown syntax that reads badly as plain text: headings, emphasis, code
+// fences, quotes, and rules. Links keep their URL in parentheses.
+func MarkdownToText(markdown string) string {
+	text := markdown
+	for _, r := range markdownReplacements {
+		text = r.re.ReplaceAllString(text, r.with)
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(text, "\n\n"))
+}
+
+// DocxToText extracts the text of a Word document, one line per paragraph.
+func DocxToText(path string) (string, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		LogError("error while opening docx", "path", path, "error", err.Error())
+		return "", fmt.Errorf("error while opening docx at %s: %w", path, err)
+	}
+	defer func() { _ = archive.Close() }()
+
+	f, err := archive.Open("word/document.xml")
+	if err != nil {
+		LogError("error while opening docx document", "path", path, "error", err.Error())
+		return "", fmt.Errorf("error while opening docx document at %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var buf bytes.Buffer
+	decoder := xml.NewDecoder(f)
+	inText := false
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			LogError("error while parsing docx", "path", path, "error", err.Error())
+			return "", fmt.Errorf("error while parsing docx at %s: %w", path, err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				buf.WriteString("\t")
+			case "br", "cr":
+				buf.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				buf.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				buf.Write(t)
+			}
+		}
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
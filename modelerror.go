@@ -0,0 +1,64 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+// ToolError is an error written for the model that called a tool: what went wrong in a short message, and a
+// hint of what to try next. Models tend to give up on a chain of Go errors, so when a tool fails with a
+// ToolError anywhere in the chain, the model only gets the message and the hint, and the chain is logged.
+type ToolError struct {
+	Message string
+	Hint    string
+	// Err is the cause, which errors.Is and errors.As see.
+	Err error
+}
+
+func (e *ToolError) Error() string {
+	return e.Message
+}
+
+func (e *ToolError) Unwrap() error {
+	return e.Err
+}
+
+// ModelError returns a ToolError with the message and the hint, e.g.
+// ModelError("no such city: Pariss", "check the spelling or use the search-cities tool").
+//
+//goland:noinspection GoUnusedExportedFunction
+func ModelError(message, hint string) error {
+	return &ToolError{Message: message, Hint: hint}
+}
+
+// withHint returns err as a ToolError with the hint.
+func withHint(err error, hint string) error {
+	return &ToolError{Message: err.Error(), Hint: hint, Err: err}
+}
+
+// modelErrorText returns the error of a tool as the model gets it: the message and the hint of a ToolError in
+// the chain, or a hint for the common causes that don't have one. Other errors are returned as they are.
+func modelErrorText(err error) error {
+	var toolErr *ToolError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &toolErr):
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		toolErr = &ToolError{Message: err.Error(), Hint: "send the arguments as a JSON object that matches the parameters of the tool"}
+	case errors.Is(err, os.ErrNotExist):
+		toolErr = &ToolError{Message: err.Error(), Hint: "check the name and the directory, e.g. by listing the directory first"}
+	case errors.Is(err, context.DeadlineExceeded):
+		toolErr = &ToolError{Message: err.Error(), Hint: "try again with a smaller request, or later"}
+	default:
+		return err
+	}
+
+	text := "error: " + toolErr.Message
+	if toolErr.Hint != "" {
+		text += "\nhint: " + toolErr.Hint
+	}
+	return errors.New(text)
+}
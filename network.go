@@ -0,0 +1,226 @@
+package framework
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrNetworkDisabled = errors.New("network access is disabled")
+	ErrHostNotAllowed  = errors.New("host is not allowed by the network policy")
+	ErrPinMismatch     = errors.New("certificate doesn't match the pinned keys")
+)
+
+// NetworkPolicy restricts the outbound requests of the clients returned by HTTPClient.
+// Hosts are matched exactly, "*.example.com" matches the subdomains of example.com, and "*" matches every host.
+type NetworkPolicy struct {
+	// Disabled blocks all requests.
+	Disabled bool
+	// AllowHosts, when not empty, are the only hosts requests can be made to.
+	AllowHosts []string
+	// DenyHosts are blocked even when they're allowed.
+	DenyHosts []string
+	// Proxy is the URL of the proxy for all requests. When empty, the proxy is read from the environment.
+	Proxy string
+	// Pins maps a host to the base64 encoded SHA-256 hashes of the public keys its certificate chain must include.
+	Pins map[string][]string
+}
+
+var (
+	networkPolicyMu sync.RWMutex
+	networkPolicy   = networkPolicyFromEnv()
+	// networkTransportOfPolicy is the transport of networkPolicy. It's built on first use and again after the
+	// policy changes, so that connections are kept alive across requests.
+	networkTransportOfPolicy *http.Transport
+)
+
+// networkPolicyFromEnv reads the initial policy: JARBLES_NETWORK=off disables the network, and
+// JARBLES_NETWORK_ALLOW, JARBLES_NETWORK_DENY, and JARBLES_NETWORK_PROXY set the hosts and the proxy.
+func networkPolicyFromEnv() NetworkPolicy {
+	hosts := func(key string) []string {
+		var list []string
+		for _, host := range strings.Split(os.Getenv(key), ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				list = append(list, host)
+			}
+		}
+		return list
+	}
+
+	return NetworkPolicy{
+		Disabled:   os.Getenv("JARBLES_NETWORK") == "off",
+		AllowHosts: hosts("JARBLES_NETWORK_ALLOW"),
+		DenyHosts:  hosts("JARBLES_NETWORK_DENY"),
+		Proxy:      os.Getenv("JARBLES_NETWORK_PROXY"),
+	}
+}
+
+// SetNetworkPolicy replaces the policy of the built-in tools and of the clients returned by HTTPClient.
+//
+//goland:noinspection GoUnusedExportedFunction
+func SetNetworkPolicy(policy NetworkPolicy) {
+	networkPolicyMu.Lock()
+	defer networkPolicyMu.Unlock()
+
+	networkPolicy = policy
+	if networkTransportOfPolicy != nil {
+		networkTransportOfPolicy.CloseIdleConnections()
+		networkTransportOfPolicy = nil
+	}
+}
+
+// CurrentNetworkPolicy returns the policy in effect.
+func CurrentNetworkPolicy() NetworkPolicy {
+	networkPolicyMu.RLock()
+	defer networkPolicyMu.RUnlock()
+
+	return networkPolicy
+}
+
+// HTTPClient returns a client that enforces the network policy. The built-in tools make all of their requests
+// with it, and custom tools should too. When JARBLES_CASSETTE is set, requests are recorded to or replayed from
+// that cassette, depending on JARBLES_RECORDER_MODE. Otherwise GET and HEAD requests are retried with
+// DefaultRetryPolicy on network errors and on responses with a status that RetryableHTTPStatus accepts.
+func HTTPClient() *http.Client {
+	policy, transport := currentNetworkTransport()
+
+	httpTransportMu.RLock()
+	rt := httpTransport
+	httpTransportMu.RUnlock()
+
+	if rt == nil {
+		if cassette := os.Getenv("JARBLES_CASSETTE"); cassette != "" {
+			rt = NewRecorder(cassette, os.Getenv("JARBLES_RECORDER_MODE"))
+		} else {
+			rt = &retryTransport{policy: DefaultRetryPolicy, next: transport}
+		}
+	}
+
+	return &http.Client{Transport: &policyTransport{policy: policy, next: rt}}
+}
+
+// networkTransport returns a transport that enforces the network policy in effect, its hosts, proxy, and pins,
+// without the retries and the recorder of HTTPClient.
+func networkTransport() http.RoundTripper {
+	policy, transport := currentNetworkTransport()
+	return &policyTransport{policy: policy, next: transport}
+}
+
+// currentNetworkTransport returns the policy in effect and its transport, building the transport when the
+// policy changed since the last request.
+func currentNetworkTransport() (NetworkPolicy, *http.Transport) {
+	networkPolicyMu.RLock()
+	policy, transport := networkPolicy, networkTransportOfPolicy
+	networkPolicyMu.RUnlock()
+	if transport != nil {
+		return policy, transport
+	}
+
+	networkPolicyMu.Lock()
+	defer networkPolicyMu.Unlock()
+
+	if networkTransportOfPolicy == nil {
+		networkTransportOfPolicy = networkPolicy.transport()
+	}
+	return networkPolicy, networkTransportOfPolicy
+}
+
+// transport returns a transport that uses the proxy and checks the pins of the policy.
+func (p NetworkPolicy) transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if p.Proxy != "" {
+		proxy, err := url.Parse(p.Proxy)
+		if err == nil {
+			transport.Proxy = http.ProxyURL(proxy)
+		} else {
+			LogError("error while parsing proxy url, ignoring it", "proxy", p.Proxy, "error", err.Error())
+		}
+	}
+
+	if len(p.Pins) > 0 {
+		transport.TLSClientConfig = &tls.Config{
+			VerifyConnection: func(state tls.ConnectionState) error {
+				return verifyPins(p.Pins[state.ServerName], state.PeerCertificates)
+			},
+		}
+	}
+
+	return transport
+}
+
+func verifyPins(pins []string, certificates []*x509.Certificate) error {
+	if len(pins) == 0 {
+		return nil
+	}
+
+	for _, certificate := range certificates {
+		sum := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+		hash := base64.StdEncoding.EncodeToString(sum[:])
+		for _, pin := range pins {
+			if pin == hash {
+				return nil
+			}
+		}
+	}
+
+	return ErrPinMismatch
+}
+
+// allows reports whether the policy allows requests to the host.
+func (p NetworkPolicy) allows(host string) error {
+	if p.Disabled {
+		return ErrNetworkDisabled
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if hostMatches(p.DenyHosts, host) {
+		return fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+	}
+	if len(p.AllowHosts) > 0 && !hostMatches(p.AllowHosts, host) {
+		return fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+	}
+
+	return nil
+}
+
+func hostMatches(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		switch {
+		case pattern == "*" || pattern == host:
+			return true
+		case strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]):
+			return true
+		}
+	}
+	return false
+}
+
+// policyTransport checks every request, redirects included, against the policy before sending it.
+type policyTransport struct {
+	policy NetworkPolicy
+	next   http.RoundTripper
+}
+
+func (t *policyTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	err := t.policy.allows(request.URL.Hostname())
+	if err != nil {
+		LoggerFrom(request.Context()).Warn("request blocked by the network policy", "url", request.URL.Redacted(), "error", err.Error())
+		if request.Body != nil {
+			_ = request.Body.Close()
+		}
+		return nil, err
+	}
+
+	return t.next.RoundTrip(request)
+}
@@ -0,0 +1,151 @@
+package framework
+
+import (
+	"context"
+)
+
+type OperationKind int
+
+const (
+	// OperationAction returns an ExtensionResponse and can be linked to from cards.
+	OperationAction OperationKind = iota
+	// OperationCommand returns nothing.
+	OperationCommand
+)
+
+func (k OperationKind) String() string {
+	if k == OperationCommand {
+		return "command"
+	}
+	return "action"
+}
+
+// Operation is an action or a command of an extension. Both are routed, guarded, and described the same way,
+// only their fields in describe differ.
+type Operation struct {
+	Kind        OperationKind
+	ID          string
+	Index       int
+	Name        string
+	Description string
+	Function    ActionFunction
+	// ContextFunction is called instead of Function when set.
+	ContextFunction ActionContextFunction
+	Extension       *Extension
+	URLPath         string
+	// Arguments describe the fields of the JSON payload, so the host can render a form for them.
+	Arguments         []ToolArguments
+	RequiredArguments []string
+	Cron              string
+	// TimeZone is the IANA time zone of the cron schedule. The default time zone is used when it's empty.
+	TimeZone string
+	// Latency and Cost are the usual tiers of a run, so the host can warn before expensive operations. Estimate
+	// optionally estimates a particular run for the __estimate operation.
+	Latency  string
+	Cost     string
+	Estimate EstimateFunction
+	// Budget is the name of the budget the operation records its spend against with RecordSpend. The operation
+	// is blocked once the budget is used up for the month.
+	Budget      string
+	ContentType string
+	// Uploads are the files the action accepts from the host, nil when it doesn't accept any.
+	Uploads *UploadRules
+	// Env is the environment of the commands the operation runs with Command, nil to inherit the whole one.
+	Env *EnvPolicy
+}
+
+// ExtensionAction is an operation of OperationAction.
+type ExtensionAction = Operation
+
+// ExtensionCommand is kept with the Function type it always had for existing callers. Commands are operations
+// of OperationCommand since actions and commands are routed the same way.
+type ExtensionCommand struct {
+	ID        string
+	Extension *Extension
+	Function  CommandFunction
+}
+
+// operationKey keys the operations of an extension, so that an action and a command can have the same ID
+// like they always could.
+type operationKey struct {
+	kind OperationKind
+	id   string
+}
+
+// call runs the operation after the checks that apply to every operation.
+func (o Operation) call(ctx context.Context, payload string) (string, error) {
+	err := checkBudget(o.Budget)
+	if err != nil {
+		LoggerFrom(ctx).Warn(o.Kind.String()+" blocked", "name", o.ID, "error", err.Error())
+		return "", err
+	}
+
+	LoggerFrom(ctx).Info("calling "+o.Kind.String(), "name", o.ID)
+	LoggerFrom(ctx).Debug("calling "+o.Kind.String(), "payload", payload)
+	var output string
+	if o.ContextFunction != nil {
+		output, err = o.ContextFunction(withEnvPolicy(ctx, o.Env), payload)
+	} else {
+		output, err = o.Function(payload)
+	}
+	recordUsage(o.ID, err)
+	return output, err
+}
+
+func (o Operation) describeAction() jarblesExtensionAction {
+	return jarblesExtensionAction{
+		Id:          o.ID,
+		Index:       o.Index,
+		Name:        o.Name,
+		Description: o.Description,
+		Cron:        o.Cron,
+		TimeZone:    describeTimeZone(o.TimeZone),
+		Latency:     o.Latency,
+		Cost:        o.Cost,
+		Estimable:   o.Estimate != nil,
+		ContentType: o.ContentType,
+		Parameters:  argumentsSchema(o.Arguments, o.RequiredArguments),
+		Uploads:     describeUploads(o.Uploads),
+	}
+}
+
+func (o Operation) describeCommand() jarblesExtensionCommand {
+	return jarblesExtensionCommand{
+		Id:         o.ID,
+		Parameters: argumentsSchema(o.Arguments, o.RequiredArguments),
+		Cron:       o.Cron,
+		TimeZone:   describeTimeZone(o.TimeZone),
+		Latency:    o.Latency,
+		Cost:       o.Cost,
+		Estimable:  o.Estimate != nil,
+	}
+}
+
+// operationsOfKind counts the operations of the kind.
+func (e *Extension) operationsOfKind(kind OperationKind) int {
+	n := 0
+	for _, op := range e.operations {
+		if op.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// operation returns the operation with the ID, the action when there is a command with the same ID too.
+func (e *Extension) operation(id string) (Operation, bool) {
+	if op, ok := e.operations[operationKey{OperationAction, id}]; ok {
+		return op, true
+	}
+	op, ok := e.operations[operationKey{OperationCommand, id}]
+	return op, ok
+}
+
+func (e *Extension) addOperation(v Operation) {
+	if e.operations == nil {
+		e.operations = make(map[operationKey]Operation)
+	}
+	e.operations[operationKey{v.Kind, v.ID}] = v
+	e.describedActions = nil
+	e.describedCommands = nil
+}
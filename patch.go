@@ -0,0 +1,468 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PatchResult reports how ApplyUnifiedDiff applied a diff. The files are only changed when Applied is true,
+// i.e. every hunk of every file applied, like git apply.
+type PatchResult struct {
+	Applied bool              `json:"applied"`
+	Files   []PatchFileResult `json:"files"`
+}
+
+// PatchFileResult is the outcome of the hunks of one file. Status is created, modified, renamed, deleted, or
+// failed.
+type PatchFileResult struct {
+	Path   string            `json:"path"`
+	Status string            `json:"status"`
+	Error  string            `json:"error,omitempty"`
+	Hunks  []PatchHunkResult `json:"hunks,omitempty"`
+}
+
+// PatchHunkResult is the outcome of one hunk. Line is where it applied in the old file, starting at 1, and
+// Offset how far that is from the line of its header. Fuzzy is true when it only matched ignoring whitespace.
+type PatchHunkResult struct {
+	Header  string `json:"header"`
+	Applied bool   `json:"applied"`
+	Line    int    `json:"line,omitempty"`
+	Offset  int    `json:"offset,omitempty"`
+	Fuzzy   bool   `json:"fuzzy,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type filePatch struct {
+	oldName, newName string
+	hunks            []hunk
+}
+
+type hunk struct {
+	header string
+	// oldStart is the first line of the hunk in the old file starting at 1, or -1 when the header has no
+	// line numbers, as models sometimes write them.
+	oldStart int
+	ops      []DiffOp
+	// noNewline and oldNoNewline mark a "\ No newline at end of file" after a new or an old line
+	noNewline, oldNoNewline bool
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+\d+(?:,\d+)? @@`)
+
+// parseUnifiedDiff parses the files of a diff in the format of diff -u or git diff. The counts of the hunk
+// headers are ignored, the hunks end at the next header, since models often get them wrong.
+func parseUnifiedDiff(diff string) ([]filePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(diff, "\r\n", "\n"), "\n")
+
+	var patches []filePatch
+	var current *filePatch
+	var h *hunk
+	// blank lines are context lines that lost their space, unless they trail the hunk
+	blanks := 0
+	endHunk := func() {
+		if h != nil {
+			current.hunks = append(current.hunks, *h)
+		}
+		h, blanks = nil, 0
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			endHunk()
+			patches = append(patches, filePatch{oldName: patchName(line[4:], "a/"), newName: patchName(lines[i+1][4:], "b/")})
+			current = &patches[len(patches)-1]
+			i++
+		case strings.HasPrefix(line, "@@"):
+			if current == nil {
+				return nil, ModelError(fmt.Sprintf("the hunk at line %d of the diff comes before the --- and +++ lines of a file", i+1), "start the changes of each file with its --- and +++ lines")
+			}
+			endHunk()
+			h = &hunk{header: line, oldStart: -1}
+			if m := hunkHeader.FindStringSubmatch(line); m != nil {
+				h.oldStart, _ = strconv.Atoi(m[1])
+			}
+		case h != nil && line == "":
+			blanks++
+		case h != nil && (line[0] == ' ' || line[0] == '-' || line[0] == '+'):
+			for ; blanks > 0; blanks-- {
+				h.ops = append(h.ops, DiffOp{' ', ""})
+			}
+			h.ops = append(h.ops, DiffOp{line[0], line[1:]})
+		case h != nil && strings.HasPrefix(line, `\`):
+			if len(h.ops) > 0 && h.ops[len(h.ops)-1].Kind == '-' {
+				h.oldNoNewline = true
+			} else {
+				h.noNewline = true
+			}
+		default:
+			// e.g. the diff --git and index lines of git, or text around the diff
+			endHunk()
+		}
+	}
+	endHunk()
+
+	if len(patches) == 0 {
+		return nil, ModelError("the diff has no --- and +++ lines of a file", "send a unified diff like the output of diff -u or git diff")
+	}
+	return patches, nil
+}
+
+// patchName returns the path of a --- or +++ line without its timestamp and the a/ or b/ prefix of git.
+func patchName(name, prefix string) string {
+	name, _, _ = strings.Cut(name, "\t")
+	name = strings.TrimSpace(name)
+	if name == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(name, prefix)
+}
+
+// applyHunks applies the hunks in order to the lines of a file. Each hunk is searched from the end of the
+// previous one, at the position closest to its header, first exactly and then ignoring whitespace.
+func applyHunks(lines []string, hunks []hunk) ([]string, []PatchHunkResult, bool) {
+	results := make([]PatchHunkResult, len(hunks))
+	out := make([]string, 0, len(lines))
+	ok := true
+	cursor, delta := 0, 0
+	for i, h := range hunks {
+		results[i].Header = h.header
+
+		var old []string
+		for _, op := range h.ops {
+			if op.Kind != '+' {
+				old = append(old, op.Line)
+			}
+		}
+
+		// the header is in the lines of the old file, shifted by as much as the previous hunk was off
+		base := len(lines)
+		if h.oldStart >= 0 {
+			base = max(h.oldStart-1, 0)
+			if len(old) == 0 {
+				// a hunk without old lines inserts after its line
+				base = h.oldStart
+			}
+		}
+		expected := min(max(base+delta, cursor), len(lines))
+
+		at, fuzzy := findLines(lines, old, cursor, expected)
+		if at < 0 {
+			ok = false
+			results[i].Error = "the lines of the hunk aren't in the file"
+			continue
+		}
+		results[i].Applied = true
+		results[i].Line = at + 1
+		results[i].Fuzzy = fuzzy
+		if h.oldStart >= 0 {
+			results[i].Offset = at - base
+			delta = at - base
+		}
+
+		out = append(out, lines[cursor:at]...)
+		j := at
+		for _, op := range h.ops {
+			switch op.Kind {
+			case ' ':
+				// the context of the file wins over the one of a fuzzy match
+				out = append(out, lines[j])
+				j++
+			case '-':
+				j++
+			case '+':
+				out = append(out, op.Line)
+			}
+		}
+		cursor = j
+	}
+	out = append(out, lines[cursor:]...)
+
+	return out, results, ok
+}
+
+// findLines returns where the lines of old are in lines at or after from, closest to near, and whether they
+// only matched ignoring whitespace. It returns -1 when they aren't found.
+func findLines(lines, old []string, from, near int) (int, bool) {
+	for pass, equal := range []func(a, b string) bool{
+		func(a, b string) bool { return a == b },
+		func(a, b string) bool {
+			return strings.Join(strings.Fields(a), " ") == strings.Join(strings.Fields(b), " ")
+		},
+	} {
+		matches := func(at int) bool {
+			if at < from || at+len(old) > len(lines) {
+				return false
+			}
+			for k, line := range old {
+				if !equal(lines[at+k], line) {
+					return false
+				}
+			}
+			return true
+		}
+		for d := 0; near-d >= from || near+d <= len(lines); d++ {
+			if matches(near - d) {
+				return near - d, pass > 0
+			}
+			if matches(near + d) {
+				return near + d, pass > 0
+			}
+		}
+	}
+	return -1, false
+}
+
+// ApplyUnifiedDiff applies a diff in the format of diff -u or git diff to the files below root, and reports the
+// outcome of each hunk. Hunks whose line numbers are off, or whose context only differs in whitespace, are
+// still applied. Nothing is written unless every hunk applies. Files are created and deleted with /dev/null.
+// Files with several sections in the diff get the sections applied in order.
+func ApplyUnifiedDiff(root, diff string) (PatchResult, error) {
+	patches, err := parseUnifiedDiff(diff)
+	if err != nil {
+		return PatchResult{}, err
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return PatchResult{}, fmt.Errorf("error while getting absolute path at %s: %w", root, err)
+	}
+
+	files := patchedFiles{files: make(map[string]*patchedFile)}
+	result := PatchResult{Applied: true}
+	for _, patch := range patches {
+		name := patch.newName
+		if name == "" {
+			name = patch.oldName
+		}
+		file := PatchFileResult{Path: name, Status: "modified"}
+		switch {
+		case patch.oldName == "" && patch.newName == "":
+			file.Status, file.Error = "failed", "the diff has no file name"
+		case patch.oldName == "":
+			file.Status = "created"
+		case patch.newName == "":
+			file.Status = "deleted"
+		case patch.oldName != patch.newName:
+			file.Status = "renamed"
+		}
+
+		if file.Error == "" {
+			err = patchFile(root, patch, &file, &files)
+			if err != nil {
+				return PatchResult{}, err
+			}
+		}
+		if file.Error != "" {
+			file.Status = "failed"
+			result.Applied = false
+		}
+		for _, h := range file.Hunks {
+			if !h.Applied {
+				file.Status = "failed"
+				result.Applied = false
+			}
+		}
+		result.Files = append(result.Files, file)
+	}
+	if !result.Applied {
+		return result, nil
+	}
+
+	for _, filename := range files.order {
+		f := files.files[filename]
+		switch {
+		case f.deleted && f.onDisk:
+			err = os.Remove(filename)
+			if err != nil {
+				return PatchResult{}, fmt.Errorf("error while deleting file at %s: %w", filename, err)
+			}
+		case !f.deleted:
+			err = os.MkdirAll(filepath.Dir(filename), workspaceDirPerm)
+			if err == nil {
+				err = os.WriteFile(filename, f.content, f.perm)
+			}
+			if err != nil {
+				return PatchResult{}, fmt.Errorf("error while writing file at %s: %w", filename, err)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// patchedFiles are the files a diff changes, as the sections applied so far left them. ApplyUnifiedDiff writes
+// them once every section applied.
+type patchedFiles struct {
+	files map[string]*patchedFile
+	// order is the order the files were first changed in
+	order []string
+}
+
+// patchedFile is the pending content of a file, or that it's deleted. onDisk is whether the file existed
+// before the diff.
+type patchedFile struct {
+	content []byte
+	perm    os.FileMode
+	deleted bool
+	onDisk  bool
+}
+
+// get returns the file as the previous sections left it, read from disk if they didn't change it, or nil when
+// it doesn't exist.
+func (p *patchedFiles) get(filename string) (*patchedFile, error) {
+	if f, ok := p.files[filename]; ok {
+		if f.deleted {
+			return nil, nil
+		}
+		return f, nil
+	}
+
+	info, err := os.Stat(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while reading file at %s: %w", filename, err)
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading file at %s: %w", filename, err)
+	}
+	return &patchedFile{content: content, perm: info.Mode().Perm(), onDisk: true}, nil
+}
+
+// set records the new state of a file. A file that existed before the diff stays marked as on disk, so
+// deleting it removes it.
+func (p *patchedFiles) set(filename string, f patchedFile) {
+	previous, ok := p.files[filename]
+	if !ok {
+		p.order = append(p.order, filename)
+		_, err := os.Lstat(filename)
+		f.onDisk = err == nil
+	} else {
+		f.onDisk = previous.onDisk
+	}
+	p.files[filename] = &f
+}
+
+// patchFile applies the hunks of a patch to the file as the previous sections left it, and records the change
+// in files. Problems with the file are reported in file.Error, only unexpected errors are returned.
+func patchFile(root string, patch filePatch, file *PatchFileResult, files *patchedFiles) error {
+	resolve := func(name string) (string, bool) {
+		filename := filepath.Join(root, filepath.FromSlash(name))
+		if !withinDir(root, filename) || filename == root {
+			file.Error = "the path is not within the safe directory"
+			return "", false
+		}
+		return filename, true
+	}
+
+	perm := os.FileMode(workspaceFilePerm)
+	var src []byte
+	var oldFilename, newFilename string
+	if patch.oldName != "" {
+		filename, ok := resolve(patch.oldName)
+		if !ok {
+			return nil
+		}
+		f, err := files.get(filename)
+		if err != nil {
+			return err
+		}
+		if f == nil {
+			file.Error = "the file doesn't exist"
+			return nil
+		}
+		src, perm, oldFilename = f.content, f.perm, filename
+	}
+	if patch.newName != "" {
+		filename, ok := resolve(patch.newName)
+		if !ok {
+			return nil
+		}
+		if filename != oldFilename {
+			f, err := files.get(filename)
+			if err != nil {
+				return err
+			}
+			if f != nil {
+				file.Error = "the file already exists"
+				return nil
+			}
+		}
+		newFilename = filename
+	}
+
+	lines, results, ok := applyHunks(splitLines(string(src)), patch.hunks)
+	file.Hunks = results
+	if !ok {
+		return nil
+	}
+
+	if oldFilename != "" && oldFilename != newFilename {
+		files.set(oldFilename, patchedFile{deleted: true})
+	}
+	if newFilename == "" {
+		return nil
+	}
+
+	newline := len(src) == 0 || src[len(src)-1] == '\n'
+	for _, h := range patch.hunks {
+		if h.oldNoNewline {
+			newline = true
+		}
+		if h.noNewline {
+			newline = false
+		}
+	}
+	content := strings.Join(lines, "\n")
+	if newline && len(lines) > 0 {
+		content += "\n"
+	}
+	files.set(newFilename, patchedFile{content: []byte(content), perm: perm})
+	return nil
+}
+
+func applyDiff(root string) ToolContextFunction {
+	return func(ctx context.Context, payload string) (string, error) {
+		var request struct {
+			Dir  string `json:"dir"`
+			Diff string `json:"diff"`
+		}
+		err := json.Unmarshal([]byte(payload), &request)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while unmarshaling payload", "error", err.Error())
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+		}
+
+		dir, err := safeDir(root, request.Dir)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while getting safe directory", "error", err.Error())
+			return "", fmt.Errorf("error while getting safe directory: %w", err)
+		}
+
+		result, err := ApplyUnifiedDiff(dir, request.Diff)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while applying diff", "error", err.Error())
+			return "", err
+		}
+		if !result.Applied {
+			LoggerFrom(ctx).Warn("diff not applied", "dir", request.Dir)
+		}
+
+		data, err := marshalJSON(result)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while marshaling patch result", "error", err.Error())
+			return "", fmt.Errorf("error while marshaling patch result: %w", err)
+		}
+		return string(data), nil
+	}
+}
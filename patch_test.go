@@ -0,0 +1,190 @@
+package framework
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func tenLines() string {
+	var b strings.Builder
+	for _, line := range []string{"one", "two", "three", "four", "five", "six", "seven", "eight", "nine", "ten"} {
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+func writePatchFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func readPatched(t *testing.T, root, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(root, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestApplyUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		diff  string
+		want  map[string]string
+		gone  []string
+	}{
+		{
+			name:  "exact",
+			files: map[string]string{"a.txt": tenLines()},
+			diff:  "--- a/a.txt\n+++ b/a.txt\n@@ -2,3 +2,3 @@\n two\n-three\n+THREE\n four\n",
+			want:  map[string]string{"a.txt": strings.Replace(tenLines(), "three", "THREE", 1)},
+		},
+		{
+			name:  "several sections of one file",
+			files: map[string]string{"a.txt": tenLines()},
+			diff: "--- a/a.txt\n+++ b/a.txt\n@@ -1,3 +1,3 @@\n one\n-two\n+TWO\n three\n" +
+				"--- a/a.txt\n+++ b/a.txt\n@@ -8,3 +8,3 @@\n eight\n-nine\n+NINE\n ten\n",
+			want: map[string]string{"a.txt": strings.NewReplacer("two", "TWO", "nine", "NINE").Replace(tenLines())},
+		},
+		{
+			name:  "offset",
+			files: map[string]string{"a.txt": tenLines()},
+			diff:  "--- a/a.txt\n+++ b/a.txt\n@@ -1,3 +1,3 @@\n six\n-seven\n+SEVEN\n eight\n",
+			want:  map[string]string{"a.txt": strings.Replace(tenLines(), "seven", "SEVEN", 1)},
+		},
+		{
+			name:  "fuzzy",
+			files: map[string]string{"a.txt": "func main() {\n\tprintln(\"hi\")\n}\n"},
+			diff:  "--- a/a.txt\n+++ b/a.txt\n@@ -1,3 +1,3 @@\n func main()  {\n-    println(\"hi\")\n+\tprintln(\"bye\")\n }\n",
+			want:  map[string]string{"a.txt": "func main() {\n\tprintln(\"bye\")\n}\n"},
+		},
+		{
+			name: "create",
+			diff: "--- /dev/null\n+++ b/dir/new.txt\n@@ -0,0 +1,2 @@\n+hello\n+world\n",
+			want: map[string]string{"dir/new.txt": "hello\nworld\n"},
+		},
+		{
+			name:  "delete",
+			files: map[string]string{"a.txt": "one\ntwo\n"},
+			diff:  "--- a/a.txt\n+++ /dev/null\n@@ -1,2 +0,0 @@\n-one\n-two\n",
+			gone:  []string{"a.txt"},
+		},
+		{
+			name:  "rename",
+			files: map[string]string{"a.txt": tenLines()},
+			diff:  "--- a/a.txt\n+++ b/b.txt\n@@ -1,2 +1,2 @@\n-one\n+ONE\n two\n",
+			want:  map[string]string{"b.txt": strings.Replace(tenLines(), "one", "ONE", 1)},
+			gone:  []string{"a.txt"},
+		},
+		{
+			name:  "rename then modify",
+			files: map[string]string{"a.txt": tenLines()},
+			diff: "--- a/a.txt\n+++ b/b.txt\n@@ -1,2 +1,2 @@\n-one\n+ONE\n two\n" +
+				"--- a/b.txt\n+++ b/b.txt\n@@ -9,2 +9,2 @@\n nine\n-ten\n+TEN\n",
+			want: map[string]string{"b.txt": strings.NewReplacer("one", "ONE", "ten", "TEN").Replace(tenLines())},
+			gone: []string{"a.txt"},
+		},
+		{
+			name: "create then delete",
+			diff: "--- /dev/null\n+++ b/tmp.txt\n@@ -0,0 +1 @@\n+x\n" +
+				"--- a/tmp.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-x\n",
+			gone: []string{"tmp.txt"},
+		},
+		{
+			name:  "no newline in the new file",
+			files: map[string]string{"a.txt": "one\ntwo\n"},
+			diff:  "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n one\n-two\n+TWO\n\\ No newline at end of file\n",
+			want:  map[string]string{"a.txt": "one\nTWO"},
+		},
+		{
+			name:  "no newline in the old file",
+			files: map[string]string{"a.txt": "one\ntwo"},
+			diff:  "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n one\n-two\n\\ No newline at end of file\n+TWO\n",
+			want:  map[string]string{"a.txt": "one\nTWO\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writePatchFiles(t, tt.files)
+			result, err := ApplyUnifiedDiff(root, tt.diff)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Applied {
+				t.Fatalf("diff isn't applied: %+v", result)
+			}
+			for name, want := range tt.want {
+				if got := readPatched(t, root, name); got != want {
+					t.Errorf("%s is %q, want %q", name, got, want)
+				}
+			}
+			for _, name := range tt.gone {
+				if _, err := os.Stat(filepath.Join(root, name)); !os.IsNotExist(err) {
+					t.Errorf("%s still exists", name)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyUnifiedDiffReportsHunks(t *testing.T) {
+	root := writePatchFiles(t, map[string]string{"a.txt": tenLines()})
+	diff := "--- a/a.txt\n+++ b/a.txt\n@@ -1,3 +1,3 @@\n six\n-seven\n+SEVEN\n eight\n"
+
+	result, err := ApplyUnifiedDiff(root, diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := result.Files[0].Hunks[0]
+	if !h.Applied || h.Line != 6 || h.Offset != 5 || h.Fuzzy {
+		t.Fatalf("unexpected hunk result: %+v", h)
+	}
+}
+
+func TestApplyUnifiedDiffWritesNothingOnFailure(t *testing.T) {
+	root := writePatchFiles(t, map[string]string{"a.txt": tenLines(), "b.txt": tenLines()})
+	diff := "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n-one\n+ONE\n two\n" +
+		"--- a/b.txt\n+++ b/b.txt\n@@ -1,2 +1,2 @@\n-eleven\n+ELEVEN\n twelve\n"
+
+	result, err := ApplyUnifiedDiff(root, diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Applied {
+		t.Fatal("diff with a missing hunk is applied")
+	}
+	if result.Files[0].Status != "modified" || result.Files[1].Status != "failed" {
+		t.Fatalf("unexpected statuses: %+v", result.Files)
+	}
+	if got := readPatched(t, root, "a.txt"); got != tenLines() {
+		t.Fatalf("a.txt is changed: %q", got)
+	}
+}
+
+func TestApplyUnifiedDiffRejectsPathsOutsideRoot(t *testing.T) {
+	root := writePatchFiles(t, nil)
+	diff := "--- /dev/null\n+++ b/../escape.txt\n@@ -0,0 +1 @@\n+x\n"
+
+	result, err := ApplyUnifiedDiff(root, diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Applied || result.Files[0].Error == "" {
+		t.Fatalf("path outside the root is applied: %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "escape.txt")); !os.IsNotExist(err) {
+		t.Fatal("file outside the root is created")
+	}
+}
@@ -0,0 +1,124 @@
+package framework
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Permissions used for everything the framework writes. Private files live under ~/.jarbles and are only
+// readable by the user, workspace files are created the way an editor would. On Windows only the write bit
+// is honored and access is governed by the ACLs inherited from the parent directory.
+const (
+	privateDirPerm    = 0700
+	privateFilePerm   = 0600
+	privateExecPerm   = 0700
+	workspaceDirPerm  = 0755
+	workspaceFilePerm = 0644
+)
+
+// withinDir reports whether path is dir or is located inside it. Both paths must be absolute.
+// filepath.Rel compares volumes and path elements case-insensitively on Windows.
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false // e.g. different volumes
+	}
+
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// sameDir reports whether path is dir itself, which withinDir also allows. Both paths must be absolute.
+func sameDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel == "."
+}
+
+// writeFileAtomic writes data to a temporary file next to filename and renames it over filename, so a
+// reader never sees a partial file. The file is created with privateFilePerm.
+func writeFileAtomic(filename string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filename)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// lockFile takes an exclusive lock shared by all processes by creating filename, waiting up to timeout for it.
+// A lock older than staleAfter is assumed to be left behind by a crashed process and is taken over.
+func lockFile(filename string, timeout, staleAfter time.Duration) (func(), error) {
+	err := os.MkdirAll(filepath.Dir(filename), privateDirPerm)
+	if err != nil {
+		return nil, fmt.Errorf("error while creating lock directory: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, privateFilePerm)
+		if err == nil {
+			// the token tells this lock from one that took it over after it was found stale
+			token := fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano())
+			_, writeErr := f.WriteString(token)
+			_ = f.Close()
+			if writeErr != nil {
+				_ = os.Remove(filename)
+				return nil, fmt.Errorf("error while creating lock %s: %w", filename, writeErr)
+			}
+			return func() {
+				if data, err := os.ReadFile(filename); err == nil && string(data) == token {
+					_ = os.Remove(filename)
+				}
+			}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("error while creating lock %s: %w", filename, err)
+		}
+
+		info, err := os.Stat(filename)
+		if err == nil && time.Since(info.ModTime()) > staleAfter {
+			takeOverLock(filename, info)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %s", filename)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// takeOverLock removes the stale lock file. Another waiter may have taken it over and created a fresh lock
+// since it was found stale, so it's renamed out of the way first, and put back unless it's still the stale
+// file.
+func takeOverLock(filename string, stale os.FileInfo) {
+	moved := fmt.Sprintf("%s.stale-%d-%d", filename, os.Getpid(), time.Now().UnixNano())
+	err := os.Rename(filename, moved)
+	if err != nil {
+		// someone else took it over already
+		return
+	}
+
+	info, err := os.Stat(moved)
+	if err == nil && (!os.SameFile(info, stale) || !info.ModTime().Equal(stale.ModTime())) {
+		// a fresh lock, put it back unless yet another one was created meanwhile
+		err = os.Link(moved, filename)
+		if err != nil && !errors.Is(err, os.ErrExist) {
+			// e.g. a filesystem without hard links
+			_ = os.Rename(moved, filename)
+			return
+		}
+	}
+	_ = os.Remove(moved)
+}
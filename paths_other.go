@@ -0,0 +1,10 @@
+//go:build !windows
+
+package framework
+
+import "strings"
+
+// removePathOnce removes the first occurrence of old from path.
+func removePathOnce(path, old string) string {
+	return strings.Replace(path, old, "", 1)
+}
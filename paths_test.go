@@ -0,0 +1,109 @@
+package framework
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLockFileExcludes(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.lock")
+
+	var holders, most atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				unlock, err := lockFile(filename, 10*time.Second, time.Minute)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				n := holders.Add(1)
+				if n > most.Load() {
+					most.Store(n)
+				}
+				time.Sleep(100 * time.Microsecond)
+				holders.Add(-1)
+				unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if most.Load() != 1 {
+		t.Fatalf("%d holders at once", most.Load())
+	}
+}
+
+func TestLockFileTakesOverStaleLock(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.lock")
+	err := os.WriteFile(filename, nil, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	err = os.Chtimes(filename, old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every waiter finds the lock stale at once, only one of them may hold it at a time
+	var holders, most atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := lockFile(filename, 10*time.Second, time.Minute)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			n := holders.Add(1)
+			if n > most.Load() {
+				most.Store(n)
+			}
+			time.Sleep(5 * time.Millisecond)
+			holders.Add(-1)
+			unlock()
+		}()
+	}
+	wg.Wait()
+
+	if most.Load() != 1 {
+		t.Fatalf("%d holders at once", most.Load())
+	}
+	matches, _ := filepath.Glob(filename + "*")
+	if len(matches) != 0 {
+		t.Fatalf("lock files are left behind: %v", matches)
+	}
+}
+
+func TestLockFileUnlockKeepsTakenOverLock(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.lock")
+	unlock, err := lockFile(filename, time.Second, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another process took the lock over while this one held it for too long
+	err = os.Remove(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filename, nil, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unlock()
+	if _, err := os.Stat(filename); err != nil {
+		t.Fatalf("the lock of the other process is removed: %v", err)
+	}
+}
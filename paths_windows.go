@@ -0,0 +1,45 @@
+package framework
+
+import "strings"
+
+// removePathOnce removes the first occurrence of the components of old from path, ignoring case like the
+// Windows filesystem does. Components are compared rather than bytes, since the lowercase form of a name
+// doesn't always have the same length.
+func removePathOnce(path, old string) string {
+	oldComponents := pathComponents(old)
+	if len(oldComponents) == 0 {
+		return path
+	}
+	components := pathComponents(path)
+
+	for i := 0; i+len(oldComponents) <= len(components); i++ {
+		matches := true
+		for k, component := range oldComponents {
+			if !strings.EqualFold(path[components[i+k][0]:components[i+k][1]], old[component[0]:component[1]]) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return path[:components[i][0]] + path[components[i+len(oldComponents)-1][1]:]
+		}
+	}
+	return path
+}
+
+// pathComponents returns the start and end offsets of the components of path, which are separated by either
+// slash.
+func pathComponents(path string) [][2]int {
+	var components [][2]int
+	start := 0
+	for i := 0; i <= len(path); i++ {
+		if i < len(path) && path[i] != '\\' && path[i] != '/' {
+			continue
+		}
+		if i > start {
+			components = append(components, [2]int{start, i})
+		}
+		start = i + 1
+	}
+	return components
+}
@@ -0,0 +1,90 @@
+package framework
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type AddPluginOptions struct {
+	Path    string
+	Args    []string
+	Prefix  string
+	Timeout time.Duration
+	// Env is the environment of the binary, see EnvPolicy.
+	Env *EnvPolicy
+}
+
+// AddPlugin proxies the tools of an external binary as tools of the assistant.
+// The binary must speak the same protocol as an assistant: the first line of standard input is the
+// route name, followed by a blank line and the payload. Its describe route must return a JSON object
+// with a tools array in the format jarbles expects. Each proxied tool invokes the binary once per call.
+func (a *Assistant) AddPlugin(options AddPluginOptions) error {
+	if options.Timeout == 0 {
+		options.Timeout = 60 * time.Second
+	}
+
+	output, err := runPlugin(context.Background(), options, "describe", "")
+	if err != nil {
+		return fmt.Errorf("error while describing plugin %s: %w", options.Path, err)
+	}
+
+	var description struct {
+		Tools []tool `json:"tools"`
+	}
+	err = json.Unmarshal([]byte(output), &description)
+	if err != nil {
+		return fmt.Errorf("error while unmarshaling plugin description %s: %w", options.Path, err)
+	}
+
+	if a.tools == nil {
+		a.tools = make(map[string]Tool)
+	}
+	for _, t := range description.Tools {
+		if t.Function == nil {
+			continue
+		}
+
+		route := t.Function.Name
+		name := options.Prefix + route
+		a.tools[name] = Tool{
+			Name:        name,
+			Description: t.Function.Description,
+			ContextFunction: func(ctx context.Context, payload string) (string, error) {
+				return runPlugin(ctx, options, route, payload)
+			},
+		}
+
+		t.Function.Name = name
+		a.description.Tools = append(a.description.Tools, t)
+	}
+	a.described = nil
+
+	return nil
+}
+
+func runPlugin(ctx context.Context, options AddPluginOptions, route, payload string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, options.Timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := Command(withEnvPolicy(ctx, options.Env), options.Path, options.Args...)
+	cmd.Stdin = strings.NewReader(route + "\n\n" + payload)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	LoggerFrom(ctx).Debug("running plugin", "path", options.Path, "route", route)
+	err := cmd.Run()
+	if err != nil {
+		LoggerFrom(ctx).Error("error while running plugin", "path", options.Path, "route", route, "stderr", stderr.String(), "error", err.Error())
+		if stderr.Len() > 0 {
+			return "", fmt.Errorf("%s", stderr.String())
+		}
+		return "", fmt.Errorf("error while running plugin %s: %w", options.Path, err)
+	}
+
+	return stdout.String(), nil
+}
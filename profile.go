@@ -0,0 +1,67 @@
+package framework
+
+import (
+	"os"
+	"sync"
+)
+
+var (
+	profileMu sync.RWMutex
+	profile   = slugify(os.Getenv("JARBLES_PROFILE"))
+)
+
+// ProfileName returns the active profile. The empty string is the default profile.
+// The profile is read from JARBLES_PROFILE, can be changed with SetProfile, and is selected per request
+// with HeaderProfile.
+func ProfileName() string {
+	profileMu.RLock()
+	defer profileMu.RUnlock()
+
+	return profile
+}
+
+// SetProfile switches the profile used to locate data, cache, and log directories.
+//
+//goland:noinspection GoUnusedExportedFunction
+func SetProfile(name string) {
+	profileMu.Lock()
+	defer profileMu.Unlock()
+
+	profile = slugify(name)
+}
+
+// useRequestProfile switches to the profile the request selects with HeaderProfile, if it selects one, and
+// returns a function that switches back.
+func useRequestProfile(request Request) func() {
+	name, ok := request.Headers[HeaderProfile]
+	if !ok {
+		return func() {}
+	}
+
+	previous := ProfileName()
+	SetProfile(name)
+	return func() {
+		SetProfile(previous)
+	}
+}
+
+// profileDir is like userDir but namespaced under profiles/<name> when a profile is active.
+// Assistant and extension binaries are shared between profiles, everything they persist is not.
+func profileDir(dir ...string) string {
+	name := ProfileName()
+	if name == "" {
+		return userDir(dir...)
+	}
+
+	return userDir(append([]string{"profiles", name}, dir...)...)
+}
+
+// profileStateDir is like userStateDir but namespaced under profiles/<name> when a profile is active.
+func profileStateDir(dir ...string) string {
+	name := ProfileName()
+	if name == "" {
+		return userStateDir(dir...)
+	}
+
+	return userStateDir(append([]string{"profiles", name}, dir...)...)
+}
@@ -0,0 +1,123 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// progressTTL is how long the progress of an operation is kept after it was last reported.
+const progressTTL = time.Hour
+
+// ProgressEvent is the last progress reported by a running operation or job.
+type ProgressEvent struct {
+	ID        string    `json:"id"`
+	Operation string    `json:"operation,omitempty"`
+	Percent   float64   `json:"percent"`
+	Note      string    `json:"note,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type progressKey struct{}
+
+type progressTarget struct {
+	id        string
+	operation string
+}
+
+// withProgress returns a context whose progress is reported under the id.
+func withProgress(ctx context.Context, id, operation string) context.Context {
+	return context.WithValue(ctx, progressKey{}, progressTarget{id: id, operation: operation})
+}
+
+// Progress reports how far along the operation or job of ctx is, from 0 to 100, with an optional note.
+// The host polls it with the __progress operation, by the request ID or the job ID. Outside of an operation
+// or a job it does nothing.
+//
+//goland:noinspection GoUnusedExportedFunction
+func Progress(ctx context.Context, percent float64, note string) {
+	target, ok := ctx.Value(progressKey{}).(progressTarget)
+	if !ok || target.id == "" {
+		return
+	}
+
+	event := ProgressEvent{
+		ID:        target.id,
+		Operation: target.operation,
+		Percent:   max(0, min(100, percent)),
+		Note:      note,
+		UpdatedAt: time.Now(),
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		LoggerFrom(ctx).Error("error while marshaling progress", "error", err.Error())
+		return
+	}
+
+	dir := profileStateDir("progress")
+	err = os.MkdirAll(dir, privateDirPerm)
+	if err == nil {
+		// write and rename, so a poll never reads a partial event
+		tmp := filepath.Join(dir, target.id+".tmp")
+		err = os.WriteFile(tmp, data, privateFilePerm)
+		if err == nil {
+			err = os.Rename(tmp, filepath.Join(dir, target.id+".json"))
+		}
+	}
+	if err != nil {
+		LoggerFrom(ctx).Error("error while writing progress", "id", target.id, "error", err.Error())
+	}
+}
+
+// clearProgress removes the progress of a finished operation or job.
+func clearProgress(id string) {
+	_ = os.Remove(filepath.Join(profileStateDir("progress"), id+".json"))
+}
+
+// progressOperation returns the progress of the operations and jobs that are running, or of the one with the
+// id in the payload. Progress that wasn't updated for a while is of a process that died and is removed.
+func progressOperation(payload string) (string, error) {
+	id, _ := PayloadGetString(payload, "id", "")
+
+	entries, err := os.ReadDir(profileStateDir("progress"))
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("error while reading progress: %w", err)
+	}
+
+	events := make([]ProgressEvent, 0)
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || (id != "" && name != id) {
+			continue
+		}
+
+		filename := filepath.Join(profileStateDir("progress"), entry.Name())
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			continue
+		}
+
+		var event ProgressEvent
+		if json.Unmarshal(data, &event) != nil || time.Since(event.UpdatedAt) > progressTTL {
+			_ = os.Remove(filename)
+			continue
+		}
+		events = append(events, event)
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].UpdatedAt.After(events[j].UpdatedAt)
+	})
+
+	data, err := marshalJSON(events)
+	if err != nil {
+		return "", fmt.Errorf("error while marshaling progress: %w", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,168 @@
+package framework
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// MaxRequestSize is the largest request, operation line and payload included, that ParseRequest accepts.
+var MaxRequestSize int64 = 32 << 20
+
+var (
+	ErrEmptyRequest       = errors.New("empty request")
+	ErrMissingOperation   = errors.New("missing operation")
+	ErrMissingDelimiter   = errors.New("missing blank line between operation and payload")
+	ErrRequestTooLarge    = errors.New("request too large")
+	ErrMalformedOperation = errors.New("malformed operation")
+	ErrMalformedPayload   = errors.New("malformed payload")
+)
+
+// Headers sent by the host with the conversation a request belongs to.
+const (
+	HeaderConversationID = "Conversation-Id"
+	HeaderMessageID      = "Message-Id"
+	HeaderUserID         = "User-Id"
+	// HeaderDeadline is when the host gives up on the request, in RFC 3339, e.g. 2024-05-01T12:00:30Z.
+	HeaderDeadline = "Deadline"
+	// HeaderProfile selects the profile of the request, overriding JARBLES_PROFILE. An empty value is the
+	// default profile.
+	HeaderProfile = "Profile"
+)
+
+// Request is a single call from the host: the operation (route, tool, action, or command name), optional
+// headers, and its payload.
+type Request struct {
+	Operation string
+	// Headers are keyed by their canonical name, e.g. Conversation-Id.
+	Headers map[string]string
+	Payload string
+}
+
+// ParseRequest reads a request in the jarbles protocol: the operation on the first line, optional
+// "Name: value" header lines, a blank line, and the payload on the remaining lines. A payload sent with
+// "Content-Encoding: gzip" is decompressed. Errors wrap one of the Err* values of this package.
+func ParseRequest(r io.Reader) (Request, error) {
+	limited := &io.LimitedReader{R: r, N: MaxRequestSize + 1}
+	data, err := io.ReadAll(limited)
+	if err != nil {
+		return Request{}, fmt.Errorf("error while reading request: %w", err)
+	}
+	if int64(len(data)) > MaxRequestSize {
+		return Request{}, fmt.Errorf("%w: more than %d bytes", ErrRequestTooLarge, MaxRequestSize)
+	}
+	if len(data) == 0 {
+		return Request{}, ErrEmptyRequest
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(data))
+
+	operation, err := reader.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return Request{}, fmt.Errorf("error while reading operation: %w", err)
+	}
+	operation = strings.TrimRight(operation, "\r\n")
+	if operation == "" {
+		return Request{}, ErrMissingOperation
+	}
+	if strings.IndexFunc(operation, unicode.IsControl) >= 0 || strings.TrimSpace(operation) != operation {
+		return Request{}, fmt.Errorf("%w: %q", ErrMalformedOperation, operation)
+	}
+
+	var headers map[string]string
+	for {
+		line, err := reader.ReadString('\n')
+		if errors.Is(err, io.EOF) && line == "" {
+			return Request{Operation: operation, Headers: headers}, nil
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+
+		// a line that isn't a header is most likely the payload without the blank line before it
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || name == "" || strings.TrimFunc(name, isHeaderNameRune) != "" {
+			return Request{}, ErrMissingDelimiter
+		}
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[textproto.CanonicalMIMEHeaderKey(name)] = strings.TrimSpace(value)
+	}
+
+	rest, _ := io.ReadAll(reader)
+	payload := strings.ReplaceAll(string(rest), "\r\n", "\n")
+	payload = strings.TrimSuffix(payload, "\n")
+
+	if encoding := headers[HeaderContentEncoding]; encoding == "gzip" {
+		payload, err = decompressPayload(payload)
+		if err != nil {
+			return Request{}, fmt.Errorf("%w: %w", ErrMalformedPayload, err)
+		}
+	} else if encoding != "" && encoding != "identity" {
+		return Request{}, fmt.Errorf("%w: unsupported content encoding %q", ErrMalformedPayload, encoding)
+	}
+
+	return Request{Operation: operation, Headers: headers, Payload: payload}, nil
+}
+
+func isHeaderNameRune(r rune) bool {
+	return r == '-' || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
+
+// RequestMetadata is the conversation that a request belongs to, as sent by the host in the headers.
+// Fields the host didn't send are empty.
+type RequestMetadata struct {
+	ConversationID string
+	MessageID      string
+	UserID         string
+	// Deadline is zero when the host didn't send one.
+	Deadline time.Time
+	// Headers has all the headers of the request, including ones this package doesn't know about.
+	Headers map[string]string
+}
+
+type requestMetaKey struct{}
+
+// withRequestMeta adds the metadata of the request to ctx, and the deadline of the host, so that the
+// operations that honor ctx never outlive the request. The caller calls cancel when the request is done.
+func withRequestMeta(ctx context.Context, request Request) (context.Context, context.CancelFunc) {
+	meta := RequestMetadata{
+		ConversationID: request.Headers[HeaderConversationID],
+		MessageID:      request.Headers[HeaderMessageID],
+		UserID:         request.Headers[HeaderUserID],
+		Headers:        request.Headers,
+	}
+
+	if value := request.Headers[HeaderDeadline]; value != "" {
+		deadline, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			LoggerFrom(ctx).Warn("ignoring invalid deadline", "deadline", value, "error", err.Error())
+		} else {
+			meta.Deadline = deadline
+		}
+	}
+
+	ctx = context.WithValue(ctx, requestMetaKey{}, meta)
+	if meta.Deadline.IsZero() {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, meta.Deadline)
+}
+
+// RequestMeta returns the metadata of the request that ctx belongs to, e.g. to keep state per conversation
+// or to ignore a message that was already handled.
+//
+//goland:noinspection GoUnusedExportedFunction
+func RequestMeta(ctx context.Context) RequestMetadata {
+	meta, _ := ctx.Value(requestMetaKey{}).(RequestMetadata)
+	return meta
+}
@@ -0,0 +1,158 @@
+package framework
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"net/textproto"
+	"slices"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func gzipPayload(tb testing.TB, payload string) string {
+	tb.Helper()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(payload))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	err = zw.Close()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func FuzzParseRequest(f *testing.F) {
+	// a small limit lets the fuzzer reach it
+	maxRequestSize := MaxRequestSize
+	MaxRequestSize = 4 << 10
+	f.Cleanup(func() { MaxRequestSize = maxRequestSize })
+
+	seeds := []string{
+		"",
+		"\n",
+		"describe",
+		"describe\n",
+		"describe\n\n",
+		"get-weather\n\n{\"city\":\"Paris\"}",
+		"get-weather\r\n\r\n{\"city\":\"Paris\"}\r\n",
+		" get-weather\n\n{}",
+		"get\rweather\n\n{}",
+		"get\tweather\n\n{}",
+		"get-weather\n{\"city\":\"Paris\"}",
+		"get-weather\nConversation-Id: c1\nmessage-id: m1\nUser-Id: u1\n\n{}",
+		"get-weather\nDeadline: 2024-05-01T12:00:30Z\n\n{}",
+		"get-weather\nNot a header\n\n{}",
+		"get-weather\n: empty name\n\n{}",
+		"get-weather\nConversation-Id: c1\n",
+		"get-weather\nContent-Encoding: identity\n\n{}",
+		"get-weather\nContent-Encoding: br\n\n{}",
+		"get-weather\nContent-Encoding: gzip\n\n" + gzipPayload(f, `{"city":"Paris"}`),
+		"get-weather\nContent-Encoding: gzip\n\nnot base64!",
+		"get-weather\nContent-Encoding: gzip\n\n" + base64.StdEncoding.EncodeToString([]byte("not gzip")),
+		"get-weather\nContent-Encoding: gzip\n\n" + gzipPayload(f, strings.Repeat("a", int(MaxRequestSize)+1)),
+		"get-weather\n\n" + strings.Repeat("a", int(MaxRequestSize)),
+	}
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+
+	errs := []error{ErrEmptyRequest, ErrMissingOperation, ErrMissingDelimiter, ErrRequestTooLarge, ErrMalformedOperation, ErrMalformedPayload}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		request, err := ParseRequest(bytes.NewReader(data))
+		if err != nil {
+			if !slices.ContainsFunc(errs, func(target error) bool { return errors.Is(err, target) }) {
+				t.Fatalf("error doesn't wrap an Err value: %v", err)
+			}
+			return
+		}
+
+		if request.Operation == "" || strings.IndexFunc(request.Operation, unicode.IsControl) >= 0 || strings.TrimSpace(request.Operation) != request.Operation {
+			t.Fatalf("malformed operation: %q", request.Operation)
+		}
+		if int64(len(request.Payload)) > MaxRequestSize {
+			t.Fatalf("payload of %d bytes is larger than %d", len(request.Payload), MaxRequestSize)
+		}
+		for name := range request.Headers {
+			if name != textproto.CanonicalMIMEHeaderKey(name) {
+				t.Fatalf("header name isn't canonical: %q", name)
+			}
+		}
+	})
+}
+
+func TestParseRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Request
+		wantErr error
+	}{
+		{name: "operation only", input: "describe\n", want: Request{Operation: "describe"}},
+		{name: "payload", input: "get-weather\n\n{\"city\":\"Paris\"}\n", want: Request{Operation: "get-weather", Payload: `{"city":"Paris"}`}},
+		{name: "crlf", input: "get-weather\r\n\r\na\r\nb\r\n", want: Request{Operation: "get-weather", Payload: "a\nb"}},
+		{
+			name:  "headers",
+			input: "get-weather\nconversation-id: c1\nMessage-Id:  m1 \n\n{}",
+			want:  Request{Operation: "get-weather", Headers: map[string]string{HeaderConversationID: "c1", HeaderMessageID: "m1"}, Payload: "{}"},
+		},
+		{
+			name:  "gzip",
+			input: "get-weather\nContent-Encoding: gzip\n\n" + gzipPayload(t, `{"city":"Paris"}`),
+			want:  Request{Operation: "get-weather", Headers: map[string]string{HeaderContentEncoding: "gzip"}, Payload: `{"city":"Paris"}`},
+		},
+		{name: "empty", input: "", wantErr: ErrEmptyRequest},
+		{name: "blank operation", input: "\n\n{}", wantErr: ErrMissingOperation},
+		{name: "padded operation", input: " describe\n", wantErr: ErrMalformedOperation},
+		{name: "control character", input: "get\rweather\n\n{}", wantErr: ErrMalformedOperation},
+		{name: "missing delimiter", input: "get-weather\n{\"city\":\"Paris\"}", wantErr: ErrMissingDelimiter},
+		{name: "unsupported encoding", input: "get-weather\nContent-Encoding: br\n\n{}", wantErr: ErrMalformedPayload},
+		{name: "corrupt gzip", input: "get-weather\nContent-Encoding: gzip\n\nnot base64!", wantErr: ErrMalformedPayload},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRequest(strings.NewReader(tt.input))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Operation != tt.want.Operation || got.Payload != tt.want.Payload || len(got.Headers) != len(tt.want.Headers) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for name, value := range tt.want.Headers {
+				if got.Headers[name] != value {
+					t.Fatalf("header %s is %q, want %q", name, got.Headers[name], value)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRequestSizeLimits(t *testing.T) {
+	maxRequestSize := MaxRequestSize
+	MaxRequestSize = 1 << 10
+	t.Cleanup(func() { MaxRequestSize = maxRequestSize })
+
+	_, err := ParseRequest(strings.NewReader("get-weather\n\n" + strings.Repeat("a", int(MaxRequestSize))))
+	if !errors.Is(err, ErrRequestTooLarge) {
+		t.Fatalf("got error %v, want %v", err, ErrRequestTooLarge)
+	}
+
+	// the compressed payload is small, the decompressed one isn't
+	_, err = ParseRequest(strings.NewReader("get-weather\nContent-Encoding: gzip\n\n" + gzipPayload(t, strings.Repeat("a", int(MaxRequestSize)+1))))
+	if !errors.Is(err, ErrRequestTooLarge) {
+		t.Fatalf("got error %v, want %v", err, ErrRequestTooLarge)
+	}
+}
@@ -0,0 +1,85 @@
+package framework
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Provider is implemented by packages that publish a pack of tools for an external API.
+// A provider package typically registers itself from an init function so that an assistant
+// only needs to import it and call UseProvider.
+type Provider interface {
+	Name() string
+	Configure(secrets map[string]string) error
+	Tools() []Tool
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]Provider)
+)
+
+// RegisterProvider makes a provider available by name. It panics if the name is already registered.
+//
+//goland:noinspection GoUnusedExportedFunction
+func RegisterProvider(p Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	if p == nil {
+		panic("provider is nil")
+	}
+	if _, dup := providers[p.Name()]; dup {
+		panic("provider already registered: " + p.Name())
+	}
+	providers[p.Name()] = p
+}
+
+func LookupProvider(name string) (Provider, bool) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	p, ok := providers[name]
+	return p, ok
+}
+
+// Providers returns the sorted names of the registered providers.
+//
+//goland:noinspection GoUnusedExportedFunction
+func Providers() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// AddProvider configures the provider with the given secrets and adds all of its tools to the assistant.
+func (a *Assistant) AddProvider(p Provider, secrets map[string]string) error {
+	err := p.Configure(secrets)
+	if err != nil {
+		return fmt.Errorf("error while configuring provider %s: %w", p.Name(), err)
+	}
+
+	for _, t := range p.Tools() {
+		a.AddTool(t)
+	}
+
+	return nil
+}
+
+// UseProvider adds the tools of a registered provider to the assistant.
+func (a *Assistant) UseProvider(name string, secrets map[string]string) error {
+	p, ok := LookupProvider(name)
+	if !ok {
+		return fmt.Errorf("unknown provider: %s", name)
+	}
+
+	return a.AddProvider(p, secrets)
+}
@@ -0,0 +1,397 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spcoder/jarbles-framework/lib"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	JobStatusPending string = "pending"
+	JobStatusRunning string = "running"
+	JobStatusFailed  string = "failed"
+)
+
+// jobLease is how long a job can be running before it's assumed that its worker died and it's run again.
+const jobLease = 10 * time.Minute
+
+type JobFunction func(ctx context.Context, payload string) error
+
+// Job is a unit of background work. Jobs are removed from the queue when they succeed.
+type Job struct {
+	ID          string    `json:"id"`
+	Handler     string    `json:"handler"`
+	Payload     string    `json:"payload,omitempty"`
+	Status      string    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	MaxAttempts int       `json:"max_attempts"`
+	RunAfter    time.Time `json:"run_after"`
+	LastError   string    `json:"last_error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type jobHandler struct {
+	function JobFunction
+	retry    RetryPolicy
+}
+
+type AddJobHandlerOptions struct {
+	ID       string
+	Function JobFunction
+	// Retry sets the attempts and the backoff between them. Its RetryOn is ignored, every error is retried.
+	Retry RetryPolicy
+}
+
+// AddJobHandler adds a handler for the jobs enqueued for it with Enqueue.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (e *Extension) AddJobHandler(options AddJobHandlerOptions) {
+	if e.jobHandlers == nil {
+		e.jobHandlers = make(map[string]jobHandler)
+	}
+	e.jobHandlers[slugify(options.ID)] = jobHandler{function: options.Function, retry: options.Retry.withDefaults()}
+}
+
+// Enqueue adds a job for the handler to the durable queue of the extension and returns its ID. Jobs are run by
+// Work, or by the host with the __jobs_run operation.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (e *Extension) Enqueue(handler, payload string) (string, error) {
+	id := slugify(handler)
+	h, ok := e.jobHandlers[id]
+	if !ok {
+		return "", fmt.Errorf("unknown job handler: %s", handler)
+	}
+
+	now := time.Now()
+	job := Job{
+		ID:          randomID(),
+		Handler:     id,
+		Payload:     payload,
+		Status:      JobStatusPending,
+		MaxAttempts: h.retry.MaxAttempts,
+		RunAfter:    now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	err := e.updateJobs(func(jobs []Job) ([]Job, error) {
+		return append(jobs, job), nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return job.ID, nil
+}
+
+// Jobs returns the pending, running, and failed jobs, the oldest first.
+func (e *Extension) Jobs() ([]Job, error) {
+	jobs, err := e.loadJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs, nil
+}
+
+// RetryJob makes a failed job pending again, with its attempts reset.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (e *Extension) RetryJob(id string) error {
+	return e.updateJobs(func(jobs []Job) ([]Job, error) {
+		for i := range jobs {
+			if jobs[i].ID == id {
+				jobs[i].Status = JobStatusPending
+				jobs[i].Attempts = 0
+				jobs[i].RunAfter = time.Now()
+				jobs[i].UpdatedAt = time.Now()
+				return jobs, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown job: %s", id)
+	})
+}
+
+type WorkOptions struct {
+	// Concurrency is the number of jobs that run at the same time. Defaults to 1.
+	Concurrency int
+	// PollInterval is how often the queue is checked when it's empty. Defaults to 5 seconds.
+	PollInterval time.Duration
+}
+
+// Work runs jobs until ctx is done, for extensions that run as a daemon. It waits for the running jobs to
+// finish before it returns.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (e *Extension) Work(ctx context.Context, options WorkOptions) error {
+	if options.Concurrency < 1 {
+		options.Concurrency = 1
+	}
+	if options.PollInterval == 0 {
+		options.PollInterval = 5 * time.Second
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	slots := make(chan struct{}, options.Concurrency)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case slots <- struct{}{}:
+		}
+
+		job, ok, err := e.claimJob()
+		if err != nil {
+			LoggerFrom(ctx).Error("error while claiming job", "error", err.Error())
+		}
+		if !ok {
+			<-slots
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(options.PollInterval):
+			}
+			continue
+		}
+
+		wg.Add(1)
+		go func(job Job) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			e.runJob(ctx, job)
+		}(job)
+	}
+}
+
+// runDueJobs runs the jobs that are due one after the other and returns how many ran.
+func (e *Extension) runDueJobs(ctx context.Context) (string, error) {
+	ran := 0
+	for {
+		job, ok, err := e.claimJob()
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			break
+		}
+		e.runJob(ctx, job)
+		ran++
+	}
+
+	return fmt.Sprintf(`{"ran":%d}`, ran), nil
+}
+
+// claimJob marks the next due job as running and returns it.
+func (e *Extension) claimJob() (Job, bool, error) {
+	var claimed Job
+	found := false
+
+	err := e.updateJobs(func(jobs []Job) ([]Job, error) {
+		now := time.Now()
+		for i := range jobs {
+			job := &jobs[i]
+			expired := job.Status == JobStatusRunning && now.Sub(job.UpdatedAt) > jobLease
+			if (job.Status == JobStatusPending && !job.RunAfter.After(now)) || expired {
+				job.Status = JobStatusRunning
+				job.Attempts++
+				job.UpdatedAt = now
+				claimed, found = *job, true
+				break
+			}
+		}
+		return jobs, nil
+	})
+
+	return claimed, found, err
+}
+
+func (e *Extension) runJob(ctx context.Context, job Job) {
+	ctx = withProgress(ctx, job.ID, job.Handler)
+	defer clearProgress(job.ID)
+
+	var err error
+	h, ok := e.jobHandlers[job.Handler]
+	if ok {
+		LoggerFrom(ctx).Info("running job", "id", job.ID, "handler", job.Handler, "attempt", job.Attempts)
+		err = h.function(ctx, job.Payload)
+	} else {
+		err = fmt.Errorf("unknown job handler: %s", job.Handler)
+	}
+	if err != nil {
+		LoggerFrom(ctx).Error("error while running job", "id", job.ID, "handler", job.Handler, "error", err.Error())
+	}
+
+	updateErr := e.updateJobs(func(jobs []Job) ([]Job, error) {
+		kept := jobs[:0]
+		for _, j := range jobs {
+			if j.ID != job.ID {
+				kept = append(kept, j)
+				continue
+			}
+			if err == nil {
+				continue
+			}
+
+			j.LastError = err.Error()
+			j.UpdatedAt = time.Now()
+			if j.Attempts >= j.MaxAttempts || !ok {
+				j.Status = JobStatusFailed
+			} else {
+				j.Status = JobStatusPending
+				j.RunAfter = time.Now().Add(h.retry.delay(j.Attempts))
+			}
+			kept = append(kept, j)
+		}
+		return kept, nil
+	})
+	if updateErr != nil {
+		LoggerFrom(ctx).Error("error while updating job", "id", job.ID, "error", updateErr.Error())
+	}
+}
+
+// jobsOperation lists the jobs for the __jobs operation.
+func (e *Extension) jobsOperation() (string, error) {
+	jobs, err := e.Jobs()
+	if err != nil {
+		return "", err
+	}
+	if jobs == nil {
+		jobs = []Job{}
+	}
+
+	data, err := marshalJSON(jobs)
+	if err != nil {
+		return "", fmt.Errorf("error while marshaling jobs: %w", err)
+	}
+	return string(data), nil
+}
+
+type AddJobsCardOptions struct {
+	ID      string
+	Title   string
+	Refresh time.Duration
+	Height  string
+}
+
+// AddJobsCard adds a card that shows the pending, running, and failed jobs, and the action that renders them.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (e *Extension) AddJobsCard(options AddJobsCardOptions) {
+	if options.Title == "" {
+		options.Title = "Jobs"
+	}
+	if options.Refresh == 0 {
+		options.Refresh = 10 * time.Second
+	}
+
+	e.AddAction(AddActionOptions{
+		ID: options.ID,
+		ContextFunction: func(ctx context.Context, payload string) (*ExtensionResponse, error) {
+			jobs, err := e.Jobs()
+			if err != nil {
+				LoggerFrom(ctx).Error("error while listing jobs", "error", err.Error())
+				return nil, err
+			}
+
+			rows := make([]lib.JobRow, 0, len(jobs))
+			for _, job := range jobs {
+				rows = append(rows, lib.JobRow{
+					ID:       job.ID,
+					Handler:  job.Handler,
+					Status:   job.Status,
+					Attempts: job.Attempts,
+					RunAfter: job.RunAfter.In(TimeZone()).Format(time.DateTime),
+					Error:    job.LastError,
+				})
+			}
+
+			return &ExtensionResponse{
+				HTMLTitle: options.Title,
+				HTMLBody:  lib.Jobs(lib.JobsOptions{Title: options.Title, Jobs: rows, Refresh: options.Refresh}),
+				NoLayout:  true,
+			}, nil
+		},
+	})
+
+	e.AddCardCustom(ExtensionCard{
+		ID: options.ID,
+		HTML: lib.CardEmbed(lib.CardEmbedOptions{
+			ExtensionName: e.Name,
+			Title:         options.Title,
+			Href:          e.ActionUrl(slugify(options.ID)),
+			Height:        options.Height,
+		}),
+	})
+}
+
+func (e *Extension) jobsKey() string {
+	return storageKey("data", e.ID, "jobs.json")
+}
+
+// updateJobs loads the queue, passes it to update, and saves what update returns. Workers in this process and
+// in other processes are serialized with a mutex and a lock file.
+func (e *Extension) updateJobs(update func(jobs []Job) ([]Job, error)) error {
+	e.jobsMu.Lock()
+	defer e.jobsMu.Unlock()
+
+	unlock, err := lockFile(filepath.Join(profileStateDir("locks"), e.ID+"-jobs.lock"), 10*time.Second, time.Minute)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	jobs, err := e.loadJobs()
+	if err != nil {
+		return err
+	}
+
+	jobs, err = update(jobs)
+	if err != nil {
+		return err
+	}
+	if jobs == nil {
+		jobs = []Job{}
+	}
+
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error while marshaling jobs: %w", err)
+	}
+
+	err = CurrentStorage().Write(e.jobsKey(), data)
+	if err != nil {
+		return fmt.Errorf("error while writing jobs: %w", err)
+	}
+	return nil
+}
+
+func (e *Extension) loadJobs() ([]Job, error) {
+	data, err := CurrentStorage().Read(e.jobsKey())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while reading jobs: %w", err)
+	}
+
+	var jobs []Job
+	err = json.Unmarshal(data, &jobs)
+	if err != nil {
+		return nil, fmt.Errorf("error while unmarshaling jobs: %w", err)
+	}
+	return jobs, nil
+}
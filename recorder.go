@@ -0,0 +1,244 @@
+package framework
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	RecorderModeRecord string = "record"
+	RecorderModeReplay string = "replay"
+)
+
+var (
+	httpTransportMu sync.RWMutex
+	httpTransport   http.RoundTripper
+)
+
+// SetHTTPTransport replaces the transport used by the clients returned by HTTPClient, e.g. with a Recorder.
+// The network policy is still enforced. Passing nil restores the default transport.
+//
+//goland:noinspection GoUnusedExportedFunction
+func SetHTTPTransport(rt http.RoundTripper) {
+	httpTransportMu.Lock()
+	defer httpTransportMu.Unlock()
+
+	httpTransport = rt
+}
+
+type cassetteInteraction struct {
+	Method          string      `json:"method"`
+	URL             string      `json:"url"`
+	RequestHeaders  http.Header `json:"request_headers,omitempty"`
+	RequestBody     string      `json:"request_body,omitempty"`
+	StatusCode      int         `json:"status_code"`
+	ResponseHeaders http.Header `json:"response_headers,omitempty"`
+	ResponseBody    string      `json:"response_body"`
+}
+
+// Recorder is an http.RoundTripper that records interactions to a cassette file, or replays them from it,
+// so that tools making HTTP requests can be tested deterministically and offline. Cassettes are JSON files,
+// conventionally stored under testdata, that also show exactly what an assistant sent.
+type Recorder struct {
+	filename      string
+	mode          string
+	redactHeaders []string
+	redactParams  []string
+
+	mu           sync.Mutex
+	loaded       bool
+	interactions []cassetteInteraction
+	used         []bool
+}
+
+// redactedValue replaces the values of the query parameters that are redacted in cassettes.
+const redactedValue = "REDACTED"
+
+var (
+	// defaultRedactedHeaders are left out of every cassette.
+	defaultRedactedHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization", "X-Api-Key"}
+	// defaultRedactedParams are the query parameters that commonly hold secrets, e.g. the apikey of Alpha Vantage.
+	defaultRedactedParams = []string{"apikey", "api_key", "key", "token", "access_token", "secret", "client_secret", "password", "signature", "sig"}
+)
+
+type RecorderOptions struct {
+	Cassette string
+	// Mode is RecorderModeReplay to answer from the cassette, any other mode records.
+	Mode string
+	// RedactHeaders are request headers left out of the cassette, besides Authorization, Cookie, and the other
+	// common credentials.
+	RedactHeaders []string
+	// RedactParams are query parameters whose values are replaced with REDACTED in the cassette, besides the
+	// common ones like apikey and token. They are matched ignoring case.
+	RedactParams []string
+}
+
+// NewRecorder returns a Recorder for the cassette. In replay mode requests are answered from the cassette
+// and fail when no recorded interaction matches. Any other mode records real requests, appending to the cassette.
+func NewRecorder(cassette, mode string) *Recorder {
+	return NewRecorderWithOptions(RecorderOptions{Cassette: cassette, Mode: mode})
+}
+
+// NewRecorderWithOptions is like NewRecorder with more headers and query parameters to redact. Real requests
+// are sent with the network policy, its hosts, proxy, and pins.
+func NewRecorderWithOptions(options RecorderOptions) *Recorder {
+	return &Recorder{
+		filename:      options.Cassette,
+		mode:          options.Mode,
+		redactHeaders: append(append([]string(nil), defaultRedactedHeaders...), options.RedactHeaders...),
+		redactParams:  append(append([]string(nil), defaultRedactedParams...), options.RedactParams...),
+	}
+}
+
+func (r *Recorder) RoundTrip(request *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var requestBody []byte
+	if request.Body != nil {
+		requestBody, err = io.ReadAll(request.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading request body: %w", err)
+		}
+		_ = request.Body.Close()
+		request.Body = io.NopCloser(bytes.NewReader(requestBody))
+	}
+
+	if r.mode == RecorderModeReplay {
+		return r.replay(request, requestBody)
+	}
+
+	resp, err := networkTransport().RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+
+	responseBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error while reading response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(responseBody))
+
+	headers := request.Header.Clone()
+	for _, name := range r.redactHeaders {
+		headers.Del(name)
+	}
+
+	r.interactions = append(r.interactions, cassetteInteraction{
+		Method:          request.Method,
+		URL:             r.cassetteURL(request.URL),
+		RequestHeaders:  headers,
+		RequestBody:     string(requestBody),
+		StatusCode:      resp.StatusCode,
+		ResponseHeaders: resp.Header,
+		ResponseBody:    string(responseBody),
+	})
+	r.used = append(r.used, true)
+
+	return resp, r.save()
+}
+
+// cassetteURL returns the URL with the values of the redacted query parameters replaced, and without a password.
+// Recording and replaying both use it, so the redacted URLs still match.
+func (r *Recorder) cassetteURL(u *url.URL) string {
+	query := u.Query()
+	redacted := false
+	for name, values := range query {
+		if !slices.ContainsFunc(r.redactParams, func(param string) bool { return strings.EqualFold(param, name) }) {
+			continue
+		}
+		for i := range values {
+			values[i] = redactedValue
+		}
+		redacted = true
+	}
+
+	// the query is only encoded again when it changed, so the URLs of older cassettes still match
+	stripped := *u
+	if redacted {
+		stripped.RawQuery = query.Encode()
+	}
+	return stripped.Redacted()
+}
+
+// replay answers with the first unused interaction matching the method, url, and body.
+func (r *Recorder) replay(request *http.Request, body []byte) (*http.Response, error) {
+	u := r.cassetteURL(request.URL)
+	for i, interaction := range r.interactions {
+		if r.used[i] || interaction.Method != request.Method || interaction.URL != u || interaction.RequestBody != string(body) {
+			continue
+		}
+		r.used[i] = true
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.StatusCode, http.StatusText(interaction.StatusCode)),
+			StatusCode:    interaction.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        interaction.ResponseHeaders,
+			Body:          io.NopCloser(bytes.NewReader([]byte(interaction.ResponseBody))),
+			ContentLength: int64(len(interaction.ResponseBody)),
+			Request:       request,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("no recorded interaction for %s %s in %s", request.Method, u, r.filename)
+}
+
+func (r *Recorder) load() error {
+	if r.loaded {
+		return nil
+	}
+	r.loaded = true
+
+	data, err := os.ReadFile(r.filename)
+	if os.IsNotExist(err) && r.mode != RecorderModeReplay {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error while reading cassette at %s: %w", r.filename, err)
+	}
+
+	err = json.Unmarshal(data, &r.interactions)
+	if err != nil {
+		return fmt.Errorf("error while unmarshaling cassette at %s: %w", r.filename, err)
+	}
+	r.used = make([]bool, len(r.interactions))
+
+	return nil
+}
+
+func (r *Recorder) save() error {
+	data, err := json.MarshalIndent(r.interactions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error while marshaling cassette: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(r.filename), workspaceDirPerm)
+	if err != nil {
+		return fmt.Errorf("error while creating cassette directory: %w", err)
+	}
+
+	err = os.WriteFile(r.filename, data, workspaceFilePerm)
+	if err != nil {
+		return fmt.Errorf("error while writing cassette at %s: %w", r.filename, err)
+	}
+
+	return nil
+}
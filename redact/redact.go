@@ -0,0 +1,241 @@
+// Package redact detects personal data and secrets in text, like email addresses, phone numbers,
+// credit card numbers, and API keys, and masks them according to a policy.
+//
+// Detection is pattern based and errs on the side of masking: it's meant to keep the obvious cases out of logs,
+// stored state, and model context, not to guarantee that no personal data gets through.
+package redact
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type Kind string
+
+const (
+	KindEmail      Kind = "email"
+	KindPhone      Kind = "phone"
+	KindCreditCard Kind = "credit-card"
+	KindAPIKey     Kind = "api-key"
+)
+
+// AllKinds lists the kinds in the order they are detected. When matches overlap, the earlier kind wins.
+var AllKinds = []Kind{KindAPIKey, KindEmail, KindCreditCard, KindPhone}
+
+type Style int
+
+const (
+	// StyleLabel replaces a match with its kind, e.g. [REDACTED EMAIL].
+	StyleLabel Style = iota
+	// StylePartial keeps the last four characters of a match and masks the rest.
+	StylePartial
+)
+
+// Policy selects what is redacted and how. A zero Policy redacts all kinds with labels.
+type Policy struct {
+	Kinds []Kind
+	Style Style
+}
+
+// DefaultPolicy redacts all kinds with labels.
+var DefaultPolicy = Policy{}
+
+type Match struct {
+	Kind  Kind
+	Start int
+	End   int
+	Value string
+}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+
+	phonePattern = regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{2,4}\)[\s.-]?|\b\d{2,4}[\s.-])\d{3,4}[\s.-]?\d{3,4}\b`)
+
+	// dotted quads look like phone numbers with dots
+	ipv4Pattern = regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}\b`)
+
+	creditCardPattern = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+
+	apiKeyPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`\bsk-(?:proj-|ant-)?[A-Za-z0-9_-]{20,}`),
+		regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),
+		regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,}\b`),
+		regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`),
+		regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`),
+		regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),
+		regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/-]{20,}=*`),
+	}
+
+	// long tokens that mix letters and digits and look random are likely to be keys
+	tokenPattern = regexp.MustCompile(`\b[A-Za-z0-9_\-]{32,}\b`)
+)
+
+// Find returns the matches of the kinds in text, ordered by position. All kinds are detected when none are given.
+func Find(text string, kinds ...Kind) []Match {
+	if len(kinds) == 0 {
+		kinds = AllKinds
+	}
+
+	var matches []Match
+	add := func(kind Kind, loc []int) {
+		for _, m := range matches {
+			if loc[0] < m.End && m.Start < loc[1] {
+				return
+			}
+		}
+		matches = append(matches, Match{Kind: kind, Start: loc[0], End: loc[1], Value: text[loc[0]:loc[1]]})
+	}
+
+	for _, kind := range AllKinds {
+		if !contains(kinds, kind) {
+			continue
+		}
+
+		switch kind {
+		case KindAPIKey:
+			for _, pattern := range apiKeyPatterns {
+				for _, loc := range pattern.FindAllStringIndex(text, -1) {
+					add(kind, loc)
+				}
+			}
+			for _, loc := range tokenPattern.FindAllStringIndex(text, -1) {
+				if looksRandom(text[loc[0]:loc[1]]) {
+					add(kind, loc)
+				}
+			}
+		case KindEmail:
+			for _, loc := range emailPattern.FindAllStringIndex(text, -1) {
+				add(kind, loc)
+			}
+		case KindCreditCard:
+			for _, loc := range creditCardPattern.FindAllStringIndex(text, -1) {
+				if luhn(text[loc[0]:loc[1]]) {
+					add(kind, loc)
+				}
+			}
+		case KindPhone:
+			addresses := ipv4Pattern.FindAllStringIndex(text, -1)
+			for _, loc := range phonePattern.FindAllStringIndex(text, -1) {
+				digits := countDigits(text[loc[0]:loc[1]])
+				if digits >= 7 && digits <= 15 && !overlaps(addresses, loc) {
+					add(kind, loc)
+				}
+			}
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Start < matches[j].Start
+	})
+	return matches
+}
+
+// Redact masks the matches of the policy in text.
+func (p Policy) Redact(text string) string {
+	matches := Find(text, p.Kinds...)
+	if len(matches) == 0 {
+		return text
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(text[last:m.Start])
+		b.WriteString(p.mask(m))
+		last = m.End
+	}
+	b.WriteString(text[last:])
+
+	return b.String()
+}
+
+func (p Policy) mask(m Match) string {
+	if p.Style == StylePartial && len(m.Value) > 8 {
+		return strings.Repeat("*", len(m.Value)-4) + m.Value[len(m.Value)-4:]
+	}
+	return "[REDACTED " + strings.ToUpper(strings.ReplaceAll(string(m.Kind), "-", " ")) + "]"
+}
+
+// Redact masks all kinds in text with labels.
+//
+//goland:noinspection GoUnusedExportedFunction
+func Redact(text string) string {
+	return DefaultPolicy.Redact(text)
+}
+
+func contains(kinds []Kind, kind Kind) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func overlaps(locs [][]int, loc []int) bool {
+	for _, l := range locs {
+		if loc[0] < l[1] && l[0] < loc[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func countDigits(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			n++
+		}
+	}
+	return n
+}
+
+// luhn reports whether the digits of s pass the Luhn checksum used by card numbers.
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && n <= 19 && sum%10 == 0
+}
+
+// looksRandom reports whether s mixes letters and digits and has the entropy of a generated token.
+func looksRandom(s string) bool {
+	letters, digits := 0, 0
+	counts := make(map[rune]int)
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+			letters++
+		}
+		counts[r]++
+	}
+	if letters == 0 || digits == 0 {
+		return false
+	}
+
+	entropy := 0.0
+	for _, c := range counts {
+		p := float64(c) / float64(len(s))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= 3.5
+}
@@ -0,0 +1,13 @@
+package framework
+
+import (
+	"github.com/spcoder/jarbles-framework/redact"
+)
+
+// Redacted returns a copy of the tool whose output is redacted with the policy before it's returned to the model.
+// Set JARBLES_LOG_REDACT=true to also redact everything that is logged.
+//
+//goland:noinspection GoUnusedExportedFunction
+func Redacted(t Tool, policy redact.Policy) Tool {
+	return mapToolOutput(t, policy.Redact)
+}
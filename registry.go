@@ -0,0 +1,235 @@
+package framework
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const disabledSuffix = ".disabled"
+
+const (
+	KindAssistant string = "assistant"
+	KindExtension string = "extension"
+)
+
+// Installed describes an assistant or extension registered under ~/.jarbles.
+type Installed struct {
+	Kind    string
+	ID      string
+	Binary  string
+	Enabled bool
+	// Definition is the path of the description TOML. Only assistants have one.
+	Definition string
+}
+
+// InstalledAssistants lists the assistants found in AssistantsDir(), enabled or not.
+//
+//goland:noinspection GoUnusedExportedFunction
+func InstalledAssistants() ([]Installed, error) {
+	entries, err := readDirIfExists(AssistantsDir())
+	if err != nil {
+		return nil, err
+	}
+
+	var installed []Installed
+	for _, entry := range entries {
+		name := entry.Name()
+		enabled := !strings.HasSuffix(name, disabledSuffix)
+		base := strings.TrimSuffix(name, disabledSuffix)
+		if entry.IsDir() || filepath.Ext(base) != ".toml" {
+			continue
+		}
+
+		definition := filepath.Join(AssistantsDir(), name)
+		data, err := os.ReadFile(definition)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading assistant definition at %s: %w", definition, err)
+		}
+
+		var fa frameworkAssistant
+		err = toml.Unmarshal(data, &fa)
+		if err != nil {
+			return nil, fmt.Errorf("error while unmarshaling assistant definition at %s: %w", definition, err)
+		}
+
+		binaryName := fa.BinaryName
+		if binaryName == "" {
+			binaryName = strings.TrimSuffix(base, ".toml")
+		}
+
+		installed = append(installed, Installed{
+			Kind:       KindAssistant,
+			ID:         fa.StaticID,
+			Binary:     filepath.Join(AssistantsDir(), binaryName),
+			Enabled:    enabled,
+			Definition: definition,
+		})
+	}
+
+	return installed, nil
+}
+
+// InstalledExtensions lists the extension binaries found in ExtensionsDir(), enabled or not.
+//
+//goland:noinspection GoUnusedExportedFunction
+func InstalledExtensions() ([]Installed, error) {
+	entries, err := readDirIfExists(ExtensionsDir())
+	if err != nil {
+		return nil, err
+	}
+
+	var installed []Installed
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+		installed = append(installed, Installed{
+			Kind:    KindExtension,
+			ID:      strings.TrimSuffix(strings.TrimSuffix(name, disabledSuffix), ".exe"),
+			Binary:  filepath.Join(ExtensionsDir(), name),
+			Enabled: !strings.HasSuffix(name, disabledSuffix),
+		})
+	}
+
+	return installed, nil
+}
+
+// Enable makes the host load an assistant or extension again.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (i *Installed) Enable() error {
+	if i.Enabled {
+		return nil
+	}
+
+	err := i.rename(func(path string) string { return strings.TrimSuffix(path, disabledSuffix) })
+	if err != nil {
+		return err
+	}
+	i.Enabled = true
+
+	return nil
+}
+
+// Disable keeps an assistant or extension installed but stops the host from loading it.
+// Assistants are disabled by renaming their definition, extensions by renaming their binary.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (i *Installed) Disable() error {
+	if !i.Enabled {
+		return nil
+	}
+
+	err := i.rename(func(path string) string { return path + disabledSuffix })
+	if err != nil {
+		return err
+	}
+	i.Enabled = false
+
+	return nil
+}
+
+func (i *Installed) rename(fn func(string) string) error {
+	path := &i.Binary
+	if i.Kind == KindAssistant {
+		path = &i.Definition
+	}
+
+	renamed := fn(*path)
+	err := os.Rename(*path, renamed)
+	if err != nil {
+		return fmt.Errorf("error while renaming %s to %s: %w", *path, renamed, err)
+	}
+	*path = renamed
+
+	return nil
+}
+
+// avatarExts are the extensions an avatar copied by Package can have.
+var avatarExts = []string{".png", ".jpg", ".jpeg", ".gif", ".webp", ".svg"}
+
+// Remove deletes the binary and, for assistants, the definition and avatar.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (i *Installed) Remove() error {
+	paths := []string{i.Binary}
+	if i.Kind == KindAssistant {
+		paths = append(paths, i.Definition)
+		// the avatar is named like the definition, only the extension is of the image
+		base := strings.TrimSuffix(strings.TrimSuffix(i.Definition, disabledSuffix), ".toml")
+		for _, ext := range avatarExts {
+			paths = append(paths, base+ext)
+		}
+	}
+
+	for _, path := range paths {
+		err := os.Remove(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error while removing %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// Check verifies that the binary exists, is executable, and answers describe with valid JSON.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (i *Installed) Check() error {
+	info, err := os.Stat(i.Binary)
+	if err != nil {
+		return fmt.Errorf("error while reading binary at %s: %w", i.Binary, err)
+	}
+	// Windows has no executable bit, binaries are executable by their extension
+	executable := info.Mode()&0111 != 0
+	if runtime.GOOS == "windows" {
+		executable = strings.EqualFold(filepath.Ext(i.Binary), ".exe")
+	}
+	if info.IsDir() || !executable {
+		return fmt.Errorf("binary is not executable: %s", i.Binary)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, i.Binary)
+	cmd.Stdin = strings.NewReader("describe\n\n")
+	cmd.Stdout = &stdout
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("error while running describe on %s: %w", i.Binary, err)
+	}
+
+	var description map[string]any
+	err = json.Unmarshal(stdout.Bytes(), &description)
+	if err != nil {
+		return fmt.Errorf("describe output of %s is not valid json: %w", i.Binary, err)
+	}
+
+	return nil
+}
+
+func readDirIfExists(dir string) ([]os.DirEntry, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while reading directory %s: %w", dir, err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,137 @@
+package framework
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// REPL runs an interactive loop on the terminal for testing the tools of an assistant locally.
+// Enter a tool name and then its JSON payload. JSON results are pretty printed.
+// The commands tools, history, !<n> (run history entry n again), and exit are also available.
+// History is kept in the log directory between sessions.
+//
+//goland:noinspection GoUnusedExportedFunction
+func REPL(a *Assistant) error {
+	return a.repl(os.Stdin, os.Stdout)
+}
+
+type replEntry struct {
+	Tool    string `json:"tool"`
+	Payload string `json:"payload"`
+}
+
+func (a *Assistant) repl(r io.Reader, w io.Writer) error {
+	_ = os.MkdirAll(LogDir(), privateDirPerm)
+	historyFile := filepath.Join(LogDir(), "repl_history.jsonl")
+	history := replLoadHistory(historyFile)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	prompt := func(p string) (string, bool) {
+		_, _ = fmt.Fprint(w, p)
+		if !scanner.Scan() {
+			return "", false
+		}
+		return strings.TrimSpace(scanner.Text()), true
+	}
+
+	for {
+		line, ok := prompt("tool> ")
+		if !ok {
+			_, _ = fmt.Fprintln(w)
+			return scanner.Err()
+		}
+
+		var entry replEntry
+		switch {
+		case line == "":
+			continue
+		case line == "exit" || line == "quit":
+			return nil
+		case line == "tools":
+			names := []string{"describe"}
+			for name := range a.tools {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			_, _ = fmt.Fprintln(w, strings.Join(names, "\n"))
+			continue
+		case line == "history":
+			for i, h := range history {
+				_, _ = fmt.Fprintf(w, "%3d  %s %s\n", i+1, h.Tool, h.Payload)
+			}
+			continue
+		case strings.HasPrefix(line, "!"):
+			n, err := strconv.Atoi(line[1:])
+			if err != nil || n < 1 || n > len(history) {
+				_, _ = fmt.Fprintf(w, "no history entry %s\n", line[1:])
+				continue
+			}
+			entry = history[n-1]
+			_, _ = fmt.Fprintf(w, "%s %s\n", entry.Tool, entry.Payload)
+		default:
+			payload, ok := prompt("payload> ")
+			if !ok {
+				return scanner.Err()
+			}
+			if payload == "" {
+				payload = "{}"
+			}
+			entry = replEntry{Tool: line, Payload: payload}
+		}
+
+		history = append(history, entry)
+		replAppendHistory(historyFile, entry)
+
+		output := a.Test(a.Payload(entry.Tool, entry.Payload))
+
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, []byte(output), "", "  ") == nil {
+			output = pretty.String()
+		}
+		_, _ = fmt.Fprintln(w, output)
+	}
+}
+
+func replLoadHistory(filename string) []replEntry {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil
+	}
+
+	var history []replEntry
+	for _, line := range strings.Split(string(data), "\n") {
+		var entry replEntry
+		if json.Unmarshal([]byte(line), &entry) == nil && entry.Tool != "" {
+			history = append(history, entry)
+		}
+	}
+
+	return history
+}
+
+func replAppendHistory(filename string, entry replEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, privateFilePerm)
+	if err != nil {
+		return
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	_, _ = f.Write(append(data, '\n'))
+}
@@ -0,0 +1,290 @@
+package framework
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// RepoMapMaxFileSize is the largest file whose symbols and TODOs are read, larger ones only have their size.
+var RepoMapMaxFileSize int64 = 1 << 20
+
+// repoMapMaxSymbols caps the symbols listed for each file in the text of a repository map.
+const repoMapMaxSymbols = 20
+
+var todoPattern = regexp.MustCompile(`\b(TODO|FIXME|XXX|HACK)\b`)
+
+// RepoFile is a file of a repository map. Symbols are the exported declarations of go files, e.g. Walk,
+// WalkOptions, or Ignore.Match.
+type RepoFile struct {
+	Path    string   `json:"path"`
+	Size    int64    `json:"size"`
+	Lines   int      `json:"lines,omitempty"`
+	TODOs   int      `json:"todos,omitempty"`
+	Package string   `json:"package,omitempty"`
+	Symbols []string `json:"symbols,omitempty"`
+	Binary  bool     `json:"binary,omitempty"`
+}
+
+// RepoMap is a compact orientation of a repository for a model, cheaper than reading its files one by one.
+// Hash changes whenever the content of a file changes.
+type RepoMap struct {
+	Hash      string     `json:"hash"`
+	Size      int64      `json:"size"`
+	TODOs     int        `json:"todos"`
+	Files     []RepoFile `json:"files"`
+	Truncated bool       `json:"truncated,omitempty"`
+}
+
+// RepoMapCacheDir has the summaries of the files of repository maps, keyed by the hash of their content, so
+// that only the files that changed are parsed again.
+func RepoMapCacheDir() string {
+	return profileStateDir("repomap")
+}
+
+// BuildRepoMap maps the files below root that ignore doesn't match.
+func BuildRepoMap(ctx context.Context, root string, ignore *Ignore) (RepoMap, error) {
+	entries, truncated, err := Walk(ctx, root, WalkOptions{MaxEntries: WalkMaxEntries, Ignore: ignore})
+	if err != nil {
+		return RepoMap{}, err
+	}
+
+	cacheFile := filepath.Join(RepoMapCacheDir(), fmt.Sprintf("%x.json", sha256.Sum256([]byte(root))))
+	cache := make(map[string]RepoFile)
+	if data, err := os.ReadFile(cacheFile); err == nil {
+		_ = json.Unmarshal(data, &cache)
+	}
+
+	used := make(map[string]RepoFile)
+	hash := sha256.New()
+	m := RepoMap{Truncated: truncated}
+	for _, entry := range entries {
+		if entry.Type != FileTypeFile {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return RepoMap{}, err
+		}
+
+		data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(entry.Path)))
+		if err != nil {
+			LoggerFrom(ctx).Warn("skipping unreadable file in repo map", "path", entry.Path, "error", err.Error())
+			continue
+		}
+		sum := sha256.Sum256(data)
+		key := hex.EncodeToString(sum[:])
+		_, _ = fmt.Fprintf(hash, "%s\x00%s\n", entry.Path, key)
+
+		file, ok := cache[key]
+		if !ok {
+			file = summarizeRepoFile(entry.Path, data)
+		}
+		used[key] = file
+
+		file.Path = entry.Path
+		m.Files = append(m.Files, file)
+		m.Size += file.Size
+		m.TODOs += file.TODOs
+	}
+	m.Hash = hex.EncodeToString(hash.Sum(nil))
+
+	// only the files of this map are kept, the summaries of deleted or changed files go away
+	if data, err := json.Marshal(used); err == nil {
+		if err := os.MkdirAll(RepoMapCacheDir(), privateDirPerm); err == nil {
+			err = os.WriteFile(cacheFile, data, privateFilePerm)
+			if err != nil {
+				LoggerFrom(ctx).Warn("error while caching repo map", "error", err.Error())
+			}
+		}
+	}
+
+	return m, nil
+}
+
+func summarizeRepoFile(name string, data []byte) RepoFile {
+	file := RepoFile{Size: int64(len(data))}
+	if file.Size > RepoMapMaxFileSize {
+		return file
+	}
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		file.Binary = true
+		return file
+	}
+
+	file.Lines = bytes.Count(data, []byte("\n"))
+	file.TODOs = len(todoPattern.FindAllIndex(data, -1))
+	if strings.HasSuffix(name, ".go") {
+		file.Package, file.Symbols = goSymbols(name, data)
+	}
+
+	return file
+}
+
+// goSymbols returns the package and the exported declarations of a go file, or nothing when it doesn't parse.
+func goSymbols(name string, data []byte) (string, []string) {
+	f, err := parser.ParseFile(token.NewFileSet(), name, data, parser.SkipObjectResolution)
+	if err != nil {
+		return "", nil
+	}
+
+	var symbols []string
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if !d.Name.IsExported() {
+				continue
+			}
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				receiver := receiverName(d.Recv.List[0].Type)
+				if !ast.IsExported(receiver) {
+					continue
+				}
+				symbols = append(symbols, receiver+"."+d.Name.Name)
+			} else {
+				symbols = append(symbols, d.Name.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if s.Name.IsExported() {
+						symbols = append(symbols, s.Name.Name)
+					}
+				case *ast.ValueSpec:
+					for _, n := range s.Names {
+						if n.IsExported() {
+							symbols = append(symbols, n.Name)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return f.Name.Name, symbols
+}
+
+func receiverName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(t.X)
+	case *ast.IndexExpr:
+		return receiverName(t.X)
+	case *ast.IndexListExpr:
+		return receiverName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+// String renders the map as compact text, a line for each file grouped by directory, e.g.
+//
+//	walk.go 5.2 KB, 180 lines: Walk, WalkOptions, WalkEntry
+func (m RepoMap) String() string {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "%d files, %s, %d TODOs\n", len(m.Files), formatSize(m.Size), m.TODOs)
+	if m.Truncated {
+		b.WriteString("(truncated, more files weren't mapped)\n")
+	}
+
+	files := append([]RepoFile(nil), m.Files...)
+	sort.SliceStable(files, func(i, j int) bool {
+		di, dj := path.Dir(files[i].Path), path.Dir(files[j].Path)
+		if di != dj {
+			return di < dj
+		}
+		return files[i].Path < files[j].Path
+	})
+
+	// a directory can have a test package next to its package
+	packages := make(map[string][]string)
+	for _, f := range files {
+		d := path.Dir(f.Path)
+		if f.Package != "" && !slices.Contains(packages[d], f.Package) {
+			packages[d] = append(packages[d], f.Package)
+		}
+	}
+
+	dir := ""
+	for _, f := range files {
+		if d := path.Dir(f.Path); d != dir {
+			dir = d
+			b.WriteString(d + "/")
+			if len(packages[d]) > 0 {
+				b.WriteString(" (package " + strings.Join(packages[d], ", ") + ")")
+			}
+			b.WriteByte('\n')
+		}
+
+		_, _ = fmt.Fprintf(&b, "  %s %s", path.Base(f.Path), formatSize(f.Size))
+		switch {
+		case f.Binary:
+			b.WriteString(", binary")
+		case f.Lines > 0:
+			_, _ = fmt.Fprintf(&b, ", %d lines", f.Lines)
+		}
+		if f.TODOs > 0 {
+			_, _ = fmt.Fprintf(&b, ", %d TODOs", f.TODOs)
+		}
+		if len(f.Symbols) > 0 {
+			symbols := f.Symbols
+			more := ""
+			if len(symbols) > repoMapMaxSymbols {
+				more = fmt.Sprintf(" and %d more", len(symbols)-repoMapMaxSymbols)
+				symbols = symbols[:repoMapMaxSymbols]
+			}
+			_, _ = fmt.Fprintf(&b, ": %s%s", strings.Join(symbols, ", "), more)
+		}
+		b.WriteByte('\n')
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
+func repoMap(root string) ToolContextFunction {
+	return func(ctx context.Context, payload string) (string, error) {
+		dirName, _ := PayloadGetString(payload, "dir", "")
+		dir, err := safeDir(root, dirName)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while getting safe directory", "error", err.Error())
+			return "", fmt.Errorf("error while getting safe directory: %w", err)
+		}
+
+		ignore, err := loadIgnoreFor(root, dir)
+		if err != nil {
+			return "", err
+		}
+
+		m, err := BuildRepoMap(ctx, dir, ignore)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while building repo map", "dir", dir, "error", err.Error())
+			return "", fmt.Errorf("error while building repo map: %w", err)
+		}
+
+		return m.String(), nil
+	}
+}
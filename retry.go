@@ -0,0 +1,177 @@
+package framework
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy configures Retry. Zero fields use the defaults: 3 attempts, 200ms initial delay doubling up to 5s,
+// with half of each delay randomized, retrying every error that isn't permanent or a canceled context.
+type RetryPolicy struct {
+	MaxAttempts  int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	// Jitter is the fraction of each delay that is randomized, between 0 and 1.
+	Jitter float64
+	// RetryOn reports whether an error is worth another attempt.
+	RetryOn func(err error) bool
+}
+
+var DefaultRetryPolicy = RetryPolicy{}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks an error that Retry must not retry.
+//
+//goland:noinspection GoUnusedExportedFunction
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = 3
+	}
+	if p.InitialDelay == 0 {
+		p.InitialDelay = 200 * time.Millisecond
+	}
+	if p.MaxDelay == 0 {
+		p.MaxDelay = 5 * time.Second
+	}
+	if p.Multiplier == 0 {
+		p.Multiplier = 2
+	}
+	if p.Jitter == 0 {
+		p.Jitter = 0.5
+	}
+	return p
+}
+
+// delay returns how long to wait before the attempt after the given one, which starts at 1.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := float64(p.InitialDelay)
+	for i := 1; i < attempt; i++ {
+		d *= p.Multiplier
+		if d >= float64(p.MaxDelay) {
+			d = float64(p.MaxDelay)
+			break
+		}
+	}
+
+	jitter := d * p.Jitter
+	return time.Duration(d - jitter + rand.Float64()*jitter)
+}
+
+// Retry calls fn until it succeeds, returns an error that shouldn't be retried, the attempts run out, or ctx is done.
+// Between attempts it waits with exponential backoff and jitter. The error of the last attempt is returned.
+func Retry(ctx context.Context, policy RetryPolicy, fn func(ctx context.Context) error) error {
+	policy = policy.withDefaults()
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn(ctx)
+		if err == nil {
+			return nil
+		}
+
+		var permanent permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+		if policy.RetryOn != nil && !policy.RetryOn(err) {
+			return err
+		}
+		if attempt >= policy.MaxAttempts {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		delay := policy.delay(attempt)
+		LoggerFrom(ctx).Debug("retrying", "attempt", attempt, "delay", delay.String(), "error", err.Error())
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// RetryableHTTPStatus reports whether a response with the status code is worth retrying.
+func RetryableHTTPStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+type retryableStatusError struct {
+	resp *http.Response
+}
+
+func (e retryableStatusError) Error() string {
+	return fmt.Sprintf("unexpected status: %s", e.resp.Status)
+}
+
+// retryTransport retries requests without a body, which are safe to send again, on network errors and on
+// responses with a retryable status.
+type retryTransport struct {
+	policy RetryPolicy
+	next   http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Body != nil && request.Body != http.NoBody || request.Method != http.MethodGet && request.Method != http.MethodHead {
+		return t.next.RoundTrip(request)
+	}
+
+	var resp *http.Response
+	err := Retry(request.Context(), t.policy, func(ctx context.Context) error {
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+
+		var err error
+		resp, err = t.next.RoundTrip(request)
+		if err != nil {
+			return err
+		}
+		if RetryableHTTPStatus(resp.StatusCode) {
+			return retryableStatusError{resp: resp}
+		}
+		return nil
+	})
+
+	// after the last attempt the response with the retryable status is returned as is
+	var statusErr retryableStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.resp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,395 @@
+package framework
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LicenseUnknown is the license of a component whose license can't be found or recognized.
+const LicenseUnknown = "unknown"
+
+// copyleftLicenses are the licenses that put conditions on the software that uses the component.
+var copyleftLicenses = []string{"GPL", "AGPL", "LGPL", "MPL", "EPL", "EUPL", "CDDL", "OSL", "SSPL"}
+
+// Component is a dependency of a project. License is an SPDX ID or expression, or LicenseUnknown.
+type Component struct {
+	Ecosystem string
+	Name      string
+	Version   string
+	License   string
+}
+
+// PURL returns the package URL of the component, see https://github.com/package-url/purl-spec.
+func (c Component) PURL() string {
+	name := c.Name
+	if c.Ecosystem == "npm" {
+		// the @ of a scope is encoded, the slash after it separates the namespace
+		name = strings.Replace(name, "@", "%40", 1)
+	}
+	return "pkg:" + c.Ecosystem + "/" + name + "@" + url.PathEscape(c.Version)
+}
+
+// Components returns the dependencies of the go module and the node package in dir, sorted by name.
+// Go dependencies must be downloaded for their license to be found, and node ones need a package-lock.json.
+func Components(ctx context.Context, dir string) ([]Component, error) {
+	var components []Component
+	var errs []error
+	found := false
+
+	if fileExists(dir, "go.mod") {
+		found = true
+		c, err := goComponents(ctx, dir)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		components = append(components, c...)
+	}
+	if fileExists(dir, "package-lock.json") {
+		found = true
+		c, err := npmComponents(dir)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		components = append(components, c...)
+	}
+	if !found {
+		return nil, fmt.Errorf("error while listing components of %s: no go.mod or package-lock.json", dir)
+	}
+
+	sort.Slice(components, func(i, j int) bool {
+		if components[i].Ecosystem != components[j].Ecosystem {
+			return components[i].Ecosystem < components[j].Ecosystem
+		}
+		return components[i].Name < components[j].Name
+	})
+
+	return components, errors.Join(errs...)
+}
+
+func goComponents(ctx context.Context, dir string) ([]Component, error) {
+	goPath, err := GoPath()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, BuildStepTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := toolchainCommand(ctx, goPath, "list", "-m", "-json", "all")
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	LoggerFrom(ctx).Info("running command", "command", cmd)
+	err = cmd.Run()
+	if err != nil {
+		LoggerFrom(ctx).Error("error while listing modules", "stderr", stderr.String(), "error", err.Error())
+		return nil, fmt.Errorf("error while listing modules: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	var components []Component
+	decoder := json.NewDecoder(&stdout)
+	for {
+		var module struct {
+			Path    string
+			Version string
+			Dir     string
+			Main    bool
+			Replace *struct {
+				Version string
+				Dir     string
+			}
+		}
+		err := decoder.Decode(&module)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error while unmarshaling modules: %w", err)
+		}
+		if module.Main {
+			continue
+		}
+
+		version, moduleDir := module.Version, module.Dir
+		if module.Replace != nil {
+			version, moduleDir = module.Replace.Version, module.Replace.Dir
+		}
+		components = append(components, Component{
+			Ecosystem: "golang",
+			Name:      module.Path,
+			Version:   version,
+			License:   DetectLicense(moduleDir),
+		})
+	}
+
+	return components, nil
+}
+
+func npmComponents(dir string) ([]Component, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "package-lock.json"))
+	if err != nil {
+		return nil, fmt.Errorf("error while reading package-lock.json: %w", err)
+	}
+
+	// lockfile versions 2 and 3 have every package under packages, keyed by its path in node_modules
+	var lock struct {
+		Packages map[string]struct {
+			Name    string          `json:"name"`
+			Version string          `json:"version"`
+			License json.RawMessage `json:"license"`
+			Link    bool            `json:"link"`
+		} `json:"packages"`
+	}
+	err = json.Unmarshal(data, &lock)
+	if err != nil {
+		return nil, fmt.Errorf("error while unmarshaling package-lock.json: %w", err)
+	}
+
+	var components []Component
+	for path, pkg := range lock.Packages {
+		i := strings.LastIndex(path, "node_modules/")
+		if path == "" || pkg.Link || i < 0 {
+			continue
+		}
+
+		name := pkg.Name
+		if name == "" {
+			name = path[i+len("node_modules/"):]
+		}
+
+		// license is an SPDX expression, or an object with a type in old packages
+		license := LicenseUnknown
+		var expression string
+		var object struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(pkg.License, &expression) == nil && expression != "" {
+			license = expression
+		} else if json.Unmarshal(pkg.License, &object) == nil && object.Type != "" {
+			license = object.Type
+		}
+
+		components = append(components, Component{Ecosystem: "npm", Name: name, Version: pkg.Version, License: license})
+	}
+
+	return components, nil
+}
+
+var (
+	spdxID          = regexp.MustCompile(`^(MIT|ISC|Zlib|Unlicense|WTFPL|0BSD|[A-Za-z]+-[0-9A-Za-z.+-]+)$`)
+	licenseFile     = regexp.MustCompile(`(?i)^(un)?licen[cs]e|^copying`)
+	licensePatterns = []struct {
+		id      string
+		pattern *regexp.Regexp
+	}{
+		{"AGPL-3.0", regexp.MustCompile(`GNU AFFERO GENERAL PUBLIC LICENSE`)},
+		{"LGPL-3.0", regexp.MustCompile(`GNU LESSER GENERAL PUBLIC LICENSE\s+Version 3`)},
+		{"LGPL-2.1", regexp.MustCompile(`GNU LESSER GENERAL PUBLIC LICENSE\s+Version 2\.1`)},
+		{"GPL-3.0", regexp.MustCompile(`GNU GENERAL PUBLIC LICENSE\s+Version 3`)},
+		{"GPL-2.0", regexp.MustCompile(`GNU GENERAL PUBLIC LICENSE\s+Version 2`)},
+		{"MPL-2.0", regexp.MustCompile(`Mozilla Public License,? [Vv]ersion 2\.0`)},
+		{"Apache-2.0", regexp.MustCompile(`Apache License,?\s+Version 2\.0`)},
+		{"BSD-3-Clause", regexp.MustCompile(`(?s)Redistributions of source code.*Neither the name`)},
+		{"BSD-2-Clause", regexp.MustCompile(`(?s)Redistributions of source code.*Redistributions in binary form`)},
+		{"ISC", regexp.MustCompile(`Permission to use, copy, modify, and(/or)? distribute this software for any`)},
+		{"MIT", regexp.MustCompile(`Permission is hereby granted, free of charge`)},
+		{"Unlicense", regexp.MustCompile(`This is free and unencumbered software released into the public domain`)},
+		{"CC0-1.0", regexp.MustCompile(`CC0 1\.0 Universal`)},
+	}
+)
+
+// DetectLicense recognizes the license of the source code in dir from its LICENSE or COPYING file, and returns
+// its SPDX ID, or LicenseUnknown.
+func DetectLicense(dir string) string {
+	if dir == "" {
+		return LicenseUnknown
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return LicenseUnknown
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !licenseFile.MatchString(entry.Name()) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		for _, p := range licensePatterns {
+			if p.pattern.Match(data) {
+				return p.id
+			}
+		}
+	}
+
+	return LicenseUnknown
+}
+
+// IsCopyleft reports whether the license, or a license of the expression, is a copyleft one.
+func IsCopyleft(license string) bool {
+	for _, id := range strings.FieldsFunc(license, func(r rune) bool { return r == ' ' || r == '(' || r == ')' }) {
+		for _, prefix := range copyleftLicenses {
+			if strings.HasPrefix(strings.ToUpper(id), prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CycloneDX returns the components as a CycloneDX 1.5 SBOM in JSON of the project with the name.
+func CycloneDX(name string, components []Component) ([]byte, error) {
+	type license struct {
+		ID   string `json:"id,omitempty"`
+		Name string `json:"name,omitempty"`
+	}
+	type licenseChoice struct {
+		License    *license `json:"license,omitempty"`
+		Expression string   `json:"expression,omitempty"`
+	}
+	type component struct {
+		Type     string          `json:"type"`
+		BOMRef   string          `json:"bom-ref,omitempty"`
+		Name     string          `json:"name"`
+		Version  string          `json:"version,omitempty"`
+		PURL     string          `json:"purl,omitempty"`
+		Licenses []licenseChoice `json:"licenses,omitempty"`
+	}
+
+	serial := make([]byte, 16)
+	_, _ = rand.Read(serial)
+	serial[6] = serial[6]&0x0f | 0x40 // version 4
+	serial[8] = serial[8]&0x3f | 0x80 // variant 10
+
+	bom := struct {
+		BOMFormat    string `json:"bomFormat"`
+		SpecVersion  string `json:"specVersion"`
+		SerialNumber string `json:"serialNumber"`
+		Version      int    `json:"version"`
+		Metadata     struct {
+			Timestamp string    `json:"timestamp"`
+			Component component `json:"component"`
+		} `json:"metadata"`
+		Components []component `json:"components"`
+	}{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", serial[0:4], serial[4:6], serial[6:8], serial[8:10], serial[10:]),
+		Version:      1,
+		Components:   make([]component, 0, len(components)),
+	}
+	bom.Metadata.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	bom.Metadata.Component = component{Type: "application", Name: name}
+
+	for _, c := range components {
+		cc := component{Type: "library", BOMRef: c.PURL(), Name: c.Name, Version: c.Version, PURL: c.PURL()}
+		switch {
+		case c.License == LicenseUnknown:
+		case strings.ContainsAny(c.License, " ()"):
+			cc.Licenses = []licenseChoice{{Expression: c.License}}
+		case spdxID.MatchString(c.License):
+			cc.Licenses = []licenseChoice{{License: &license{ID: c.License}}}
+		default:
+			// old npm packages have free form licenses, e.g. BSD, which aren't SPDX IDs
+			cc.Licenses = []licenseChoice{{License: &license{Name: c.License}}}
+		}
+		bom.Components = append(bom.Components, cc)
+	}
+
+	data, err := json.MarshalIndent(bom, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error while marshaling sbom: %w", err)
+	}
+	return data, nil
+}
+
+// LicenseSummary counts the components of each license, and lists the ones with a copyleft or unknown
+// license, which usually need a closer look.
+type LicenseSummary struct {
+	Components int            `json:"components"`
+	Licenses   map[string]int `json:"licenses"`
+	Copyleft   []string       `json:"copyleft,omitempty"`
+	Unknown    []string       `json:"unknown,omitempty"`
+	SBOM       string         `json:"sbom,omitempty"`
+}
+
+// SummarizeLicenses returns the license summary of the components.
+func SummarizeLicenses(components []Component) LicenseSummary {
+	summary := LicenseSummary{Components: len(components), Licenses: make(map[string]int)}
+	for _, c := range components {
+		summary.Licenses[c.License]++
+		ref := c.Name + "@" + c.Version
+		if c.License == LicenseUnknown {
+			summary.Unknown = append(summary.Unknown, ref)
+		} else if IsCopyleft(c.License) {
+			summary.Copyleft = append(summary.Copyleft, ref+": "+c.License)
+		}
+	}
+	return summary
+}
+
+func generateSBOM(safeSrc string) ToolContextFunction {
+	return func(ctx context.Context, payload string) (string, error) {
+		var request struct {
+			WorkingDir string `json:"workingDir"`
+		}
+		err := json.Unmarshal([]byte(payload), &request)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while unmarshaling payload", "error", err.Error())
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+		}
+
+		workingDir, err := safeDir(safeSrc, request.WorkingDir)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while getting safe working directory", "error", err.Error())
+			return "", fmt.Errorf("error while getting safe working directory: %w", err)
+		}
+
+		components, err := Components(ctx, workingDir)
+		if err != nil {
+			if len(components) == 0 {
+				LoggerFrom(ctx).Error("error while listing components", "error", err.Error())
+				return "", err
+			}
+			LoggerFrom(ctx).Warn("some components are missing", "error", err.Error())
+		}
+
+		sbom, err := CycloneDX(filepath.Base(workingDir), components)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while generating sbom", "error", err.Error())
+			return "", err
+		}
+
+		summary := SummarizeLicenses(components)
+		summary.SBOM, err = PutBlob(bytes.NewReader(sbom))
+		if err != nil {
+			return "", err
+		}
+
+		data, err := marshalJSON(summary)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while marshaling license summary", "error", err.Error())
+			return "", fmt.Errorf("error while marshaling license summary: %w", err)
+		}
+
+		return string(data), nil
+	}
+}
@@ -0,0 +1,297 @@
+package framework
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"text/template"
+)
+
+// The kinds of projects Scaffold generates.
+const (
+	ScaffoldAssistant = "assistant"
+	ScaffoldExtension = "extension"
+)
+
+const frameworkModule = "github.com/spcoder/jarbles-framework"
+
+type scaffoldData struct {
+	Kind             string
+	Name             string
+	ID               string
+	FrameworkVersion string
+}
+
+type scaffoldFile struct {
+	name     string
+	template *template.Template
+}
+
+var scaffoldGoMod = template.Must(template.New("go.mod").Parse(`module {{.ID}}
+
+go 1.22
+{{if .FrameworkVersion}}
+require ` + frameworkModule + ` {{.FrameworkVersion}}
+{{end}}`))
+
+var scaffoldMakefile = template.Must(template.New("Makefile").Parse(`.PHONY: build test tidy{{if eq .Kind "assistant"}} install{{end}}
+
+build: tidy
+	go build -o bin/{{.ID}} .
+
+test: tidy
+	go test ./...
+
+tidy:
+	go mod tidy
+{{- if eq .Kind "assistant"}}
+
+install: build
+	go run . install
+{{- end}}
+`))
+
+var scaffoldAssistantMain = template.Must(template.New("main.go").Parse(`package main
+
+import (
+	"fmt"
+	"os"
+
+	framework "` + frameworkModule + `"
+)
+
+func newAssistant() framework.Assistant {
+	a := framework.NewAssistant(framework.NewAssistantOptions{
+		StaticID:    {{printf "%q" .ID}},
+		Name:        {{printf "%q" .Name}},
+		Description: "an assistant generated by framework.Scaffold",
+	})
+	a.AddInstructions("Greet the user with the hello tool.")
+	a.AddTool(framework.Tool{
+		Name:        "hello",
+		Description: "greets someone by name",
+		Arguments: []framework.ToolArguments{
+			{
+				Name:        "name",
+				Type:        "string",
+				Description: "the name of the person to greet",
+			},
+		},
+		RequiredArguments: []string{"name"},
+		Function:          hello,
+	})
+	return a
+}
+
+func hello(payload string) (string, error) {
+	name, _ := framework.PayloadGetString(payload, "name", "world")
+	return "Hello, " + name + "!", nil
+}
+
+func main() {
+	a := newAssistant()
+	if len(os.Args) > 1 && os.Args[1] == "install" {
+		err := a.Install(framework.PackageOptions{})
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	a.Respond()
+}
+`))
+
+var scaffoldAssistantTest = template.Must(template.New("main_test.go").Parse(`package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHello(t *testing.T) {
+	a := newAssistant()
+	output := a.Test(a.Payload("hello", ` + "`" + `{"name": "Ada"}` + "`" + `))
+	if !strings.Contains(output, "Hello, Ada!") {
+		t.Errorf("unexpected output: %s", output)
+	}
+}
+`))
+
+var scaffoldExtensionMain = template.Must(template.New("main.go").Parse(`package main
+
+import (
+	framework "` + frameworkModule + `"
+)
+
+func newExtension() *framework.Extension {
+	e := framework.NewExtension(framework.NewExtensionOptions{
+		Name:        {{printf "%q" .Name}},
+		Description: "an extension generated by framework.Scaffold",
+	})
+	e.AddAction(framework.AddActionOptions{
+		ID:       "hello",
+		Function: hello,
+	})
+	e.AddCard(framework.AddCardOptions{
+		ID:          "hello",
+		ActionID:    "hello",
+		Title:       "Hello",
+		Description: "says hello",
+	})
+	return &e
+}
+
+func hello(_ string) (*framework.ExtensionResponse, error) {
+	return &framework.ExtensionResponse{
+		HTMLTitle: "Hello",
+		HTMLBody:  {{printf "%q" (printf "<p>Hello from %s!</p>" .Name)}},
+	}, nil
+}
+
+func main() {
+	newExtension().Respond()
+}
+`))
+
+var scaffoldExtensionTest = template.Must(template.New("main_test.go").Parse(`package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHello(t *testing.T) {
+	e := newExtension()
+	output := e.Test(e.Payload("hello", ""))
+	if !strings.Contains(output, "Hello from") {
+		t.Errorf("unexpected output: %s", output)
+	}
+}
+`))
+
+// Scaffold generates a ready to build assistant or extension project named name in dir: main.go with an
+// example tool or action, a test, go.mod, and a Makefile. Files that already exist in dir aren't overwritten,
+// Scaffold fails instead. It returns the names of the generated files.
+func Scaffold(kind, name, dir string) ([]string, error) {
+	data := scaffoldData{Kind: kind, Name: name, ID: slugify(name), FrameworkVersion: frameworkVersion()}
+	if data.ID == "" {
+		return nil, fmt.Errorf("error while scaffolding: %q isn't a valid name", name)
+	}
+
+	files := []scaffoldFile{
+		{"go.mod", scaffoldGoMod},
+		{"Makefile", scaffoldMakefile},
+	}
+	switch kind {
+	case ScaffoldAssistant:
+		files = append(files, scaffoldFile{"main.go", scaffoldAssistantMain}, scaffoldFile{"main_test.go", scaffoldAssistantTest})
+	case ScaffoldExtension:
+		files = append(files, scaffoldFile{"main.go", scaffoldExtensionMain}, scaffoldFile{"main_test.go", scaffoldExtensionTest})
+	default:
+		return nil, fmt.Errorf("error while scaffolding: unknown kind %q, must be %s or %s", kind, ScaffoldAssistant, ScaffoldExtension)
+	}
+
+	// everything is rendered and checked before the first file is written
+	contents := make(map[string][]byte)
+	var names []string
+	for _, f := range files {
+		if _, err := os.Stat(filepath.Join(dir, f.name)); err == nil {
+			return nil, fmt.Errorf("error while scaffolding: %s already exists", filepath.Join(dir, f.name))
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("error while scaffolding: %w", err)
+		}
+
+		var buf bytes.Buffer
+		err := f.template.Execute(&buf, data)
+		if err != nil {
+			return nil, fmt.Errorf("error while rendering %s: %w", f.name, err)
+		}
+		content := buf.Bytes()
+		if strings.HasSuffix(f.name, ".go") {
+			content, err = format.Source(content)
+			if err != nil {
+				return nil, fmt.Errorf("error while formatting %s: %w", f.name, err)
+			}
+		}
+		contents[f.name] = content
+		names = append(names, f.name)
+	}
+
+	err := os.MkdirAll(dir, workspaceDirPerm)
+	if err != nil {
+		return nil, fmt.Errorf("error while creating project directory: %s: %w", dir, err)
+	}
+	for _, name := range names {
+		err = os.WriteFile(filepath.Join(dir, name), contents[name], workspaceFilePerm)
+		if err != nil {
+			return nil, fmt.Errorf("error while writing %s: %w", name, err)
+		}
+	}
+
+	return names, nil
+}
+
+// frameworkVersion returns the version of the framework the running binary was built with, or an empty string
+// when it isn't a released version, and go mod tidy has to find one.
+func frameworkVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	version := ""
+	if info.Main.Path == frameworkModule {
+		version = info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == frameworkModule {
+			version = dep.Version
+			if dep.Replace != nil {
+				// a local replacement has no version to require
+				version = dep.Replace.Version
+			}
+		}
+	}
+	if !strings.HasPrefix(version, "v") {
+		return ""
+	}
+
+	return version
+}
+
+func scaffoldProject(root string) ToolContextFunction {
+	return func(ctx context.Context, payload string) (string, error) {
+		var request struct {
+			Kind string `json:"kind"`
+			Name string `json:"name"`
+			Dir  string `json:"dir"`
+		}
+		err := json.Unmarshal([]byte(payload), &request)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while unmarshaling payload", "error", err.Error())
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+		}
+
+		dir, err := safeDir(root, request.Dir)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while getting safe directory", "error", err.Error())
+			return "", fmt.Errorf("error while getting safe directory: %w", err)
+		}
+
+		names, err := Scaffold(request.Kind, request.Name, dir)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while scaffolding project", "kind", request.Kind, "error", err.Error())
+			return "", err
+		}
+
+		return fmt.Sprintf("generated %s in %s, run make build to build it", strings.Join(names, ", "), request.Dir), nil
+	}
+}
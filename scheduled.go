@@ -0,0 +1,271 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ScheduledEntry is a one-shot run of a scheduled handler at a point in time.
+type ScheduledEntry struct {
+	ID      string    `json:"id"`
+	Handler string    `json:"handler"`
+	At      time.Time `json:"at"`
+	// TimeZone is the IANA time zone that At was given in. It's empty when the local zone has no known name.
+	TimeZone string `json:"time_zone,omitempty"`
+	Payload  string `json:"payload,omitempty"`
+}
+
+type scheduledResult struct {
+	ID       string             `json:"id"`
+	Handler  string             `json:"handler"`
+	Response *ExtensionResponse `json:"response,omitempty"`
+	Error    string             `json:"error,omitempty"`
+}
+
+type jarblesExtensionScheduled struct {
+	Id       string `json:"id"`
+	Handler  string `json:"handler"`
+	At       string `json:"at"`
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+type AddScheduledOptions struct {
+	ID       string
+	Function ExtensionFunction
+}
+
+// AddScheduled adds a handler that runs once for every entry scheduled for it with Schedule, e.g. from an action
+// that handles "remind me at 3pm on Friday". Pending entries are listed in describe, and the host runs the entries
+// that are due with the __scheduled operation.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (e *Extension) AddScheduled(options AddScheduledOptions) {
+	if e.scheduled == nil {
+		e.scheduled = make(map[string]ExtensionFunction)
+	}
+	e.scheduled[slugify(options.ID)] = options.Function
+}
+
+type ScheduleOptions struct {
+	// Handler is the ID of a handler added with AddScheduled.
+	Handler string
+	// At is the instant the entry runs, e.g. time.Now().Add(time.Hour).
+	At time.Time
+	// LocalTime is a date and time without a zone that is used instead of At, e.g. "2024-05-03 15:00" for
+	// "3pm on Friday". It's in TimeZone, or in the default time zone when TimeZone is empty.
+	LocalTime string
+	// TimeZone is the IANA time zone of LocalTime and the one the entry is shown in.
+	TimeZone string
+	Payload  string
+}
+
+// Schedule persists an entry that runs the handler with the payload at the time, and returns the ID of the entry.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (e *Extension) Schedule(options ScheduleOptions) (string, error) {
+	handler := slugify(options.Handler)
+	if _, ok := e.scheduled[handler]; !ok {
+		return "", fmt.Errorf("unknown scheduled handler: %s", options.Handler)
+	}
+
+	location, err := loadTimeZone(options.TimeZone)
+	if err != nil {
+		return "", err
+	}
+	at := options.At.In(location)
+	if options.LocalTime != "" {
+		at, err = inTimeZone(options.LocalTime, location)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	entry := ScheduledEntry{
+		ID:       randomID(),
+		Handler:  handler,
+		At:       at,
+		TimeZone: zoneName(at.Location()),
+		Payload:  options.Payload,
+	}
+
+	err = e.updateScheduled(func(entries []ScheduledEntry) ([]ScheduledEntry, error) {
+		return append(entries, entry), nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return entry.ID, nil
+}
+
+// Unschedule removes a pending entry. Removing an entry that doesn't exist isn't an error.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (e *Extension) Unschedule(id string) error {
+	return e.updateScheduled(func(entries []ScheduledEntry) ([]ScheduledEntry, error) {
+		kept := entries[:0]
+		for _, entry := range entries {
+			if entry.ID != id {
+				kept = append(kept, entry)
+			}
+		}
+		return kept, nil
+	})
+}
+
+// Scheduled returns the pending entries, the earliest first.
+func (e *Extension) Scheduled() ([]ScheduledEntry, error) {
+	entries, err := e.loadScheduled()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].At.Before(entries[j].At)
+	})
+	return entries, nil
+}
+
+// runScheduled runs the entries that are due and returns their responses. Entries are removed before they run,
+// so an entry runs at most once even when its handler fails.
+func (e *Extension) runScheduled(ctx context.Context) (string, error) {
+	now := time.Now()
+	var due []ScheduledEntry
+	err := e.updateScheduled(func(entries []ScheduledEntry) ([]ScheduledEntry, error) {
+		var pending []ScheduledEntry
+		for _, entry := range entries {
+			if entry.At.After(now) {
+				pending = append(pending, entry)
+			} else {
+				due = append(due, entry)
+			}
+		}
+		return pending, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].At.Before(due[j].At)
+	})
+
+	results := make([]scheduledResult, 0, len(due))
+	for _, entry := range due {
+		result := scheduledResult{ID: entry.ID, Handler: entry.Handler}
+
+		function, ok := e.scheduled[entry.Handler]
+		if !ok {
+			result.Error = fmt.Sprintf("unknown scheduled handler: %s", entry.Handler)
+		} else {
+			LoggerFrom(ctx).Info("running scheduled entry", "id", entry.ID, "handler", entry.Handler)
+			result.Response, err = function(entry.Payload)
+			if err != nil {
+				LoggerFrom(ctx).Error("error while running scheduled entry", "id", entry.ID, "error", err.Error())
+				result.Error = err.Error()
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	data, err := marshalJSON(results)
+	if err != nil {
+		return "", fmt.Errorf("error while marshaling scheduled results: %w", err)
+	}
+	return string(data), nil
+}
+
+// describeScheduled lists the pending entries for describe. The entries are only informational there,
+// so an error is logged rather than failing describe.
+func (e *Extension) describeScheduled() []jarblesExtensionScheduled {
+	described := make([]jarblesExtensionScheduled, 0)
+	if len(e.scheduled) == 0 {
+		return described
+	}
+
+	entries, err := e.Scheduled()
+	if err != nil {
+		LogError("error while listing scheduled entries", "error", err.Error())
+		return described
+	}
+
+	for _, entry := range entries {
+		at, timeZone := entry.At, describeTimeZone(entry.TimeZone)
+		if timeZone != "" {
+			location, _ := time.LoadLocation(timeZone)
+			at = at.In(location)
+		}
+
+		described = append(described, jarblesExtensionScheduled{
+			Id:       entry.ID,
+			Handler:  entry.Handler,
+			At:       at.Format(time.RFC3339),
+			TimeZone: timeZone,
+		})
+	}
+	return described
+}
+
+func (e *Extension) scheduledKey() string {
+	return storageKey("data", e.ID, "scheduled.json")
+}
+
+func (e *Extension) loadScheduled() ([]ScheduledEntry, error) {
+	data, err := CurrentStorage().Read(e.scheduledKey())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while reading scheduled entries: %w", err)
+	}
+
+	var entries []ScheduledEntry
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("error while unmarshaling scheduled entries: %w", err)
+	}
+	return entries, nil
+}
+
+// updateScheduled loads the entries, passes them to update, and saves what update returns, under a lock shared
+// by all processes, so that an entry scheduled while the host runs the due ones isn't lost.
+func (e *Extension) updateScheduled(update func(entries []ScheduledEntry) ([]ScheduledEntry, error)) error {
+	e.scheduledMu.Lock()
+	defer e.scheduledMu.Unlock()
+
+	unlock, err := lockFile(filepath.Join(profileStateDir("locks"), e.ID+"-scheduled.lock"), 10*time.Second, time.Minute)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, err := e.loadScheduled()
+	if err != nil {
+		return err
+	}
+
+	entries, err = update(entries)
+	if err != nil {
+		return err
+	}
+	if entries == nil {
+		entries = []ScheduledEntry{}
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error while marshaling scheduled entries: %w", err)
+	}
+
+	err = CurrentStorage().Write(e.scheduledKey(), data)
+	if err != nil {
+		return fmt.Errorf("error while writing scheduled entries: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package framework
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	starlarkjson "go.starlark.net/lib/json"
+	starlarkmath "go.starlark.net/lib/math"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// scriptFileOptions allows the dialect features scripts commonly need. Runaway loops are bounded by scriptMaxSteps.
+var scriptFileOptions = &syntax.FileOptions{
+	Set:             true,
+	While:           true,
+	TopLevelControl: true,
+	GlobalReassign:  true,
+}
+
+const (
+	scriptMaxSteps = 10_000_000
+	scriptTimeout  = 10 * time.Second
+)
+
+// runStarlark executes a starlark script with a restricted set of predeclared names: the json and math
+// modules, and the payload string. Loading other files is not allowed. The output is anything the script
+// printed followed by the value of its result global, if it defines one. Non-string results are encoded as JSON.
+func runStarlark(ctx context.Context, filename string, src []byte, payload string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, scriptTimeout)
+	defer cancel()
+
+	var output strings.Builder
+	thread := &starlark.Thread{
+		Name: filename,
+		Print: func(_ *starlark.Thread, msg string) {
+			output.WriteString(msg)
+			output.WriteString("\n")
+		},
+		Load: func(_ *starlark.Thread, module string) (starlark.StringDict, error) {
+			return nil, fmt.Errorf("loading modules is not allowed: %s", module)
+		},
+	}
+	thread.SetMaxExecutionSteps(scriptMaxSteps)
+
+	go func() {
+		<-ctx.Done()
+		thread.Cancel("script timed out")
+	}()
+
+	predeclared := starlark.StringDict{
+		"json":    starlarkjson.Module,
+		"math":    starlarkmath.Module,
+		"payload": starlark.String(payload),
+	}
+
+	globals, err := starlark.ExecFileOptions(scriptFileOptions, thread, filename, src, predeclared)
+	if err != nil {
+		LoggerFrom(ctx).Error("error while running script", "filename", filename, "error", err.Error())
+		return "", fmt.Errorf("error while running script %s: %w", filename, err)
+	}
+
+	result, ok := globals["result"]
+	if !ok {
+		return output.String(), nil
+	}
+
+	s, ok := starlark.AsString(result)
+	if !ok {
+		encoded, err := starlark.Call(thread, starlarkjson.Module.Members["encode"], starlark.Tuple{result}, nil)
+		if err != nil {
+			return "", fmt.Errorf("error while encoding script result: %w", err)
+		}
+		s, _ = starlark.AsString(encoded)
+	}
+	output.WriteString(s)
+
+	return output.String(), nil
+}
+
+func runScript(safeDir string) ToolContextFunction {
+	return func(ctx context.Context, payload string) (string, error) {
+		var request struct {
+			Name  string `json:"name"`
+			Input string `json:"input"`
+		}
+		err := json.Unmarshal([]byte(payload), &request)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while unmarshaling payload", "error", err.Error())
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+		}
+
+		LoggerFrom(ctx).Debug("run-script", "name", request.Name)
+
+		filename, err := safePath(safeDir, "", request.Name)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while getting safe path", "error", err.Error())
+			return "", fmt.Errorf("error while getting safe path: %w", err)
+		}
+
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while reading script", "filename", filename, "error", err.Error())
+			return "", fmt.Errorf("error while reading script at %s: %s", filename, err)
+		}
+
+		return runStarlark(ctx, filename, src, request.Input)
+	}
+}
+
+func scriptHandlerFunction(handlers []scriptHandler, name string, shellAllowlist []string) (ToolContextFunction, error) {
+	for _, handler := range handlers {
+		if handler.Name != name {
+			continue
+		}
+
+		switch handler.Type {
+		case "starlark":
+			src := []byte(handler.Source)
+			return func(ctx context.Context, payload string) (string, error) {
+				return runStarlark(ctx, handler.Name, src, payload)
+			}, nil
+		case "shell":
+			if len(handler.Command) == 0 {
+				return nil, fmt.Errorf("shell handler %s has no command", handler.Name)
+			}
+			path, err := allowedCommand(shellAllowlist, handler.Command[0])
+			if err != nil {
+				return nil, fmt.Errorf("shell handler %s: %w", handler.Name, err)
+			}
+			// the command is run by the path it resolved to now, not looked up again
+			command := append([]string{path}, handler.Command[1:]...)
+			return func(ctx context.Context, payload string) (string, error) {
+				return runShellHandler(withEnvPolicy(ctx, handler.Env), command, payload)
+			}, nil
+		default:
+			return nil, fmt.Errorf("unknown handler type: %s", handler.Type)
+		}
+	}
+
+	return nil, fmt.Errorf("unknown handler: %s", name)
+}
+
+// allowedCommand resolves the command of a shell handler and returns its path when the allowlist has it. A
+// command with a path separator must be listed as it is, so an allowed "git" doesn't allow /tmp/evil/git, and
+// a name must resolve to the same path as an entry of the allowlist.
+func allowedCommand(allowlist []string, command string) (string, error) {
+	if strings.ContainsAny(command, `/\`) && !slices.Contains(allowlist, command) {
+		return "", fmt.Errorf("%s is not in the allowlist", command)
+	}
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return "", fmt.Errorf("error while looking up %s: %w", command, err)
+	}
+
+	for _, entry := range allowlist {
+		// a name only allows itself, an absolute path any name that resolves to it
+		if entry != command && !filepath.IsAbs(entry) {
+			continue
+		}
+		allowed, err := exec.LookPath(entry)
+		if err == nil && allowed == path {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s resolves to %s which is not in the allowlist", command, path)
+}
+
+// runShellHandler runs the command without a shell, passing the payload on standard input.
+func runShellHandler(ctx context.Context, command []string, payload string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := Command(ctx, command[0], command[1:]...)
+	cmd.Stdin = strings.NewReader(payload)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	LoggerFrom(ctx).Info("running command", "command", cmd)
+	err := cmd.Run()
+	if err != nil {
+		LoggerFrom(ctx).Error("error while running shell handler", "command", cmd, "stderr", stderr.String(), "error", err.Error())
+		if stderr.Len() > 0 {
+			return "", fmt.Errorf("%s", stderr.String())
+		}
+		return "", fmt.Errorf("error while running %s: %w", command[0], err)
+	}
+
+	return stdout.String(), nil
+}
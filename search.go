@@ -0,0 +1,219 @@
+package framework
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// SearchMaxMatches is the default limit of the matches of SearchFiles, so a common query can't flood the model.
+var SearchMaxMatches = 100
+
+// SearchMaxFileSize is the largest file SearchFiles reads, larger ones are skipped.
+var SearchMaxFileSize int64 = 1 << 20
+
+// searchSnippetWidth caps the text of a match, long lines are cut around the match.
+const searchSnippetWidth = 200
+
+type SearchOptions struct {
+	// Regexp treats the query as a regular expression, see regexp/syntax, rather than as literal text.
+	Regexp bool
+	// IgnoreCase matches regardless of case.
+	IgnoreCase bool
+	// Glob only searches the files that match it, see MatchGlob.
+	Glob string
+	// Ignore skips the files and directories it matches, see LoadIgnore.
+	Ignore *Ignore
+	// MaxMatches stops the search after that many matches. Defaults to SearchMaxMatches.
+	MaxMatches int
+}
+
+// SearchMatch is a line that matches the query. Path is relative to the root with forward slashes, and Line and
+// Column start at 1.
+type SearchMatch struct {
+	Path   string `json:"path"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Text   string `json:"text"`
+}
+
+// SearchResults are the matches of SearchFiles in the order of the paths, and the number of files with matches.
+// Truncated is true when the search stopped at MaxMatches or the walk at WalkMaxEntries.
+type SearchResults struct {
+	Matches   []SearchMatch `json:"matches"`
+	Files     int           `json:"files"`
+	Truncated bool          `json:"truncated,omitempty"`
+}
+
+// SearchFiles searches the text files below root for the query, like grep. Binary files and files larger than
+// SearchMaxFileSize are skipped.
+func SearchFiles(ctx context.Context, root, query string, options SearchOptions) (SearchResults, error) {
+	if query == "" {
+		return SearchResults{}, ModelError("the query is empty", "pass the text to search for in query")
+	}
+	pattern := query
+	if !options.Regexp {
+		pattern = regexp.QuoteMeta(query)
+	}
+	if options.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return SearchResults{}, withHint(fmt.Errorf("error while parsing query %s: %w", query, err), "escape the special characters of the regular expression, or set regexp to false")
+	}
+	if options.MaxMatches <= 0 {
+		options.MaxMatches = SearchMaxMatches
+	}
+
+	entries, truncated, err := Walk(ctx, root, WalkOptions{MaxEntries: WalkMaxEntries, Ignore: options.Ignore, Glob: options.Glob})
+	if err != nil {
+		return SearchResults{}, err
+	}
+
+	results := SearchResults{Matches: []SearchMatch{}, Truncated: truncated}
+	for _, entry := range entries {
+		if entry.Type != FileTypeFile || entry.Size > SearchMaxFileSize {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return SearchResults{}, err
+		}
+
+		matches, err := searchFile(filepath.Join(root, filepath.FromSlash(entry.Path)), re, options.MaxMatches-len(results.Matches))
+		if err != nil {
+			LoggerFrom(ctx).Warn("skipping unreadable file in search", "path", entry.Path, "error", err.Error())
+			continue
+		}
+		if len(matches) == 0 {
+			continue
+		}
+
+		results.Files++
+		for _, m := range matches {
+			m.Path = entry.Path
+			results.Matches = append(results.Matches, m)
+		}
+		if len(results.Matches) >= options.MaxMatches {
+			results.Truncated = true
+			break
+		}
+	}
+
+	return results, nil
+}
+
+// searchFile returns up to limit matching lines of the file, none when it is binary.
+func searchFile(filename string, re *regexp.Regexp, limit int) ([]SearchMatch, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return nil, nil
+	}
+
+	var matches []SearchMatch
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for n := 1; scanner.Scan() && len(matches) < limit; n++ {
+		line := scanner.Text()
+		loc := re.FindStringIndex(line)
+		if loc == nil {
+			continue
+		}
+		matches = append(matches, SearchMatch{
+			Line:   n,
+			Column: utf8.RuneCountInString(line[:loc[0]]) + 1,
+			Text:   searchSnippet(line, loc[0], loc[1]),
+		})
+	}
+
+	return matches, scanner.Err()
+}
+
+// searchSnippet returns the line without its indentation, cut around the match when it is long.
+func searchSnippet(line string, start, end int) string {
+	trimmed := strings.TrimLeft(line, " \t")
+	offset := len(line) - len(trimmed)
+	start, end = start-offset, end-offset
+	line = strings.TrimRight(trimmed, " \t\r")
+	if len(line) <= searchSnippetWidth {
+		return line
+	}
+
+	from := max(0, start-(searchSnippetWidth-(end-start))/2)
+	to := min(len(line), from+searchSnippetWidth)
+	from = max(0, to-searchSnippetWidth)
+	// cut at rune boundaries
+	for from > 0 && !utf8.RuneStart(line[from]) {
+		from--
+	}
+	for to < len(line) && !utf8.RuneStart(line[to]) {
+		to++
+	}
+
+	snippet := line[from:to]
+	if from > 0 {
+		snippet = "…" + snippet
+	}
+	if to < len(line) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+func searchFiles(root string) ToolContextFunction {
+	return func(ctx context.Context, payload string) (string, error) {
+		var request struct {
+			Dir        string `json:"dir"`
+			Query      string `json:"query"`
+			Regexp     bool   `json:"regexp"`
+			IgnoreCase bool   `json:"ignoreCase"`
+			Glob       string `json:"glob"`
+		}
+		err := json.Unmarshal([]byte(payload), &request)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while unmarshaling payload", "error", err.Error())
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+		}
+
+		dir, err := safeDir(root, request.Dir)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while getting safe directory", "error", err.Error())
+			return "", fmt.Errorf("error while getting safe directory: %w", err)
+		}
+
+		ignore, err := loadIgnoreFor(root, dir)
+		if err != nil {
+			return "", err
+		}
+		results, err := SearchFiles(ctx, dir, request.Query, SearchOptions{
+			Regexp:     request.Regexp,
+			IgnoreCase: request.IgnoreCase,
+			Glob:       request.Glob,
+			Ignore:     ignore,
+		})
+		if err != nil {
+			LoggerFrom(ctx).Error("error while searching files", "query", request.Query, "error", err.Error())
+			return "", err
+		}
+		if len(results.Matches) == 0 {
+			return "no matches found", nil
+		}
+
+		data, err := marshalJSON(results)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while marshaling search results", "error", err.Error())
+			return "", fmt.Errorf("error while marshaling search results: %w", err)
+		}
+		return string(data), nil
+	}
+}
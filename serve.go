@@ -0,0 +1,122 @@
+package framework
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type ServeOptions struct {
+	// Addr is the address to listen on. Defaults to 127.0.0.1:7331.
+	Addr string
+	// CardInterval is how often live cards are regenerated for their events. Defaults to 1 second.
+	CardInterval time.Duration
+}
+
+// Serve runs the extension as an HTTP daemon until ctx is done, for hosts that keep the extension running
+// instead of starting it for every request:
+//
+//   - POST /requests runs a request in the jarbles protocol from the body and responds with its output.
+//   - GET /cards/{id}/events streams the HTML of a card as server-sent events, every time it changes. Cards
+//     without a Render function send their HTML once.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (e *Extension) Serve(ctx context.Context, options ServeOptions) error {
+	if options.Addr == "" {
+		options.Addr = "127.0.0.1:7331"
+	}
+	if options.CardInterval == 0 {
+		options.CardInterval = time.Second
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /requests", func(w http.ResponseWriter, r *http.Request) {
+		body := http.MaxBytesReader(w, r.Body, MaxRequestSize)
+
+		// requests share the logger and the cached description of the extension, so they run one at a time
+		e.serveMu.Lock()
+		output := e.execute(body)
+		e.serveMu.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = io.WriteString(w, output)
+	})
+	mux.HandleFunc("GET /cards/{id}/events", func(w http.ResponseWriter, r *http.Request) {
+		e.cardEvents(w, r, options.CardInterval)
+	})
+
+	server := &http.Server{Addr: options.Addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	LoggerFrom(ctx).Info("serving", "addr", options.Addr)
+	err := server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("error while serving: %w", err)
+	}
+	return nil
+}
+
+// cardEvents streams the HTML of a card until the client goes away.
+func (e *Extension) cardEvents(w http.ResponseWriter, r *http.Request, interval time.Duration) {
+	var card *ExtensionCard
+	for i := range e.Cards {
+		if e.Cards[i].ID == r.PathValue("id") {
+			card = &e.Cards[i]
+			break
+		}
+	}
+	if card == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last, idle := "", 0
+	for {
+		e.serveMu.Lock()
+		html := card.html()
+		e.serveMu.Unlock()
+
+		switch {
+		case html != last:
+			_, _ = fmt.Fprintf(w, "event: card\ndata: %s\n\n", strings.ReplaceAll(html, "\n", "\ndata: "))
+			last, idle = html, 0
+		case time.Duration(idle)*interval >= 15*time.Second:
+			// a comment keeps proxies from closing an idle stream
+			_, _ = io.WriteString(w, ": keep-alive\n\n")
+			idle = 0
+		default:
+			idle++
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
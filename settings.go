@@ -0,0 +1,190 @@
+package framework
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Types of settings, which decide how the host renders them and how their values are validated.
+const (
+	SettingTypeString   string = "string"
+	SettingTypeInt      string = "int"
+	SettingTypeFloat    string = "float"
+	SettingTypeBool     string = "bool"
+	SettingTypeDuration string = "duration" // e.g. 1h30m or 7d, see ConfigGetDuration
+	SettingTypeTime     string = "time"     // e.g. 2024-05-01T09:00:00Z or 09:00, see ConfigGetTime
+)
+
+// Setting declares a config key, so that the host can render a settings form for it and ConfigGet and
+// ConfigSet can check its values. Secret settings, e.g. API keys, are rendered as password inputs and their
+// values are never sent back to the host. Options restricts the values to a list, e.g. for a select.
+type Setting struct {
+	Key         string   `json:"key" toml:"key"`
+	Type        string   `json:"type" toml:"type"`
+	Default     string   `json:"default,omitempty" toml:"default,omitempty"`
+	Secret      bool     `json:"secret,omitempty" toml:"secret,omitempty"`
+	Description string   `json:"description,omitempty" toml:"description,omitempty"`
+	Options     []string `json:"options,omitempty" toml:"options,omitempty"`
+}
+
+var (
+	settingsMu  sync.RWMutex
+	settingDefs = make(map[string]Setting)
+)
+
+// Validate returns an error when the value doesn't fit the type or the options of the setting.
+func (s Setting) Validate(value string) error {
+	var err error
+	switch s.Type {
+	case SettingTypeString, "":
+		// any value
+	case SettingTypeInt:
+		_, err = parseConfigInt(value)
+	case SettingTypeFloat:
+		_, err = strconv.ParseFloat(value, 64)
+	case SettingTypeBool:
+		_, err = strconv.ParseBool(value)
+	case SettingTypeDuration:
+		_, err = parseConfigDuration(value)
+	case SettingTypeTime:
+		_, err = parseConfigTime(value, time.UTC, time.Now())
+	default:
+		return fmt.Errorf("setting %s has an unknown type: %s", s.Key, s.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("%q isn't a valid %s for setting %s", value, s.Type, s.Key)
+	}
+
+	if len(s.Options) > 0 && !slices.Contains(s.Options, value) {
+		return fmt.Errorf("%q isn't one of the options of setting %s", value, s.Key)
+	}
+
+	return nil
+}
+
+// declareSetting registers the setting for ConfigGet, ConfigSet, and the __settings operation. The type
+// defaults to SettingTypeString.
+func declareSetting(s Setting) Setting {
+	if s.Type == "" {
+		s.Type = SettingTypeString
+	}
+	if s.Default != "" {
+		if err := s.Validate(s.Default); err != nil {
+			LogError("invalid default of setting", "key", s.Key, "error", err.Error())
+		}
+	}
+
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	settingDefs[s.Key] = s
+	return s
+}
+
+func lookupSetting(key string) (Setting, bool) {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+
+	s, ok := settingDefs[key]
+	return s, ok
+}
+
+func declaredSettings() []Setting {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+
+	settings := make([]Setting, 0, len(settingDefs))
+	for _, s := range settingDefs {
+		settings = append(settings, s)
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Key < settings[j].Key })
+	return settings
+}
+
+// AddSetting declares a config key of the assistant, which describe lists for the host to render.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (a *Assistant) AddSetting(setting Setting) {
+	a.description.Settings = append(a.description.Settings, declareSetting(setting))
+	a.described = nil
+}
+
+// AddSetting declares a config key of the extension, which describe lists for the host to render.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (e *Extension) AddSetting(setting Setting) {
+	e.settings = append(e.settings, declareSetting(setting))
+}
+
+type settingState struct {
+	Setting
+	Value string `json:"value,omitempty"`
+	// IsSet is true when the value was saved rather than the default, which is how the host knows that a
+	// secret is set without its value.
+	IsSet bool `json:"is_set"`
+}
+
+// settingsOperation lists the declared settings with their values, or saves the values of the payload first.
+// The values are all validated before any is saved.
+func settingsOperation(payload string) (string, error) {
+	var request struct {
+		Values map[string]string `json:"values"`
+	}
+	if payload != "" {
+		err := json.Unmarshal([]byte(payload), &request)
+		if err != nil {
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+		}
+	}
+
+	for key, value := range request.Values {
+		s, ok := lookupSetting(key)
+		if !ok {
+			return "", fmt.Errorf("error while saving settings: %s isn't a setting", key)
+		}
+		err := s.Validate(value)
+		if err != nil {
+			return "", fmt.Errorf("error while saving settings: %w", err)
+		}
+	}
+
+	var config map[string]string
+	var err error
+	if len(request.Values) > 0 {
+		LogInfo("saving settings", "count", len(request.Values))
+		err = configUpdate(func(c map[string]string) error {
+			for key, value := range request.Values {
+				c[key] = value
+			}
+			config = c
+			return nil
+		})
+	} else {
+		config, err = configLoad()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	settings := declaredSettings()
+	states := make([]settingState, 0, len(settings))
+	for _, s := range settings {
+		value, ok := config[s.Key]
+		state := settingState{Setting: s, IsSet: ok}
+		if ok && !s.Secret {
+			state.Value = value
+		}
+		states = append(states, state)
+	}
+
+	data, err := json.Marshal(states)
+	if err != nil {
+		return "", fmt.Errorf("error while marshaling settings: %w", err)
+	}
+	return string(data), nil
+}
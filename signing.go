@@ -0,0 +1,123 @@
+package framework
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func KeysDir() string {
+	return profileDir("keys")
+}
+
+// DescriptionSignature binds a description to the sha256 of the binary it was approved with.
+type DescriptionSignature struct {
+	PublicKey    string `json:"public_key"`
+	BinarySHA256 string `json:"binary_sha256"`
+	Signature    string `json:"signature"`
+}
+
+// SigningKey loads the ed25519 key pair from KeysDir(), creating it on first use. It signs releases on the
+// machine of their author, see SignRelease.
+func SigningKey() (ed25519.PrivateKey, error) {
+	filename := filepath.Join(KeysDir(), "signing.key")
+
+	seed, err := os.ReadFile(filename)
+	if err == nil {
+		if len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("signing key has an invalid size: %s", filename)
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error while reading signing key: %s: %w", filename, err)
+	}
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error while generating signing key: %w", err)
+	}
+
+	err = os.MkdirAll(KeysDir(), privateDirPerm)
+	if err != nil {
+		return nil, fmt.Errorf("error while creating keys directory: %s: %w", KeysDir(), err)
+	}
+
+	err = os.WriteFile(filename, private.Seed(), privateFilePerm)
+	if err != nil {
+		return nil, fmt.Errorf("error while writing signing key: %s: %w", filename, err)
+	}
+
+	publicFilename := filepath.Join(KeysDir(), "signing.pub")
+	err = os.WriteFile(publicFilename, []byte(base64.StdEncoding.EncodeToString(public)), workspaceFilePerm)
+	if err != nil {
+		return nil, fmt.Errorf("error while writing public key: %s: %w", publicFilename, err)
+	}
+
+	return private, nil
+}
+
+// SignDescription signs the description together with the sha256 of the installed binary. Hosts call it
+// when the user approves an assistant or extension at install, with a key that the binaries can't read, e.g.
+// one kept in the keychain of the OS, so a binary can't sign a description of its own.
+//
+//goland:noinspection GoUnusedExportedFunction
+func SignDescription(binary string, description []byte, key ed25519.PrivateKey) (DescriptionSignature, error) {
+	sum, err := fileSHA256(binary)
+	if err != nil {
+		return DescriptionSignature{}, fmt.Errorf("error while hashing binary at %s: %w", binary, err)
+	}
+
+	return DescriptionSignature{
+		PublicKey:    base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		BinarySHA256: sum,
+		Signature:    base64.StdEncoding.EncodeToString(ed25519.Sign(key, signedDescription(sum, description))),
+	}, nil
+}
+
+// VerifyDescription hashes the installed binary again and reports whether it and the description are the ones
+// signed with publicKey, so a binary that was replaced fails even when it describes itself the same way.
+// Hosts pass the base64 public key of the key they signed with.
+//
+//goland:noinspection GoUnusedExportedFunction
+func VerifyDescription(binary string, description []byte, signature DescriptionSignature, publicKey string) error {
+	if signature.PublicKey != publicKey {
+		return fmt.Errorf("description was signed with an unexpected key")
+	}
+
+	public, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(public) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid public key")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+
+	sum, err := fileSHA256(binary)
+	if err != nil {
+		return fmt.Errorf("error while hashing binary at %s: %w", binary, err)
+	}
+	if sum != signature.BinarySHA256 {
+		return fmt.Errorf("binary at %s changed since the description was signed", binary)
+	}
+
+	if !ed25519.Verify(public, signedDescription(sum, description), sig) {
+		return fmt.Errorf("signature does not match the description")
+	}
+
+	return nil
+}
+
+// signedDescription returns the message that is signed: the hash of the binary and of the description.
+func signedDescription(binarySHA256 string, description []byte) []byte {
+	sum := sha256.Sum256(description)
+	return []byte("jarbles-description-v1\n" + binarySHA256 + "\n" + hex.EncodeToString(sum[:]) + "\n")
+}
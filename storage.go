@@ -0,0 +1,369 @@
+package framework
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Storage persists the documents the framework keeps for assistants, such as config, state, and logs.
+// Keys are slash separated paths relative to the jarbles home directory. Read returns an error
+// matching os.ErrNotExist when the key doesn't exist.
+type Storage interface {
+	Read(key string) ([]byte, error)
+	Write(key string, data []byte) error
+	Delete(key string) error
+	List(prefix string) ([]string, error)
+}
+
+// Appender is implemented by storages that can add to the end of a document without rewriting it.
+type Appender interface {
+	Append(key string, data []byte) error
+}
+
+var (
+	storageMu      sync.RWMutex
+	currentStorage Storage = FileStorage{}
+)
+
+// CurrentStorage returns the storage used by the framework. It defaults to FileStorage.
+func CurrentStorage() Storage {
+	storageMu.RLock()
+	defer storageMu.RUnlock()
+
+	return currentStorage
+}
+
+// SetStorage replaces the storage used by the framework, e.g. with a WebDAVStorage so that
+// the same assistant shares its memory and settings across machines.
+//
+//goland:noinspection GoUnusedExportedFunction
+func SetStorage(s Storage) {
+	storageMu.Lock()
+	defer storageMu.Unlock()
+
+	currentStorage = s
+}
+
+// storageKey builds a key from its parts, namespaced by the active profile.
+func storageKey(parts ...string) string {
+	if name := ProfileName(); name != "" {
+		parts = append([]string{"profiles", name}, parts...)
+	}
+
+	return path.Join(parts...)
+}
+
+// appendStorage adds data to the end of the document at key, reading and rewriting it when s can't append.
+func appendStorage(s Storage, key string, data []byte) error {
+	if a, ok := s.(Appender); ok {
+		return a.Append(key, data)
+	}
+
+	existing, err := s.Read(key)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return s.Write(key, append(existing, data...))
+}
+
+// FileStorage stores documents as files under the jarbles home directory. Logs can be discarded,
+// so they are kept in the state directory instead, see userStateDir.
+type FileStorage struct{}
+
+func (s FileStorage) filename(key string) string {
+	parts := strings.Split(path.Clean("/" + key)[1:], "/")
+	if isLogKey(parts) {
+		return userStateDir(parts...)
+	}
+	return userDir(parts...)
+}
+
+// isLogKey reports whether the parts of a key are in the log directory of storageKey.
+func isLogKey(parts []string) bool {
+	if len(parts) > 2 && parts[0] == "profiles" {
+		parts = parts[2:]
+	}
+	return len(parts) > 0 && parts[0] == "log"
+}
+
+func (s FileStorage) Read(key string) ([]byte, error) {
+	return os.ReadFile(s.filename(key))
+}
+
+func (s FileStorage) Write(key string, data []byte) error {
+	filename := s.filename(key)
+	err := os.MkdirAll(filepath.Dir(filename), privateDirPerm)
+	if err != nil {
+		return fmt.Errorf("error while creating directory for %s: %w", key, err)
+	}
+
+	// write and rename, so a reader never sees a partial document
+	err = writeFileAtomic(filename, data)
+	if err != nil {
+		return fmt.Errorf("error while writing %s: %w", key, err)
+	}
+
+	return nil
+}
+
+func (s FileStorage) Append(key string, data []byte) error {
+	filename := s.filename(key)
+	err := os.MkdirAll(filepath.Dir(filename), privateDirPerm)
+	if err != nil {
+		return fmt.Errorf("error while creating directory for %s: %w", key, err)
+	}
+
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, privateFilePerm)
+	if err != nil {
+		return fmt.Errorf("error while opening %s: %w", key, err)
+	}
+	_, err = f.Write(data)
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("error while appending to %s: %w", key, err)
+	}
+
+	return f.Close()
+}
+
+func (s FileStorage) Delete(key string) error {
+	err := os.Remove(s.filename(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s FileStorage) List(prefix string) ([]string, error) {
+	root := userDir()
+	if isLogKey(strings.Split(path.Clean("/" + prefix)[1:], "/")) {
+		root = userStateDir()
+	}
+	dir := s.filename(prefix)
+
+	var keys []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error while listing %s: %w", prefix, err)
+	}
+
+	return keys, nil
+}
+
+// WebDAVStorage stores documents on a WebDAV server, such as Nextcloud or an S3 gateway that speaks WebDAV.
+type WebDAVStorage struct {
+	BaseURL  string
+	Username string
+	Password string
+	Client   *http.Client
+}
+
+func (s WebDAVStorage) Read(key string) ([]byte, error) {
+	resp, err := s.do(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s: %w", key, os.ErrNotExist)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status while reading %s: %s", key, resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+func (s WebDAVStorage) Write(key string, data []byte) error {
+	err := s.mkcol(path.Dir(key))
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(http.MethodPut, key, bytes.NewReader(data), nil)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("unexpected status while writing %s: %s", key, resp.Status)
+	}
+
+	return nil
+}
+
+func (s WebDAVStorage) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("unexpected status while deleting %s: %s", key, resp.Status)
+	}
+
+	return nil
+}
+
+func (s WebDAVStorage) List(prefix string) ([]string, error) {
+	var keys []string
+	err := s.list(strings.TrimSuffix(prefix, "/")+"/", &keys)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+func (s WebDAVStorage) list(dir string, keys *[]string) error {
+	resp, err := s.do("PROPFIND", dir, strings.NewReader(`<?xml version="1.0"?><propfind xmlns="DAV:"><prop><resourcetype/></prop></propfind>`), map[string]string{
+		"Depth":        "1",
+		"Content-Type": "application/xml",
+	})
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode != http.StatusMultiStatus {
+		return fmt.Errorf("unexpected status while listing %s: %s", dir, resp.Status)
+	}
+
+	var multistatus struct {
+		Responses []struct {
+			Href       string    `xml:"href"`
+			Collection *struct{} `xml:"propstat>prop>resourcetype>collection"`
+		} `xml:"response"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&multistatus)
+	if err != nil {
+		return fmt.Errorf("error while decoding listing of %s: %w", dir, err)
+	}
+
+	base, err := url.Parse(s.BaseURL)
+	if err != nil {
+		return fmt.Errorf("error while parsing base url: %w", err)
+	}
+	basePath := strings.TrimSuffix(base.Path, "/") + "/"
+
+	for _, r := range multistatus.Responses {
+		// the path of the parsed href is unescaped
+		u, err := url.Parse(r.Href)
+		if err != nil {
+			continue
+		}
+
+		key := strings.TrimPrefix(u.Path, basePath)
+		if strings.TrimSuffix(key, "/") == strings.TrimSuffix(dir, "/") {
+			continue // the collection itself
+		}
+
+		if r.Collection != nil {
+			err = s.list(strings.TrimSuffix(key, "/")+"/", keys)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		*keys = append(*keys, key)
+	}
+
+	return nil
+}
+
+// mkcol creates every collection of dir, ignoring the ones that already exist.
+func (s WebDAVStorage) mkcol(dir string) error {
+	if dir == "." || dir == "/" || dir == "" {
+		return nil
+	}
+
+	current := ""
+	for _, part := range strings.Split(dir, "/") {
+		current = path.Join(current, part)
+		resp, err := s.do("MKCOL", current+"/", nil, nil)
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+
+		if resp.StatusCode >= 300 && resp.StatusCode != http.StatusMethodNotAllowed {
+			return fmt.Errorf("unexpected status while creating %s: %s", current, resp.Status)
+		}
+	}
+
+	return nil
+}
+
+func (s WebDAVStorage) do(method, key string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	client := s.Client
+	if client == nil {
+		client = HTTPClient()
+		client.Timeout = 30 * time.Second
+	}
+
+	// keys may contain characters that mean something in a URL, such as ? or #
+	segments := strings.Split(strings.TrimPrefix(key, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	rawURL := strings.TrimSuffix(s.BaseURL, "/") + "/" + strings.Join(segments, "/")
+	request, err := http.NewRequest(method, rawURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("error while creating request for %s: %w", key, err)
+	}
+	if s.Username != "" {
+		request.SetBasicAuth(s.Username, s.Password)
+	}
+	for k, v := range headers {
+		request.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error while calling %s %s: %w", method, key, err)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,284 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// MaxSymbolResults caps the references the find-symbol tool returns.
+var MaxSymbolResults = 200
+
+// SymbolLocation is where a symbol is defined or referenced. Kind is func, method, type, var, const, field,
+// or package, and Text is the line of source code.
+type SymbolLocation struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Text   string `json:"text,omitempty"`
+}
+
+// SymbolResults are the definitions of a symbol and the references to them.
+type SymbolResults struct {
+	Definitions []SymbolLocation `json:"definitions"`
+	References  []SymbolLocation `json:"references"`
+	Truncated   bool             `json:"truncated,omitempty"`
+}
+
+// FindSymbol finds the definitions of the identifier in the go module in dir, and the references to them, with
+// type information rather than text matching. The name is an identifier, e.g. Walk, or a method or field with
+// its type, e.g. Ignore.Match. Tests are included.
+func FindSymbol(ctx context.Context, dir, name string) (SymbolResults, error) {
+	results, _, err := lookupSymbol(ctx, dir, name)
+	return results, err
+}
+
+// loadGoPackages loads the packages of patterns in dir with their syntax and types. Overlay replaces the
+// content of files by their absolute path.
+func loadGoPackages(ctx context.Context, dir string, overlay map[string][]byte, patterns ...string) ([]*packages.Package, error) {
+	goPath, err := GoPath()
+	if err != nil {
+		return nil, err
+	}
+
+	// go/packages runs go list, with the same environment as the other toolchain commands. The dependencies are
+	// type checked from source, export data written by a newer go than x/tools knows can't be read.
+	pkgs, err := packages.Load(&packages.Config{
+		Context: ctx,
+		Dir:     dir,
+		Env:     toolchainCommand(ctx, goPath).Env,
+		Tests:   true,
+		Overlay: overlay,
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedDeps | packages.NeedSyntax |
+			packages.NeedTypes | packages.NeedTypesInfo,
+	}, patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("error while loading packages: %w", err)
+	}
+
+	return pkgs, nil
+}
+
+// lookupSymbol is FindSymbol, which also returns the loaded packages.
+func lookupSymbol(ctx context.Context, dir, name string) (SymbolResults, []*packages.Package, error) {
+	typeName, ident, found := strings.Cut(name, ".")
+	if !found {
+		typeName, ident = "", name
+	}
+
+	pkgs, err := loadGoPackages(ctx, dir, nil, "./...")
+	if err != nil {
+		return SymbolResults{}, nil, err
+	}
+
+	// the packages of tests have their own copy of the objects, so objects are compared by position
+	key := func(fset *token.FileSet, obj types.Object) string {
+		return fset.Position(obj.Pos()).String() + " " + obj.Name()
+	}
+
+	definitions := make(map[string]bool)
+	var results SymbolResults
+	seen := make(map[string]bool)
+	lines := make(map[string][]string)
+	add := func(list *[]SymbolLocation, fset *token.FileSet, pos token.Pos, obj types.Object) {
+		position := fset.Position(pos)
+		id := position.String()
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+
+		location := SymbolLocation{
+			Kind:   symbolKind(obj),
+			Name:   obj.Name(),
+			File:   position.Filename,
+			Line:   position.Line,
+			Column: position.Column,
+			Text:   sourceLine(lines, position),
+		}
+		if rel, err := filepath.Rel(dir, position.Filename); err == nil && !strings.HasPrefix(rel, "..") {
+			location.File = filepath.ToSlash(rel)
+		}
+		*list = append(*list, location)
+	}
+
+	for _, pkg := range pkgs {
+		if pkg.TypesInfo == nil {
+			continue
+		}
+		for id, obj := range pkg.TypesInfo.Defs {
+			if obj == nil || id.Name != ident || !matchesReceiver(obj, typeName) {
+				continue
+			}
+			definitions[key(pkg.Fset, obj)] = true
+			add(&results.Definitions, pkg.Fset, id.Pos(), obj)
+		}
+	}
+
+	for _, pkg := range pkgs {
+		if pkg.TypesInfo == nil {
+			continue
+		}
+		for id, obj := range pkg.TypesInfo.Uses {
+			if id.Name != ident || !definitions[key(pkg.Fset, obj)] {
+				continue
+			}
+			if len(results.References) >= MaxSymbolResults {
+				results.Truncated = true
+				break
+			}
+			add(&results.References, pkg.Fset, id.Pos(), obj)
+		}
+	}
+
+	for _, list := range [][]SymbolLocation{results.Definitions, results.References} {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].File != list[j].File {
+				return list[i].File < list[j].File
+			}
+			return list[i].Line < list[j].Line || list[i].Line == list[j].Line && list[i].Column < list[j].Column
+		})
+	}
+
+	return results, pkgs, nil
+}
+
+// matchesReceiver reports whether obj is a method or field of the named type, or a package level object
+// when typeName is empty.
+func matchesReceiver(obj types.Object, typeName string) bool {
+	switch o := obj.(type) {
+	case *types.Func:
+		recv := o.Type().(*types.Signature).Recv()
+		if recv == nil {
+			return typeName == ""
+		}
+		return typeName == "" || receiverTypeName(recv.Type()) == typeName
+	case *types.Var:
+		if o.IsField() {
+			return typeName == "" || fieldOwner(o) == typeName
+		}
+	}
+	return typeName == "" && obj.Parent() == obj.Pkg().Scope()
+}
+
+func receiverTypeName(t types.Type) string {
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	if n, ok := t.(*types.Named); ok {
+		return n.Obj().Name()
+	}
+	return ""
+}
+
+// fieldOwner returns the name of the struct type that declares the field, or an empty string.
+func fieldOwner(field *types.Var) string {
+	if field.Pkg() == nil {
+		return ""
+	}
+	scope := field.Pkg().Scope()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		s, ok := tn.Type().Underlying().(*types.Struct)
+		if !ok {
+			continue
+		}
+		for i := 0; i < s.NumFields(); i++ {
+			if s.Field(i) == field {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func symbolKind(obj types.Object) string {
+	switch o := obj.(type) {
+	case *types.Func:
+		if o.Type().(*types.Signature).Recv() != nil {
+			return "method"
+		}
+		return "func"
+	case *types.TypeName:
+		return "type"
+	case *types.Const:
+		return "const"
+	case *types.PkgName:
+		return "package"
+	case *types.Var:
+		if o.IsField() {
+			return "field"
+		}
+	}
+	return "var"
+}
+
+// sourceLine returns the trimmed line of the position, reading each file once.
+func sourceLine(cache map[string][]string, position token.Position) string {
+	lines, ok := cache[position.Filename]
+	if !ok {
+		data, err := os.ReadFile(position.Filename)
+		if err == nil {
+			lines = strings.Split(string(data), "\n")
+		}
+		cache[position.Filename] = lines
+	}
+	if position.Line < 1 || position.Line > len(lines) {
+		return ""
+	}
+	return strings.TrimSpace(lines[position.Line-1])
+}
+
+func findSymbol(safeSrc string) ToolContextFunction {
+	return func(ctx context.Context, payload string) (string, error) {
+		var request struct {
+			WorkingDir string `json:"workingDir"`
+			Name       string `json:"name"`
+		}
+		err := json.Unmarshal([]byte(payload), &request)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while unmarshaling payload", "error", err.Error())
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+		}
+		if request.Name == "" {
+			LoggerFrom(ctx).Error("name parameter is missing")
+			return "", fmt.Errorf("name parameter is missing")
+		}
+
+		workingDir, err := safeDir(safeSrc, request.WorkingDir)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while getting safe working directory", "error", err.Error())
+			return "", fmt.Errorf("error while getting safe working directory: %w", err)
+		}
+
+		results, err := FindSymbol(ctx, workingDir, request.Name)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while finding symbol", "name", request.Name, "error", err.Error())
+			return "", err
+		}
+		if len(results.Definitions) == 0 {
+			return "no definition of " + request.Name + " found", nil
+		}
+
+		data, err := marshalJSON(results)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while marshaling symbol results", "error", err.Error())
+			return "", fmt.Errorf("error while marshaling symbol results: %w", err)
+		}
+
+		return string(data), nil
+	}
+}
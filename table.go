@@ -0,0 +1,30 @@
+package framework
+
+import (
+	"strconv"
+)
+
+// TableQuery is the page and sort that a link of lib.Table asks for.
+type TableQuery struct {
+	Page int
+	Sort string
+	Desc bool
+}
+
+// PayloadTableQuery returns the page, sort, and order query parameters of a link of lib.Table from the payload
+// of the action that renders the table. The page defaults to 1.
+//
+//goland:noinspection GoUnusedExportedFunction
+func PayloadTableQuery(payload string) TableQuery {
+	query := TableQuery{Page: 1}
+
+	page, _ := PayloadGetString(payload, "page", "1")
+	if n, err := strconv.Atoi(page); err == nil && n > 0 {
+		query.Page = n
+	}
+	query.Sort, _ = PayloadGetString(payload, "sort", "")
+	order, _ := PayloadGetString(payload, "order", "asc")
+	query.Desc = order == "desc"
+
+	return query
+}
@@ -0,0 +1,360 @@
+package framework
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TestCase is the result of one test, or of a package that failed without a failing test, e.g. when it
+// doesn't build. Output is only kept for failures.
+type TestCase struct {
+	Package string  `json:"package"`
+	Name    string  `json:"name,omitempty"`
+	Tags    string  `json:"tags,omitempty"`
+	Status  string  `json:"status"`
+	Elapsed float64 `json:"elapsed"`
+	Output  string  `json:"output,omitempty"`
+}
+
+// TestSummary aggregates the test cases of every run of a test matrix. Report and Summary are the blob hashes
+// of the JUnit XML report and of the summary itself as JSON.
+type TestSummary struct {
+	Passed  int        `json:"passed"`
+	Failed  int        `json:"failed"`
+	Skipped int        `json:"skipped"`
+	Elapsed float64    `json:"elapsed"`
+	Cases   []TestCase `json:"cases"`
+	Report  string     `json:"report,omitempty"`
+	Summary string     `json:"-"`
+}
+
+// TestMatrix is what runs: the packages once for each entry of Tags, an empty entry for no build tags.
+type TestMatrix struct {
+	Packages []string
+	Tags     []string
+	Run      string
+}
+
+// RunTests runs go test for every entry of the matrix in dir and aggregates the results. Failing tests aren't
+// an error, only a run that can't start is.
+func RunTests(ctx context.Context, dir string, matrix TestMatrix) (TestSummary, error) {
+	if len(matrix.Packages) == 0 {
+		matrix.Packages = []string{"./..."}
+	}
+	if len(matrix.Tags) == 0 {
+		matrix.Tags = []string{""}
+	}
+
+	for _, pkg := range matrix.Packages {
+		if strings.HasPrefix(pkg, "-") {
+			return TestSummary{}, fmt.Errorf("invalid package %s", pkg)
+		}
+	}
+
+	goPath, err := GoPath()
+	if err != nil {
+		return TestSummary{}, err
+	}
+
+	var summary TestSummary
+	for _, tags := range matrix.Tags {
+		args := []string{"test", "-json"}
+		if tags != "" {
+			args = append(args, "-tags", tags)
+		}
+		if matrix.Run != "" {
+			args = append(args, "-run", matrix.Run)
+		}
+		args = append(args, matrix.Packages...)
+
+		cases, err := runTestCommand(ctx, goPath, dir, tags, args)
+		if err != nil {
+			return TestSummary{}, err
+		}
+		summary.Cases = append(summary.Cases, cases...)
+	}
+
+	for _, c := range summary.Cases {
+		switch c.Status {
+		case "pass":
+			summary.Passed++
+		case "fail":
+			summary.Failed++
+		case "skip":
+			summary.Skipped++
+		}
+		summary.Elapsed += c.Elapsed
+	}
+
+	return summary, nil
+}
+
+func runTestCommand(ctx context.Context, goPath, dir, tags string, args []string) ([]TestCase, error) {
+	ctx, cancel := context.WithTimeout(ctx, BuildStepTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := toolchainCommand(ctx, goPath, args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	LoggerFrom(ctx).Info("running command", "command", cmd)
+	runErr := cmd.Run()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("error while running tests: %w", ctx.Err())
+	}
+
+	cases := parseTestEvents(&stdout, tags)
+	if runErr != nil && len(cases) == 0 {
+		LoggerFrom(ctx).Error("error while running tests", "stderr", stderr.String(), "error", runErr.Error())
+		return nil, fmt.Errorf("error while running tests: %s", strings.TrimSpace(stderr.String()+"\n"+runErr.Error()))
+	}
+
+	// build errors are on standard error, attach them to the packages that failed without a failing test
+	for i := range cases {
+		if cases[i].Name == "" && cases[i].Status == "fail" && stderr.Len() > 0 {
+			cases[i].Output += stderr.String()
+		}
+	}
+
+	return cases, nil
+}
+
+// parseTestEvents reads the output of go test -json, see go doc test2json.
+func parseTestEvents(r *bytes.Buffer, tags string) []TestCase {
+	type key struct{ pkg, test string }
+	output := make(map[key]*strings.Builder)
+	var cases []TestCase
+	failedTests := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var event struct {
+			Action     string
+			Package    string
+			ImportPath string
+			Test       string
+			Elapsed    float64
+			Output     string
+		}
+		if json.Unmarshal(scanner.Bytes(), &event) != nil {
+			continue
+		}
+
+		k := key{event.Package, event.Test}
+		switch event.Action {
+		case "build-output":
+			// newer versions of go report build errors of packages here instead of on standard error
+			pkg, _, _ := strings.Cut(event.ImportPath, " ")
+			k = key{pkg, ""}
+			fallthrough
+		case "output":
+			if output[k] == nil {
+				output[k] = &strings.Builder{}
+			}
+			output[k].WriteString(event.Output)
+		case "pass", "fail", "skip":
+			if event.Test == "" && (event.Action != "fail" || failedTests[event.Package]) {
+				continue
+			}
+			c := TestCase{Package: event.Package, Name: event.Test, Tags: tags, Status: event.Action, Elapsed: event.Elapsed}
+			if event.Action == "fail" {
+				failedTests[event.Package] = true
+				if output[k] != nil {
+					c.Output = output[k].String()
+				}
+			}
+			cases = append(cases, c)
+		}
+	}
+
+	return cases
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Output  string `xml:",chardata"`
+}
+
+// JUnit returns the summary as a JUnit XML report, with a test suite for each package and build tags.
+func (s TestSummary) JUnit() ([]byte, error) {
+	seconds := func(f float64) string { return fmt.Sprintf("%.3f", f) }
+
+	suites := make(map[string]*junitTestSuite)
+	elapsed := make(map[string]float64)
+	var names []string
+	for _, c := range s.Cases {
+		name := c.Package
+		if c.Tags != "" {
+			name += " [" + c.Tags + "]"
+		}
+		suite := suites[name]
+		if suite == nil {
+			suite = &junitTestSuite{Name: name}
+			suites[name] = suite
+			names = append(names, name)
+		}
+
+		tc := junitTestCase{ClassName: c.Package, Name: c.Name, Time: seconds(c.Elapsed)}
+		if tc.Name == "" {
+			tc.Name = "(package)"
+		}
+		switch c.Status {
+		case "fail":
+			tc.Failure = &junitFailure{Message: "failed", Output: c.Output}
+			suite.Failures++
+		case "skip":
+			tc.Skipped = &struct{}{}
+			suite.Skipped++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, tc)
+		elapsed[name] += c.Elapsed
+	}
+
+	sort.Strings(names)
+	report := junitTestSuites{Tests: len(s.Cases), Failures: s.Failed, Skipped: s.Skipped, Time: seconds(s.Elapsed)}
+	for _, name := range names {
+		suite := suites[name]
+		suite.Time = seconds(elapsed[name])
+		report.Suites = append(report.Suites, *suite)
+	}
+
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error while marshaling junit report: %w", err)
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// Digest is a compact pass/fail summary for the model: the counts, each failure with the first lines of its
+// output, and the blobs of the full reports.
+func (s TestSummary) Digest() string {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "%d passed, %d failed, %d skipped in %s\n", s.Passed, s.Failed, s.Skipped, time.Duration(s.Elapsed*float64(time.Second)).Round(time.Millisecond))
+	for _, c := range s.Cases {
+		if c.Status != "fail" {
+			continue
+		}
+
+		name := c.Package
+		if c.Name != "" {
+			name += "." + c.Name
+		}
+		if c.Tags != "" {
+			name += " [" + c.Tags + "]"
+		}
+		_, _ = fmt.Fprintf(&b, "FAIL %s\n", name)
+
+		lines := strings.Split(strings.TrimSpace(c.Output), "\n")
+		if len(lines) > 5 {
+			lines = append(lines[:5], "...")
+		}
+		for _, line := range lines {
+			if line = strings.TrimSpace(line); line != "" {
+				_, _ = fmt.Fprintf(&b, "    %s\n", line)
+			}
+		}
+	}
+	if s.Report != "" {
+		_, _ = fmt.Fprintf(&b, "junit report: blob %s\n", s.Report)
+	}
+	if s.Summary != "" {
+		_, _ = fmt.Fprintf(&b, "json summary: blob %s\n", s.Summary)
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// storeTestReports puts the JUnit report and the JSON summary in the blob store.
+func storeTestReports(summary *TestSummary) error {
+	report, err := summary.JUnit()
+	if err != nil {
+		return err
+	}
+	summary.Report, err = PutBlob(bytes.NewReader(report))
+	if err != nil {
+		return err
+	}
+
+	data, err := marshalJSON(summary)
+	if err != nil {
+		return fmt.Errorf("error while marshaling test summary: %w", err)
+	}
+	summary.Summary, err = PutBlob(bytes.NewReader(data))
+	return err
+}
+
+func runTests(safeSrc string) ToolContextFunction {
+	return func(ctx context.Context, payload string) (string, error) {
+		var request struct {
+			WorkingDir string `json:"workingDir"`
+			Packages   string `json:"packages"`
+			Tags       string `json:"tags"`
+			Run        string `json:"run"`
+		}
+		err := json.Unmarshal([]byte(payload), &request)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while unmarshaling payload", "error", err.Error())
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+		}
+
+		workingDir, err := safeDir(safeSrc, request.WorkingDir)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while getting safe working directory", "error", err.Error())
+			return "", fmt.Errorf("error while getting safe working directory: %w", err)
+		}
+
+		matrix := TestMatrix{Packages: strings.Fields(request.Packages), Run: request.Run}
+		if request.Tags != "" {
+			matrix.Tags = strings.Split(request.Tags, ";")
+		}
+		summary, err := RunTests(ctx, workingDir, matrix)
+		if err != nil {
+			return "", err
+		}
+
+		err = storeTestReports(&summary)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while storing test reports", "error", err.Error())
+			return "", err
+		}
+
+		return summary.Digest(), nil
+	}
+}
@@ -0,0 +1,113 @@
+package framework
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// configKeyTimeZone is the config key of the default IANA time zone of an assistant or extension.
+const configKeyTimeZone = "timezone"
+
+func defaultTimeZone() string {
+	name, ok := ConfigGet(configKeyTimeZone)
+	if !ok {
+		return CurrentProfile().TimeZone
+	}
+	return name
+}
+
+// TimeZone returns the default time zone of the running assistant or extension, which is set with the timezone
+// config key, or else is the time zone of the user. Cron and scheduled entries without a time zone of their own
+// are in it. Without a valid default the local time zone is returned.
+func TimeZone() *time.Location {
+	name := defaultTimeZone()
+	if name == "" {
+		return time.Local
+	}
+
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		LogWarn("invalid default time zone, using local time", "timezone", name, "error", err.Error())
+		return time.Local
+	}
+	return location
+}
+
+// describeTimeZone returns the name of the time zone if it's valid, so that the host never receives a zone it can't load.
+func describeTimeZone(name string) string {
+	if name == "" {
+		return ""
+	}
+	if name == "Local" {
+		// loads, but names whatever zone the process that reads it runs in
+		LogWarn("local time zone, leaving it out of describe", "timezone", name)
+		return ""
+	}
+
+	_, err := time.LoadLocation(name)
+	if err != nil {
+		LogWarn("invalid time zone, leaving it out of describe", "timezone", name, "error", err.Error())
+		return ""
+	}
+	return name
+}
+
+// zoneName returns the IANA name of location. The local zone is named "Local", so its name is looked up in
+// TZ or /etc/localtime instead, and is empty when it can't be found.
+func zoneName(location *time.Location) string {
+	name := location.String()
+	if name != "Local" {
+		return name
+	}
+
+	if tz, ok := os.LookupEnv("TZ"); ok {
+		if _, err := time.LoadLocation(tz); tz != "" && err == nil {
+			return tz
+		}
+		return ""
+	}
+
+	target, err := filepath.EvalSymlinks("/etc/localtime")
+	if err != nil {
+		return ""
+	}
+	_, after, found := strings.Cut(filepath.ToSlash(target), "/zoneinfo/")
+	if !found {
+		return ""
+	}
+	if _, err := time.LoadLocation(after); err != nil {
+		return ""
+	}
+	return after
+}
+
+// loadTimeZone loads the named zone, or returns the default zone when name is empty.
+func loadTimeZone(name string) (*time.Location, error) {
+	if name == "" {
+		return TimeZone(), nil
+	}
+
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("error while loading time zone %s: %w", name, err)
+	}
+	return location, nil
+}
+
+// localTimeLayouts are the layouts of a date and time without a zone.
+var localTimeLayouts = []string{time.DateTime, "2006-01-02 15:04", "2006-01-02T15:04:05", "2006-01-02T15:04"}
+
+// inTimeZone returns the instant of a date and time without a zone, e.g. "2024-05-03 15:00", in location.
+// "3pm on Friday" means 3pm where the user is, not where the process runs.
+func inTimeZone(localTime string, location *time.Location) (time.Time, error) {
+	for _, layout := range localTimeLayouts {
+		t, err := time.ParseInLocation(layout, localTime, location)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid local time %q, expected e.g. 2024-05-03 15:00", localTime)
+}
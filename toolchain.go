@@ -0,0 +1,155 @@
+package framework
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// The config keys of explicit paths to the go and goimports binaries used by the compile and build-extension tools.
+const (
+	configKeyGoPath        = "go_path"
+	configKeyGoimportsPath = "goimports_path"
+)
+
+// ErrToolchainNotFound is returned when a go toolchain binary is neither configured, in the PATH, nor in a
+// well-known location.
+var ErrToolchainNotFound = errors.New("toolchain binary not found")
+
+// SetGoPath stores the path of the go binary in the config of the running assistant or extension.
+// Hosts launched from a GUI often have a minimal PATH, which makes builds fail without it.
+//
+//goland:noinspection GoUnusedExportedFunction
+func SetGoPath(path string) error {
+	return ConfigSet(configKeyGoPath, path)
+}
+
+// SetGoimportsPath stores the path of the goimports binary in the config of the running assistant or extension.
+//
+//goland:noinspection GoUnusedExportedFunction
+func SetGoimportsPath(path string) error {
+	return ConfigSet(configKeyGoimportsPath, path)
+}
+
+// GoPath returns the path of the go binary: the configured one, else the one in the PATH, else the one in
+// GOROOT or a well-known install location.
+func GoPath() (string, error) {
+	return resolveToolchain(configKeyGoPath, "go", goCandidates())
+}
+
+// GoimportsPath returns the path of the goimports binary: the configured one, else the one in the PATH, else
+// the one in GOBIN, GOPATH/bin, or next to the go binary.
+func GoimportsPath() (string, error) {
+	return resolveToolchain(configKeyGoimportsPath, "goimports", goimportsCandidates())
+}
+
+func resolveToolchain(configKey, name string, candidates []string) (string, error) {
+	if path, ok := ConfigGet(configKey); ok && path != "" {
+		if !isExecutable(path) {
+			return "", fmt.Errorf("error while resolving %s: configured path %s is not executable: %w", name, path, ErrToolchainNotFound)
+		}
+		return path, nil
+	}
+
+	if path, err := exec.LookPath(name); err == nil {
+		return path, nil
+	}
+
+	for _, dir := range candidates {
+		path := filepath.Join(dir, executableName(name))
+		if isExecutable(path) {
+			LogDebug("found toolchain binary outside of the PATH", "name", name, "path", path)
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("error while resolving %s, set the %s config key: %w", name, configKey, ErrToolchainNotFound)
+}
+
+// goCandidates returns the directories where the go binary is usually installed.
+func goCandidates() []string {
+	var dirs []string
+	if goroot := os.Getenv("GOROOT"); goroot != "" {
+		dirs = append(dirs, filepath.Join(goroot, "bin"))
+	}
+	if goroot := runtime.GOROOT(); goroot != "" {
+		dirs = append(dirs, filepath.Join(goroot, "bin"))
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		dirs = append(dirs, filepath.Join(os.Getenv("ProgramFiles"), "Go", "bin"))
+	case "darwin":
+		dirs = append(dirs, "/usr/local/go/bin", "/opt/homebrew/bin", "/usr/local/bin")
+	default:
+		dirs = append(dirs, "/usr/local/go/bin", "/usr/lib/go/bin", "/snap/bin", "/usr/bin")
+	}
+
+	// versions installed with golang.org/dl
+	if home, err := os.UserHomeDir(); err == nil {
+		sdks, _ := filepath.Glob(filepath.Join(home, "sdk", "go*", "bin"))
+		dirs = append(dirs, sdks...)
+	}
+
+	return dirs
+}
+
+// goimportsCandidates returns the directories where go install puts binaries.
+func goimportsCandidates() []string {
+	var dirs []string
+	if gobin := os.Getenv("GOBIN"); gobin != "" {
+		dirs = append(dirs, gobin)
+	}
+	for _, gopath := range filepath.SplitList(os.Getenv("GOPATH")) {
+		dirs = append(dirs, filepath.Join(gopath, "bin"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, "go", "bin"))
+	}
+	if path, err := GoPath(); err == nil {
+		dirs = append(dirs, filepath.Dir(path))
+	}
+
+	return dirs
+}
+
+// toolchainCommand returns a command that runs the binary at path with the directory of the go binary first in
+// its PATH, because goimports and go build run other toolchain binaries by name. The EnvPolicy applies too.
+func toolchainCommand(ctx context.Context, path string, args ...string) *exec.Cmd {
+	cmd := Command(ctx, path, args...)
+	if goPath, err := GoPath(); err == nil {
+		env := cmd.Env
+		if env == nil {
+			env = os.Environ()
+		}
+
+		dirs := []string{filepath.Dir(goPath)}
+		for _, kv := range env {
+			if value, ok := strings.CutPrefix(kv, "PATH="); ok && value != "" {
+				dirs = append(dirs, value)
+			}
+		}
+		cmd.Env = append(env, "PATH="+strings.Join(dirs, string(os.PathListSeparator)))
+	}
+	return cmd
+}
+
+func executableName(name string) string {
+	if runtime.GOOS == "windows" {
+		return name + ".exe"
+	}
+	return name
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	return runtime.GOOS == "windows" || info.Mode()&0o111 != 0
+}
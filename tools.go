@@ -1,6 +1,7 @@
 package framework
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -17,12 +19,39 @@ import (
 var StandardTools = struct {
 	ReadFile       func(string) Tool
 	WriteFile      func(string) Tool
+	AppendFile     func(string) Tool
+	ReplaceInFile  func(string) Tool
+	ApplyDiff      func(string) Tool
+	DiffFiles      func(string) Tool
+	DeleteFile     func(string) Tool
 	CopyFile       func(string, string) Tool
 	ListDir        func(string) Tool
+	ListFiles      func(string) Tool
+	SearchFiles    func(string) Tool
 	Compile        func(string, string) Tool
 	BuildExtension func(string) Tool
+	Build          func(string, string) Tool
+	RunTests       func(string) Tool
+	FormatCode     func(string) Tool
+	AnalyzeCode    func(string) Tool
+	ScanVulns      func(string) Tool
+	GenerateSBOM   func(string) Tool
+	RepoMap        func(string) Tool
+	FindSymbol     func(string) Tool
+	EditGo         func(string) Tool
+	Scaffold       func(string) Tool
 	GetHTML        func() Tool
+	HTTPGet        func(HTTPOptions) Tool
+	HTTPRequest    func(HTTPRequestOptions) Tool
+	DownloadFile   func(string, DownloadOptions) Tool
+	FXRate         func(QuoteProvider) Tool
+	StockQuote     func(QuoteProvider) Tool
+	RunScript      func(string) Tool
+	Backup         func(string) Tool
+	Restore        func(string) Tool
 }{
+	// ReadFile reads a file within the safeDir.
+	// Pass the tool to Untrusted when the files may contain content from others.
 	ReadFile: func(safeDir string) Tool {
 		return Tool{
 			Name:        "read-file",
@@ -68,116 +97,790 @@ var StandardTools = struct {
 			RequiredArguments: []string{"dir", "name", "content"},
 		}
 	},
+	// AppendFile appends to a file within the safeDir, e.g. a log or notes, and creates it when it's missing.
+	AppendFile: func(safeDir string) Tool {
+		return Tool{
+			Name:        "append-file",
+			Description: "appends content to the end of a file, which is created when it doesn't exist",
+			Function:    appendFile(safeDir),
+			Arguments: []ToolArguments{
+				{
+					Name:        "dir",
+					Type:        "string",
+					Description: "the directory of the file",
+				},
+				{
+					Name:        "name",
+					Type:        "string",
+					Description: "the name of the file without the directory",
+				},
+				{
+					Name:        "content",
+					Type:        "string",
+					Description: "the content to append, including a trailing newline for a new line",
+				},
+			},
+			RequiredArguments: []string{"dir", "name", "content"},
+		}
+	},
+	// ReplaceInFile replaces literal text or the matches of a regular expression in a file within the safeDir,
+	// and returns the number of replacements with a diff, so small edits don't need the whole file.
+	ReplaceInFile: func(safeDir string) Tool {
+		return Tool{
+			Name:        "replace-in-file",
+			Description: "replaces text in a file and returns the number of replacements with a diff",
+			Function:    replaceInFile(safeDir),
+			Arguments: []ToolArguments{
+				{
+					Name:        "dir",
+					Type:        "string",
+					Description: "the directory of the file",
+				},
+				{
+					Name:        "name",
+					Type:        "string",
+					Description: "the name of the file without the directory",
+				},
+				{
+					Name:        "search",
+					Type:        "string",
+					Description: "the text to replace",
+				},
+				{
+					Name:        "replace",
+					Type:        "string",
+					Description: "the replacement, which can refer to the groups of a regular expression with $1 or ${name}",
+				},
+				{
+					Name:        "regexp",
+					Type:        "boolean",
+					Description: "treat search as a regular expression rather than literal text",
+				},
+				{
+					Name:        "count",
+					Type:        "integer",
+					Description: "the most replacements to make from the start of the file, all of them when zero",
+				},
+			},
+			RequiredArguments: []string{"dir", "name", "search", "replace"},
+		}
+	},
+	// ApplyDiff applies a unified diff to the files in a directory within the safeDir and reports the outcome of
+	// each hunk as JSON, see ApplyUnifiedDiff.
+	ApplyDiff: func(safeDir string) Tool {
+		return Tool{
+			Name:            "apply-diff",
+			Description:     "applies a unified diff, like git apply, and reports which hunks applied; nothing is changed unless all of them apply",
+			ContextFunction: applyDiff(safeDir),
+			Arguments: []ToolArguments{
+				{
+					Name:        "dir",
+					Type:        "string",
+					Description: "the directory the paths of the diff are relative to, the root directory when empty",
+				},
+				{
+					Name:        "diff",
+					Type:        "string",
+					Description: "the diff in the unified format of diff -u or git diff, with --- and +++ lines for each file",
+				},
+			},
+			RequiredArguments: []string{"diff"},
+		}
+	},
+	// DiffFiles returns the unified diff between two files within the safeDir, or between a file and content.
+	DiffFiles: func(safeDir string) Tool {
+		return Tool{
+			Name:        "diff-files",
+			Description: "shows what changed between two files, or between a file and new content, as a unified diff",
+			Function:    diffFiles(safeDir),
+			Arguments: []ToolArguments{
+				{
+					Name:        "dir",
+					Type:        "string",
+					Description: "the directory of the files",
+				},
+				{
+					Name:        "name",
+					Type:        "string",
+					Description: "the name of the old file without the directory",
+				},
+				{
+					Name:        "otherName",
+					Type:        "string",
+					Description: "the name of the new file without the directory",
+				},
+				{
+					Name:        "content",
+					Type:        "string",
+					Description: "the new content, compared with the file instead of otherName",
+				},
+			},
+			RequiredArguments: []string{"dir", "name"},
+		}
+	},
+	// DeleteFile deletes a file within the safeDir, or a directory with its content when recursive is true.
+	// The safeDir itself is never deleted.
+	DeleteFile: func(safeDir string) Tool {
+		return Tool{
+			Name:        "delete-file",
+			Description: "deletes a file, or a directory when recursive is true",
+			Function:    deleteFile(safeDir),
+			Arguments: []ToolArguments{
+				{
+					Name:        "dir",
+					Type:        "string",
+					Description: "the directory of the file",
+				},
+				{
+					Name:        "name",
+					Type:        "string",
+					Description: "the name of the file without the directory",
+				},
+				{
+					Name:        "recursive",
+					Type:        "boolean",
+					Description: "delete a directory with all its content",
+				},
+			},
+			RequiredArguments: []string{"dir", "name"},
+		}
+	},
 	CopyFile: func(safeSrc, safeDest string) Tool {
 		return Tool{
-			Name:        "copy-file",
-			Description: "copies a file",
-			Function:    copyFile(safeSrc, safeDest),
+			Name:        "copy-file",
+			Description: "copies a file",
+			Function:    copyFile(safeSrc, safeDest),
+			Arguments: []ToolArguments{
+				{
+					Name:        "src",
+					Type:        "string",
+					Description: "the path of the source file",
+				},
+				{
+					Name:        "dest",
+					Type:        "string",
+					Description: "the path of the destination file",
+				},
+			},
+			RequiredArguments: []string{"src", "dest"},
+		}
+	},
+	ListDir: func(safeDir string) Tool {
+		return Tool{
+			Name:            "list-directories",
+			Description:     "lists the directories in a directory",
+			ContextFunction: listDir(safeDir),
+		}
+	},
+	// ListFiles lists the files in a directory within the safeDir as a FileNode tree in JSON, with the size and
+	// modification time of the files.
+	ListFiles: func(safeDir string) Tool {
+		return Tool{
+			Name:            "list-files",
+			Description:     "lists the files in a directory as a tree with their size and modification time",
+			ContextFunction: listFiles(safeDir),
+			Arguments: []ToolArguments{
+				{
+					Name:        "dir",
+					Type:        "string",
+					Description: "the directory to list, the root directory when empty",
+				},
+				{
+					Name:        "depth",
+					Type:        "integer",
+					Description: "how many levels of directories to list, all of them when zero",
+				},
+				{
+					Name:        "glob",
+					Type:        "string",
+					Description: "only list the files that match the glob, e.g. **/*.go",
+				},
+			},
+		}
+	},
+	// SearchFiles searches the text files in a directory within the safeDir for literal text or a regular
+	// expression, and returns the matching lines with their path and line number as JSON.
+	SearchFiles: func(safeDir string) Tool {
+		return Tool{
+			Name:            "search-files",
+			Description:     "searches the content of files like grep and returns the matching lines with their path and line number",
+			ContextFunction: searchFiles(safeDir),
+			Arguments: []ToolArguments{
+				{
+					Name:        "query",
+					Type:        "string",
+					Description: "the text to search for",
+				},
+				{
+					Name:        "regexp",
+					Type:        "boolean",
+					Description: "treat the query as a regular expression rather than literal text",
+				},
+				{
+					Name:        "ignoreCase",
+					Type:        "boolean",
+					Description: "match regardless of case",
+				},
+				{
+					Name:        "dir",
+					Type:        "string",
+					Description: "the directory to search, the root directory when empty",
+				},
+				{
+					Name:        "glob",
+					Type:        "string",
+					Description: "only search the files that match the glob, e.g. **/*.go",
+				},
+			},
+			RequiredArguments: []string{"query"},
+		}
+	},
+	// Compile compiles and builds a binary from go source code.
+	// The go and goimports binaries are found with GoPath and GoimportsPath.
+	// The entrypoint must be main.go.
+	// Requires a go.mod file.
+	// Build errors are returned as JSON diagnostics, see ParseDiagnostics.
+	Compile: func(safeSrc, safeDest string) Tool {
+		return Tool{
+			Name:            "compile",
+			Description:     "compiles and builds a binary from go source code",
+			ContextFunction: compile(safeSrc, safeDest),
+			Arguments: []ToolArguments{
+				{
+					Name:        "workingDir",
+					Type:        "string",
+					Description: "the working directory that contains the source code",
+				},
+				{
+					Name:        "outputDir",
+					Type:        "string",
+					Description: "the output directory of the binary",
+				},
+				{
+					Name:        "outputName",
+					Type:        "string",
+					Description: "the filename of the output binary without the directory",
+				},
+			},
+			RequiredArguments: []string{"workingDir", "outputDir", "outputName"},
+		}
+	},
+	// Compile compiles and builds a binary from go source code.
+	// The go and goimports binaries are found with GoPath and GoimportsPath.
+	// The entrypoint must be main.go.
+	// Requires a go.mod file.
+	// Build errors are returned as JSON diagnostics, see ParseDiagnostics.
+	BuildExtension: func(safeSrc string) Tool {
+		return Tool{
+			Name:            "build-extension",
+			Description:     "compiles and builds a jarbles extension from go source code",
+			ContextFunction: buildExtension(safeSrc),
+			Arguments: []ToolArguments{
+				{
+					Name:        "workingDir",
+					Type:        "string",
+					Description: "the working directory that contains the source code",
+				},
+				{
+					Name:        "outputName",
+					Type:        "string",
+					Description: "the filename of the output binary without the directory",
+				},
+			},
+			RequiredArguments: []string{"workingDir", "outputName"},
+		}
+	},
+	// Build builds the project in a working directory within safeSrc with the Builder that detects it, e.g. go
+	// for a go.mod, cargo for a Cargo.toml, npm or yarn for a package.json, and pip for a requirements.txt.
+	// A binary, for builders that produce one, is put in an output directory within safeDest.
+	Build: func(safeSrc, safeDest string) Tool {
+		return Tool{
+			Name:            "build",
+			Description:     "builds a project of any supported language from source code",
+			ContextFunction: build(safeSrc, safeDest),
+			Arguments: []ToolArguments{
+				{
+					Name:        "workingDir",
+					Type:        "string",
+					Description: "the working directory that contains the source code",
+				},
+				{
+					Name:        "outputDir",
+					Type:        "string",
+					Description: "the output directory of the binary, if any",
+				},
+				{
+					Name:        "outputName",
+					Type:        "string",
+					Description: "the filename of the output binary without the directory, if any",
+				},
+				{
+					Name:        "builder",
+					Type:        "string",
+					Description: "the builder to use instead of detecting it: go, rust, node, or python",
+				},
+			},
+			RequiredArguments: []string{"workingDir"},
+		}
+	},
+	// RunTests runs the go tests of a working directory within safeSrc, once for each set of build tags. It
+	// returns a pass/fail digest, and stores a JUnit XML report and a JSON summary in the blob store.
+	RunTests: func(safeSrc string) Tool {
+		return Tool{
+			Name:            "run-tests",
+			Description:     "runs the go tests of a project and reports which ones fail",
+			ContextFunction: runTests(safeSrc),
+			Arguments: []ToolArguments{
+				{
+					Name:        "workingDir",
+					Type:        "string",
+					Description: "the working directory that contains the go.mod file",
+				},
+				{
+					Name:        "packages",
+					Type:        "string",
+					Description: "the space separated packages to test, ./... when empty",
+				},
+				{
+					Name:        "tags",
+					Type:        "string",
+					Description: "the build tags of each run separated by semicolons, e.g. ;integration runs the tests without tags and then with the integration tag",
+				},
+				{
+					Name:        "run",
+					Type:        "string",
+					Description: "only run the tests that match the regular expression",
+				},
+			},
+			RequiredArguments: []string{"workingDir"},
+		}
+	},
+	// FormatCode formats a file within the safeDir with goimports, prettier, or black depending on its extension,
+	// see FormatCode, and returns a diff of the changes.
+	FormatCode: func(safeDir string) Tool {
+		return Tool{
+			Name:            "format-code",
+			Description:     "formats the source code of a file and returns a diff of the changes",
+			ContextFunction: formatCode(safeDir),
+			Arguments: []ToolArguments{
+				{
+					Name:        "dir",
+					Type:        "string",
+					Description: "the directory of the file",
+				},
+				{
+					Name:        "name",
+					Type:        "string",
+					Description: "the name of the file without the directory",
+				},
+				{
+					Name:        "check",
+					Type:        "boolean",
+					Description: "only return the diff without saving the formatted file",
+				},
+			},
+			RequiredArguments: []string{"dir", "name"},
+		}
+	},
+	// AnalyzeCode runs the Linters on a working directory within safeSrc and returns their findings grouped
+	// by severity, at most MaxFindings of them.
+	AnalyzeCode: func(safeSrc string) Tool {
+		return Tool{
+			Name:            "analyze-code",
+			Description:     "runs linters on a project and returns their findings grouped by severity",
+			ContextFunction: analyzeCode(safeSrc),
+			Arguments: []ToolArguments{
+				{
+					Name:        "workingDir",
+					Type:        "string",
+					Description: "the working directory that contains the source code",
+				},
+				{
+					Name:        "linters",
+					Type:        "string",
+					Description: "comma separated linters to run instead of the ones for the project, e.g. golangci-lint,eslint",
+				},
+			},
+			RequiredArguments: []string{"workingDir"},
+		}
+	},
+	// ScanVulns runs govulncheck and npm audit on a working directory within safeSrc and returns the vulnerable
+	// dependencies with the versions that fix them, see ScanVulnerabilities.
+	ScanVulns: func(safeSrc string) Tool {
+		return Tool{
+			Name:            "scan-vulnerabilities",
+			Description:     "finds the vulnerable dependencies of a project and the versions that fix them",
+			ContextFunction: scanVulnerabilities(safeSrc),
+			Latency:         LatencySlow,
+			Arguments: []ToolArguments{
+				{
+					Name:        "workingDir",
+					Type:        "string",
+					Description: "the working directory that contains the go.mod or package.json file",
+				},
+			},
+			RequiredArguments: []string{"workingDir"},
+		}
+	},
+	// GenerateSBOM stores a CycloneDX SBOM of a working directory within safeSrc in the blob store, and returns
+	// a summary of the licenses of its dependencies, see Components.
+	GenerateSBOM: func(safeSrc string) Tool {
+		return Tool{
+			Name:            "generate-sbom",
+			Description:     "generates a software bill of materials of a project and summarizes the licenses of its dependencies",
+			ContextFunction: generateSBOM(safeSrc),
+			Arguments: []ToolArguments{
+				{
+					Name:        "workingDir",
+					Type:        "string",
+					Description: "the working directory that contains the go.mod or package-lock.json file",
+				},
+			},
+			RequiredArguments: []string{"workingDir"},
+		}
+	},
+	// RepoMap maps a directory within the safeDir: its files with their size, TODO count, and the exported
+	// symbols of go files, grouped by directory. Meant as the first call of a coding assistant.
+	RepoMap: func(safeDir string) Tool {
+		return Tool{
+			Name:            "repo-map",
+			Description:     "summarizes the files, packages, and exported symbols of a repository, cheaper than reading the files",
+			ContextFunction: repoMap(safeDir),
+			Arguments: []ToolArguments{
+				{
+					Name:        "dir",
+					Type:        "string",
+					Description: "the directory of the repository",
+				},
+			},
+		}
+	},
+	// FindSymbol finds the definitions of an identifier in a go module within the safeSrc, and the references to
+	// them, with type information.
+	FindSymbol: func(safeSrc string) Tool {
+		return Tool{
+			Name:            "find-symbol",
+			Description:     "finds where a go identifier is defined and referenced in a go module, with file and line",
+			ContextFunction: findSymbol(safeSrc),
+			Arguments: []ToolArguments{
+				{
+					Name:        "workingDir",
+					Type:        "string",
+					Description: "the working directory that contains the go.mod file",
+				},
+				{
+					Name:        "name",
+					Type:        "string",
+					Description: "the identifier, e.g. Walk, or a method or field with its type, e.g. Ignore.Match",
+				},
+			},
+			RequiredArguments: []string{"workingDir", "name"},
+		}
+	},
+	// EditGo edits the go code of a module within the safeSrc with the syntax tree rather than text: it renames an
+	// identifier with its references, adds a field to a struct, or inserts functions. Edits that leave new type
+	// errors are refused.
+	EditGo: func(safeSrc string) Tool {
+		return Tool{
+			Name:            "edit-go",
+			Description:     "renames a go identifier everywhere, adds a struct field, or inserts functions, and returns the diff; edits that don't type check are refused",
+			ContextFunction: editGo(safeSrc),
+			Arguments: []ToolArguments{
+				{
+					Name:        "workingDir",
+					Type:        "string",
+					Description: "the working directory that contains the go.mod file",
+				},
+				{
+					Name:        "op",
+					Type:        "string",
+					Description: "rename, add-field, or insert-func",
+				},
+				{
+					Name:        "file",
+					Type:        "string",
+					Description: "the go file to edit, relative to the working directory, for add-field and insert-func",
+				},
+				{
+					Name:        "name",
+					Type:        "string",
+					Description: "the identifier to rename, e.g. Walk or Ignore.Match, or the struct type for add-field",
+				},
+				{
+					Name:        "newName",
+					Type:        "string",
+					Description: "the new name of the identifier for rename",
+				},
+				{
+					Name:        "code",
+					Type:        "string",
+					Description: "the field declaration for add-field, or the functions for insert-func",
+				},
+				{
+					Name:        "after",
+					Type:        "string",
+					Description: "the declaration to insert the functions after for insert-func, at the end of the file when empty",
+				},
+				{
+					Name:        "check",
+					Type:        "boolean",
+					Description: "only return the diff without writing the files",
+				},
+			},
+			RequiredArguments: []string{"workingDir", "op"},
+		}
+	},
+	// Scaffold generates a new assistant or extension project in a directory within the safeDir, see Scaffold.
+	Scaffold: func(safeDir string) Tool {
+		return Tool{
+			Name:            "scaffold-project",
+			Description:     "generates a ready to build jarbles assistant or extension project with an example tool or action and a test",
+			ContextFunction: scaffoldProject(safeDir),
+			Arguments: []ToolArguments{
+				{
+					Name:        "kind",
+					Type:        "string",
+					Description: "the kind of project",
+					Enum:        []string{ScaffoldAssistant, ScaffoldExtension},
+				},
+				{
+					Name:        "name",
+					Type:        "string",
+					Description: "the name of the assistant or extension",
+				},
+				{
+					Name:        "dir",
+					Type:        "string",
+					Description: "the directory of the project, created when it doesn't exist",
+				},
+			},
+			RequiredArguments: []string{"kind", "name", "dir"},
+		}
+	},
+	// GetHTML fetches the HTML content of a URL.
+	// Pass the tool to Untrusted to sanitize the pages it returns.
+	GetHTML: func() Tool {
+		return Tool{
+			Name:            "get-html",
+			Description:     "fetches the HTML content of a URL",
+			ContextFunction: getHTML(),
+			Arguments: []ToolArguments{
+				{
+					Name:        "url",
+					Type:        "string",
+					Description: "the URL to fetch",
+				},
+				{
+					Name:        "markdown",
+					Type:        "boolean",
+					Description: "converts the HTML to markdown, which is shorter and easier to read",
+				},
+			},
+			RequiredArguments: []string{"url"},
+		}
+	},
+	// HTTPGet fetches a URL of an allowed host and returns its body as text, cut at options.MaxSize.
+	HTTPGet: func(options HTTPOptions) Tool {
+		return Tool{
+			Name:            "http-get",
+			Description:     "fetches a URL and returns the text of the response",
+			ContextFunction: httpGet(options),
+			Arguments: []ToolArguments{
+				{
+					Name:        "url",
+					Type:        "string",
+					Description: "the URL to fetch, allowed hosts: " + strings.Join(options.AllowHosts, ", "),
+				},
+				{
+					Name:        "markdown",
+					Type:        "boolean",
+					Description: "converts an HTML response to markdown, which is shorter and easier to read",
+				},
+			},
+			RequiredArguments: []string{"url"},
+		}
+	},
+	// HTTPRequest sends a request with any of options.Methods to an allowed host and returns the status, headers,
+	// and body of the response as JSON, see HTTPResponse. Credentials are read from the config, so the model
+	// never sees them, and are only sent to options.AuthHosts.
+	HTTPRequest: func(options HTTPRequestOptions) Tool {
+		methods := options.Methods
+		if len(methods) == 0 {
+			methods = defaultHTTPMethods
+		}
+		return Tool{
+			Name:            "http-request",
+			Description:     "sends an HTTP request, e.g. to an API, and returns the status, headers, and body of the response",
+			ContextFunction: httpRequest(options),
 			Arguments: []ToolArguments{
 				{
-					Name:        "src",
+					Name:        "method",
 					Type:        "string",
-					Description: "the path of the source file",
+					Description: "the method, one of " + strings.Join(methods, ", ") + ", GET when empty",
+					Enum:        methods,
 				},
 				{
-					Name:        "dest",
+					Name:        "url",
 					Type:        "string",
-					Description: "the path of the destination file",
+					Description: "the URL, allowed hosts: " + strings.Join(options.AllowHosts, ", "),
+				},
+				{
+					Name:        "headers",
+					Type:        "object",
+					Description: "the headers of the request by name, e.g. {\"Accept\": \"application/json\"}",
+				},
+				{
+					Name:        "body",
+					Type:        "string",
+					Description: "the body of the request, sent as JSON when it's valid JSON and no Content-Type is given",
 				},
 			},
-			RequiredArguments: []string{"src", "dest"},
+			RequiredArguments: []string{"url"},
 		}
 	},
-	ListDir: func(safeDir string) Tool {
+	// DownloadFile downloads a file from an allowed host into the safeDir, checking its sha256 checksum when
+	// one is given. An interrupted download is resumed by the next call with the same checksum.
+	DownloadFile: func(safeDir string, options DownloadOptions) Tool {
 		return Tool{
-			Name:        "list-directories",
-			Description: "lists the directories in a directory",
-			Function:    listDir(safeDir),
+			Name:            "download-file",
+			Description:     "downloads a file from a URL",
+			ContextFunction: downloadFile(safeDir, options),
+			Arguments: []ToolArguments{
+				{
+					Name:        "url",
+					Type:        "string",
+					Description: "the URL of the file",
+				},
+				{
+					Name:        "name",
+					Type:        "string",
+					Description: "the name to save the file as, the last element of the URL path when empty",
+				},
+				{
+					Name:        "sha256",
+					Type:        "string",
+					Description: "the expected sha256 checksum of the file in hex",
+				},
+			},
+			RequiredArguments: []string{"url"},
 		}
 	},
-	// Compile compiles and builds a binary from go source code.
-	// The go and goimports binaries must be in the PATH.
-	// The entrypoint must be main.go.
-	// Requires a go.mod file.
-	Compile: func(safeSrc, safeDest string) Tool {
+	// FXRate looks up the exchange rate between two currencies.
+	// Wrap the provider with NewCachedQuoteProvider to cache results and respect rate limits.
+	FXRate: func(provider QuoteProvider) Tool {
 		return Tool{
-			Name:        "compile",
-			Description: "compiles and builds a binary from go source code",
-			Function:    compile(safeSrc, safeDest),
+			Name:            "fx-rate",
+			Description:     "gets the exchange rate between two currencies",
+			ContextFunction: fxRate(provider),
 			Arguments: []ToolArguments{
 				{
-					Name:        "workingDir",
+					Name:        "base",
 					Type:        "string",
-					Description: "the working directory that contains the source code",
+					Description: "the ISO 4217 code of the currency to convert from, e.g. USD",
 				},
 				{
-					Name:        "outputDir",
+					Name:        "quote",
 					Type:        "string",
-					Description: "the output directory of the binary",
+					Description: "the ISO 4217 code of the currency to convert to, e.g. EUR",
 				},
+			},
+			RequiredArguments: []string{"base", "quote"},
+		}
+	},
+	// StockQuote looks up the latest price of an equity.
+	// Wrap the provider with NewCachedQuoteProvider to cache results and respect rate limits.
+	StockQuote: func(provider QuoteProvider) Tool {
+		return Tool{
+			Name:            "stock-quote",
+			Description:     "gets the latest price of a stock",
+			ContextFunction: stockQuote(provider),
+			Arguments: []ToolArguments{
 				{
-					Name:        "outputName",
+					Name:        "symbol",
 					Type:        "string",
-					Description: "the filename of the output binary without the directory",
+					Description: "the ticker symbol of the stock, e.g. AAPL",
 				},
 			},
-			RequiredArguments: []string{"workingDir", "outputDir", "outputName"},
+			RequiredArguments: []string{"symbol"},
 		}
 	},
-	// Compile compiles and builds a binary from go source code.
-	// The go and goimports binaries must be in the PATH.
-	// The entrypoint must be main.go.
-	// Requires a go.mod file.
-	BuildExtension: func(safeSrc string) Tool {
+	// RunScript runs a starlark script stored in the safeDir.
+	// Scripts can read the input from the payload global, use the json and math modules,
+	// and return output by printing or by assigning the result global.
+	RunScript: func(safeDir string) Tool {
 		return Tool{
-			Name:        "build-extension",
-			Description: "compiles and builds a jarbles extension from go source code",
-			Function:    buildExtension(safeSrc),
+			Name:            "run-script",
+			Description:     "runs a starlark script",
+			ContextFunction: runScript(safeDir),
 			Arguments: []ToolArguments{
 				{
-					Name:        "workingDir",
+					Name:        "name",
 					Type:        "string",
-					Description: "the working directory that contains the source code",
+					Description: "the filename of the script",
 				},
 				{
-					Name:        "outputName",
+					Name:        "input",
 					Type:        "string",
-					Description: "the filename of the output binary without the directory",
+					Description: "the input passed to the script as the payload variable",
 				},
 			},
-			RequiredArguments: []string{"workingDir", "outputName"},
+			RequiredArguments: []string{"name"},
 		}
 	},
-	// GetHTML fetches the HTML content of a URL.
-	GetHTML: func() Tool {
+	// Backup writes an encrypted backup of the assistant data into the safeDir.
+	// The passphrase is read from JARBLES_BACKUP_PASSPHRASE so that it never passes through the model.
+	Backup: func(safeDir string) Tool {
 		return Tool{
-			Name:        "get-html",
-			Description: "fetches the HTML content of a URL",
-			Function:    getHTML(),
+			Name:            "backup",
+			Description:     "creates an encrypted backup of the config, state, notes, and secrets",
+			ContextFunction: backupTool(safeDir, false),
 			Arguments: []ToolArguments{
 				{
-					Name:        "url",
+					Name:        "name",
 					Type:        "string",
-					Description: "the URL to fetch",
+					Description: "the filename of the backup",
 				},
 			},
-			RequiredArguments: []string{"url"},
+			RequiredArguments: []string{"name"},
+		}
+	},
+	// Restore restores an encrypted backup from the safeDir.
+	// The passphrase is read from JARBLES_BACKUP_PASSPHRASE so that it never passes through the model.
+	Restore: func(safeDir string) Tool {
+		return Tool{
+			Name:            "restore",
+			Description:     "restores the config, state, notes, and secrets from an encrypted backup",
+			ContextFunction: backupTool(safeDir, true),
+			Arguments: []ToolArguments{
+				{
+					Name:        "name",
+					Type:        "string",
+					Description: "the filename of the backup",
+				},
+			},
+			RequiredArguments: []string{"name"},
 		}
 	},
 }
 
 // safePath ensures that the file location specified by path is within the safeDir
 func safePath(safeDir, baseDir, name string) (string, error) {
-	path := filepath.Join(safeDir, strings.Replace(baseDir, safeDir, "", 1), strings.Replace(name, baseDir, "", 1))
+	path := filepath.Join(safeDir, removePathOnce(baseDir, safeDir), removePathOnce(name, baseDir))
 	absPath, err := filepath.Abs(path)
 	if err != nil {
 		LogError("error while getting absolute path", "path", path, "error", err.Error())
 		return "", fmt.Errorf("error while getting absolute path at %s: %w", path, err)
 	}
 
-	if !strings.HasPrefix(absPath, safeDir) {
+	absSafeDir, err := filepath.Abs(safeDir)
+	if err != nil {
+		LogError("error while getting absolute path", "safeDir", safeDir, "error", err.Error())
+		return "", fmt.Errorf("error while getting absolute path at %s: %w", safeDir, err)
+	}
+
+	if !withinDir(absSafeDir, absPath) {
 		LogError("path is not within the safe directory", "safeDir", safeDir, "path", path)
-		return "", fmt.Errorf("path is not within the safe directory: %s", absPath)
+		return "", ModelError("path is not within the safe directory: "+absPath, "use a path relative to the root directory, without ..")
 	}
 
 	return absPath, nil
@@ -185,16 +888,22 @@ func safePath(safeDir, baseDir, name string) (string, error) {
 
 // safeDir ensures that the directory location specified by dir is within the safeDir
 func safeDir(safeDir, dir string) (string, error) {
-	path := filepath.Join(safeDir, strings.Replace(dir, safeDir, "", 1))
+	path := filepath.Join(safeDir, removePathOnce(dir, safeDir))
 	absPath, err := filepath.Abs(path)
 	if err != nil {
 		LogError("error while getting absolute path", "dir", dir, "error", err.Error())
 		return "", fmt.Errorf("error while getting absolute path at %s: %w", dir, err)
 	}
 
-	if !strings.HasPrefix(absPath, safeDir) {
+	absSafeDir, err := filepath.Abs(safeDir)
+	if err != nil {
+		LogError("error while getting absolute path", "safeDir", safeDir, "error", err.Error())
+		return "", fmt.Errorf("error while getting absolute path at %s: %w", safeDir, err)
+	}
+
+	if !withinDir(absSafeDir, absPath) {
 		LogError("path is not within the safe directory", "safeDir", safeDir, "dir", dir)
-		return "", fmt.Errorf("path is not within the safe directory: %s", absPath)
+		return "", ModelError("path is not within the safe directory: "+absPath, "use a path relative to the root directory, without ..")
 	}
 
 	return absPath, nil
@@ -209,7 +918,7 @@ func readFile(safeDir string) ToolFunction {
 		err := json.Unmarshal([]byte(payload), &request)
 		if err != nil {
 			LogError("error while unmarshaling payload", "error", err.Error())
-			return "", fmt.Errorf("error while unmarshaling payload: %s", err)
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
 		}
 
 		LogDebug("read-file", "dir", request.Dir, "name", request.Name)
@@ -220,10 +929,15 @@ func readFile(safeDir string) ToolFunction {
 			return "", fmt.Errorf("error while getting safe path: %w", err)
 		}
 
+		// documents are read as their text, the raw bytes mean nothing to a model
+		if t, err := DetectMIME(filename); err == nil && t == MIMEDocx {
+			return DocxToText(filename)
+		}
+
 		data, err := os.ReadFile(filename)
 		if err != nil {
 			LogError("error while reading file", "filename", filename, "error", err.Error())
-			return "", fmt.Errorf("error while reading file at %s: %s", filename, err)
+			return "", fmt.Errorf("error while reading file at %s: %w", filename, err)
 		}
 
 		LogDebug("file read successfully", "filename", filename)
@@ -240,7 +954,7 @@ func copyFile(safeSrc, safeDest string) ToolFunction {
 		err := json.Unmarshal([]byte(payload), &request)
 		if err != nil {
 			LogError("error while unmarshaling payload", "error", err.Error())
-			return "", fmt.Errorf("error while unmarshaling payload: %s", err)
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
 		}
 
 		LogDebug("copy-file", "src", request.Src, "dest", request.Dest)
@@ -251,13 +965,22 @@ func copyFile(safeSrc, safeDest string) ToolFunction {
 			return "", fmt.Errorf("error while getting safe src path: %w", err)
 		}
 
+		ignore, err := loadIgnoreFor(safeSrc, filepath.Dir(src))
+		if err != nil {
+			return "", err
+		}
+		if ignore.Match(filepath.Base(src), false) {
+			LogError("source file is ignored", "src", src)
+			return "", fmt.Errorf("source file is ignored: %s", request.Src)
+		}
+
 		dest, err := safePath(safeDest, "", request.Dest)
 		if err != nil {
 			LogError("error while getting safe dest path", "error", err.Error())
 			return "", fmt.Errorf("error while getting safe dest path: %w", err)
 		}
 
-		err = os.MkdirAll(filepath.Dir(dest), os.ModePerm)
+		err = os.MkdirAll(filepath.Dir(dest), workspaceDirPerm)
 		if err != nil {
 			LogError("error while making the destination directory ", "dir", filepath.Dir(dest), "error", err.Error())
 			return "", fmt.Errorf("error while making the destination directory at %s: %s", filepath.Dir(dest), err)
@@ -309,7 +1032,7 @@ func saveFile(safeDir string) ToolFunction {
 		err := json.Unmarshal([]byte(payload), &request)
 		if err != nil {
 			LogError("error while unmarshaling payload", "error", err.Error())
-			return "", fmt.Errorf("error while unmarshaling payload: %s", err)
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
 		}
 
 		LogDebug("save-file", "dir", request.Dir, "name", request.Name)
@@ -321,13 +1044,13 @@ func saveFile(safeDir string) ToolFunction {
 		}
 
 		dirname := filepath.Dir(filename)
-		err = os.MkdirAll(dirname, os.ModePerm)
+		err = os.MkdirAll(dirname, workspaceDirPerm)
 		if err != nil {
 			LogError("error while making the destination directory ", "dir", dirname, "error", err.Error())
 			return "", fmt.Errorf("error while making the destination directory at %s: %s", dirname, err)
 		}
 
-		err = os.WriteFile(filename, []byte(request.Content), 0644)
+		err = os.WriteFile(filename, []byte(request.Content), workspaceFilePerm)
 		if err != nil {
 			LogError("error while writing file", "filename", filename, "error", err.Error())
 			return "", fmt.Errorf("error while writing file at %s: %s", filename, err)
@@ -338,227 +1061,461 @@ func saveFile(safeDir string) ToolFunction {
 	}
 }
 
-func listDir(safeDir string) ToolFunction {
-	return func(_ string) (string, error) {
-		var dirs []string
-		err := filepath.WalkDir(safeDir, func(path string, d os.DirEntry, err error) error {
-			if err != nil {
-				return err
+func appendFile(safeDir string) ToolFunction {
+	return func(payload string) (string, error) {
+		var request struct {
+			Dir     string `json:"dir"`
+			Name    string `json:"name"`
+			Content string `json:"content"`
+		}
+		err := json.Unmarshal([]byte(payload), &request)
+		if err != nil {
+			LogError("error while unmarshaling payload", "error", err.Error())
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+		}
+
+		LogDebug("append-file", "dir", request.Dir, "name", request.Name)
+
+		filename, err := safePath(safeDir, request.Dir, request.Name)
+		if err != nil {
+			LogError("error while getting safe path", "error", err.Error())
+			return "", fmt.Errorf("error while getting safe path: %w", err)
+		}
+
+		dirname := filepath.Dir(filename)
+		err = os.MkdirAll(dirname, workspaceDirPerm)
+		if err != nil {
+			LogError("error while making the destination directory ", "dir", dirname, "error", err.Error())
+			return "", fmt.Errorf("error while making the destination directory at %s: %s", dirname, err)
+		}
+
+		f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, workspaceFilePerm)
+		if err != nil {
+			LogError("error while opening file", "filename", filename, "error", err.Error())
+			return "", fmt.Errorf("error while opening file at %s: %s", filename, err)
+		}
+		_, err = f.WriteString(request.Content)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			LogError("error while appending to file", "filename", filename, "error", err.Error())
+			return "", fmt.Errorf("error while appending to file at %s: %s", filename, err)
+		}
+
+		LogDebug("file appended successfully", "filename", filename)
+		return "file appended successfully", nil
+	}
+}
+
+func replaceInFile(safeDir string) ToolFunction {
+	return func(payload string) (string, error) {
+		var request struct {
+			Dir     string `json:"dir"`
+			Name    string `json:"name"`
+			Search  string `json:"search"`
+			Replace string `json:"replace"`
+			Regexp  bool   `json:"regexp"`
+			Count   int    `json:"count"`
+		}
+		err := json.Unmarshal([]byte(payload), &request)
+		if err != nil {
+			LogError("error while unmarshaling payload", "error", err.Error())
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+		}
+		if request.Search == "" {
+			return "", ModelError("the search is empty", "pass the text to replace in search")
+		}
+
+		LogDebug("replace-in-file", "dir", request.Dir, "name", request.Name)
+
+		filename, err := safePath(safeDir, request.Dir, request.Name)
+		if err != nil {
+			LogError("error while getting safe path", "error", err.Error())
+			return "", fmt.Errorf("error while getting safe path: %w", err)
+		}
+
+		info, err := os.Stat(filename)
+		if err != nil {
+			LogError("error while reading file", "filename", filename, "error", err.Error())
+			return "", fmt.Errorf("error while reading file at %s: %w", filename, err)
+		}
+
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			LogError("error while reading file", "filename", filename, "error", err.Error())
+			return "", fmt.Errorf("error while reading file at %s: %w", filename, err)
+		}
+
+		pattern := regexp.QuoteMeta(request.Search)
+		if request.Regexp {
+			pattern = request.Search
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			LogError("error while parsing search", "search", request.Search, "error", err.Error())
+			return "", withHint(fmt.Errorf("error while parsing search %s: %w", request.Search, err), "escape the special characters of the regular expression, or set regexp to false")
+		}
+
+		n := -1
+		if request.Count > 0 {
+			n = request.Count
+		}
+		matches := re.FindAllSubmatchIndex(src, n)
+		if len(matches) == 0 {
+			return "no matches found, the file is unchanged", nil
+		}
+
+		var replaced []byte
+		last := 0
+		for _, m := range matches {
+			replaced = append(replaced, src[last:m[0]]...)
+			if request.Regexp {
+				replaced = re.Expand(replaced, []byte(request.Replace), src, m)
+			} else {
+				replaced = append(replaced, request.Replace...)
 			}
+			last = m[1]
+		}
+		replaced = append(replaced, src[last:]...)
+
+		err = os.WriteFile(filename, replaced, info.Mode().Perm())
+		if err != nil {
+			LogError("error while writing file", "filename", filename, "error", err.Error())
+			return "", fmt.Errorf("error while writing file at %s: %s", filename, err)
+		}
+
+		LogDebug("file replaced successfully", "filename", filename, "replacements", len(matches))
+		diff := UnifiedDiff(request.Name, request.Name, string(src), string(replaced))
+		return fmt.Sprintf("replacements: %d\n\n%s", len(matches), diff), nil
+	}
+}
+
+func diffFiles(safeDir string) ToolFunction {
+	return func(payload string) (string, error) {
+		var request struct {
+			Dir       string  `json:"dir"`
+			Name      string  `json:"name"`
+			OtherName string  `json:"otherName"`
+			Content   *string `json:"content"`
+		}
+		err := json.Unmarshal([]byte(payload), &request)
+		if err != nil {
+			LogError("error while unmarshaling payload", "error", err.Error())
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+		}
+		if (request.OtherName == "") == (request.Content == nil) {
+			return "", ModelError("either otherName or content is required", "pass otherName to compare two files, or content to compare a file with it")
+		}
 
-			if d.IsDir() {
-				// # ignore .git directories
-				if d.Name() == ".git" {
-					return filepath.SkipDir
-				}
-
-				abspath, err := filepath.Abs(path)
-				if err != nil {
-					LogError("error while getting absolute path", "path", path, "error", err.Error())
-					return fmt.Errorf("error while getting absolute path at %s: %w", path, err)
-				}
-				dirs = append(dirs, abspath)
+		read := func(name string) (string, error) {
+			filename, err := safePath(safeDir, request.Dir, name)
+			if err != nil {
+				LogError("error while getting safe path", "error", err.Error())
+				return "", fmt.Errorf("error while getting safe path: %w", err)
 			}
-			return nil
-		})
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				LogError("error while reading file", "filename", filename, "error", err.Error())
+				return "", fmt.Errorf("error while reading file at %s: %w", filename, err)
+			}
+			return string(data), nil
+		}
+
+		old, err := read(request.Name)
 		if err != nil {
-			LogError("error while walking directory", "path", safeDir, "error", err.Error())
-			return "", fmt.Errorf("error while walking directory at %s: %s", safeDir, err)
+			return "", err
 		}
-		return strings.Join(dirs, "\n"), nil
+		newName := request.Name
+		var content string
+		if request.Content != nil {
+			content = *request.Content
+		} else {
+			newName = request.OtherName
+			content, err = read(request.OtherName)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		diff := UnifiedDiff(request.Name, newName, old, content)
+		if diff == "" {
+			return "the files are the same", nil
+		}
+		return diff, nil
 	}
 }
 
-func compile(safeSrc, safeDest string) ToolFunction {
+func deleteFile(safeDir string) ToolFunction {
 	return func(payload string) (string, error) {
 		var request struct {
-			WorkingDir string `json:"workingDir"`
-			OutputDir  string `json:"outputDir"`
-			OutputName string `json:"outputName"`
+			Dir       string `json:"dir"`
+			Name      string `json:"name"`
+			Recursive bool   `json:"recursive"`
 		}
 		err := json.Unmarshal([]byte(payload), &request)
 		if err != nil {
 			LogError("error while unmarshaling payload", "error", err.Error())
-			return "", fmt.Errorf("error while unmarshaling payload: %s", err)
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
 		}
 
-		workingDir, err := safeDir(safeSrc, request.WorkingDir)
+		LogDebug("delete-file", "dir", request.Dir, "name", request.Name, "recursive", request.Recursive)
+
+		filename, err := safePath(safeDir, request.Dir, request.Name)
 		if err != nil {
-			LogError("error while getting safe working directory", "error", err.Error())
-			return "", fmt.Errorf("error while getting safe working directory: %w", err)
+			LogError("error while getting safe path", "error", err.Error())
+			return "", fmt.Errorf("error while getting safe path: %w", err)
 		}
 
-		outputDir, err := safeDir(safeDest, request.OutputDir)
+		absSafeDir, err := filepath.Abs(safeDir)
 		if err != nil {
-			LogError("error while getting safe output directory", "error", err.Error())
-			return "", fmt.Errorf("error while getting safe output directory: %w", err)
+			LogError("error while getting absolute path", "safeDir", safeDir, "error", err.Error())
+			return "", fmt.Errorf("error while getting absolute path at %s: %w", safeDir, err)
+		}
+		if sameDir(absSafeDir, filename) {
+			LogError("refusing to delete the safe directory", "safeDir", safeDir)
+			return "", fmt.Errorf("refusing to delete the safe directory: %s", filename)
 		}
 
-		LogDebug("compile", "workingDir", workingDir, "outputDir", outputDir, "outputName", request.OutputName)
+		// Lstat, so that a symlink is deleted rather than what it points to
+		info, err := os.Lstat(filename)
+		if err != nil {
+			LogError("error while deleting file", "filename", filename, "error", err.Error())
+			return "", fmt.Errorf("error while deleting file at %s: %s", filename, err)
+		}
+
+		if info.IsDir() && request.Recursive {
+			err = os.RemoveAll(filename)
+		} else {
+			err = os.Remove(filename)
+		}
+		if err != nil {
+			LogError("error while deleting file", "filename", filename, "error", err.Error())
+			if info.IsDir() && !request.Recursive {
+				return "", fmt.Errorf("error while deleting directory at %s: %s, set recursive to delete its content", filename, err)
+			}
+			return "", fmt.Errorf("error while deleting file at %s: %s", filename, err)
+		}
+
+		LogDebug("file deleted successfully", "filename", filename)
+		if info.IsDir() {
+			return "directory deleted successfully", nil
+		}
+		return "file deleted successfully", nil
+	}
+}
 
-		err = modTidyCommand(workingDir)
+func listDir(safeDir string) ToolContextFunction {
+	return func(ctx context.Context, _ string) (string, error) {
+		root, err := filepath.Abs(safeDir)
 		if err != nil {
-			return "", fmt.Errorf("error while downloading dependencies: %s", err)
+			LoggerFrom(ctx).Error("error while getting absolute path", "path", safeDir, "error", err.Error())
+			return "", fmt.Errorf("error while getting absolute path at %s: %w", safeDir, err)
 		}
 
-		err = goimportsCommand(workingDir)
+		// skip .git, node_modules, and the directories in the ignore files
+		ignore, err := LoadIgnore(root)
 		if err != nil {
-			return "", fmt.Errorf("error while organizing imports: %s", err)
+			return "", err
 		}
 
-		err = buildCommand(workingDir, outputDir, request.OutputName)
+		entries, truncated, err := Walk(ctx, root, WalkOptions{
+			MaxEntries: WalkMaxEntries,
+			Hidden:     true,
+			Ignore:     ignore,
+			DirsOnly:   true,
+		})
 		if err != nil {
-			return "", fmt.Errorf("error while building: %s", err)
+			return "", err
 		}
 
-		return "compile completed successfully", nil
+		dirs := []string{root}
+		for _, entry := range entries {
+			dirs = append(dirs, filepath.Join(root, filepath.FromSlash(entry.Path)))
+		}
+		if truncated {
+			dirs = append(dirs, fmt.Sprintf("(stopped after %d directories)", len(entries)))
+		}
+		return strings.Join(dirs, "\n"), nil
 	}
 }
 
-func buildExtension(safeSrc string) ToolFunction {
-	return func(payload string) (string, error) {
+func compile(safeSrc, safeDest string) ToolContextFunction {
+	return func(ctx context.Context, payload string) (string, error) {
 		var request struct {
 			WorkingDir string `json:"workingDir"`
+			OutputDir  string `json:"outputDir"`
 			OutputName string `json:"outputName"`
 		}
 		err := json.Unmarshal([]byte(payload), &request)
 		if err != nil {
-			LogError("error while unmarshaling payload", "error", err.Error())
-			return "", fmt.Errorf("error while unmarshaling payload: %s", err)
+			LoggerFrom(ctx).Error("error while unmarshaling payload", "error", err.Error())
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
 		}
 
 		workingDir, err := safeDir(safeSrc, request.WorkingDir)
 		if err != nil {
-			LogError("error while getting safe working directory", "error", err.Error())
+			LoggerFrom(ctx).Error("error while getting safe working directory", "error", err.Error())
 			return "", fmt.Errorf("error while getting safe working directory: %w", err)
 		}
 
-		LogDebug("compile", "workingDir", workingDir, "outputName", request.OutputName)
+		outputDir, err := safeDir(safeDest, request.OutputDir)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while getting safe output directory", "error", err.Error())
+			return "", fmt.Errorf("error while getting safe output directory: %w", err)
+		}
+
+		LoggerFrom(ctx).Debug("compile", "workingDir", workingDir, "outputDir", outputDir, "outputName", request.OutputName)
 
-		err = modTidyCommand(workingDir)
+		err = goBuilder{}.Build(ctx, BuildRequest{WorkingDir: workingDir, OutputDir: outputDir, OutputName: request.OutputName})
+		if err != nil {
+			return "", buildFailure("building", err)
+		}
+
+		return "compile completed successfully", nil
+	}
+}
+
+func buildExtension(safeSrc string) ToolContextFunction {
+	return func(ctx context.Context, payload string) (string, error) {
+		var request struct {
+			WorkingDir string `json:"workingDir"`
+			OutputName string `json:"outputName"`
+		}
+		err := json.Unmarshal([]byte(payload), &request)
 		if err != nil {
-			return "", fmt.Errorf("error while downloading dependencies: %s", err)
+			LoggerFrom(ctx).Error("error while unmarshaling payload", "error", err.Error())
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
 		}
 
-		err = goimportsCommand(workingDir)
+		workingDir, err := safeDir(safeSrc, request.WorkingDir)
 		if err != nil {
-			return "", fmt.Errorf("error while organizing imports: %s", err)
+			LoggerFrom(ctx).Error("error while getting safe working directory", "error", err.Error())
+			return "", fmt.Errorf("error while getting safe working directory: %w", err)
 		}
 
-		outputDir := userDir("extensions")
-		err = buildCommand(workingDir, outputDir, request.OutputName)
+		LoggerFrom(ctx).Debug("compile", "workingDir", workingDir, "outputName", request.OutputName)
+
+		err = goBuilder{}.Build(ctx, BuildRequest{WorkingDir: workingDir, OutputDir: ExtensionsDir(), OutputName: request.OutputName})
 		if err != nil {
-			return "", fmt.Errorf("error while building: %s", err)
+			return "", buildFailure("building", err)
 		}
 
 		return "compile completed successfully", nil
 	}
 }
 
-func modTidyCommand(workingDir string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+func modTidyCommand(ctx context.Context, workingDir string) error {
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
 
-	LogDebug("downloading dependencies", "workingDir", workingDir)
+	LoggerFrom(ctx).Debug("downloading dependencies", "workingDir", workingDir)
+
+	goPath, err := GoPath()
+	if err != nil {
+		return err
+	}
 
-	cmd := exec.CommandContext(ctx, "go", "mod", "tidy")
+	cmd := toolchainCommand(ctx, goPath, "mod", "tidy")
 	cmd.Dir = workingDir
 
 	return runCommand(cmd)
 }
 
-func goimportsCommand(workingDir string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+func goimportsCommand(ctx context.Context, workingDir string) error {
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
 
 	mainFile := filepath.Join(workingDir, "main.go")
-	LogDebug("organizing imports", "mainFile", mainFile, "workingDir", workingDir)
+	LoggerFrom(ctx).Debug("organizing imports", "mainFile", mainFile, "workingDir", workingDir)
+
+	goimportsPath, err := GoimportsPath()
+	if err != nil {
+		return err
+	}
 
-	cmd := exec.CommandContext(ctx, "goimports", "-w", mainFile)
+	cmd := toolchainCommand(ctx, goimportsPath, "-w", mainFile)
 	cmd.Dir = workingDir
 
-	return runCommand(cmd)
+	return buildError(runCommand(cmd), workingDir)
 }
 
-func buildCommand(workingDir, outputDir, binaryName string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+func buildCommand(ctx context.Context, workingDir, outputDir, binaryName string) error {
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
 
 	mainFile := filepath.Join(workingDir, "main.go")
 	outputFile := filepath.Join(outputDir, binaryName)
-	LogDebug("building", "workingDir", workingDir, "outputDir", outputDir, "binaryName", binaryName, "mainFile", mainFile, "outputFile", outputFile)
+	LoggerFrom(ctx).Debug("building", "workingDir", workingDir, "outputDir", outputDir, "binaryName", binaryName, "mainFile", mainFile, "outputFile", outputFile)
+
+	goPath, err := GoPath()
+	if err != nil {
+		return err
+	}
 
-	cmd := exec.CommandContext(ctx, "go", "build", "-o", outputFile, mainFile)
+	cmd := toolchainCommand(ctx, goPath, "build", "-o", outputFile, mainFile)
 	cmd.Dir = workingDir
 
-	return runCommand(cmd)
+	return buildError(runCommand(cmd), workingDir)
 }
 
+// runCommand runs the command and returns its standard error as the error when it fails. The output is
+// buffered rather than read from pipes one after the other, which would hang once the command fills the
+// pipe it isn't read from, e.g. the progress output of npm install.
 func runCommand(cmd *exec.Cmd) error {
-	LogInfo("running command", "command", cmd)
-	stdout, _ := cmd.StdoutPipe()
-	stderr, _ := cmd.StderrPipe()
-
-	err := cmd.Start()
-	if err != nil {
-		LogError("error while starting the command", "error", err.Error())
-		return fmt.Errorf("error while starting the command: %w", err)
-	}
-
-	errdata, err := io.ReadAll(stderr)
-	if err != nil {
-		LogError("error while reading standard error", "error", err.Error())
-		return fmt.Errorf("error while reading standard error: %w", err)
-	}
-
-	outdata, err := io.ReadAll(stdout)
-	if err != nil {
-		LogError("error while reading standard output", "error", err.Error())
-		return fmt.Errorf("error while reading standard output: %w", err)
-	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
 
-	err = cmd.Wait()
+	LogInfo("running command", "command", cmd)
+	err := cmd.Run()
 	if err != nil {
-		LogDebug("STDERR", "errdata", string(errdata))
-		LogDebug("STDOUT", "outdata", string(outdata))
-		LogError("error while waiting for command to finish", "error", err.Error())
-		return fmt.Errorf("%s", errdata) // return the exact error message from the command
+		LogDebug("STDERR", "errdata", stderr.String())
+		LogDebug("STDOUT", "outdata", stdout.String())
+		LogError("error while running command", "error", err.Error())
+		if stderr.Len() == 0 {
+			return fmt.Errorf("error while running command: %w", err)
+		}
+		return fmt.Errorf("%s", stderr.String()) // return the exact error message from the command
 	}
 
-	LogDebug("DATA", "outdata", string(outdata))
+	LogDebug("DATA", "outdata", stdout.String())
 	return nil
 }
 
-func getHTML() ToolFunction {
-	return func(payload string) (string, error) {
+func getHTML() ToolContextFunction {
+	return func(ctx context.Context, payload string) (string, error) {
 		rawURL, ok := PayloadGetString(payload, "url", "")
 		if !ok {
-			LogError("url parameter is missing")
+			LoggerFrom(ctx).Error("url parameter is missing")
 			return "", fmt.Errorf("url parameter is missing")
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 		defer cancel()
 
 		request, _ := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
 		request.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.3")
-		resp, err := http.DefaultClient.Do(request)
+		resp, err := HTTPClient().Do(request)
 		if err != nil {
 			return "", fmt.Errorf("error fetching URL: %v", err)
 		}
 		defer func(Body io.ReadCloser) {
 			err := Body.Close()
 			if err != nil {
-				LogError("error closing response body", "error", err)
+				LoggerFrom(ctx).Error("error closing response body", "error", err)
 			}
 		}(resp.Body)
 
 		html, err := io.ReadAll(resp.Body)
 		if err != nil {
-			LogError("error while reading response body", "error", err)
+			LoggerFrom(ctx).Error("error while reading response body", "error", err)
 			return "", fmt.Errorf("error while reading response body: %w", err)
 		}
 
+		if markdown, _ := PayloadGetBool(payload, "markdown", false); markdown {
+			return HTMLToMarkdown(string(html)), nil
+		}
 		return string(html), nil
 	}
 }
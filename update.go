@@ -0,0 +1,346 @@
+package framework
+
+import (
+	"cmp"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+var ErrNoUpdate = errors.New("no update available")
+
+// Release is the manifest that an author publishes at the release URL for each new version.
+type Release struct {
+	Version string `json:"version"`
+	Notes   string `json:"notes,omitempty"`
+	// Binaries are keyed by platform, e.g. "linux/amd64".
+	Binaries map[string]ReleaseBinary `json:"binaries"`
+}
+
+type ReleaseBinary struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+	// Signature is the base64 ed25519 signature of the version, platform, and sha256 of the binary, see
+	// SignRelease. Signing the version too keeps an older binary from being served as a newer release.
+	Signature string `json:"signature"`
+}
+
+type SelfUpdateOptions struct {
+	// ReleaseURL is where the Release manifest is published.
+	ReleaseURL string
+	// PublicKey is the base64 ed25519 key that the binaries are signed with, pinned in the binary so a
+	// compromised release URL can't push its own binaries, nor older ones as a newer version.
+	PublicKey string
+	// CurrentVersion defaults to the version of the build from its module or VCS information.
+	CurrentVersion string
+	// MaxSize is the largest binary in bytes. Defaults to 200 MiB.
+	MaxSize int64
+}
+
+func (o SelfUpdateOptions) withDefaults() SelfUpdateOptions {
+	if o.CurrentVersion == "" {
+		o.CurrentVersion = buildVersion()
+	}
+	if o.MaxSize == 0 {
+		o.MaxSize = 200 << 20
+	}
+	return o
+}
+
+// SignRelease signs a binary of a version for a platform, e.g. "linux/amd64", with the key from SigningKey,
+// for the Signature of a ReleaseBinary.
+//
+//goland:noinspection GoUnusedExportedFunction
+func SignRelease(version, platform string, binary []byte) (string, error) {
+	key, err := SigningKey()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(binary)
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, signedRelease(version, platform, hex.EncodeToString(sum[:])))), nil
+}
+
+// signedRelease is the message the signature of a release binary is of.
+func signedRelease(version, platform, binarySHA256 string) []byte {
+	return []byte("jarbles-release-v1\n" + version + "\n" + platform + "\n" + strings.ToLower(binarySHA256) + "\n")
+}
+
+// CheckUpdate fetches the release manifest and returns it when its version is newer than the current one,
+// or an error wrapping ErrNoUpdate.
+func CheckUpdate(ctx context.Context, options SelfUpdateOptions) (Release, error) {
+	options = options.withDefaults()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, options.ReleaseURL, nil)
+	if err != nil {
+		LoggerFrom(ctx).Error("error while creating release request", "error", err.Error())
+		return Release{}, fmt.Errorf("error while creating release request: %w", err)
+	}
+	resp, err := HTTPClient().Do(request)
+	if err != nil {
+		LoggerFrom(ctx).Error("error while fetching release", "url", options.ReleaseURL, "error", err.Error())
+		return Release{}, fmt.Errorf("error while fetching release: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		LoggerFrom(ctx).Error("error while fetching release", "url", options.ReleaseURL, "status", resp.Status)
+		return Release{}, fmt.Errorf("error while fetching release: %s", resp.Status)
+	}
+
+	var release Release
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&release)
+	if err != nil {
+		LoggerFrom(ctx).Error("error while decoding release", "error", err.Error())
+		return Release{}, fmt.Errorf("error while decoding release: %w", err)
+	}
+
+	if compareVersions(release.Version, options.CurrentVersion) <= 0 {
+		return release, fmt.Errorf("%w: %s is the latest version", ErrNoUpdate, options.CurrentVersion)
+	}
+	return release, nil
+}
+
+// SelfUpdate replaces the running binary with the latest release when it's newer. The binary is verified
+// against its checksum and its signature with the pinned public key, and swapped in with a rename, so the
+// installed binary is never half written. The new version runs from the next request.
+//
+//goland:noinspection GoUnusedExportedFunction
+func SelfUpdate(ctx context.Context, options SelfUpdateOptions) (Release, error) {
+	options = options.withDefaults()
+
+	public, err := base64.StdEncoding.DecodeString(options.PublicKey)
+	if err != nil || len(public) != ed25519.PublicKeySize {
+		LoggerFrom(ctx).Error("invalid update public key")
+		return Release{}, fmt.Errorf("invalid update public key")
+	}
+
+	release, err := CheckUpdate(ctx, options)
+	if err != nil {
+		return release, err
+	}
+
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+	binary, ok := release.Binaries[platform]
+	if !ok {
+		LoggerFrom(ctx).Error("release has no binary for the platform", "version", release.Version, "platform", platform)
+		return release, fmt.Errorf("release %s has no binary for %s", release.Version, platform)
+	}
+
+	data, err := fetchReleaseBinary(ctx, binary.URL, options.MaxSize)
+	if err != nil {
+		LoggerFrom(ctx).Error("error while downloading release", "url", binary.URL, "error", err.Error())
+		return release, err
+	}
+
+	sum := sha256.Sum256(data)
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), binary.SHA256) {
+		LoggerFrom(ctx).Error("release checksum mismatch", "version", release.Version)
+		return release, fmt.Errorf("checksum mismatch for release %s", release.Version)
+	}
+	signature, err := base64.StdEncoding.DecodeString(binary.Signature)
+	if err != nil || !ed25519.Verify(public, signedRelease(release.Version, platform, hex.EncodeToString(sum[:])), signature) {
+		LoggerFrom(ctx).Error("release signature mismatch", "version", release.Version)
+		return release, fmt.Errorf("signature mismatch for release %s", release.Version)
+	}
+
+	err = replaceExecutable(data)
+	if err != nil {
+		LoggerFrom(ctx).Error("error while replacing binary", "error", err.Error())
+		return release, err
+	}
+
+	LoggerFrom(ctx).Info("updated", "from", options.CurrentVersion, "to", release.Version)
+	return release, nil
+}
+
+func fetchReleaseBinary(ctx context.Context, url string, maxSize int64) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error while creating request: %w", err)
+	}
+	resp, err := HTTPClient().Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error while downloading %s: %w", url, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error while downloading %s: %s", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error while downloading %s: %w", url, err)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("%w: %s is more than %d bytes", ErrDownloadTooLarge, url, maxSize)
+	}
+	return data, nil
+}
+
+// replaceExecutable writes the new binary next to the running one and renames it over it. Windows can't
+// replace a running binary, so it's moved aside first and removed by the next update.
+func replaceExecutable(data []byte) error {
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		return fmt.Errorf("error while finding the binary: %w", err)
+	}
+
+	tmp := exe + ".new"
+	err = os.WriteFile(tmp, data, privateExecPerm)
+	if err != nil {
+		return fmt.Errorf("error while writing binary at %s: %w", tmp, err)
+	}
+
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		_ = os.Remove(old)
+		err = os.Rename(exe, old)
+		if err != nil {
+			_ = os.Remove(tmp)
+			return fmt.Errorf("error while moving binary aside: %w", err)
+		}
+	}
+
+	err = os.Rename(tmp, exe)
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("error while replacing binary at %s: %w", exe, err)
+	}
+	return nil
+}
+
+// compareVersions compares versions like v1.2.10 numerically, part by part, and like semver a pre-release
+// like v1.2.0-rc.1 is older than v1.2.0. A version that isn't a release, e.g. a commit hash, is older than
+// any release.
+func compareVersions(a, b string) int {
+	pa, preA, okA := versionParts(a)
+	pb, preB, okB := versionParts(b)
+	switch {
+	case !okA && !okB:
+		return strings.Compare(a, b)
+	case !okA:
+		return -1
+	case !okB:
+		return 1
+	}
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return comparePreReleases(preA, preB)
+}
+
+// comparePreReleases compares the pre-release suffixes of equal versions like semver: no suffix is newer,
+// and the dot-separated identifiers compare numerically when they are numbers.
+func comparePreReleases(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+
+	ia, ib := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < min(len(ia), len(ib)); i++ {
+		x, errX := strconv.Atoi(ia[i])
+		y, errY := strconv.Atoi(ib[i])
+		switch {
+		case errX == nil && errY == nil:
+			if x != y {
+				return cmp.Compare(x, y)
+			}
+		case errX == nil:
+			return -1
+		case errY == nil:
+			return 1
+		default:
+			if c := strings.Compare(ia[i], ib[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return cmp.Compare(len(ia), len(ib))
+}
+
+// versionParts returns the numbers and the pre-release suffix of a version. Build metadata after + is
+// ignored.
+func versionParts(version string) ([]int, string, bool) {
+	version = strings.TrimPrefix(version, "v")
+	version, _, _ = strings.Cut(version, "+")
+	version, pre, _ := strings.Cut(version, "-")
+	if version == "" {
+		return nil, "", false
+	}
+	var parts []int
+	for _, s := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, "", false
+		}
+		parts = append(parts, n)
+	}
+	return parts, pre, true
+}
+
+// AddCheckUpdateAction adds the check-update action, which tells whether a newer release is published and
+// installs it when the payload is {"install": true}.
+//
+//goland:noinspection GoUnusedExportedFunction
+func (e *Extension) AddCheckUpdateAction(options SelfUpdateOptions) {
+	e.AddAction(AddActionOptions{
+		ID: "check-update",
+		ContextFunction: func(ctx context.Context, payload string) (*ExtensionResponse, error) {
+			install, _ := PayloadGetBool(payload, "install", false)
+
+			var release Release
+			var err error
+			if install {
+				release, err = SelfUpdate(ctx, options)
+			} else {
+				release, err = CheckUpdate(ctx, options)
+			}
+			if errors.Is(err, ErrNoUpdate) {
+				return ReturnText(fmt.Sprintf("%s is up to date", e.Name))
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			text := fmt.Sprintf("%s %s is available", e.Name, release.Version)
+			if install {
+				text = fmt.Sprintf("%s was updated to %s", e.Name, release.Version)
+			}
+			if release.Notes != "" {
+				text += "\n\n" + release.Notes
+			}
+			return ReturnText(text)
+		},
+	})
+}
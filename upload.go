@@ -0,0 +1,235 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// HeaderUploads is the header with the files that the user uploaded for a request, a JSON array of Upload.
+const HeaderUploads = "Uploads"
+
+// FeatureUploads is advertised by the framework, the host can send uploads to actions that accept them.
+const FeatureUploads string = "uploads"
+
+var ErrInvalidUpload = errors.New("invalid upload")
+
+// UploadsDir is the sandbox that the host copies uploaded files to before handing them to an action.
+// Uploads outside of it are rejected.
+func UploadsDir() string {
+	return profileStateDir("uploads")
+}
+
+// Upload is a file the user uploaded. Path is a temporary file in UploadsDir that the host removes after the
+// request, so an action that keeps the file moves it with MoveTo.
+type Upload struct {
+	Path        string `json:"path"`
+	Name        string `json:"name"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256,omitempty"`
+}
+
+// UploadRules are the uploads an action accepts, they are checked before the action runs.
+type UploadRules struct {
+	// MaxFiles defaults to 1.
+	MaxFiles int
+	// MaxSize is the largest file in bytes. Zero means no limit.
+	MaxSize int64
+	// ContentTypes and Extensions, e.g. "application/pdf" and ".pdf", limit the files when set. A file
+	// matching either is accepted.
+	ContentTypes []string
+	Extensions   []string
+}
+
+// Uploads returns the uploads of the request that ctx belongs to. Each upload is checked to be a regular
+// file within UploadsDir of the size the host sent.
+func Uploads(ctx context.Context) ([]Upload, error) {
+	header := RequestMeta(ctx).Headers[HeaderUploads]
+	if header == "" {
+		return nil, nil
+	}
+
+	var uploads []Upload
+	err := json.Unmarshal([]byte(header), &uploads)
+	if err != nil {
+		LoggerFrom(ctx).Error("error while unmarshaling uploads", "error", err.Error())
+		return nil, fmt.Errorf("%w: %w", ErrInvalidUpload, err)
+	}
+
+	dir, err := filepath.Abs(UploadsDir())
+	if err != nil {
+		return nil, fmt.Errorf("error while getting absolute path at %s: %w", UploadsDir(), err)
+	}
+	for i, upload := range uploads {
+		path, err := filepath.Abs(upload.Path)
+		if err != nil || !withinDir(dir, path) {
+			LoggerFrom(ctx).Error("upload is outside of the uploads directory", "path", upload.Path)
+			return nil, fmt.Errorf("%w: %s is outside of %s", ErrInvalidUpload, upload.Path, dir)
+		}
+		info, err := os.Lstat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			LoggerFrom(ctx).Error("upload is not a file", "path", upload.Path)
+			return nil, fmt.Errorf("%w: %s is not a file", ErrInvalidUpload, upload.Path)
+		}
+		if info.Size() != upload.Size {
+			LoggerFrom(ctx).Error("upload size mismatch", "path", upload.Path, "size", info.Size(), "expected", upload.Size)
+			return nil, fmt.Errorf("%w: %s is %d bytes, not %d", ErrInvalidUpload, upload.Path, info.Size(), upload.Size)
+		}
+		uploads[i].Path = path
+		if upload.Name == "" {
+			uploads[i].Name = filepath.Base(path)
+		}
+	}
+	return uploads, nil
+}
+
+// Check returns an error wrapping ErrInvalidUpload when the uploads break the rules.
+func (r UploadRules) Check(uploads []Upload) error {
+	maxFiles := r.MaxFiles
+	if maxFiles == 0 {
+		maxFiles = 1
+	}
+	if len(uploads) > maxFiles {
+		return fmt.Errorf("%w: %d files, at most %d are accepted", ErrInvalidUpload, len(uploads), maxFiles)
+	}
+
+	for _, upload := range uploads {
+		if r.MaxSize > 0 && upload.Size > r.MaxSize {
+			return fmt.Errorf("%w: %s is larger than %d bytes", ErrInvalidUpload, upload.Name, r.MaxSize)
+		}
+		if len(r.ContentTypes) == 0 && len(r.Extensions) == 0 {
+			continue
+		}
+		contentType, _, _ := strings.Cut(upload.ContentType, ";")
+		if slices.Contains(r.ContentTypes, strings.TrimSpace(contentType)) {
+			continue
+		}
+		if slices.ContainsFunc(r.Extensions, func(ext string) bool {
+			return strings.EqualFold(ext, filepath.Ext(upload.Name))
+		}) {
+			continue
+		}
+		return fmt.Errorf("%w: %s is not an accepted type", ErrInvalidUpload, upload.Name)
+	}
+	return nil
+}
+
+// Verify checks the file against the sha256 checksum that the host sent, if any.
+func (u Upload) Verify() error {
+	if u.SHA256 == "" {
+		return nil
+	}
+	sum, err := fileSHA256(u.Path)
+	if err != nil {
+		LogError("error while hashing upload", "path", u.Path, "error", err.Error())
+		return fmt.Errorf("error while hashing upload %s: %w", u.Name, err)
+	}
+	if !strings.EqualFold(sum, u.SHA256) {
+		LogError("upload checksum mismatch", "path", u.Path, "expected", u.SHA256, "actual", sum)
+		return fmt.Errorf("%w: checksum mismatch for %s", ErrInvalidUpload, u.Name)
+	}
+	return nil
+}
+
+// Open opens the uploaded file. The caller closes it.
+func (u Upload) Open() (*os.File, error) {
+	return os.Open(u.Path)
+}
+
+// MoveTo moves the uploaded file into dir under its name, which is reduced to its last element, and returns
+// the new path. The file is copied when dir is on another device.
+func (u Upload) MoveTo(dir string) (string, error) {
+	name := filepath.Base(filepath.Clean("/" + u.Name))
+	if name == "/" || name == "." {
+		name = filepath.Base(u.Path)
+	}
+	dest := filepath.Join(dir, name)
+
+	err := os.MkdirAll(dir, privateDirPerm)
+	if err != nil {
+		LogError("error while creating directory", "dir", dir, "error", err.Error())
+		return "", fmt.Errorf("error while creating directory %s: %w", dir, err)
+	}
+
+	err = os.Rename(u.Path, dest)
+	if err == nil {
+		return dest, nil
+	}
+
+	// e.g. the uploads directory is on a different volume
+	err = copyUpload(u.Path, dest)
+	if err != nil {
+		LogError("error while moving upload", "path", u.Path, "dest", dest, "error", err.Error())
+		return "", fmt.Errorf("error while moving upload %s: %w", u.Name, err)
+	}
+	_ = os.Remove(u.Path)
+	return dest, nil
+}
+
+func copyUpload(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, privateFilePerm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	closeErr := out.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// checkUploads runs before an action that accepts uploads.
+func checkUploads(ctx context.Context, rules UploadRules) error {
+	uploads, err := Uploads(ctx)
+	if err != nil {
+		return err
+	}
+	err = rules.Check(uploads)
+	if err != nil {
+		LoggerFrom(ctx).Error("uploads rejected", "error", err.Error())
+		return err
+	}
+	for _, upload := range uploads {
+		err = upload.Verify()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type jarblesUploads struct {
+	MaxFiles     int      `json:"maxFiles"`
+	MaxSize      int64    `json:"maxSize,omitempty"`
+	ContentTypes []string `json:"contentTypes,omitempty"`
+	Extensions   []string `json:"extensions,omitempty"`
+}
+
+func describeUploads(rules *UploadRules) *jarblesUploads {
+	if rules == nil {
+		return nil
+	}
+	return &jarblesUploads{
+		MaxFiles:     max(rules.MaxFiles, 1),
+		MaxSize:      rules.MaxSize,
+		ContentTypes: rules.ContentTypes,
+		Extensions:   rules.Extensions,
+	}
+}
@@ -0,0 +1,306 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spcoder/jarbles-framework/lib"
+)
+
+// usageDays is how many days of usage are kept.
+const usageDays = 30
+
+var (
+	// usageMu guards pendingUsage, usageWriteMu serializes the usage writers of this process, the lock file
+	// those of other processes.
+	usageMu      sync.Mutex
+	usageWriteMu sync.Mutex
+
+	// pendingUsage holds the counts of the current request until flushUsage writes them.
+	pendingUsage = make(map[usageBucket]*UsageDay)
+)
+
+type usageBucket struct {
+	id   string
+	date string
+}
+
+// UsageDay is how often each tool or operation was called on a day, and how often it failed.
+type UsageDay struct {
+	Date   string         `json:"date"`
+	Calls  map[string]int `json:"calls"`
+	Errors map[string]int `json:"errors,omitempty"`
+}
+
+// Total returns the calls and errors of all tools and operations on the day.
+func (d UsageDay) Total() (calls, errors int) {
+	for _, n := range d.Calls {
+		calls += n
+	}
+	for _, n := range d.Errors {
+		errors += n
+	}
+	return calls, errors
+}
+
+// recordUsage counts a call of a tool or operation of the current assistant or extension. The counts are
+// kept in memory and written by flushUsage once the request is done, so calls don't wait on storage.
+func recordUsage(name string, callErr error) {
+	id, err := currentConfigID()
+	if err != nil {
+		return
+	}
+
+	usageMu.Lock()
+	defer usageMu.Unlock()
+
+	bucket := usageBucket{id: id, date: time.Now().Format(time.DateOnly)}
+	day := pendingUsage[bucket]
+	if day == nil {
+		day = &UsageDay{Date: bucket.date, Calls: map[string]int{}}
+		pendingUsage[bucket] = day
+	}
+	day.Calls[name]++
+	if callErr != nil {
+		if day.Errors == nil {
+			day.Errors = map[string]int{}
+		}
+		day.Errors[name]++
+	}
+}
+
+// flushUsage adds the counts recorded since the last flush to the stored usage. Usage is only for the
+// dashboard, so failing to save it is logged and otherwise ignored.
+func flushUsage(ctx context.Context) {
+	usageMu.Lock()
+	pending := pendingUsage
+	pendingUsage = make(map[usageBucket]*UsageDay)
+	usageMu.Unlock()
+
+	byID := make(map[string][]UsageDay)
+	for bucket, day := range pending {
+		byID[bucket.id] = append(byID[bucket.id], *day)
+	}
+	for id, recorded := range byID {
+		err := updateUsage(id, func(days []UsageDay) []UsageDay {
+			for _, r := range recorded {
+				days = addUsageDay(days, r)
+			}
+			return days
+		})
+		if err != nil {
+			LoggerFrom(ctx).Warn("error while saving usage", "error", err.Error())
+		}
+	}
+}
+
+// updateUsage reads, updates, and writes the usage of an assistant or extension while holding its lock,
+// so concurrent processes don't lose each other's counts.
+func updateUsage(id string, update func([]UsageDay) []UsageDay) error {
+	usageWriteMu.Lock()
+	defer usageWriteMu.Unlock()
+
+	unlock, err := lockFile(filepath.Join(profileStateDir("locks"), id+"-usage.lock"), 10*time.Second, time.Minute)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	days, err := Usage(id)
+	if err != nil {
+		return err
+	}
+	days = update(days)
+	if len(days) > usageDays {
+		days = days[len(days)-usageDays:]
+	}
+
+	data, err := json.Marshal(days)
+	if err != nil {
+		return fmt.Errorf("error while marshaling usage: %w", err)
+	}
+	return CurrentStorage().Write(usageKey(id), data)
+}
+
+// addUsageDay adds the counts of a day to days, which stay ordered by date.
+func addUsageDay(days []UsageDay, add UsageDay) []UsageDay {
+	i := sort.Search(len(days), func(i int) bool { return days[i].Date >= add.Date })
+	if i == len(days) || days[i].Date != add.Date {
+		days = append(days, UsageDay{})
+		copy(days[i+1:], days[i:])
+		days[i] = UsageDay{Date: add.Date, Calls: map[string]int{}}
+	}
+	day := &days[i]
+	if day.Calls == nil {
+		day.Calls = map[string]int{}
+	}
+	for name, n := range add.Calls {
+		day.Calls[name] += n
+	}
+	for name, n := range add.Errors {
+		if day.Errors == nil {
+			day.Errors = map[string]int{}
+		}
+		day.Errors[name] += n
+	}
+	return days
+}
+
+// Usage returns the usage of the last 30 days of an assistant or extension by its ID, oldest first. Days
+// without calls are left out.
+func Usage(id string) ([]UsageDay, error) {
+	data, err := CurrentStorage().Read(usageKey(slugify(id)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while reading usage: %w", err)
+	}
+
+	var days []UsageDay
+	err = json.Unmarshal(data, &days)
+	if err != nil {
+		return nil, fmt.Errorf("error while unmarshaling usage: %w", err)
+	}
+	return days, nil
+}
+
+func usageKey(id string) string {
+	return storageKey("data", id, "usage.json")
+}
+
+// NewUsageDashboard returns an extension with cards of the usage of an assistant or extension: the calls
+// and error rate of the last 7 days, the calls per day, and the most called tools. Call Execute on it from
+// the main function of the dashboard extension.
+//
+//goland:noinspection GoUnusedExportedFunction
+func NewUsageDashboard(id string) *Extension {
+	e := NewExtension(NewExtensionOptions{
+		Name:        id + " usage",
+		Description: "calls, errors, and top tools of " + id,
+	})
+
+	e.AddCardCustom(ExtensionCard{
+		ID:   "usage-summary",
+		Icon: "bar-chart",
+		Render: func() (string, error) {
+			days, err := Usage(id)
+			if err != nil {
+				return "", err
+			}
+			calls, errs := usageSince(days, 7)
+			previous, _ := usageSince(days, 14)
+			previous -= calls
+
+			rate := "0%"
+			status := lib.StatusSuccess
+			if calls > 0 {
+				rate = fmt.Sprintf("%.1f%%", float64(errs)/float64(calls)*100)
+				if errs*20 > calls {
+					status = lib.StatusDanger
+				}
+			}
+
+			body := lib.Stat(lib.StatOptions{Label: "calls in the last 7 days", Value: strconv.Itoa(calls), Delta: usageDelta(calls, previous), Trend: usageTrend(calls, previous)}) +
+				lib.Badge(lib.BadgeOptions{Label: rate + " errors", Status: status})
+			return lib.CardDefault(lib.CardDefaultOptions{ExtensionName: e.Name, Title: "Usage", Body: lib.Raw(body)}), nil
+		},
+	})
+
+	e.AddCardCustom(ExtensionCard{
+		ID:   "usage-per-day",
+		Icon: "calendar",
+		Render: func() (string, error) {
+			days, err := Usage(id)
+			if err != nil {
+				return "", err
+			}
+			var rows [][]string
+			for i := len(days) - 1; i >= 0 && len(rows) < 14; i-- {
+				calls, errs := days[i].Total()
+				rows = append(rows, []string{days[i].Date, strconv.Itoa(calls), strconv.Itoa(errs)})
+			}
+			body := lib.Table([]string{"day", "calls", "errors"}, rows, lib.TableOptions{})
+			return lib.CardDefault(lib.CardDefaultOptions{ExtensionName: e.Name, Title: "Calls per day", Body: lib.Raw(body)}), nil
+		},
+	})
+
+	e.AddCardCustom(ExtensionCard{
+		ID:   "usage-top",
+		Icon: "activity",
+		Render: func() (string, error) {
+			days, err := Usage(id)
+			if err != nil {
+				return "", err
+			}
+			calls := map[string]int{}
+			errs := map[string]int{}
+			for _, day := range days {
+				for name, n := range day.Calls {
+					calls[name] += n
+				}
+				for name, n := range day.Errors {
+					errs[name] += n
+				}
+			}
+			names := make([]string, 0, len(calls))
+			for name := range calls {
+				names = append(names, name)
+			}
+			sort.Slice(names, func(i, j int) bool {
+				if calls[names[i]] != calls[names[j]] {
+					return calls[names[i]] > calls[names[j]]
+				}
+				return names[i] < names[j]
+			})
+
+			var rows [][]string
+			for _, name := range names[:min(10, len(names))] {
+				rows = append(rows, []string{name, strconv.Itoa(calls[name]), strconv.Itoa(errs[name])})
+			}
+			body := lib.Table([]string{"tool", "calls", "errors"}, rows, lib.TableOptions{Caption: "last 30 days"})
+			return lib.CardDefault(lib.CardDefaultOptions{ExtensionName: e.Name, Title: "Top tools", Body: lib.Raw(body)}), nil
+		},
+	})
+
+	return &e
+}
+
+// usageSince returns the calls and errors of the last n days, today included.
+func usageSince(days []UsageDay, n int) (calls, errs int) {
+	since := time.Now().AddDate(0, 0, -n+1).Format(time.DateOnly)
+	for _, day := range days {
+		if day.Date >= since {
+			c, e := day.Total()
+			calls += c
+			errs += e
+		}
+	}
+	return calls, errs
+}
+
+func usageDelta(current, previous int) string {
+	if previous == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%+.0f%%", float64(current-previous)/float64(previous)*100)
+}
+
+func usageTrend(current, previous int) string {
+	switch {
+	case current > previous:
+		return lib.TrendUp
+	case current < previous:
+		return lib.TrendDown
+	default:
+		return lib.TrendFlat
+	}
+}
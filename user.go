@@ -0,0 +1,105 @@
+package framework
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// UserProfile is who the Jarbles user is and what they prefer, as passed by the host.
+type UserProfile struct {
+	DisplayName string            `json:"name,omitempty"`
+	Locale      string            `json:"locale,omitempty"`
+	TimeZone    string            `json:"time_zone,omitempty"`
+	Preferences map[string]string `json:"preferences,omitempty"`
+}
+
+// Preference returns the value of a preference, or defaultValue when the user hasn't set it.
+func (p UserProfile) Preference(key, defaultValue string) string {
+	value, ok := p.Preferences[key]
+	if !ok {
+		return defaultValue
+	}
+	return value
+}
+
+// CurrentProfile returns the profile of the user. The host passes it in the describe payload as
+// {"user": {...}}, which is remembered for the requests that follow, and can override it per request with
+// JARBLES_USER_NAME, JARBLES_USER_LOCALE, JARBLES_USER_TIMEZONE, and JARBLES_USER_PREFERENCES, a JSON object.
+// A profile that can't be loaded is treated as empty.
+//
+//goland:noinspection GoUnusedExportedFunction
+func CurrentProfile() UserProfile {
+	var profile UserProfile
+	data, err := CurrentStorage().Read(userProfileKey())
+	if err == nil {
+		err = json.Unmarshal(data, &profile)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		LogWarn("error while loading user profile", "error", err.Error())
+	}
+
+	if v := os.Getenv("JARBLES_USER_NAME"); v != "" {
+		profile.DisplayName = v
+	}
+	if v := os.Getenv("JARBLES_USER_LOCALE"); v != "" {
+		profile.Locale = v
+	}
+	if v := os.Getenv("JARBLES_USER_TIMEZONE"); v != "" {
+		profile.TimeZone = v
+	}
+	if v := os.Getenv("JARBLES_USER_PREFERENCES"); v != "" {
+		var preferences map[string]string
+		err := json.Unmarshal([]byte(v), &preferences)
+		if err != nil {
+			LogWarn("invalid JARBLES_USER_PREFERENCES", "error", err.Error())
+		}
+		for key, value := range preferences {
+			if profile.Preferences == nil {
+				profile.Preferences = make(map[string]string)
+			}
+			profile.Preferences[key] = value
+		}
+	}
+
+	return profile
+}
+
+// handshake remembers the user profile in the payload of describe. The profile is shared by the assistants
+// and extensions of the active profile, and is only written when it changed.
+func handshake(payload string) error {
+	if payload == "" {
+		return nil
+	}
+
+	var request struct {
+		User *UserProfile `json:"user"`
+	}
+	err := json.Unmarshal([]byte(payload), &request)
+	if err != nil || request.User == nil {
+		return nil // not a handshake
+	}
+
+	data, err := json.MarshalIndent(request.User, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error while marshaling user profile: %w", err)
+	}
+
+	// every describe carries the profile, but it rarely changes
+	existing, err := CurrentStorage().Read(userProfileKey())
+	if err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+
+	err = CurrentStorage().Write(userProfileKey(), data)
+	if err != nil {
+		return fmt.Errorf("error while writing user profile: %w", err)
+	}
+	return nil
+}
+
+func userProfileKey() string {
+	return storageKey("data", "user.json")
+}
@@ -0,0 +1,281 @@
+package framework
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// The config key of an explicit path to the govulncheck binary used by the scan-vulnerabilities tool.
+const configKeyGovulncheckPath = "govulncheck_path"
+
+// Vulnerability is a vulnerable dependency with the advisories that affect it. FixedVersion is the lowest version
+// that fixes all of them, empty when there is no fix yet. Called is true when govulncheck found the vulnerable
+// code reachable from the module, and always true for npm.
+type Vulnerability struct {
+	Ecosystem    string   `json:"ecosystem"`
+	Package      string   `json:"package"`
+	Version      string   `json:"version,omitempty"`
+	FixedVersion string   `json:"fixed_version,omitempty"`
+	Severity     string   `json:"severity,omitempty"`
+	Advisories   []string `json:"advisories"`
+	Summary      string   `json:"summary,omitempty"`
+	Called       bool     `json:"called"`
+}
+
+// Bump returns the command that upgrades the dependency to its fixed version, or an empty string.
+func (v Vulnerability) Bump() string {
+	if v.FixedVersion == "" {
+		return ""
+	}
+	switch v.Ecosystem {
+	case "go":
+		if v.Package == "stdlib" || v.Package == "toolchain" {
+			return "upgrade go to " + v.FixedVersion
+		}
+		return "go get " + v.Package + "@" + v.FixedVersion
+	case "npm":
+		return "npm install " + v.Package + "@" + v.FixedVersion
+	}
+	return ""
+}
+
+// SetGovulncheckPath stores the path of the govulncheck binary in the config of the running assistant or
+// extension.
+//
+//goland:noinspection GoUnusedExportedFunction
+func SetGovulncheckPath(path string) error {
+	return ConfigSet(configKeyGovulncheckPath, path)
+}
+
+// ScanVulnerabilities runs govulncheck for a go module and npm audit for a node package in dir, and returns the
+// vulnerable dependencies, the ones with reachable vulnerable code first.
+func ScanVulnerabilities(ctx context.Context, dir string) ([]Vulnerability, error) {
+	var vulnerabilities []Vulnerability
+	var errs []error
+	scanned := false
+
+	if fileExists(dir, "go.mod") {
+		scanned = true
+		found, err := govulncheck(ctx, dir)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		vulnerabilities = append(vulnerabilities, found...)
+	}
+	if fileExists(dir, "package.json") {
+		scanned = true
+		found, err := npmAudit(ctx, dir)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		vulnerabilities = append(vulnerabilities, found...)
+	}
+	if !scanned {
+		return nil, fmt.Errorf("error while scanning %s: no go.mod or package.json", dir)
+	}
+
+	sort.SliceStable(vulnerabilities, func(i, j int) bool {
+		if vulnerabilities[i].Called != vulnerabilities[j].Called {
+			return vulnerabilities[i].Called
+		}
+		return vulnerabilities[i].Package < vulnerabilities[j].Package
+	})
+
+	return vulnerabilities, errors.Join(errs...)
+}
+
+func govulncheck(ctx context.Context, dir string) ([]Vulnerability, error) {
+	path, err := resolveToolchain(configKeyGovulncheckPath, "govulncheck", goimportsCandidates())
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := runLinter(ctx, dir, path, "-json", "./...")
+	if err != nil {
+		return nil, fmt.Errorf("error while running govulncheck: %w", err)
+	}
+
+	// the output is a stream of indented JSON messages, see govulncheck -h
+	summaries := make(map[string]string)
+	byPackage := make(map[string]*Vulnerability)
+	var order []string
+	decoder := json.NewDecoder(bytes.NewReader(stdout))
+	for {
+		var message struct {
+			OSV *struct {
+				ID      string `json:"id"`
+				Summary string `json:"summary"`
+			} `json:"osv"`
+			Finding *struct {
+				OSV          string `json:"osv"`
+				FixedVersion string `json:"fixed_version"`
+				Trace        []struct {
+					Module   string `json:"module"`
+					Version  string `json:"version"`
+					Function string `json:"function"`
+				} `json:"trace"`
+			} `json:"finding"`
+		}
+		err := decoder.Decode(&message)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error while unmarshaling govulncheck output: %w", err)
+		}
+
+		if message.OSV != nil {
+			summaries[message.OSV.ID] = message.OSV.Summary
+		}
+		if message.Finding == nil || len(message.Finding.Trace) == 0 {
+			continue
+		}
+
+		finding := message.Finding
+		module := finding.Trace[0].Module
+		v := byPackage[module]
+		if v == nil {
+			v = &Vulnerability{Ecosystem: "go", Package: module, Version: finding.Trace[0].Version}
+			byPackage[module] = v
+			order = append(order, module)
+		}
+		if !slices.Contains(v.Advisories, finding.OSV) {
+			v.Advisories = append(v.Advisories, finding.OSV)
+		}
+		if compareVersions(finding.FixedVersion, v.FixedVersion) > 0 {
+			v.FixedVersion = finding.FixedVersion
+		}
+		// a finding with a function in its trace is reachable from the module, not only imported
+		if finding.Trace[0].Function != "" {
+			v.Called = true
+		}
+	}
+
+	vulnerabilities := make([]Vulnerability, 0, len(order))
+	for _, module := range order {
+		v := byPackage[module]
+		var lines []string
+		for _, id := range v.Advisories {
+			lines = append(lines, id+": "+summaries[id])
+		}
+		v.Summary = strings.Join(lines, "\n")
+		vulnerabilities = append(vulnerabilities, *v)
+	}
+
+	return vulnerabilities, nil
+}
+
+func npmAudit(ctx context.Context, dir string) ([]Vulnerability, error) {
+	npm := "npm"
+	if runtime.GOOS == "windows" {
+		npm += ".cmd"
+	}
+
+	stdout, err := runLinter(ctx, dir, npm, "audit", "--json")
+	if err != nil {
+		return nil, fmt.Errorf("error while running npm audit: %w", err)
+	}
+
+	var report struct {
+		Vulnerabilities map[string]struct {
+			Name     string            `json:"name"`
+			Severity string            `json:"severity"`
+			Range    string            `json:"range"`
+			Via      []json.RawMessage `json:"via"`
+			// FixAvailable is false, true, or the package and version to install
+			FixAvailable json.RawMessage `json:"fixAvailable"`
+		} `json:"vulnerabilities"`
+	}
+	err = json.Unmarshal(stdout, &report)
+	if err != nil {
+		return nil, fmt.Errorf("error while unmarshaling npm audit report: %w", err)
+	}
+
+	var vulnerabilities []Vulnerability
+	for name, entry := range report.Vulnerabilities {
+		v := Vulnerability{Ecosystem: "npm", Package: name, Version: entry.Range, Severity: entry.Severity, Called: true}
+
+		// via holds advisories, or the names of the vulnerable packages this one depends on
+		var lines []string
+		for _, raw := range entry.Via {
+			var advisory struct {
+				URL   string `json:"url"`
+				Title string `json:"title"`
+			}
+			if json.Unmarshal(raw, &advisory) == nil && advisory.URL != "" {
+				v.Advisories = append(v.Advisories, advisory.URL)
+				lines = append(lines, advisory.Title)
+			}
+		}
+		if len(v.Advisories) == 0 {
+			// only vulnerable through its dependencies, which are reported on their own
+			continue
+		}
+		v.Summary = strings.Join(lines, "\n")
+
+		var fix struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		}
+		if json.Unmarshal(entry.FixAvailable, &fix) == nil && fix.Name == name {
+			v.FixedVersion = fix.Version
+		}
+
+		vulnerabilities = append(vulnerabilities, v)
+	}
+
+	return vulnerabilities, nil
+}
+
+func scanVulnerabilities(safeSrc string) ToolContextFunction {
+	return func(ctx context.Context, payload string) (string, error) {
+		var request struct {
+			WorkingDir string `json:"workingDir"`
+		}
+		err := json.Unmarshal([]byte(payload), &request)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while unmarshaling payload", "error", err.Error())
+			return "", fmt.Errorf("error while unmarshaling payload: %w", err)
+		}
+
+		workingDir, err := safeDir(safeSrc, request.WorkingDir)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while getting safe working directory", "error", err.Error())
+			return "", fmt.Errorf("error while getting safe working directory: %w", err)
+		}
+
+		vulnerabilities, err := ScanVulnerabilities(ctx, workingDir)
+		if err != nil && len(vulnerabilities) == 0 {
+			LoggerFrom(ctx).Error("error while scanning vulnerabilities", "error", err.Error())
+			return "", err
+		}
+		if len(vulnerabilities) == 0 {
+			return "no vulnerable dependencies found", nil
+		}
+
+		type entry struct {
+			Vulnerability
+			Bump string `json:"bump,omitempty"`
+		}
+		entries := make([]entry, 0, len(vulnerabilities))
+		for _, v := range vulnerabilities {
+			entries = append(entries, entry{Vulnerability: v, Bump: v.Bump()})
+		}
+
+		data, err := marshalJSON(entries)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while marshaling vulnerabilities", "error", err.Error())
+			return "", fmt.Errorf("error while marshaling vulnerabilities: %w", err)
+		}
+
+		return string(data), nil
+	}
+}
@@ -0,0 +1,168 @@
+package framework
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WalkMaxEntries is the default limit of the entries that the file tools walk, so a large directory can't
+// flood the model.
+var WalkMaxEntries = 10000
+
+type WalkOptions struct {
+	// Workers is how many directories are read at the same time. Defaults to 8.
+	Workers int
+	// MaxEntries stops the walk after that many entries. Zero means no limit.
+	MaxEntries int
+	// MaxDepth limits how deep the walk goes, 1 walks the root only. Zero means no limit.
+	MaxDepth int
+	// Hidden includes files and directories that start with a dot. The .git directory is always skipped.
+	Hidden bool
+	// Ignore skips the files and directories it matches, see LoadIgnore. The ignore files of the directories
+	// below the root are added to it as they're walked.
+	Ignore *Ignore
+	// Glob only returns the files that match it, see MatchGlob.
+	Glob string
+	// DirsOnly walks the directories without returning the files.
+	DirsOnly bool
+}
+
+// WalkEntry is a file or a directory found by Walk. Path is relative to the root with forward slashes. Size and
+// ModTime are only set for files.
+type WalkEntry struct {
+	Path    string
+	Type    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Walk walks root with bounded workers and returns its entries sorted by path. Truncated is true when the
+// walk stopped at MaxEntries, which entries are returned then depends on the order the directories are
+// read in. Directories below the root that can't be read are skipped. The walk stops early when ctx is done.
+func Walk(ctx context.Context, root string, options WalkOptions) (entries []WalkEntry, truncated bool, err error) {
+	if options.Workers <= 0 {
+		options.Workers = 8
+	}
+	var glob *regexp.Regexp
+	if options.Glob != "" {
+		glob, err = globRegexp(options.Glob)
+		if err != nil {
+			LoggerFrom(ctx).Error("error while parsing glob", "glob", options.Glob, "error", err.Error())
+			return nil, false, fmt.Errorf("error while parsing glob %s: %w", options.Glob, err)
+		}
+	}
+
+	_, err = os.ReadDir(root)
+	if err != nil {
+		LoggerFrom(ctx).Error("error while reading directory", "path", root, "error", err.Error())
+		return nil, false, fmt.Errorf("error while reading directory at %s: %w", root, err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, options.Workers)
+	)
+
+	// add records an entry and reports whether the walk goes on
+	add := func(entry WalkEntry) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if options.MaxEntries > 0 && len(entries) >= options.MaxEntries {
+			truncated = true
+			cancel()
+			return false
+		}
+		entries = append(entries, entry)
+		return true
+	}
+
+	var visit func(dir, rel string, depth int)
+	visit = func(dir, rel string, depth int) {
+		defer wg.Done()
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		children, err := os.ReadDir(dir)
+		<-sem
+		if err != nil {
+			LoggerFrom(ctx).Warn("skipping directory", "path", dir, "error", err.Error())
+			return
+		}
+
+		for _, d := range children {
+			if ctx.Err() != nil {
+				return
+			}
+
+			childRel := path.Join(rel, d.Name())
+			if d.Name() == ".git" || !options.Hidden && strings.HasPrefix(d.Name(), ".") || options.Ignore.Match(childRel, d.IsDir()) {
+				continue
+			}
+
+			if !d.IsDir() && (options.DirsOnly || glob != nil && !glob.MatchString(childRel)) {
+				continue
+			}
+
+			entry := WalkEntry{Path: childRel, Type: FileTypeFile}
+			switch {
+			case d.IsDir():
+				entry.Type = FileTypeDir
+			case d.Type()&fs.ModeSymlink != 0:
+				entry.Type = FileTypeSymlink
+			default:
+				info, err := d.Info()
+				if err != nil {
+					continue // removed while walking
+				}
+				entry.Size = info.Size()
+				entry.ModTime = info.ModTime()
+			}
+			if !add(entry) {
+				return
+			}
+
+			if d.IsDir() && (options.MaxDepth == 0 || depth+1 < options.MaxDepth) {
+				childDir := filepath.Join(dir, d.Name())
+				if options.Ignore != nil {
+					err := options.Ignore.AddDir(childDir, childRel)
+					if err != nil {
+						LoggerFrom(ctx).Warn("skipping ignore files", "path", childDir, "error", err.Error())
+					}
+				}
+				wg.Add(1)
+				go visit(childDir, childRel, depth+1)
+			}
+		}
+	}
+
+	wg.Add(1)
+	visit(root, ".", 0)
+	wg.Wait()
+
+	// the walk stopped because ctx is done, not because of MaxEntries
+	if err := context.Cause(ctx); err != nil && !truncated {
+		LoggerFrom(ctx).Error("walk cancelled", "path", root, "error", err.Error())
+		return nil, false, fmt.Errorf("error while walking directory at %s: %w", root, err)
+	}
+
+	slices.SortFunc(entries, func(a, b WalkEntry) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return entries, truncated, nil
+}
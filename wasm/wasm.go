@@ -0,0 +1,171 @@
+// Package wasm exposes the functions of WASI modules as jarbles tools.
+//
+// Every .wasm file in the safe directory is compiled and each exported function that takes no parameters
+// and returns no results becomes a tool named <module>-<function>. Command modules that only export _start
+// become a tool named after the module. The tool payload is passed to the function on standard input and
+// whatever the function writes to standard output is returned to the model.
+//
+// Modules run without filesystem or network access, with a memory cap and an execution timeout.
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	framework "github.com/spcoder/jarbles-framework"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type ToolsOptions struct {
+	SafeDir          string
+	MemoryLimitPages uint32
+	Timeout          time.Duration
+}
+
+// Tools loads the modules in options.SafeDir and returns a tool for each exported function.
+//
+//goland:noinspection GoUnusedExportedFunction
+func Tools(options ToolsOptions) ([]framework.Tool, error) {
+	if options.MemoryLimitPages == 0 {
+		options.MemoryLimitPages = 256 // 16 MiB
+	}
+	if options.Timeout == 0 {
+		options.Timeout = 10 * time.Second
+	}
+
+	filenames, err := filepath.Glob(filepath.Join(options.SafeDir, "*.wasm"))
+	if err != nil {
+		return nil, fmt.Errorf("error while listing wasm modules in %s: %w", options.SafeDir, err)
+	}
+
+	ctx := context.Background()
+	r := wazero.NewRuntimeWithConfig(ctx, runtimeConfig(options))
+	defer func(r wazero.Runtime) {
+		_ = r.Close(ctx)
+	}(r)
+
+	var tools []framework.Tool
+	for _, filename := range filenames {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading wasm module at %s: %w", filename, err)
+		}
+
+		compiled, err := r.CompileModule(ctx, data)
+		if err != nil {
+			return nil, fmt.Errorf("error while compiling wasm module at %s: %w", filename, err)
+		}
+
+		module := strings.TrimSuffix(filepath.Base(filename), ".wasm")
+		for _, function := range exportedFunctions(compiled) {
+			name := module + "-" + function
+			if function == "_start" {
+				name = module
+			}
+
+			tools = append(tools, framework.Tool{
+				Name:        name,
+				Description: fmt.Sprintf("runs the %s function of the %s wasm module", function, module),
+				Function:    call(options, filename, function),
+				Arguments: []framework.ToolArguments{
+					{
+						Name:        "input",
+						Type:        "string",
+						Description: "the input passed to the function",
+					},
+				},
+			})
+		}
+	}
+
+	return tools, nil
+}
+
+func runtimeConfig(options ToolsOptions) wazero.RuntimeConfig {
+	return wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(options.MemoryLimitPages).
+		WithCloseOnContextDone(true)
+}
+
+// exportedFunctions returns the sorted names of the functions that can be called as tools.
+// _start is only included when the module exports nothing else.
+func exportedFunctions(compiled wazero.CompiledModule) []string {
+	var names []string
+	hasStart := false
+	for name, definition := range compiled.ExportedFunctions() {
+		if len(definition.ParamTypes()) > 0 || len(definition.ResultTypes()) > 0 {
+			continue
+		}
+		switch name {
+		case "_start":
+			hasStart = true
+		case "_initialize":
+		default:
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 && hasStart {
+		names = append(names, "_start")
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func call(options ToolsOptions, filename, function string) framework.ToolFunction {
+	return func(payload string) (string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), options.Timeout)
+		defer cancel()
+
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			framework.LogError("error while reading wasm module", "filename", filename, "error", err.Error())
+			return "", fmt.Errorf("error while reading wasm module at %s: %w", filename, err)
+		}
+
+		r := wazero.NewRuntimeWithConfig(ctx, runtimeConfig(options))
+		defer func(r wazero.Runtime) {
+			_ = r.Close(context.Background())
+		}(r)
+
+		wasi_snapshot_preview1.MustInstantiate(ctx, r)
+
+		var stdout, stderr bytes.Buffer
+		config := wazero.NewModuleConfig().
+			WithStdin(strings.NewReader(payload)).
+			WithStdout(&stdout).
+			WithStderr(&stderr).
+			WithStartFunctions()
+
+		mod, err := r.InstantiateWithConfig(ctx, data, config)
+		if err != nil {
+			framework.LogError("error while instantiating wasm module", "filename", filename, "error", err.Error())
+			return "", fmt.Errorf("error while instantiating wasm module at %s: %w", filename, err)
+		}
+
+		framework.LogDebug("calling wasm function", "filename", filename, "function", function)
+		_, err = mod.ExportedFunction(function).Call(ctx)
+
+		var exitErr *sys.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 0 {
+			err = nil
+		}
+		if err != nil {
+			framework.LogError("error while calling wasm function", "filename", filename, "function", function, "stderr", stderr.String(), "error", err.Error())
+			if stderr.Len() > 0 {
+				return "", fmt.Errorf("%s", stderr.String())
+			}
+			return "", fmt.Errorf("error while calling %s in wasm module %s: %w", function, filename, err)
+		}
+
+		return stdout.String(), nil
+	}
+}